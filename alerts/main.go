@@ -0,0 +1,304 @@
+// Alerts evaluates tenants' alert rules against the worker's completion
+// events and announces every rule that trips. Rules are the alert_rules
+// attribute of a tenant's TenantPolicies item, e.g.
+//
+//	[{"name": "secret-burst", "redaction": "secret", "threshold": 10, "window_minutes": 5}]
+//
+// alerts when more than 10 of the tenant's records have a "secret" redaction
+// within 5 minutes. A rule matches a record by redaction type, label and/or
+// source; every condition it sets must hold. Matching records are counted in
+// tumbling windows in USAGE_TABLE_NAME, next to ingest's rate limit windows,
+// and the record that takes a window past the threshold publishes one
+// "Alert Rule Triggered" event to USAGE_EVENT_BUS, which delivers it to the
+// tenant-alerts SNS topic and so to the tenant's webhooks, like quota alerts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"robust-processor/internal/logscrub"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+const metricNamespace = "RobustProcessor"
+
+const (
+	alertSource     = "robust-processor"
+	alertDetailType = "Alert Rule Triggered"
+	// rulesTTL matches the worker's policy cache: an edited rule applies
+	// within a minute
+	rulesTTL = time.Minute
+	// maxWindow bounds window_minutes to a day
+	maxWindow = 24 * 60
+)
+
+var (
+	dynamoClient      *dynamodb.Client
+	eventBridgeClient *eventbridge.Client
+	policyTableName   string
+	usageTableName    string
+	alertBus          string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	eventBridgeClient = eventbridge.NewFromConfig(cfg)
+	policyTableName = os.Getenv("POLICY_TABLE_NAME")
+	usageTableName = os.Getenv("USAGE_TABLE_NAME")
+	alertBus = os.Getenv("USAGE_EVENT_BUS")
+}
+
+// rule is one entry of a tenant's alert_rules
+type rule struct {
+	Name string `dynamodbav:"name"`
+	// Redaction, Label and Source are the conditions a record must meet;
+	// empty ones are not checked. Redaction names a detector as counted in
+	// the record's redactions ("email", "secret", "ml_name", ...).
+	Redaction string `dynamodbav:"redaction"`
+	Label     string `dynamodbav:"label"`
+	Source    string `dynamodbav:"source"`
+	// Threshold is the number of matching records a window may hold
+	// without alerting
+	Threshold     int64 `dynamodbav:"threshold"`
+	WindowMinutes int   `dynamodbav:"window_minutes"`
+}
+
+var ruleName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// validate checks a rule; an invalid rule is skipped, not fatal to the others
+func (r rule) validate() error {
+	switch {
+	case !ruleName.MatchString(r.Name):
+		return fmt.Errorf("name must be 1-64 letters, digits, '_', '.' or '-'")
+	case r.Redaction == "" && r.Label == "" && r.Source == "":
+		return fmt.Errorf("rule %s: set at least one of redaction, label and source", r.Name)
+	case r.Threshold < 0:
+		return fmt.Errorf("rule %s: threshold must not be negative", r.Name)
+	case r.WindowMinutes < 1 || r.WindowMinutes > maxWindow:
+		return fmt.Errorf("rule %s: window_minutes must be between 1 and %d", r.Name, maxWindow)
+	}
+	return nil
+}
+
+// matches reports whether a completed record meets every condition of r
+func (r rule) matches(c completion) bool {
+	return (r.Redaction == "" || c.Redactions[r.Redaction] > 0) &&
+		(r.Label == "" || slices.Contains(c.Labels, r.Label)) &&
+		(r.Source == "" || c.Source == r.Source)
+}
+
+// completion holds the fields of the worker's event detail rules look at
+type completion struct {
+	TenantID    string         `json:"tenant_id"`
+	LogID       string         `json:"log_id"`
+	Source      string         `json:"source"`
+	Status      string         `json:"status"`
+	ProcessedAt string         `json:"processed_at"`
+	Labels      []string       `json:"labels"`
+	Redactions  map[string]int `json:"redactions"`
+}
+
+// triggered is the detail of an alert event
+type triggered struct {
+	TenantID      string `json:"tenant_id"`
+	Rule          string `json:"rule"`
+	Threshold     int64  `json:"threshold"`
+	WindowMinutes int    `json:"window_minutes"`
+	WindowStart   string `json:"window_start"`
+	Records       int64  `json:"records"`
+	// LogID is the record that tripped the rule
+	LogID string `json:"log_id"`
+}
+
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	var c completion
+	if err := json.Unmarshal(event.Detail, &c); err != nil {
+		return err
+	}
+	if c.Status != "PROCESSED" || c.TenantID == "" {
+		return nil
+	}
+	rules := rulesFor(ctx, c.TenantID)
+	if len(rules) == 0 {
+		return nil
+	}
+	at, err := time.Parse(time.RFC3339, c.ProcessedAt)
+	if err != nil {
+		at = event.Time
+	}
+	for _, r := range rules {
+		if r.matches(c) {
+			if err := count(ctx, c, r, at.UTC()); err != nil {
+				// EventBridge retries the event; counts of rules already
+				// counted are then one high, which can only alert early
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// count adds a matching record to the rule's current window and announces
+// the rule when this record takes the window past its threshold. The ADD is
+// atomic, so exactly one record sees each window cross.
+func count(ctx context.Context, c completion, r rule, at time.Time) error {
+	window := time.Duration(r.WindowMinutes) * time.Minute
+	start := at.Truncate(window)
+	out, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usageTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: c.TenantID},
+			"period":    &types.AttributeValueMemberS{Value: "alert#" + r.Name + "#" + start.Format(time.RFC3339)},
+		},
+		UpdateExpression: aws.String("ADD records :one SET expires_at = :exp"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+			":exp": &types.AttributeValueMemberN{Value: strconv.FormatInt(start.Add(window+time.Hour).Unix(), 10)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		slog.Error("Failed to count alert rule match", "tenant_id", c.TenantID, "rule", r.Name, "error", err)
+		return err
+	}
+	var got struct {
+		Records int64 `dynamodbav:"records"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Attributes, &got); err != nil {
+		return err
+	}
+	if got.Records == r.Threshold+1 {
+		announce(ctx, triggered{
+			TenantID:      c.TenantID,
+			Rule:          r.Name,
+			Threshold:     r.Threshold,
+			WindowMinutes: r.WindowMinutes,
+			WindowStart:   start.Format(time.RFC3339),
+			Records:       got.Records,
+			LogID:         c.LogID,
+		})
+	}
+	return nil
+}
+
+// announce publishes one alert. There is no retry: a lost alert is counted,
+// and the window's count stays in the usage table until it expires.
+func announce(ctx context.Context, t triggered) {
+	slog.Info("Alert rule triggered", "tenant_id", t.TenantID, "rule", t.Rule, "window_start", t.WindowStart)
+	emitMetric("AlertsTriggered", 1, "Count", map[string]string{"tenant_id": t.TenantID})
+	if alertBus == "" {
+		return
+	}
+	detail, _ := json.Marshal(t)
+	out, err := eventBridgeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{{
+			EventBusName: aws.String(alertBus),
+			Source:       aws.String(alertSource),
+			DetailType:   aws.String(alertDetailType),
+			Detail:       aws.String(string(detail)),
+		}},
+	})
+	if err != nil || out.FailedEntryCount > 0 {
+		slog.Warn("Failed to announce alert", "tenant_id", t.TenantID, "rule", t.Rule, "error", err)
+		emitMetric("AlertEventFailures", 1, "Count", nil)
+	}
+}
+
+type cachedRules struct {
+	rules     []rule
+	fetchedAt time.Time
+}
+
+var (
+	rulesMu    sync.Mutex
+	rulesCache = map[string]cachedRules{}
+)
+
+// rulesFor returns the tenant's valid rules, cached for rulesTTL. A failed
+// read serves the previous rules, or none if there are none.
+func rulesFor(ctx context.Context, tenantID string) []rule {
+	rulesMu.Lock()
+	cached, ok := rulesCache[tenantID]
+	rulesMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < rulesTTL {
+		return cached.rules
+	}
+
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(policyTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		ProjectionExpression: aws.String("alert_rules"),
+	})
+	if err != nil {
+		slog.Warn("Failed to load alert rules", "tenant_id", tenantID, "error", err)
+		return cached.rules
+	}
+	var stored struct {
+		Rules []rule `dynamodbav:"alert_rules"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &stored); err != nil {
+		slog.Warn("Invalid alert rules", "tenant_id", tenantID, "error", err)
+	}
+	var rules []rule
+	for _, r := range stored.Rules {
+		if err := r.validate(); err != nil {
+			slog.Warn("Skipping invalid alert rule", "tenant_id", tenantID, "error", err)
+			emitMetric("AlertRulesInvalid", 1, "Count", nil)
+			continue
+		}
+		rules = append(rules, r)
+	}
+
+	rulesMu.Lock()
+	rulesCache[tenantID] = cachedRules{rules: rules, fetchedAt: time.Now()}
+	rulesMu.Unlock()
+	return rules
+}
+
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
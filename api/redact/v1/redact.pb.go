@@ -0,0 +1,812 @@
+// Synchronous access to the pipeline's redaction engine (pkg/redact), for
+// services that need text scrubbed in-process rather than via the async
+// ingest pipeline. Served by cmd/redactd.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: redact/v1/redact.proto
+
+package redactv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type RedactRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TenantId      string                 `protobuf:"bytes,1,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	Fields        map[string]string      `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RedactRequest) Reset() {
+	*x = RedactRequest{}
+	mi := &file_redact_v1_redact_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RedactRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RedactRequest) ProtoMessage() {}
+
+func (x *RedactRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RedactRequest.ProtoReflect.Descriptor instead.
+func (*RedactRequest) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RedactRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *RedactRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *RedactRequest) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type RedactResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Text   string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Fields map[string]string      `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Number of redactions per detector, over text and fields
+	Redactions map[string]int32 `protobuf:"bytes,3,rep,name=redactions,proto3" json:"redactions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// Version of the tenant policy applied; 0 for the built-in policy
+	PolicyVersion int32 `protobuf:"varint,4,opt,name=policy_version,json=policyVersion,proto3" json:"policy_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RedactResponse) Reset() {
+	*x = RedactResponse{}
+	mi := &file_redact_v1_redact_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RedactResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RedactResponse) ProtoMessage() {}
+
+func (x *RedactResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RedactResponse.ProtoReflect.Descriptor instead.
+func (*RedactResponse) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RedactResponse) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *RedactResponse) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *RedactResponse) GetRedactions() map[string]int32 {
+	if x != nil {
+		return x.Redactions
+	}
+	return nil
+}
+
+func (x *RedactResponse) GetPolicyVersion() int32 {
+	if x != nil {
+		return x.PolicyVersion
+	}
+	return 0
+}
+
+type DetectRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TenantId      string                 `protobuf:"bytes,1,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DetectRequest) Reset() {
+	*x = DetectRequest{}
+	mi := &file_redact_v1_redact_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DetectRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DetectRequest) ProtoMessage() {}
+
+func (x *DetectRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DetectRequest.ProtoReflect.Descriptor instead.
+func (*DetectRequest) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DetectRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *DetectRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type DetectResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Matches       []*Match               `protobuf:"bytes,1,rep,name=matches,proto3" json:"matches,omitempty"`
+	PolicyVersion int32                  `protobuf:"varint,2,opt,name=policy_version,json=policyVersion,proto3" json:"policy_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DetectResponse) Reset() {
+	*x = DetectResponse{}
+	mi := &file_redact_v1_redact_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DetectResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DetectResponse) ProtoMessage() {}
+
+func (x *DetectResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DetectResponse.ProtoReflect.Descriptor instead.
+func (*DetectResponse) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DetectResponse) GetMatches() []*Match {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+func (x *DetectResponse) GetPolicyVersion() int32 {
+	if x != nil {
+		return x.PolicyVersion
+	}
+	return 0
+}
+
+// Match is one redacted range of the text, as UTF-8 byte offsets
+type Match struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Detector string                 `protobuf:"bytes,1,opt,name=detector,proto3" json:"detector,omitempty"`
+	// Byte offsets into the UTF-8 text
+	Start int32 `protobuf:"varint,2,opt,name=start,proto3" json:"start,omitempty"`
+	End   int32 `protobuf:"varint,3,opt,name=end,proto3" json:"end,omitempty"`
+	// Code point offsets, for languages whose strings index by character
+	RuneStart     int32 `protobuf:"varint,4,opt,name=rune_start,json=runeStart,proto3" json:"rune_start,omitempty"`
+	RuneEnd       int32 `protobuf:"varint,5,opt,name=rune_end,json=runeEnd,proto3" json:"rune_end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Match) Reset() {
+	*x = Match{}
+	mi := &file_redact_v1_redact_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Match) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Match) ProtoMessage() {}
+
+func (x *Match) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Match.ProtoReflect.Descriptor instead.
+func (*Match) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Match) GetDetector() string {
+	if x != nil {
+		return x.Detector
+	}
+	return ""
+}
+
+func (x *Match) GetStart() int32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *Match) GetEnd() int32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *Match) GetRuneStart() int32 {
+	if x != nil {
+		return x.RuneStart
+	}
+	return 0
+}
+
+func (x *Match) GetRuneEnd() int32 {
+	if x != nil {
+		return x.RuneEnd
+	}
+	return 0
+}
+
+type PreviewRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Policy        *Policy                `protobuf:"bytes,1,opt,name=policy,proto3" json:"policy,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PreviewRequest) Reset() {
+	*x = PreviewRequest{}
+	mi := &file_redact_v1_redact_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PreviewRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PreviewRequest) ProtoMessage() {}
+
+func (x *PreviewRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PreviewRequest.ProtoReflect.Descriptor instead.
+func (*PreviewRequest) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PreviewRequest) GetPolicy() *Policy {
+	if x != nil {
+		return x.Policy
+	}
+	return nil
+}
+
+func (x *PreviewRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type PreviewResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Matches       []*Match               `protobuf:"bytes,2,rep,name=matches,proto3" json:"matches,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PreviewResponse) Reset() {
+	*x = PreviewResponse{}
+	mi := &file_redact_v1_redact_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PreviewResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PreviewResponse) ProtoMessage() {}
+
+func (x *PreviewResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PreviewResponse.ProtoReflect.Descriptor instead.
+func (*PreviewResponse) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PreviewResponse) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *PreviewResponse) GetMatches() []*Match {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+// Policy mirrors redact.Policy, the redaction part of a tenant policy
+type Policy struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CustomPatterns []*CustomPattern       `protobuf:"bytes,1,rep,name=custom_patterns,json=customPatterns,proto3" json:"custom_patterns,omitempty"`
+	Profanity      *ProfanityFilter       `protobuf:"bytes,2,opt,name=profanity,proto3" json:"profanity,omitempty"`
+	PreserveFormat bool                   `protobuf:"varint,3,opt,name=preserve_format,json=preserveFormat,proto3" json:"preserve_format,omitempty"`
+	Placeholder    string                 `protobuf:"bytes,4,opt,name=placeholder,proto3" json:"placeholder,omitempty"`
+	Placeholders   map[string]string      `protobuf:"bytes,5,rep,name=placeholders,proto3" json:"placeholders,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Built-in detectors not to run
+	DisabledDetectors []string `protobuf:"bytes,6,rep,name=disabled_detectors,json=disabledDetectors,proto3" json:"disabled_detectors,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Policy) Reset() {
+	*x = Policy{}
+	mi := &file_redact_v1_redact_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Policy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Policy) ProtoMessage() {}
+
+func (x *Policy) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Policy.ProtoReflect.Descriptor instead.
+func (*Policy) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Policy) GetCustomPatterns() []*CustomPattern {
+	if x != nil {
+		return x.CustomPatterns
+	}
+	return nil
+}
+
+func (x *Policy) GetProfanity() *ProfanityFilter {
+	if x != nil {
+		return x.Profanity
+	}
+	return nil
+}
+
+func (x *Policy) GetPreserveFormat() bool {
+	if x != nil {
+		return x.PreserveFormat
+	}
+	return false
+}
+
+func (x *Policy) GetPlaceholder() string {
+	if x != nil {
+		return x.Placeholder
+	}
+	return ""
+}
+
+func (x *Policy) GetPlaceholders() map[string]string {
+	if x != nil {
+		return x.Placeholders
+	}
+	return nil
+}
+
+func (x *Policy) GetDisabledDetectors() []string {
+	if x != nil {
+		return x.DisabledDetectors
+	}
+	return nil
+}
+
+type CustomPattern struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Name    string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Pattern string                 `protobuf:"bytes,2,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	// Ranks overlapping matches; built-ins rank 20-50, custom patterns default 0
+	Priority int32 `protobuf:"varint,3,opt,name=priority,proto3" json:"priority,omitempty"`
+	// Replaces matches instead of the policy's placeholder
+	Token         string `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CustomPattern) Reset() {
+	*x = CustomPattern{}
+	mi := &file_redact_v1_redact_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CustomPattern) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CustomPattern) ProtoMessage() {}
+
+func (x *CustomPattern) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CustomPattern.ProtoReflect.Descriptor instead.
+func (*CustomPattern) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CustomPattern) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CustomPattern) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+func (x *CustomPattern) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *CustomPattern) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type ProfanityFilter struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Enabled       bool                   `protobuf:"varint,1,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	Words         []string               `protobuf:"bytes,2,rep,name=words,proto3" json:"words,omitempty"`
+	Strategy      string                 `protobuf:"bytes,3,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	Token         string                 `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProfanityFilter) Reset() {
+	*x = ProfanityFilter{}
+	mi := &file_redact_v1_redact_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProfanityFilter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProfanityFilter) ProtoMessage() {}
+
+func (x *ProfanityFilter) ProtoReflect() protoreflect.Message {
+	mi := &file_redact_v1_redact_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProfanityFilter.ProtoReflect.Descriptor instead.
+func (*ProfanityFilter) Descriptor() ([]byte, []int) {
+	return file_redact_v1_redact_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ProfanityFilter) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+func (x *ProfanityFilter) GetWords() []string {
+	if x != nil {
+		return x.Words
+	}
+	return nil
+}
+
+func (x *ProfanityFilter) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *ProfanityFilter) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+var File_redact_v1_redact_proto protoreflect.FileDescriptor
+
+const file_redact_v1_redact_proto_rawDesc = "" +
+	"\n" +
+	"\x16redact/v1/redact.proto\x12\tredact.v1\"\xb9\x01\n" +
+	"\rRedactRequest\x12\x1b\n" +
+	"\ttenant_id\x18\x01 \x01(\tR\btenantId\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12<\n" +
+	"\x06fields\x18\x03 \x03(\v2$.redact.v1.RedactRequest.FieldsEntryR\x06fields\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xcf\x02\n" +
+	"\x0eRedactResponse\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12=\n" +
+	"\x06fields\x18\x02 \x03(\v2%.redact.v1.RedactResponse.FieldsEntryR\x06fields\x12I\n" +
+	"\n" +
+	"redactions\x18\x03 \x03(\v2).redact.v1.RedactResponse.RedactionsEntryR\n" +
+	"redactions\x12%\n" +
+	"\x0epolicy_version\x18\x04 \x01(\x05R\rpolicyVersion\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a=\n" +
+	"\x0fRedactionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\"@\n" +
+	"\rDetectRequest\x12\x1b\n" +
+	"\ttenant_id\x18\x01 \x01(\tR\btenantId\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\"c\n" +
+	"\x0eDetectResponse\x12*\n" +
+	"\amatches\x18\x01 \x03(\v2\x10.redact.v1.MatchR\amatches\x12%\n" +
+	"\x0epolicy_version\x18\x02 \x01(\x05R\rpolicyVersion\"\x85\x01\n" +
+	"\x05Match\x12\x1a\n" +
+	"\bdetector\x18\x01 \x01(\tR\bdetector\x12\x14\n" +
+	"\x05start\x18\x02 \x01(\x05R\x05start\x12\x10\n" +
+	"\x03end\x18\x03 \x01(\x05R\x03end\x12\x1d\n" +
+	"\n" +
+	"rune_start\x18\x04 \x01(\x05R\truneStart\x12\x19\n" +
+	"\brune_end\x18\x05 \x01(\x05R\aruneEnd\"O\n" +
+	"\x0ePreviewRequest\x12)\n" +
+	"\x06policy\x18\x01 \x01(\v2\x11.redact.v1.PolicyR\x06policy\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\"Q\n" +
+	"\x0fPreviewResponse\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12*\n" +
+	"\amatches\x18\x02 \x03(\v2\x10.redact.v1.MatchR\amatches\"\x89\x03\n" +
+	"\x06Policy\x12A\n" +
+	"\x0fcustom_patterns\x18\x01 \x03(\v2\x18.redact.v1.CustomPatternR\x0ecustomPatterns\x128\n" +
+	"\tprofanity\x18\x02 \x01(\v2\x1a.redact.v1.ProfanityFilterR\tprofanity\x12'\n" +
+	"\x0fpreserve_format\x18\x03 \x01(\bR\x0epreserveFormat\x12 \n" +
+	"\vplaceholder\x18\x04 \x01(\tR\vplaceholder\x12G\n" +
+	"\fplaceholders\x18\x05 \x03(\v2#.redact.v1.Policy.PlaceholdersEntryR\fplaceholders\x12-\n" +
+	"\x12disabled_detectors\x18\x06 \x03(\tR\x11disabledDetectors\x1a?\n" +
+	"\x11PlaceholdersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"o\n" +
+	"\rCustomPattern\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\apattern\x18\x02 \x01(\tR\apattern\x12\x1a\n" +
+	"\bpriority\x18\x03 \x01(\x05R\bpriority\x12\x14\n" +
+	"\x05token\x18\x04 \x01(\tR\x05token\"s\n" +
+	"\x0fProfanityFilter\x12\x18\n" +
+	"\aenabled\x18\x01 \x01(\bR\aenabled\x12\x14\n" +
+	"\x05words\x18\x02 \x03(\tR\x05words\x12\x1a\n" +
+	"\bstrategy\x18\x03 \x01(\tR\bstrategy\x12\x14\n" +
+	"\x05token\x18\x04 \x01(\tR\x05token2\xcf\x01\n" +
+	"\rRedactService\x12=\n" +
+	"\x06Redact\x12\x18.redact.v1.RedactRequest\x1a\x19.redact.v1.RedactResponse\x12=\n" +
+	"\x06Detect\x12\x18.redact.v1.DetectRequest\x1a\x19.redact.v1.DetectResponse\x12@\n" +
+	"\aPreview\x12\x19.redact.v1.PreviewRequest\x1a\x1a.redact.v1.PreviewResponseB)Z'robust-processor/api/redact/v1;redactv1b\x06proto3"
+
+var (
+	file_redact_v1_redact_proto_rawDescOnce sync.Once
+	file_redact_v1_redact_proto_rawDescData []byte
+)
+
+func file_redact_v1_redact_proto_rawDescGZIP() []byte {
+	file_redact_v1_redact_proto_rawDescOnce.Do(func() {
+		file_redact_v1_redact_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_redact_v1_redact_proto_rawDesc), len(file_redact_v1_redact_proto_rawDesc)))
+	})
+	return file_redact_v1_redact_proto_rawDescData
+}
+
+var file_redact_v1_redact_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_redact_v1_redact_proto_goTypes = []any{
+	(*RedactRequest)(nil),   // 0: redact.v1.RedactRequest
+	(*RedactResponse)(nil),  // 1: redact.v1.RedactResponse
+	(*DetectRequest)(nil),   // 2: redact.v1.DetectRequest
+	(*DetectResponse)(nil),  // 3: redact.v1.DetectResponse
+	(*Match)(nil),           // 4: redact.v1.Match
+	(*PreviewRequest)(nil),  // 5: redact.v1.PreviewRequest
+	(*PreviewResponse)(nil), // 6: redact.v1.PreviewResponse
+	(*Policy)(nil),          // 7: redact.v1.Policy
+	(*CustomPattern)(nil),   // 8: redact.v1.CustomPattern
+	(*ProfanityFilter)(nil), // 9: redact.v1.ProfanityFilter
+	nil,                     // 10: redact.v1.RedactRequest.FieldsEntry
+	nil,                     // 11: redact.v1.RedactResponse.FieldsEntry
+	nil,                     // 12: redact.v1.RedactResponse.RedactionsEntry
+	nil,                     // 13: redact.v1.Policy.PlaceholdersEntry
+}
+var file_redact_v1_redact_proto_depIdxs = []int32{
+	10, // 0: redact.v1.RedactRequest.fields:type_name -> redact.v1.RedactRequest.FieldsEntry
+	11, // 1: redact.v1.RedactResponse.fields:type_name -> redact.v1.RedactResponse.FieldsEntry
+	12, // 2: redact.v1.RedactResponse.redactions:type_name -> redact.v1.RedactResponse.RedactionsEntry
+	4,  // 3: redact.v1.DetectResponse.matches:type_name -> redact.v1.Match
+	7,  // 4: redact.v1.PreviewRequest.policy:type_name -> redact.v1.Policy
+	4,  // 5: redact.v1.PreviewResponse.matches:type_name -> redact.v1.Match
+	8,  // 6: redact.v1.Policy.custom_patterns:type_name -> redact.v1.CustomPattern
+	9,  // 7: redact.v1.Policy.profanity:type_name -> redact.v1.ProfanityFilter
+	13, // 8: redact.v1.Policy.placeholders:type_name -> redact.v1.Policy.PlaceholdersEntry
+	0,  // 9: redact.v1.RedactService.Redact:input_type -> redact.v1.RedactRequest
+	2,  // 10: redact.v1.RedactService.Detect:input_type -> redact.v1.DetectRequest
+	5,  // 11: redact.v1.RedactService.Preview:input_type -> redact.v1.PreviewRequest
+	1,  // 12: redact.v1.RedactService.Redact:output_type -> redact.v1.RedactResponse
+	3,  // 13: redact.v1.RedactService.Detect:output_type -> redact.v1.DetectResponse
+	6,  // 14: redact.v1.RedactService.Preview:output_type -> redact.v1.PreviewResponse
+	12, // [12:15] is the sub-list for method output_type
+	9,  // [9:12] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_redact_v1_redact_proto_init() }
+func file_redact_v1_redact_proto_init() {
+	if File_redact_v1_redact_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_redact_v1_redact_proto_rawDesc), len(file_redact_v1_redact_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_redact_v1_redact_proto_goTypes,
+		DependencyIndexes: file_redact_v1_redact_proto_depIdxs,
+		MessageInfos:      file_redact_v1_redact_proto_msgTypes,
+	}.Build()
+	File_redact_v1_redact_proto = out.File
+	file_redact_v1_redact_proto_goTypes = nil
+	file_redact_v1_redact_proto_depIdxs = nil
+}
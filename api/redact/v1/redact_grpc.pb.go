@@ -0,0 +1,207 @@
+// Synchronous access to the pipeline's redaction engine (pkg/redact), for
+// services that need text scrubbed in-process rather than via the async
+// ingest pipeline. Served by cmd/redactd.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: redact/v1/redact.proto
+
+package redactv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RedactService_Redact_FullMethodName  = "/redact.v1.RedactService/Redact"
+	RedactService_Detect_FullMethodName  = "/redact.v1.RedactService/Detect"
+	RedactService_Preview_FullMethodName = "/redact.v1.RedactService/Preview"
+)
+
+// RedactServiceClient is the client API for RedactService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RedactServiceClient interface {
+	// Redact scrubs text and fields with the tenant's stored policy
+	Redact(ctx context.Context, in *RedactRequest, opts ...grpc.CallOption) (*RedactResponse, error)
+	// Detect reports what Redact would replace, without changing the text
+	Detect(ctx context.Context, in *DetectRequest, opts ...grpc.CallOption) (*DetectResponse, error)
+	// Preview applies a draft policy that is not stored, to try it out
+	Preview(ctx context.Context, in *PreviewRequest, opts ...grpc.CallOption) (*PreviewResponse, error)
+}
+
+type redactServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRedactServiceClient(cc grpc.ClientConnInterface) RedactServiceClient {
+	return &redactServiceClient{cc}
+}
+
+func (c *redactServiceClient) Redact(ctx context.Context, in *RedactRequest, opts ...grpc.CallOption) (*RedactResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RedactResponse)
+	err := c.cc.Invoke(ctx, RedactService_Redact_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *redactServiceClient) Detect(ctx context.Context, in *DetectRequest, opts ...grpc.CallOption) (*DetectResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DetectResponse)
+	err := c.cc.Invoke(ctx, RedactService_Detect_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *redactServiceClient) Preview(ctx context.Context, in *PreviewRequest, opts ...grpc.CallOption) (*PreviewResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PreviewResponse)
+	err := c.cc.Invoke(ctx, RedactService_Preview_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RedactServiceServer is the server API for RedactService service.
+// All implementations must embed UnimplementedRedactServiceServer
+// for forward compatibility.
+type RedactServiceServer interface {
+	// Redact scrubs text and fields with the tenant's stored policy
+	Redact(context.Context, *RedactRequest) (*RedactResponse, error)
+	// Detect reports what Redact would replace, without changing the text
+	Detect(context.Context, *DetectRequest) (*DetectResponse, error)
+	// Preview applies a draft policy that is not stored, to try it out
+	Preview(context.Context, *PreviewRequest) (*PreviewResponse, error)
+	mustEmbedUnimplementedRedactServiceServer()
+}
+
+// UnimplementedRedactServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRedactServiceServer struct{}
+
+func (UnimplementedRedactServiceServer) Redact(context.Context, *RedactRequest) (*RedactResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Redact not implemented")
+}
+func (UnimplementedRedactServiceServer) Detect(context.Context, *DetectRequest) (*DetectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Detect not implemented")
+}
+func (UnimplementedRedactServiceServer) Preview(context.Context, *PreviewRequest) (*PreviewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Preview not implemented")
+}
+func (UnimplementedRedactServiceServer) mustEmbedUnimplementedRedactServiceServer() {}
+func (UnimplementedRedactServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeRedactServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RedactServiceServer will
+// result in compilation errors.
+type UnsafeRedactServiceServer interface {
+	mustEmbedUnimplementedRedactServiceServer()
+}
+
+func RegisterRedactServiceServer(s grpc.ServiceRegistrar, srv RedactServiceServer) {
+	// If the following call pancis, it indicates UnimplementedRedactServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RedactService_ServiceDesc, srv)
+}
+
+func _RedactService_Redact_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RedactRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RedactServiceServer).Redact(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RedactService_Redact_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RedactServiceServer).Redact(ctx, req.(*RedactRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RedactService_Detect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DetectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RedactServiceServer).Detect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RedactService_Detect_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RedactServiceServer).Detect(ctx, req.(*DetectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RedactService_Preview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PreviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RedactServiceServer).Preview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RedactService_Preview_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RedactServiceServer).Preview(ctx, req.(*PreviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RedactService_ServiceDesc is the grpc.ServiceDesc for RedactService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RedactService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "redact.v1.RedactService",
+	HandlerType: (*RedactServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Redact",
+			Handler:    _RedactService_Redact_Handler,
+		},
+		{
+			MethodName: "Detect",
+			Handler:    _RedactService_Detect_Handler,
+		},
+		{
+			MethodName: "Preview",
+			Handler:    _RedactService_Preview_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "redact/v1/redact.proto",
+}
@@ -0,0 +1,207 @@
+// Archive keeps a copy of every log the logs table's TTL purges: it
+// consumes the table's stream, takes the removals made by the TTL service
+// itself, and writes the removed records to ARCHIVE_BUCKET as gzipped
+// NDJSON, one object per tenant and batch under
+// <tenant_id>/<yyyy>/<mm>/<dd>/. Only records the worker processed are
+// archived: QUEUED stubs that never were hold no content, and soft-deleted
+// logs expiring at the end of their recovery window were deleted on
+// purpose. original_text is never archived; records are kept in the same
+// redacted form the read API serves.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"robust-processor/internal/logscrub"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const metricNamespace = "RobustProcessor"
+
+// ttlPrincipal is the stream identity of deletions made by DynamoDB's TTL
+const ttlPrincipal = "dynamodb.amazonaws.com"
+
+var (
+	s3Client      *s3.Client
+	archiveBucket string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	s3Client = s3.NewFromConfig(cfg)
+	archiveBucket = os.Getenv("ARCHIVE_BUCKET")
+}
+
+// handler archives a batch of stream records. A failed write fails the
+// batch, which Lambda retries; objects are keyed by the batch's first
+// record, so a retry overwrites rather than duplicates.
+func handler(ctx context.Context, event events.DynamoDBEvent) error {
+	type group struct {
+		first string
+		at    time.Time
+		lines bytes.Buffer
+		n     int
+	}
+	groups := map[string]*group{}
+	var tenants []string
+	skipped := 0
+	for _, record := range event.Records {
+		if !expired(record) {
+			continue
+		}
+		image := record.Change.OldImage
+		if !archivable(image) {
+			skipped++
+			continue
+		}
+		tenantID := image["tenant_id"].String()
+		g, ok := groups[tenantID]
+		if !ok {
+			g = &group{first: record.EventID, at: record.Change.ApproximateCreationDateTime.UTC()}
+			groups[tenantID] = g
+			tenants = append(tenants, tenantID)
+		}
+		doc := make(map[string]interface{}, len(image))
+		for name, v := range image {
+			if name != "original_text" {
+				doc[name] = plain(v)
+			}
+		}
+		doc["archived_at"] = time.Now().UTC().Format(time.RFC3339)
+		line, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", record.EventID, err)
+		}
+		g.lines.Write(line)
+		g.lines.WriteByte('\n')
+		g.n++
+	}
+
+	for _, tenantID := range tenants {
+		g := groups[tenantID]
+		var body bytes.Buffer
+		zw := gzip.NewWriter(&body)
+		zw.Write(g.lines.Bytes())
+		zw.Close()
+		key := fmt.Sprintf("%s/%s/%s.ndjson.gz", tenantID, g.at.Format("2006/01/02"), g.first)
+		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:          aws.String(archiveBucket),
+			Key:             aws.String(key),
+			Body:            bytes.NewReader(body.Bytes()),
+			ContentType:     aws.String("application/x-ndjson"),
+			ContentEncoding: aws.String("gzip"),
+		})
+		if err != nil {
+			slog.Error("Failed to archive expired records", "tenant_id", tenantID, "records", g.n, "error", err)
+			emitMetric("ArchiveFailures", 1, "Count", nil)
+			return err
+		}
+		emitMetric("RecordsArchived", float64(g.n), "Count", map[string]string{"tenant_id": tenantID})
+	}
+	if skipped > 0 {
+		emitMetric("ExpiredRecordsSkipped", float64(skipped), "Count", nil)
+	}
+	return nil
+}
+
+// expired reports whether a stream record is a removal by the TTL service,
+// as opposed to one by the erase Lambda or anyone else
+func expired(record events.DynamoDBEventRecord) bool {
+	return record.EventName == "REMOVE" && record.UserIdentity != nil &&
+		record.UserIdentity.Type == "Service" && record.UserIdentity.PrincipalID == ttlPrincipal
+}
+
+// archivable reports whether a removed item is a processed, undeleted log
+func archivable(image map[string]events.DynamoDBAttributeValue) bool {
+	if len(image) == 0 {
+		return false
+	}
+	if _, deleted := image["deleted_at"]; deleted {
+		return false
+	}
+	status, ok := image["status"]
+	return ok && status.DataType() == events.DataTypeString && status.String() != "QUEUED"
+}
+
+// plain converts a stream attribute value to its JSON form: numbers keep
+// their exact text, binaries are base64
+func plain(v events.DynamoDBAttributeValue) interface{} {
+	switch v.DataType() {
+	case events.DataTypeString:
+		return v.String()
+	case events.DataTypeNumber:
+		return json.Number(v.Number())
+	case events.DataTypeBoolean:
+		return v.Boolean()
+	case events.DataTypeBinary:
+		return base64.StdEncoding.EncodeToString(v.Binary())
+	case events.DataTypeStringSet:
+		return v.StringSet()
+	case events.DataTypeNumberSet:
+		numbers := make([]json.Number, len(v.NumberSet()))
+		for i, n := range v.NumberSet() {
+			numbers[i] = json.Number(n)
+		}
+		return numbers
+	case events.DataTypeBinarySet:
+		binaries := make([]string, len(v.BinarySet()))
+		for i, b := range v.BinarySet() {
+			binaries[i] = base64.StdEncoding.EncodeToString(b)
+		}
+		return binaries
+	case events.DataTypeList:
+		list := make([]interface{}, len(v.List()))
+		for i, e := range v.List() {
+			list[i] = plain(e)
+		}
+		return list
+	case events.DataTypeMap:
+		m := make(map[string]interface{}, len(v.Map()))
+		for k, e := range v.Map() {
+			m[k] = plain(e)
+		}
+		return m
+	}
+	return nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
@@ -1,16 +1,21 @@
 # Build script for Windows PowerShell
-# Compiles Go binaries for AWS Lambda (Linux AMD64)
+# Compiles Go binaries for AWS Lambda (Linux AMD64, or ARM64 for Graviton)
 
-Write-Host "Building Go binaries for AWS Lambda..." -ForegroundColor Cyan
+param(
+    [ValidateSet("amd64", "arm64")]
+    [string]$Arch = "amd64"
+)
+
+Write-Host "Building Go binaries for AWS Lambda ($Arch)..." -ForegroundColor Cyan
 
 # Set environment for Linux cross-compilation
 $env:GOOS = "linux"
-$env:GOARCH = "amd64"
+$env:GOARCH = $Arch
 $env:CGO_ENABLED = "0"
 
 # Build Ingest Lambda
 Write-Host "Building ingest service..." -ForegroundColor Yellow
-go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./ingest/main.go
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./ingest
 if ($LASTEXITCODE -ne 0) {
     Write-Host "Failed to build ingest service" -ForegroundColor Red
     exit 1
@@ -20,7 +25,7 @@ Remove-Item bootstrap
 
 # Build Worker Lambda
 Write-Host "Building worker service..." -ForegroundColor Yellow
-go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./worker/main.go
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./worker
 if ($LASTEXITCODE -ne 0) {
     Write-Host "Failed to build worker service" -ForegroundColor Red
     exit 1
@@ -28,10 +33,153 @@ if ($LASTEXITCODE -ne 0) {
 Compress-Archive -Path bootstrap -DestinationPath worker.zip -Force
 Remove-Item bootstrap
 
+# Build Query Lambda
+Write-Host "Building query service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./query
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build query service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath query.zip -Force
+Remove-Item bootstrap
+
+# Build Completion Stream Lambda
+Write-Host "Building stream service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./stream
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build stream service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath stream.zip -Force
+Remove-Item bootstrap
+
+# Build Shadow Compare Lambda
+Write-Host "Building compare service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./compare
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build compare service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath compare.zip -Force
+Remove-Item bootstrap
+
+# Build Ingest Prefilter (authorizer) Lambda
+Write-Host "Building prefilter service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./prefilter
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build prefilter service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath prefilter.zip -Force
+Remove-Item bootstrap
+
+# Build Queue Reconciliation Lambda
+Write-Host "Building reconcile service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./reconcile
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build reconcile service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath reconcile.zip -Force
+Remove-Item bootstrap
+
+# Build DLQ Quarantine Lambda
+Write-Host "Building quarantine service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./quarantine
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build quarantine service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath quarantine.zip -Force
+Remove-Item bootstrap
+
+# Build Redrive Lambda
+Write-Host "Building redrive service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./redrive
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build redrive service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath redrive.zip -Force
+Remove-Item bootstrap
+
+# Build Undelete Lambda
+Write-Host "Building undelete service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./undelete
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build undelete service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath undelete.zip -Force
+Remove-Item bootstrap
+
+# Build BulkIngest Lambda
+Write-Host "Building bulkingest service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./bulkingest
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build bulkingest service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath bulkingest.zip -Force
+Remove-Item bootstrap
+
+# Build Alerts Lambda
+Write-Host "Building alerts service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./alerts
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build alerts service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath alerts.zip -Force
+Remove-Item bootstrap
+
+# Build Erase Lambda
+Write-Host "Building erase service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./erase
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build erase service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath erase.zip -Force
+Remove-Item bootstrap
+
+# Build Archive Lambda
+Write-Host "Building archive service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./archive
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build archive service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath archive.zip -Force
+Remove-Item bootstrap
+
+# Build Export Lambda
+Write-Host "Building export service..." -ForegroundColor Yellow
+go build -tags lambda.norpc -ldflags="-s -w" -o bootstrap ./export
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to build export service" -ForegroundColor Red
+    exit 1
+}
+Compress-Archive -Path bootstrap -DestinationPath export.zip -Force
+Remove-Item bootstrap
+
 # Reset environment
 $env:GOOS = ""
 $env:GOARCH = ""
 
 Write-Host "Build complete!" -ForegroundColor Green
 Write-Host "  - ingest.zip" -ForegroundColor White
-Write-Host "  - worker.zip" -ForegroundColor White
\ No newline at end of file
+Write-Host "  - worker.zip" -ForegroundColor White
+Write-Host "  - query.zip" -ForegroundColor White
+Write-Host "  - stream.zip" -ForegroundColor White
+Write-Host "  - compare.zip" -ForegroundColor White
+Write-Host "  - prefilter.zip" -ForegroundColor White
+Write-Host "  - reconcile.zip" -ForegroundColor White
+Write-Host "  - quarantine.zip" -ForegroundColor White
+Write-Host "  - redrive.zip" -ForegroundColor White
+Write-Host "  - undelete.zip" -ForegroundColor White
+Write-Host "  - bulkingest.zip" -ForegroundColor White
+Write-Host "  - alerts.zip" -ForegroundColor White
+Write-Host "  - erase.zip" -ForegroundColor White
+Write-Host "  - archive.zip" -ForegroundColor White
+Write-Host "  - export.zip" -ForegroundColor White
\ No newline at end of file
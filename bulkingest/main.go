@@ -0,0 +1,613 @@
+// BulkIngest queues files dropped into the bulk ingest bucket, for backfills
+// far beyond what API Gateway accepts in one request. An object is uploaded
+// under its tenant's prefix, <tenant_id>/<any name>, and S3 invokes this
+// Lambda, which splits it into LogEvents and publishes them in batches:
+// every non-blank line of a text file is a record, and every line of a
+// .ndjson or .jsonl file a JSON record as in POST /logs/batch ({"text",
+// "log_id", "fields"}), whose tenant_id, if any, must be the prefix's.
+// Records are stamped source bulk_upload, the job's batch_id and the file's
+// line and name.
+//
+// Each object is one job in BULK_JOB_TABLE_NAME, keyed by bucket, key and
+// ETag, so a repeated S3 notification or a retried invocation resumes the
+// job instead of starting it over. Progress (byte offset, lines, records
+// queued and rejected) is checkpointed after every window of records; when
+// the invocation nears its deadline the job re-invokes the function
+// asynchronously to continue from the checkpoint, reading the object from
+// that offset, so a file of any size completes. A job left RUNNING once
+// Lambda's retries are spent resumes when invoked with
+// {"continue": {"job_id": "..."}}. Log IDs are derived from the job and
+// line, so records re-sent after a failure are suppressed by the worker as
+// duplicates.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/pipelinekey"
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+)
+
+const metricNamespace = "RobustProcessor"
+
+const (
+	source = "bulk_upload"
+	// maxLineBytes bounds one record's line; longer lines are rejected
+	maxLineBytes = 200 << 10
+	// maxMessageBytes leaves room under SQS's 256 KiB for attributes
+	maxMessageBytes = 240 << 10
+	// windowRecords are read, sent and checkpointed together
+	windowRecords = 2000
+	// sendBatchLimit and sendBatchBytes are SQS's SendMessageBatch limits
+	sendBatchLimit = 10
+	sendBatchBytes = 256 * 1024
+	// sendConcurrency bounds the batches in flight
+	sendConcurrency = 8
+	sendAttempts    = 3
+	// headroom is left before the deadline to checkpoint and hand over
+	headroom = 30 * time.Second
+	// defaultRate caps records per second when BULK_RATE is unset, so a
+	// backfill can't bury live traffic in the queue
+	defaultRate = 1000
+	// maxErrors bounds the rejected lines described on a job
+	maxErrors = 20
+
+	statusRunning = "RUNNING"
+	statusDone    = "DONE"
+	statusFailed  = "FAILED"
+)
+
+var (
+	dynamoClient    *dynamodb.Client
+	s3Client        *s3.Client
+	sqsClient       *sqs.Client
+	lambdaClient    *lambdasvc.Client
+	jobTableName    string
+	queueURL        string
+	stagingQueueURL string
+	stagingTenants  = map[string]bool{}
+	rate            = defaultRate
+	// pipelineKey signs published messages; nil when signing is off
+	pipelineKey []byte
+)
+
+// logIDNamespace scopes the log IDs of bulk records
+var logIDNamespace = uuid.MustParse("5b0f3f57-4f0e-4a57-9d0c-6c1f5de8a8d4")
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	s3Client = s3.NewFromConfig(cfg)
+	sqsClient = sqs.NewFromConfig(cfg)
+	lambdaClient = lambdasvc.NewFromConfig(cfg)
+	jobTableName = os.Getenv("BULK_JOB_TABLE_NAME")
+	queueURL = os.Getenv("QUEUE_URL")
+	stagingQueueURL = os.Getenv("STAGING_QUEUE_URL")
+	for _, t := range strings.Split(os.Getenv("STAGING_TENANTS"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			stagingTenants[t] = true
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("BULK_RATE")); err == nil && n > 0 {
+		rate = n
+	}
+	if pipelineKey, err = pipelinekey.FromEnv(context.TODO(), cfg); err != nil {
+		panic("configuration error: " + err.Error())
+	}
+}
+
+// invocation is either an S3 notification or a job continuing
+type invocation struct {
+	Records  []events.S3EventRecord `json:"Records"`
+	Continue *job                   `json:"continue"`
+}
+
+// job is one object's ingestion and its progress, as stored in the job table
+type job struct {
+	JobID    string `json:"job_id" dynamodbav:"job_id"`
+	TenantID string `json:"tenant_id" dynamodbav:"tenant_id"`
+	Bucket   string `json:"bucket" dynamodbav:"bucket"`
+	Key      string `json:"key" dynamodbav:"key"`
+	ETag     string `json:"etag" dynamodbav:"etag"`
+	Size     int64  `json:"size" dynamodbav:"size"`
+
+	Status   string   `json:"-" dynamodbav:"status"`
+	Offset   int64    `json:"-" dynamodbav:"offset"`
+	Lines    int      `json:"-" dynamodbav:"lines"`
+	Queued   int      `json:"-" dynamodbav:"queued"`
+	Rejected int      `json:"-" dynamodbav:"rejected"`
+	Errors   []string `json:"-" dynamodbav:"errors,omitempty"`
+	// FailureReason says why a FAILED job stopped
+	FailureReason string `json:"-" dynamodbav:"failure_reason,omitempty"`
+	StartedAt     string `json:"-" dynamodbav:"started_at"`
+	UpdatedAt     string `json:"-" dynamodbav:"updated_at"`
+}
+
+func handler(ctx context.Context, inv invocation) error {
+	if inv.Continue != nil {
+		j, err := loadJob(ctx, inv.Continue.JobID)
+		if err != nil {
+			return err
+		}
+		return run(ctx, j)
+	}
+
+	for _, r := range inv.Records {
+		j, ok := newJob(r)
+		if !ok {
+			continue
+		}
+		started, err := startJob(ctx, &j)
+		if err != nil {
+			return err
+		}
+		if !started {
+			// A retried invocation: resume from the checkpoint
+			if j, err = loadJob(ctx, j.JobID); err != nil {
+				return err
+			}
+			slog.Info("Bulk job resumed", "job_id", j.JobID, "status", j.Status, "offset", j.Offset)
+		}
+		if err := run(ctx, j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newJob describes the job for a created object. Objects outside a tenant
+// prefix are ignored.
+func newJob(r events.S3EventRecord) (job, bool) {
+	key, err := url.QueryUnescape(r.S3.Object.Key)
+	if err != nil {
+		key = r.S3.Object.Key
+	}
+	tenantID, name, ok := strings.Cut(key, "/")
+	if !ok || tenantID == "" || name == "" {
+		slog.Warn("Ignoring object outside a tenant prefix", "key", key)
+		return job{}, false
+	}
+	etag := strings.Trim(r.S3.Object.ETag, `"`)
+	sum := sha256.Sum256([]byte(r.S3.Bucket.Name + "/" + key + "@" + etag))
+	return job{
+		JobID:    hex.EncodeToString(sum[:16]),
+		TenantID: tenantID,
+		Bucket:   r.S3.Bucket.Name,
+		Key:      key,
+		ETag:     etag,
+		Size:     r.S3.Object.Size,
+	}, true
+}
+
+// run ingests the job's object from its checkpoint, window by window, until
+// the end of the object or the invocation's deadline
+func run(ctx context.Context, j job) error {
+	if j.Status != statusRunning {
+		return nil
+	}
+	if j.Offset >= j.Size {
+		return finish(ctx, j)
+	}
+
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(j.Bucket),
+		Key:     aws.String(j.Key),
+		IfMatch: aws.String(j.ETag),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-", j.Offset)),
+	})
+	var api smithy.APIError
+	if errors.As(err, &api) && (api.ErrorCode() == "PreconditionFailed" || api.ErrorCode() == "NoSuchKey") {
+		return fail(ctx, j, "object was replaced or deleted")
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", j.Key, err)
+	}
+	defer out.Body.Close()
+	lines := &lineReader{r: bufio.NewReaderSize(out.Body, 64<<10), offset: j.Offset, line: j.Lines}
+	ndjson := strings.HasSuffix(j.Key, ".ndjson") || strings.HasSuffix(j.Key, ".jsonl")
+
+	for {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < headroom {
+			return handOver(ctx, j)
+		}
+		start := time.Now()
+		window, eof, err := readWindow(lines, &j, ndjson)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", j.Key, err)
+		}
+		if err := send(ctx, j.TenantID, window); err != nil {
+			// The window is sent again from the unchanged checkpoint
+			return fmt.Errorf("job %s: %w", j.JobID, err)
+		}
+		j.Offset, j.Lines = lines.offset, lines.line
+		j.Queued += len(window)
+		emitMetric("BulkRecordsQueued", float64(len(window)), "Count", nil)
+		if eof {
+			return finish(ctx, j)
+		}
+		if err := saveJob(ctx, j); err != nil {
+			return err
+		}
+
+		// Pace windows so the job averages at most rate records per second
+		if pause := time.Duration(len(window))*time.Second/time.Duration(rate) - time.Since(start); pause > 0 {
+			time.Sleep(pause)
+		}
+	}
+}
+
+// readWindow reads records until windowRecords are ready or the object
+// ends, counting rejected lines on the job
+func readWindow(lines *lineReader, j *job, ndjson bool) (window []model.LogEvent, eof bool, err error) {
+	for len(window) < windowRecords {
+		text, tooLong, err := lines.next()
+		if errors.Is(err, io.EOF) {
+			return window, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if tooLong {
+			reject(j, lines.line, fmt.Sprintf("longer than %d bytes", maxLineBytes))
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		event, reason := toEvent(*j, lines.line, text, ndjson)
+		if reason != "" {
+			reject(j, lines.line, reason)
+			continue
+		}
+		window = append(window, event)
+	}
+	return window, false, nil
+}
+
+// toEvent turns a line into a LogEvent, or says why it can't be one
+func toEvent(j job, line int, text string, ndjson bool) (model.LogEvent, string) {
+	event := model.LogEvent{
+		TenantID:     j.TenantID,
+		OriginalText: text,
+		Source:       source,
+		BatchID:      j.JobID,
+		Fields:       map[string]string{"line": strconv.Itoa(line), "filename": j.Key},
+	}
+	if ndjson {
+		var record struct {
+			TenantID string                     `json:"tenant_id"`
+			Text     string                     `json:"text"`
+			LogID    string                     `json:"log_id"`
+			Fields   map[string]json.RawMessage `json:"fields"`
+		}
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return event, "invalid JSON record"
+		}
+		if record.TenantID != "" && record.TenantID != j.TenantID {
+			return event, "tenant_id differs from the file's prefix"
+		}
+		if record.Text == "" {
+			return event, "missing text"
+		}
+		event.OriginalText, event.LogID = record.Text, record.LogID
+		// Non-string values are kept as their JSON encoding, as in batches
+		for k, raw := range record.Fields {
+			var v string
+			if json.Unmarshal(raw, &v) != nil {
+				v = string(raw)
+			}
+			event.Fields[k] = v
+		}
+	}
+	if event.LogID == "" {
+		event.LogID = uuid.NewSHA1(logIDNamespace, []byte(j.JobID+"#"+strconv.Itoa(line))).String()
+	}
+	payload, _ := json.Marshal(event)
+	if len(payload) > maxMessageBytes {
+		return event, "record too large to queue"
+	}
+	if err := model.Validate(payload); err != nil {
+		return event, err.Error()
+	}
+	return event, ""
+}
+
+func reject(j *job, line int, reason string) {
+	j.Rejected++
+	if len(j.Errors) < maxErrors {
+		j.Errors = append(j.Errors, fmt.Sprintf("line %d: %s", line, reason))
+	}
+	emitMetric("BulkRecordsRejected", 1, "Count", nil)
+}
+
+// send publishes a window with SendMessageBatch, several batches at a time
+// (one on a FIFO queue), retrying entries SQS refuses. Any entry still unsent fails the window.
+func send(ctx context.Context, tenantID string, window []model.LogEvent) error {
+	queue := queueURL
+	if stagingQueueURL != "" && stagingTenants[tenantID] {
+		queue = stagingQueueURL
+	}
+
+	var chunks [][]sqstypes.SendMessageBatchRequestEntry
+	var chunk []sqstypes.SendMessageBatchRequestEntry
+	size := 0
+	for i, event := range window {
+		payload, _ := json.Marshal(event)
+		attrs := model.RoutingAttributes(event)
+		if pipelineKey != nil {
+			attrs[model.SignatureAttribute] = model.Sign(pipelineKey, string(payload), model.CostTags{})
+		}
+		n := len(payload) + attributeBytes(attrs)
+		if len(chunk) == sendBatchLimit || size+n > sendBatchBytes {
+			chunks, chunk, size = append(chunks, chunk), nil, 0
+		}
+		group, dedup := model.FIFOParams(queue, event.TenantID, event.LogID)
+		entry := sqstypes.SendMessageBatchRequestEntry{
+			Id:                     aws.String(strconv.Itoa(i)),
+			MessageBody:            aws.String(string(payload)),
+			MessageAttributes:      make(map[string]sqstypes.MessageAttributeValue, len(attrs)),
+			MessageGroupId:         group,
+			MessageDeduplicationId: dedup,
+		}
+		for k, v := range attrs {
+			entry.MessageAttributes[k] = sqstypes.MessageAttributeValue{DataType: aws.String(model.AttributeType(k)), StringValue: aws.String(v)}
+		}
+		chunk = append(chunk, entry)
+		size += n
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		slots    = make(chan struct{}, sendConcurrency)
+	)
+	// A FIFO queue keeps the file's order only if batches go one at a time
+	if model.IsFIFO(queue) {
+		slots = make(chan struct{}, 1)
+	}
+	for _, c := range chunks {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			if err := sendChunk(ctx, queue, c); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// attributeBytes is what message attributes add to a message's size: each
+// name, data type and value
+func attributeBytes(attrs map[string]string) int {
+	n := 0
+	for k, v := range attrs {
+		n += len(k) + len(model.AttributeType(k)) + len(v)
+	}
+	return n
+}
+
+// sendChunk sends one batch, resending the entries that failed
+func sendChunk(ctx context.Context, queue string, entries []sqstypes.SendMessageBatchRequestEntry) error {
+	for attempt := 1; ; attempt++ {
+		out, err := sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queue),
+			Entries:  entries,
+		})
+		if err == nil && len(out.Failed) == 0 {
+			return nil
+		}
+		if err == nil {
+			failed := map[string]bool{}
+			for _, f := range out.Failed {
+				failed[aws.ToString(f.Id)] = true
+			}
+			var retry []sqstypes.SendMessageBatchRequestEntry
+			for _, e := range entries {
+				if failed[aws.ToString(e.Id)] {
+					retry = append(retry, e)
+				}
+			}
+			entries = retry
+			err = fmt.Errorf("%d entries failed: %s", len(out.Failed), aws.ToString(out.Failed[0].Message))
+		}
+		if attempt == sendAttempts {
+			return fmt.Errorf("send batch: %w", err)
+		}
+		time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+	}
+}
+
+// lineReader reads an object line by line, tracking the offset of the next
+// unread byte and the number of the last line read
+type lineReader struct {
+	r      *bufio.Reader
+	offset int64
+	line   int
+}
+
+// next returns the next line without its terminator. A line longer than
+// maxLineBytes is consumed but reported tooLong instead of returned.
+func (l *lineReader) next() (text string, tooLong bool, err error) {
+	var buf []byte
+	read := 0
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		read += len(chunk)
+		if !tooLong && len(buf)+len(chunk) <= maxLineBytes+2 {
+			buf = append(buf, chunk...)
+		} else {
+			tooLong, buf = true, nil
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && (!errors.Is(err, io.EOF) || read == 0) {
+			return "", false, err
+		}
+		l.offset += int64(read)
+		l.line++
+		return strings.TrimRight(string(buf), "\r\n"), tooLong, nil
+	}
+}
+
+// startJob records a new job, reporting false if the object's job exists
+func startJob(ctx context.Context, j *job) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	j.Status, j.StartedAt, j.UpdatedAt = statusRunning, now, now
+	item, err := attributevalue.MarshalMap(j)
+	if err != nil {
+		return false, err
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(jobTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(job_id)"),
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if errors.As(err, &conditional) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("start job %s: %w", j.JobID, err)
+	}
+	slog.Info("Bulk job started", "job_id", j.JobID, "tenant_id", j.TenantID, "key", j.Key, "size", j.Size)
+	return true, nil
+}
+
+func loadJob(ctx context.Context, jobID string) (job, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(jobTableName),
+		Key:            map[string]types.AttributeValue{"job_id": &types.AttributeValueMemberS{Value: jobID}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return job{}, fmt.Errorf("load job %s: %w", jobID, err)
+	}
+	if out.Item == nil {
+		return job{}, fmt.Errorf("job %s not found", jobID)
+	}
+	var j job
+	if err := attributevalue.UnmarshalMap(out.Item, &j); err != nil {
+		return job{}, fmt.Errorf("decode job %s: %w", jobID, err)
+	}
+	return j, nil
+}
+
+func saveJob(ctx context.Context, j job) error {
+	j.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(j)
+	if err != nil {
+		return err
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(jobTableName), Item: item})
+	if err != nil {
+		return fmt.Errorf("save job %s: %w", j.JobID, err)
+	}
+	return nil
+}
+
+func finish(ctx context.Context, j job) error {
+	j.Status = statusDone
+	if err := saveJob(ctx, j); err != nil {
+		return err
+	}
+	slog.Info("Bulk job complete", "job_id", j.JobID, "tenant_id", j.TenantID,
+		"lines", j.Lines, "queued", j.Queued, "rejected", j.Rejected)
+	return nil
+}
+
+// fail stops a job that can't complete; retrying it would not help
+func fail(ctx context.Context, j job, reason string) error {
+	j.Status, j.FailureReason = statusFailed, reason
+	slog.Error("Bulk job failed", "job_id", j.JobID, "tenant_id", j.TenantID, "reason", reason)
+	emitMetric("BulkJobsFailed", 1, "Count", nil)
+	return saveJob(ctx, j)
+}
+
+// handOver checkpoints the job and continues it in a fresh asynchronous
+// invocation
+func handOver(ctx context.Context, j job) error {
+	if err := saveJob(ctx, j); err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(invocation{Continue: &job{JobID: j.JobID}})
+	_, err := lambdaClient.Invoke(ctx, &lambdasvc.InvokeInput{
+		FunctionName:   aws.String(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("continue job %s: %w", j.JobID, err)
+	}
+	slog.Info("Bulk job continuing", "job_id", j.JobID, "offset", j.Offset, "queued", j.Queued)
+	return nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
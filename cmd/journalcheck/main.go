@@ -0,0 +1,112 @@
+// Command journalcheck answers whether a disputed record entered the system:
+// it looks the record up in the ingest journal and the logs table and, given
+// the text the tenant says they sent, compares it with the journaled hash.
+//
+//	go run ./cmd/journalcheck -tenant acme_corp -log-id 0b6c... -text-file disputed.txt
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"robust-processor/internal/integrity"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type journalEntry struct {
+	Source        string `dynamodbav:"source"`
+	ContentSHA256 string `dynamodbav:"content_sha256"`
+	AcceptedAt    string `dynamodbav:"accepted_at"`
+	ParentID      string `dynamodbav:"parent_id"`
+}
+
+type logItem struct {
+	Status      string `dynamodbav:"status"`
+	QueuedAt    string `dynamodbav:"queued_at"`
+	ProcessedAt string `dynamodbav:"processed_at"`
+}
+
+func main() {
+	tenant := flag.String("tenant", "", "tenant_id of the record")
+	logID := flag.String("log-id", "", "log_id of the record")
+	textFile := flag.String("text-file", "", "file holding the text the tenant sent, to compare with the journaled hash")
+	journal := flag.String("journal", "IngestJournal", "ingest journal table")
+	table := flag.String("table", "MultiTenantLogs", "logs table")
+	flag.Parse()
+	if *tenant == "" || *logID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		fail("configuration error: %v", err)
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	key := map[string]types.AttributeValue{
+		"tenant_id": &types.AttributeValueMemberS{Value: *tenant},
+		"log_id":    &types.AttributeValueMemberS{Value: *logID},
+	}
+
+	var entry journalEntry
+	found, err := get(ctx, client, *journal, key, &entry)
+	if err != nil {
+		fail("read journal: %v", err)
+	}
+	if !found {
+		fail("NOT ACCEPTED: no journal entry for %s/%s (entries expire after the journal retention)", *tenant, *logID)
+	}
+	fmt.Printf("Accepted %s from %s, content sha256 %s\n", entry.AcceptedAt, entry.Source, entry.ContentSHA256)
+	if entry.ParentID != "" {
+		fmt.Printf("Part of %s\n", entry.ParentID)
+	}
+
+	var item logItem
+	switch found, err := get(ctx, client, *table, key, &item); {
+	case err != nil:
+		fail("read logs table: %v", err)
+	case !found:
+		fmt.Println("No record in the logs table: never processed, or since deleted")
+	case item.Status == "QUEUED":
+		fmt.Printf("Still QUEUED since %s: not processed\n", item.QueuedAt)
+	default:
+		fmt.Printf("%s at %s\n", item.Status, item.ProcessedAt)
+	}
+
+	if *textFile != "" {
+		text, err := os.ReadFile(*textFile)
+		if err != nil {
+			fail("read text: %v", err)
+		}
+		if integrity.ContentHash(string(text)) != entry.ContentSHA256 {
+			fail("MISMATCH: the given text is not the text that was accepted")
+		}
+		fmt.Println("MATCH: the given text is the text that was accepted")
+	}
+}
+
+// get reads one item into v, reporting whether it exists
+func get(ctx context.Context, client *dynamodb.Client, table string, key map[string]types.AttributeValue, v interface{}) (bool, error) {
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || out.Item == nil {
+		return false, err
+	}
+	return true, attributevalue.UnmarshalMap(out.Item, v)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
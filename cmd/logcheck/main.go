@@ -0,0 +1,160 @@
+// Command logcheck fails if any log call in the module is handed record
+// content: an OriginalText field, a message Body, or an attribute keyed as
+// content (original_text, text, body, payload). logscrub drops and redacts
+// at runtime; this keeps such calls from being written in the first place,
+// whatever level they log at.
+//
+//	go run ./cmd/logcheck          # from the module root
+//	go run ./cmd/logcheck ./ingest ./internal/worker
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// logPackages are the packages whose calls log; fmt only when printing to a
+// stream, since Sprintf and Errorf build values that are checked where logged
+var logPackages = map[string]func(name string) bool{
+	"slog": func(string) bool { return true },
+	"log":  func(string) bool { return true },
+	"fmt":  func(name string) bool { return strings.HasPrefix(name, "Print") || strings.HasPrefix(name, "Fprint") },
+}
+
+// contentFields and contentKeys name record content
+var (
+	contentFields = map[string]bool{"OriginalText": true, "Body": true}
+	contentKeys   = map[string]bool{"original_text": true, "text": true, "body": true, "payload": true}
+)
+
+func main() {
+	flag.Parse()
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	findings, err := scan(roots)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+	if len(findings) > 0 {
+		fmt.Fprintf(os.Stderr, "%d log call(s) given record content\n", len(findings))
+		os.Exit(1)
+	}
+}
+
+// scan checks every Go file under roots, skipping hidden directories,
+// vendor and the generated api stubs
+func scan(roots []string) ([]string, error) {
+	fset := token.NewFileSet()
+	var findings []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if name := d.Name(); path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "api") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(path, ".go") {
+				return nil
+			}
+			file, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				return err
+			}
+			findings = append(findings, check(fset, file)...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
+
+// check reports every log call in file with a content argument
+func check(fset *token.FileSet, file *ast.File) []string {
+	var findings []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isLogCall(call) {
+			return true
+		}
+		for _, arg := range call.Args {
+			if what := content(arg); what != "" {
+				findings = append(findings, fmt.Sprintf("%s: %s logged", fset.Position(arg.Pos()), what))
+			}
+		}
+		return true
+	})
+	return findings
+}
+
+// isLogCall matches pkg.Func calls of the logPackages and method calls on
+// slog loggers (logger.Info, ...)
+func isLogCall(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	if pkg, ok := sel.X.(*ast.Ident); ok {
+		if logs, ok := logPackages[pkg.Name]; ok {
+			return logs(sel.Sel.Name)
+		}
+	}
+	switch sel.Sel.Name {
+	case "Debug", "Info", "Warn", "Error", "DebugContext", "InfoContext", "WarnContext", "ErrorContext", "Log", "LogAttrs":
+		return true
+	}
+	return false
+}
+
+// content names the record content an argument passes, if any, looking
+// inside conversions, calls and composite values such as slog.String(...).
+// len(...) is allowed.
+func content(arg ast.Expr) string {
+	var found string
+	ast.Inspect(arg, func(n ast.Node) bool {
+		if found != "" {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if contentFields[n.Sel.Name] {
+				found = "field " + n.Sel.Name
+			}
+		case *ast.BasicLit:
+			if n.Kind == token.STRING {
+				if key, err := strconv.Unquote(n.Value); err == nil && contentKeys[key] {
+					found = "key " + n.Value
+				}
+			}
+		case *ast.CallExpr:
+			// A length says nothing about the content
+			if fn, ok := n.Fun.(*ast.Ident); ok && fn.Name == "len" {
+				return false
+			}
+		case *ast.FuncLit:
+			return false
+		}
+		return true
+	})
+	return found
+}
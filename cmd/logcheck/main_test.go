@@ -0,0 +1,62 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		call string
+		want string
+	}{
+		{"slog field", `slog.Info("Processed", "text", event.OriginalText)`, "key \"text\""},
+		{"slog attr", `slog.Error("Failed", slog.String("detail", e.OriginalText))`, "field OriginalText"},
+		{"logger method", `logger.Debug("Message", "id", msg.MessageId, "raw", msg.Body)`, "field Body"},
+		{"context method", `logger.WarnContext(ctx, "Odd", "payload", p)`, "key \"payload\""},
+		{"conversion", `slog.Info("Processed", "preview", string([]byte(e.OriginalText)[:10]))`, "field OriginalText"},
+		{"log package", `log.Printf("got %s", request.Body)`, "field Body"},
+		{"fmt to a stream", `fmt.Fprintln(os.Stderr, "original_text", x)`, "key \"original_text\""},
+		{"length", `slog.Info("Processed", "bytes", len(event.OriginalText))`, ""},
+		{"fmt value", `msg := fmt.Sprintf("%s", event.OriginalText)`, ""},
+		{"error value", `err = fmt.Errorf("bad body %q", request.Body)`, ""},
+		{"other keys", `slog.Info("Processed", "tenant_id", e.TenantID, "log_id", e.LogID)`, ""},
+		{"not a log call", `process(event.OriginalText, "text")`, ""},
+		{"closure", `slog.Info("Done", "n", count(func() string { return e.OriginalText }))`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "package p\n\nfunc f() {\n\t" + tt.call + "\n}\n"
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "p.go", src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			findings := check(fset, file)
+			if tt.want == "" {
+				if len(findings) != 0 {
+					t.Errorf("unexpected findings %q", findings)
+				}
+				return
+			}
+			// Every content argument is reported, the first one first
+			if len(findings) == 0 || !strings.HasSuffix(findings[0], tt.want+" logged") {
+				t.Errorf("findings %q, want the first ending %q", findings, tt.want+" logged")
+			}
+		})
+	}
+}
+
+// No log call in the module may be handed record content
+func TestModule(t *testing.T) {
+	findings, err := scan([]string{"../.."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		t.Error(f)
+	}
+}
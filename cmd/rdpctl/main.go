@@ -0,0 +1,235 @@
+// Command rdpctl administers tenants. Its one command so far rotates a
+// tenant's secrets:
+//
+//	go run ./cmd/rdpctl tenant rotate-secrets -tenant acme_corp -secret-prefix ingest/api-keys/ -overlap 24h -reason "staff change"
+//
+// It replaces the tenant's API key and signing secret in its Secrets
+// Manager secret and moves its search pseudonyms to the next generation.
+// What is replaced keeps working for the overlap: old keys and signatures
+// are accepted, and POST /pseudonyms answers both generations, so nothing
+// breaks while the tenant switches. The new key and secret are printed
+// once, as JSON, and never stored anywhere else. Every rotation is recorded
+// in the SecretRotationAudit table, with who ran it and a fingerprint of
+// the new key, before anything is changed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"robust-processor/internal/apikey"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/google/uuid"
+)
+
+// Secret kinds rotate-secrets rotates, as -only names them
+const (
+	kindAPIKeys        = "api-keys"
+	kindSigningSecrets = "signing-secrets"
+	kindPseudonyms     = "pseudonyms"
+)
+
+var allKinds = []string{kindAPIKeys, kindSigningSecrets, kindPseudonyms}
+
+// rotationRecord is a SecretRotationAudit item. It holds no secret: the
+// new API key is identified by the first 16 hex digits of its SHA-256.
+type rotationRecord struct {
+	TenantID            string   `dynamodbav:"tenant_id"`
+	RotationID          string   `dynamodbav:"rotation_id"`
+	RequestedAt         string   `dynamodbav:"requested_at"`
+	RequestedBy         string   `dynamodbav:"requested_by"`
+	Reason              string   `dynamodbav:"reason,omitempty"`
+	Kinds               []string `dynamodbav:"kinds"`
+	OverlapUntil        string   `dynamodbav:"overlap_until"`
+	Status              string   `dynamodbav:"status"`
+	Rotated             []string `dynamodbav:"rotated"`
+	APIKeyFingerprint   string   `dynamodbav:"api_key_fingerprint,omitempty"`
+	CredentialsRetired  int      `dynamodbav:"credentials_retired"`
+	CredentialsDropped  int      `dynamodbav:"credentials_dropped"`
+	PseudonymGeneration int      `dynamodbav:"pseudonym_generation,omitempty"`
+	FailureReason       string   `dynamodbav:"failure_reason,omitempty"`
+	CompletedAt         string   `dynamodbav:"completed_at,omitempty"`
+}
+
+// rotationOutput is what rotate-secrets prints: the new credentials, which
+// the tenant needs and which can't be read back later
+type rotationOutput struct {
+	TenantID            string `json:"tenant_id"`
+	RotationID          string `json:"rotation_id"`
+	APIKey              string `json:"api_key,omitempty"`
+	SigningSecret       string `json:"signing_secret,omitempty"`
+	PseudonymGeneration int    `json:"pseudonym_generation,omitempty"`
+	OverlapUntil        string `json:"overlap_until"`
+}
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "tenant" || os.Args[2] != "rotate-secrets" {
+		fmt.Fprintln(os.Stderr, "usage: rdpctl tenant rotate-secrets -tenant <tenant_id> [flags]")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("rotate-secrets", flag.ExitOnError)
+	tenant := flags.String("tenant", "", "tenant_id whose secrets to rotate")
+	overlap := flags.Duration("overlap", 24*time.Hour, "how long replaced secrets keep working")
+	only := flags.String("only", strings.Join(allKinds, ","), "comma-separated secrets to rotate: "+strings.Join(allKinds, ", "))
+	reason := flags.String("reason", "", "why the secrets are rotated, for the audit record")
+	prefix := flags.String("secret-prefix", "", "Secrets Manager prefix of tenant secrets (api_key_secret_prefix)")
+	policies := flags.String("policies", "TenantPolicies", "tenant policy table")
+	audit := flags.String("audit", "SecretRotationAudit", "rotation audit table")
+	flags.Parse(os.Args[3:])
+
+	kinds := strings.Split(*only, ",")
+	for _, k := range kinds {
+		if !slices.Contains(allKinds, k) {
+			fail("unknown secret %q; -only takes %s", k, strings.Join(allKinds, ", "))
+		}
+	}
+	secrets := slices.Contains(kinds, kindAPIKeys) || slices.Contains(kinds, kindSigningSecrets)
+	if *tenant == "" || *overlap <= 0 || (secrets && *prefix == "") {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		fail("configuration error: %v", err)
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	caller, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		fail("identify caller: %v", err)
+	}
+
+	now := time.Now().UTC()
+	record := rotationRecord{
+		TenantID:     *tenant,
+		RotationID:   uuid.New().String(),
+		RequestedAt:  now.Format(time.RFC3339),
+		RequestedBy:  aws.ToString(caller.Arn),
+		Reason:       *reason,
+		Kinds:        kinds,
+		OverlapUntil: now.Add(*overlap).Format(time.RFC3339),
+		Status:       "RUNNING",
+		Rotated:      []string{},
+	}
+	// The record is written first, so no rotation goes unaudited
+	if err := putRecord(ctx, client, *audit, record); err != nil {
+		fail("write audit record: %v", err)
+	}
+
+	output := rotationOutput{TenantID: *tenant, RotationID: record.RotationID, OverlapUntil: record.OverlapUntil}
+	err = func() error {
+		if secrets {
+			store := apikey.New(cfg, *prefix, 0)
+			r, err := store.Rotate(ctx, *tenant, slices.Contains(kinds, kindAPIKeys), slices.Contains(kinds, kindSigningSecrets), *overlap)
+			if err != nil {
+				return err
+			}
+			output.APIKey, output.SigningSecret = r.APIKey, r.SigningSecret
+			record.APIKeyFingerprint = r.Fingerprint
+			record.CredentialsRetired, record.CredentialsDropped = r.Retired, r.Dropped
+			if r.APIKey != "" {
+				record.Rotated = append(record.Rotated, kindAPIKeys)
+			}
+			if r.SigningSecret != "" {
+				record.Rotated = append(record.Rotated, kindSigningSecrets)
+			}
+		}
+		if slices.Contains(kinds, kindPseudonyms) {
+			gen, err := rotatePseudonyms(ctx, client, *policies, *tenant, now.Add(*overlap))
+			if err != nil {
+				return err
+			}
+			if gen > 0 {
+				output.PseudonymGeneration, record.PseudonymGeneration = gen, gen
+				record.Rotated = append(record.Rotated, kindPseudonyms)
+			}
+		}
+		return nil
+	}()
+
+	record.Status, record.CompletedAt = "DONE", time.Now().UTC().Format(time.RFC3339)
+	if err != nil {
+		record.Status, record.FailureReason = "FAILED", err.Error()
+	}
+	if auditErr := putRecord(ctx, client, *audit, record); auditErr != nil {
+		err = errors.Join(err, fmt.Errorf("write audit record: %w", auditErr))
+	}
+	// Print whatever was rotated even on failure: a new key that was stored
+	// but not shown would lock the tenant out once the overlap ends
+	if output.APIKey != "" || output.SigningSecret != "" || output.PseudonymGeneration > 0 {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(output)
+	}
+	if err != nil {
+		fail("rotation %s: %v", record.RotationID, err)
+	}
+	if len(record.Rotated) == 0 {
+		fmt.Fprintf(os.Stderr, "tenant %s has none of %s to rotate\n", *tenant, strings.Join(kinds, ", "))
+	}
+}
+
+// rotatePseudonyms moves a tenant with search_pseudonyms to its next
+// pseudonym generation and returns it; 0 when the tenant has none. The
+// policy version is bumped, so the worker recompiles and indexes under the
+// new generation within its policy TTL. Records already indexed keep the
+// last generation's pseudonyms, which POST /pseudonyms also answers until
+// overlapUntil; a backfill re-indexes them under the new one.
+func rotatePseudonyms(ctx context.Context, client *dynamodb.Client, table, tenantID string, overlapUntil time.Time) (int, error) {
+	out, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		UpdateExpression:    aws.String("SET pseudonym_generation = if_not_exists(pseudonym_generation, :zero) + :one, pseudonym_overlap_until = :until ADD version :one"),
+		ConditionExpression: aws.String("size(search_pseudonyms) > :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero":  &types.AttributeValueMemberN{Value: "0"},
+			":one":   &types.AttributeValueMemberN{Value: "1"},
+			":until": &types.AttributeValueMemberS{Value: overlapUntil.Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if errors.As(err, &conditional) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("rotate pseudonyms: %w", err)
+	}
+	var updated struct {
+		Generation int `dynamodbav:"pseudonym_generation"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Attributes, &updated); err != nil {
+		return 0, err
+	}
+	return updated.Generation, nil
+}
+
+func putRecord(ctx context.Context, client *dynamodb.Client, table string, record rotationRecord) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(table), Item: item})
+	return err
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
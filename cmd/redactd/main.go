@@ -0,0 +1,67 @@
+// Command redactd serves the redaction engine (pkg/redact) over gRPC, so
+// services in any language can scrub text synchronously with a tenant's
+// stored policy instead of going through the async pipeline. The service is
+// defined in api/redact/v1/redact.proto.
+//
+//	POLICY_TABLE_NAME=TenantPolicies redactd -listen :50051
+//
+// Without a policy table every tenant gets the built-in policy.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	redactv1 "robust-processor/api/redact/v1"
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/tenantpolicy"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func main() {
+	logscrub.Install()
+	listen := flag.String("listen", ":50051", "gRPC listen address")
+	table := flag.String("policies", os.Getenv("POLICY_TABLE_NAME"), "tenant policy table; empty serves the built-in policy only")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	policies := &tenantpolicy.Store{Table: *table}
+	if *table != "" {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			panic("configuration error: " + err.Error())
+		}
+		policies.Client = dynamodb.NewFromConfig(cfg)
+	}
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		slog.Error("Failed to listen", "addr", *listen, "error", err)
+		os.Exit(1)
+	}
+	srv := grpc.NewServer()
+	redactv1.RegisterRedactServiceServer(srv, &server{policies: policies})
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	slog.Info("Redaction service listening", "addr", *listen)
+	if err := srv.Serve(lis); err != nil {
+		slog.Error("Failed to serve", "error", err)
+		os.Exit(1)
+	}
+}
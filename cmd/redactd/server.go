@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	redactv1 "robust-processor/api/redact/v1"
+	"robust-processor/internal/tenantpolicy"
+	"robust-processor/pkg/redact"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type server struct {
+	redactv1.UnimplementedRedactServiceServer
+	policies *tenantpolicy.Store
+}
+
+func (s *server) Redact(ctx context.Context, req *redactv1.RedactRequest) (*redactv1.RedactResponse, error) {
+	r, version, err := s.redactor(ctx, req.GetTenantId())
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	resp := &redactv1.RedactResponse{
+		Text:          r.RedactCounting(req.GetText(), counts),
+		PolicyVersion: int32(version),
+	}
+	if len(req.GetFields()) > 0 {
+		resp.Fields = make(map[string]string, len(req.GetFields()))
+		for k, v := range req.GetFields() {
+			resp.Fields[k] = r.RedactCounting(v, counts)
+		}
+	}
+	resp.Redactions = make(map[string]int32, len(counts))
+	for name, n := range counts {
+		resp.Redactions[name] = int32(n)
+	}
+	return resp, nil
+}
+
+func (s *server) Detect(ctx context.Context, req *redactv1.DetectRequest) (*redactv1.DetectResponse, error) {
+	r, version, err := s.redactor(ctx, req.GetTenantId())
+	if err != nil {
+		return nil, err
+	}
+	return &redactv1.DetectResponse{Matches: toMatches(r.Detect(req.GetText())), PolicyVersion: int32(version)}, nil
+}
+
+func (s *server) Preview(ctx context.Context, req *redactv1.PreviewRequest) (*redactv1.PreviewResponse, error) {
+	r, err := redact.Compile(fromPolicy(req.GetPolicy()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &redactv1.PreviewResponse{Text: r.Redact(req.GetText()), Matches: toMatches(r.Detect(req.GetText()))}, nil
+}
+
+// redactor maps policy loading failures to gRPC codes: a broken stored policy
+// is the tenant's to fix, a failed read is worth retrying
+func (s *server) redactor(ctx context.Context, tenantID string) (*redact.Redactor, int, error) {
+	if tenantID == "" {
+		return nil, 0, status.Error(codes.InvalidArgument, "tenant_id is required")
+	}
+	r, version, err := s.policies.Redactor(ctx, tenantID)
+	var bad tenantpolicy.InvalidError
+	switch {
+	case err == nil:
+		return r, version, nil
+	case errors.As(err, &bad):
+		return nil, 0, status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		slog.Error("Failed to load policy", "tenant_id", tenantID, "error", err)
+		return nil, 0, status.Error(codes.Unavailable, "policy unavailable")
+	}
+}
+
+func toMatches(matches []redact.Match) []*redactv1.Match {
+	out := make([]*redactv1.Match, len(matches))
+	for i, m := range matches {
+		out[i] = &redactv1.Match{
+			Detector:  m.Detector,
+			Start:     int32(m.Start),
+			End:       int32(m.End),
+			RuneStart: int32(m.RuneStart),
+			RuneEnd:   int32(m.RuneEnd),
+		}
+	}
+	return out
+}
+
+func fromPolicy(p *redactv1.Policy) redact.Policy {
+	policy := redact.Policy{
+		PreserveFormat:    p.GetPreserveFormat(),
+		Placeholder:       p.GetPlaceholder(),
+		Placeholders:      p.GetPlaceholders(),
+		DisabledDetectors: p.GetDisabledDetectors(),
+		Profanity: redact.ProfanityFilter{
+			Enabled:  p.GetProfanity().GetEnabled(),
+			Words:    p.GetProfanity().GetWords(),
+			Strategy: p.GetProfanity().GetStrategy(),
+			Token:    p.GetProfanity().GetToken(),
+		},
+	}
+	for _, c := range p.GetCustomPatterns() {
+		policy.CustomPatterns = append(policy.CustomPatterns, redact.CustomPattern{
+			Name:     c.GetName(),
+			Pattern:  c.GetPattern(),
+			Token:    c.GetToken(),
+			Priority: int(c.GetPriority()),
+		})
+	}
+	return policy
+}
@@ -0,0 +1,117 @@
+//go:build js && wasm
+
+// Command redactwasm builds the redaction engine (pkg/redact) to WebAssembly
+// for browsers and Node-based edge runtimes such as Lambda@Edge, so tenants
+// can redact before data leaves their side. Policies are the same JSON as the
+// redaction part of a tenant policy, so rules are shared with the server.
+//
+//	make wasm   # redact.wasm + wasm_exec.js
+//
+// Once loaded with Go's wasm_exec.js the module defines globalThis.redact:
+//
+//	redact.redact(text, policy?) // {text, redactions} or {error}
+//	redact.detect(text, policy?) // {matches: [{detector, start, end}]} or {error}
+//
+// policy is a JSON string or plain object; omitted means the built-ins.
+// Offsets are UTF-16 code units, i.e. JavaScript string indices.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"syscall/js"
+	"unicode/utf16"
+
+	"robust-processor/pkg/redact"
+)
+
+// compiled caches Redactors by policy JSON; pages and edge workers tend to
+// reuse one policy for every call
+var compiled sync.Map
+
+func main() {
+	js.Global().Set("redact", js.ValueOf(map[string]interface{}{
+		"redact": js.FuncOf(redactFunc),
+		"detect": js.FuncOf(detectFunc),
+	}))
+	select {}
+}
+
+func redactFunc(_ js.Value, args []js.Value) interface{} {
+	text, r, err := parseArgs(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	counts := map[string]int{}
+	out := r.RedactCounting(text, counts)
+	redactions := make(map[string]interface{}, len(counts))
+	for name, n := range counts {
+		redactions[name] = n
+	}
+	return map[string]interface{}{"text": out, "redactions": redactions}
+}
+
+func detectFunc(_ js.Value, args []js.Value) interface{} {
+	text, r, err := parseArgs(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	matches := r.Detect(text)
+	out := make([]interface{}, len(matches))
+	for i, m := range matches {
+		out[i] = map[string]interface{}{
+			"detector": m.Detector,
+			"start":    utf16Offset(text, m.Start),
+			"end":      utf16Offset(text, m.End),
+		}
+	}
+	return map[string]interface{}{"matches": out}
+}
+
+func parseArgs(args []js.Value) (string, *redact.Redactor, error) {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return "", nil, errors.New("text must be a string")
+	}
+	text := args[0].String()
+	if len(args) < 2 || args[1].IsUndefined() || args[1].IsNull() {
+		return text, redact.Default, nil
+	}
+	spec := args[1]
+	if spec.Type() != js.TypeString {
+		spec = js.Global().Get("JSON").Call("stringify", spec)
+	}
+	r, err := redactorFor(spec.String())
+	return text, r, err
+}
+
+func redactorFor(spec string) (*redact.Redactor, error) {
+	if r, ok := compiled.Load(spec); ok {
+		return r.(*redact.Redactor), nil
+	}
+	var policy redact.Policy
+	if err := json.Unmarshal([]byte(spec), &policy); err != nil {
+		return nil, err
+	}
+	r, err := redact.Compile(policy)
+	if err != nil {
+		return nil, err
+	}
+	compiled.Store(spec, r)
+	return r, nil
+}
+
+// utf16Offset converts a byte offset into text to a JavaScript string index.
+// Text from JS is valid UTF-8, lone surrogates having become U+FFFD.
+func utf16Offset(text string, offset int) int {
+	n := 0
+	for _, r := range text[:offset] {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Go panics inside a js.Func abort the module, so errors are returned
+func errorResult(err error) interface{} {
+	return map[string]interface{}{"error": err.Error()}
+}
@@ -0,0 +1,165 @@
+// Command verifychain checks a tenant's hash-chained records for one day,
+// recomputing every digest and link from the stored data and comparing the
+// end of the chain with the recorded chain head. Originals encrypted under a
+// tenant key are decrypted to verify; once the tenant has revoked the key
+// they are reported as shredded and only the links are checked.
+//
+//	go run ./cmd/verifychain -tenant acme_corp -day 2025-01-31
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"robust-processor/internal/envelope"
+	"robust-processor/internal/integrity"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+type sealedItem struct {
+	TenantID     string `dynamodbav:"tenant_id"`
+	LogID        string `dynamodbav:"log_id"`
+	Source       string `dynamodbav:"source"`
+	OriginalText string `dynamodbav:"original_text"`
+	ModifiedData string `dynamodbav:"modified_data"`
+	ProcessedAt  string `dynamodbav:"processed_at"`
+	ChainSeq     int    `dynamodbav:"chain_seq"`
+	ChainPrev    string `dynamodbav:"chain_prev"`
+	ChainHash    string `dynamodbav:"chain_hash"`
+	envelope.Sealed
+
+	// OriginalSHA256 is set instead of OriginalText for tenants that don't
+	// store originals
+	OriginalSHA256 string `dynamodbav:"original_sha256"`
+}
+
+func main() {
+	tenant := flag.String("tenant", "", "tenant_id to verify")
+	day := flag.String("day", "", "chain day, YYYY-MM-DD (UTC)")
+	table := flag.String("table", "MultiTenantLogs", "logs table")
+	chains := flag.String("chains", "IntegrityChains", "chain head table")
+	flag.Parse()
+	if *tenant == "" || *day == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		fail("configuration error: %v", err)
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	kmsClient := kms.NewFromConfig(cfg)
+	chainID := *tenant + "#" + *day
+
+	items, err := loadChain(ctx, client, *table, *tenant, chainID)
+	if err != nil {
+		fail("read records: %v", err)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ChainSeq < items[j].ChainSeq })
+
+	prevHash := ""
+	shredded := 0
+	for i, item := range items {
+		switch {
+		case item.ChainSeq != i+1:
+			fail("BROKEN: expected seq %d, found %d (%s): records missing", i+1, item.ChainSeq, item.LogID)
+		case item.ChainPrev != prevHash:
+			fail("BROKEN at seq %d (%s): previous-hash link does not match", item.ChainSeq, item.LogID)
+		}
+		if item.KeyARN != "" {
+			text, err := envelope.Open(ctx, kmsClient, item.Sealed, item.TenantID, item.LogID)
+			if envelope.KeyUnavailable(err) {
+				shredded++
+				prevHash = item.ChainHash
+				continue
+			}
+			if err != nil {
+				fail("read original at seq %d (%s): %v", item.ChainSeq, item.LogID, err)
+			}
+			item.OriginalText = text
+		}
+		if item.OriginalSHA256 != "" {
+			item.OriginalText = integrity.UnstoredOriginal(item.OriginalSHA256)
+		}
+		digest := integrity.Digest(integrity.Record{
+			TenantID:     item.TenantID,
+			LogID:        item.LogID,
+			Source:       item.Source,
+			OriginalText: item.OriginalText,
+			ModifiedData: item.ModifiedData,
+			ProcessedAt:  item.ProcessedAt,
+		})
+		if integrity.Link(prevHash, digest) != item.ChainHash {
+			fail("BROKEN at seq %d (%s): record content was modified", item.ChainSeq, item.LogID)
+		}
+		prevHash = item.ChainHash
+	}
+
+	head, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(*chains),
+		Key:            map[string]types.AttributeValue{"chain_id": &types.AttributeValueMemberS{Value: chainID}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		fail("read chain head: %v", err)
+	}
+	var headSeq, headHash string
+	if n, ok := head.Item["chain_seq"].(*types.AttributeValueMemberN); ok {
+		headSeq = n.Value
+	}
+	if h, ok := head.Item["chain_hash"].(*types.AttributeValueMemberS); ok {
+		headHash = h.Value
+	}
+	if headSeq != strconv.Itoa(len(items)) || headHash != prevHash {
+		fail("BROKEN: chain head records seq %s but %d records verify: trailing records missing", headSeq, len(items))
+	}
+
+	if shredded > 0 {
+		fmt.Printf("OK: %d records in chain %s verified, %d shredded (links only)\n", len(items)-shredded, chainID, shredded)
+		return
+	}
+	fmt.Printf("OK: %d records in chain %s verified\n", len(items), chainID)
+}
+
+func loadChain(ctx context.Context, client *dynamodb.Client, table, tenant, chainID string) ([]sealedItem, error) {
+	paginator := dynamodb.NewQueryPaginator(client, &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("tenant_id = :t"),
+		FilterExpression:       aws.String("chain_id = :c"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: tenant},
+			":c": &types.AttributeValueMemberS{Value: chainID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	var items []sealedItem
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var batch []sealedItem
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
+	}
+	return items, nil
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,181 @@
+// Command workerd runs the worker's processing core as a long-running service
+// for deployments without Lambda (ECS, EKS, on-prem hosts). It reads the same
+// environment as the LogWorker Lambda and takes work from SQS queues, from
+// HTTP (-listen) for sites with no queue or API Gateway at all, or both.
+// Receives are shared between queues by weight, so a busy tenant or
+// low-priority queue cannot starve the others.
+//
+//	WORKERD_QUEUES="https://sqs.../priority=3,https://sqs.../bulk=1" workerd
+//	workerd -listen :8080
+//
+// Batches run one at a time whichever way they arrive; scale out with more
+// replicas. Failed queue messages are left on the queue and reappear after its
+// visibility timeout, so DLQ redrive works as it does for the Lambda.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/worker"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	receiveBatch = 10 // SQS maximum per receive
+	receiveWait  = 1  // seconds; short so an empty queue doesn't hold up the others
+)
+
+func main() {
+	logscrub.Install()
+	queues := flag.String("queues", os.Getenv("WORKERD_QUEUES"), "comma-separated queue_url[=weight] list")
+	idle := flag.Duration("idle", 5*time.Second, "how long an empty queue is skipped before it is polled again")
+	listen := flag.String("listen", os.Getenv("WORKERD_LISTEN"), "serve the HTTP API on this address, e.g. :8080")
+	flag.Parse()
+
+	var sched *scheduler
+	if *queues != "" || *listen == "" {
+		var err error
+		if sched, err = parseQueues(*queues, *idle); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	// SIGTERM (ECS stop, pod eviction) lets the current batch finish
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	var wg sync.WaitGroup
+	if *listen != "" {
+		srv := newServer(*listen)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdown)
+		}()
+		go func() {
+			slog.Info("Worker serving", "addr", *listen)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Failed to serve", "error", err)
+				stop()
+			}
+		}()
+	}
+	if sched != nil {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			panic("configuration error: " + err.Error())
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx, sqs.NewFromConfig(cfg), sched)
+		}()
+	}
+	wg.Wait()
+	slog.Info("Worker stopped")
+}
+
+// run polls the scheduled queues until ctx is cancelled
+func run(ctx context.Context, client *sqs.Client, sched *scheduler) {
+	slog.Info("Worker polling", "queues", len(sched.queues))
+	for ctx.Err() == nil {
+		q := sched.next(time.Now())
+		if q == nil {
+			sleep(ctx, time.Until(sched.wake()))
+			continue
+		}
+		n, err := poll(ctx, client, q)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Failed to poll queue", "queue", q.url, "error", err)
+		}
+		if n == 0 || err != nil {
+			sched.park(q, time.Now())
+		}
+	}
+}
+
+// poll receives one batch from q, processes it and deletes the messages that
+// succeeded. It returns how many messages were received.
+func poll(ctx context.Context, client *sqs.Client, q *queue) (int, error) {
+	out, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(q.url),
+		MaxNumberOfMessages:   receiveBatch,
+		WaitTimeSeconds:       receiveWait,
+		MessageAttributeNames: []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameMessageGroupId,
+		},
+	})
+	if err != nil || len(out.Messages) == 0 {
+		return 0, err
+	}
+
+	messages := make([]worker.Message, len(out.Messages))
+	for i, m := range out.Messages {
+		messages[i] = worker.Message{
+			ID:         aws.ToString(m.MessageId),
+			Body:       aws.ToString(m.Body),
+			Group:      m.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)],
+			Attributes: map[string]string{},
+		}
+		for name, attr := range m.MessageAttributes {
+			if attr.StringValue != nil {
+				messages[i].Attributes[name] = *attr.StringValue
+			}
+		}
+	}
+	// The batch runs to completion even if shutdown starts meanwhile
+	failed := process(context.WithoutCancel(ctx), messages)
+
+	var done []types.DeleteMessageBatchRequestEntry
+	for _, m := range out.Messages {
+		if !slices.Contains(failed, aws.ToString(m.MessageId)) {
+			done = append(done, types.DeleteMessageBatchRequestEntry{Id: m.MessageId, ReceiptHandle: m.ReceiptHandle})
+		}
+	}
+	if len(done) == 0 {
+		return len(out.Messages), nil
+	}
+	res, err := client.DeleteMessageBatch(context.WithoutCancel(ctx), &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(q.url),
+		Entries:  done,
+	})
+	if err != nil {
+		return len(out.Messages), fmt.Errorf("delete processed messages: %w", err)
+	}
+	// Undeleted messages are delivered again and suppressed as duplicates
+	for _, f := range res.Failed {
+		slog.Warn("Failed to delete processed message", "message_id", aws.ToString(f.Id), "code", aws.ToString(f.Code))
+	}
+	return len(out.Messages), nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
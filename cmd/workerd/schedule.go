@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queue is one polled queue and its smooth weighted round-robin state
+type queue struct {
+	url     string
+	weight  int
+	current int
+
+	idle      time.Duration
+	idleUntil time.Time // skipped until then after an empty or failed receive
+}
+
+// scheduler picks the next queue to receive from. Over time each queue gets
+// receives in proportion to its weight, interleaved rather than in bursts
+// (3:1 polls a a b a, not a a a b). Idle queues drop out of the rotation,
+// so their share goes to queues that have work.
+type scheduler struct {
+	queues []*queue
+}
+
+// parseQueues reads "url[=weight],..."; weight defaults to 1. Queue URLs
+// carry no query string, so the last '=' separates the weight.
+func parseQueues(spec string, idle time.Duration) (*scheduler, error) {
+	s := &scheduler{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		q := &queue{url: entry, weight: 1, idle: idle}
+		if i := strings.LastIndex(entry, "="); i > 0 {
+			w, err := strconv.Atoi(entry[i+1:])
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("queue %q: weight must be a positive integer", entry[:i])
+			}
+			q.url, q.weight = entry[:i], w
+		}
+		if u, err := url.Parse(q.url); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("queue %q: not a queue URL", q.url)
+		}
+		s.queues = append(s.queues, q)
+	}
+	if len(s.queues) == 0 {
+		return nil, fmt.Errorf("no queues configured")
+	}
+	return s, nil
+}
+
+// next returns the queue to receive from, or nil if every queue is idle
+func (s *scheduler) next(now time.Time) *queue {
+	var best *queue
+	total := 0
+	for _, q := range s.queues {
+		if now.Before(q.idleUntil) {
+			continue
+		}
+		q.current += q.weight
+		total += q.weight
+		if best == nil || q.current > best.current {
+			best = q
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// park takes q out of the rotation for its idle period
+func (s *scheduler) park(q *queue, now time.Time) {
+	q.idleUntil = now.Add(q.idle)
+}
+
+// wake is when the first idle queue rejoins the rotation
+func (s *scheduler) wake() time.Time {
+	var first time.Time
+	for _, q := range s.queues {
+		if first.IsZero() || q.idleUntil.Before(first) {
+			first = q.idleUntil
+		}
+	}
+	return first
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"robust-processor/internal/worker"
+	"robust-processor/pkg/model"
+
+	"github.com/google/uuid"
+)
+
+const maxBody = 1 << 20 // same cap as an SQS message
+
+// batchMu serializes batches from the poller and the HTTP API; the core
+// flushes shared sink and completion buffers per batch
+var batchMu sync.Mutex
+
+func process(ctx context.Context, messages []worker.Message) []string {
+	batchMu.Lock()
+	defer batchMu.Unlock()
+	return worker.ProcessBatch(ctx, messages)
+}
+
+// newServer serves the processing core over HTTP for deployments with no
+// queue at all. POST /process takes one message in the queue contract
+// (pkg/model) and answers once the record is stored and sent to sinks.
+func newServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /process", handleProcess)
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
+func handleProcess(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "Body exceeds 1 MiB"})
+		return
+	}
+	// Contract errors are the caller's; anything after is ours
+	if err := model.Validate(body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	var event model.LogEvent
+	_ = json.Unmarshal(body, &event)
+
+	id := uuid.NewString()
+	if failed := process(r.Context(), []worker.Message{{ID: id, Body: string(body)}}); len(failed) > 0 {
+		// Details are in the log under message_id; a record that was stored
+		// is not written again, so the caller may simply retry
+		slog.Error("Request not processed", "message_id", id, "tenant_id", event.TenantID, "log_id", event.LogID)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Processing failed", "request_id": id})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "PROCESSED", "tenant_id": event.TenantID, "log_id": event.LogID})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
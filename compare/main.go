@@ -0,0 +1,238 @@
+// Compare joins shadow-worker output with production by tenant_id/log_id and
+// reports how often they diverge, per category, as a go/no-go signal for
+// engine changes running in shadow mode. It runs on a schedule over the
+// shadow items written since the previous run, or on demand with
+// {"since": "<RFC3339>"}.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"robust-processor/internal/logscrub"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const metricNamespace = "RobustProcessor"
+
+// maxSamples bounds the divergent log_ids listed in a report
+const maxSamples = 20
+
+// Divergence categories
+const (
+	categoryMissing      = "missing_production"
+	categoryModifiedData = "modified_data"
+	categoryRedactions   = "redactions"
+	categoryFields       = "fields"
+	categoryLabels       = "labels"
+)
+
+var categories = []string{categoryMissing, categoryModifiedData, categoryRedactions, categoryFields, categoryLabels}
+
+var (
+	dynamoClient    *dynamodb.Client
+	tableName       string
+	shadowTableName string
+	window          = time.Hour
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("TABLE_NAME")
+	shadowTableName = os.Getenv("SHADOW_TABLE_NAME")
+	if d, err := time.ParseDuration(os.Getenv("COMPARE_WINDOW")); err == nil {
+		window = d
+	}
+}
+
+// result is the part of a processed item that shadow and production must agree on
+type result struct {
+	TenantID     string            `dynamodbav:"tenant_id"`
+	LogID        string            `dynamodbav:"log_id"`
+	ModifiedData string            `dynamodbav:"modified_data"`
+	Fields       map[string]string `dynamodbav:"fields"`
+	Labels       []string          `dynamodbav:"labels,stringset"`
+	Redactions   map[string]int    `dynamodbav:"redactions"`
+	ProcessedAt  string            `dynamodbav:"processed_at"`
+	Status       string            `dynamodbav:"status"`
+}
+
+type compareRequest struct {
+	Since string `json:"since"`
+}
+
+type divergence struct {
+	TenantID string `json:"tenant_id"`
+	LogID    string `json:"log_id"`
+	Category string `json:"category"`
+}
+
+type report struct {
+	Since     string             `json:"since"`
+	Compared  int                `json:"compared"`
+	Divergent map[string]int     `json:"divergent"`
+	Rates     map[string]float64 `json:"rates"`
+	Samples   []divergence       `json:"samples,omitempty"`
+}
+
+func handler(ctx context.Context, payload json.RawMessage) (report, error) {
+	var req compareRequest
+	_ = json.Unmarshal(payload, &req) // scheduled events carry no since
+	since := time.Now().Add(-window).UTC().Format(time.RFC3339)
+	if req.Since != "" {
+		since = req.Since
+	}
+
+	shadows, err := scanShadow(ctx, since)
+	if err != nil {
+		return report{}, err
+	}
+
+	rep := report{Since: since, Divergent: map[string]int{}, Rates: map[string]float64{}}
+	for start := 0; start < len(shadows); start += 100 {
+		batch := shadows[start:min(start+100, len(shadows))]
+		production, err := getProduction(ctx, batch)
+		if err != nil {
+			return report{}, err
+		}
+		for _, shadow := range batch {
+			rep.Compared++
+			prod, ok := production[shadow.TenantID+"#"+shadow.LogID]
+			for _, category := range diff(shadow, prod, ok) {
+				rep.Divergent[category]++
+				if len(rep.Samples) < maxSamples {
+					rep.Samples = append(rep.Samples, divergence{TenantID: shadow.TenantID, LogID: shadow.LogID, Category: category})
+				}
+			}
+		}
+	}
+
+	for _, category := range categories {
+		if rep.Compared > 0 {
+			rep.Rates[category] = float64(rep.Divergent[category]) / float64(rep.Compared)
+		}
+		emitMetric("ShadowDivergenceRate", rep.Rates[category]*100, "Percent", map[string]string{"category": category})
+	}
+	emitMetric("ShadowCompared", float64(rep.Compared), "Count", nil)
+	slog.Info("Shadow comparison complete", "since", since, "compared", rep.Compared, "divergent", rep.Divergent)
+	return rep, nil
+}
+
+// diff lists the categories in which a shadow result differs from production
+func diff(shadow, prod result, found bool) []string {
+	if !found {
+		return []string{categoryMissing}
+	}
+	var out []string
+	if shadow.ModifiedData != prod.ModifiedData {
+		out = append(out, categoryModifiedData)
+	}
+	if !maps.Equal(shadow.Redactions, prod.Redactions) {
+		out = append(out, categoryRedactions)
+	}
+	if !maps.Equal(shadow.Fields, prod.Fields) {
+		out = append(out, categoryFields)
+	}
+	slices.Sort(shadow.Labels)
+	slices.Sort(prod.Labels)
+	if !slices.Equal(shadow.Labels, prod.Labels) {
+		out = append(out, categoryLabels)
+	}
+	return out
+}
+
+// scanShadow reads every shadow item processed at or after since. The shadow
+// table only holds sampled, TTL-bounded traffic, so a filtered scan is cheap.
+func scanShadow(ctx context.Context, since string) ([]result, error) {
+	var results []result
+	paginator := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{
+		TableName:                 aws.String(shadowTableName),
+		FilterExpression:          aws.String("processed_at >= :since"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":since": &types.AttributeValueMemberS{Value: since}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scan shadow table: %w", err)
+		}
+		var items []result
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("decode shadow items: %w", err)
+		}
+		results = append(results, items...)
+	}
+	return results, nil
+}
+
+// getProduction fetches the production items matching up to 100 shadow results
+func getProduction(ctx context.Context, batch []result) (map[string]result, error) {
+	keys := make([]map[string]types.AttributeValue, len(batch))
+	for i, r := range batch {
+		keys[i] = map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: r.TenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: r.LogID},
+		}
+	}
+
+	found := make(map[string]result, len(batch))
+	request := map[string]types.KeysAndAttributes{tableName: {Keys: keys}}
+	for len(request) > 0 {
+		out, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+		if err != nil {
+			return nil, fmt.Errorf("read production items: %w", err)
+		}
+		var items []result
+		if err := attributevalue.UnmarshalListOfMaps(out.Responses[tableName], &items); err != nil {
+			return nil, fmt.Errorf("decode production items: %w", err)
+		}
+		for _, item := range items {
+			// A QUEUED stub has no result yet to compare against
+			if item.Status != "QUEUED" {
+				found[item.TenantID+"#"+item.LogID] = item
+			}
+		}
+		request = out.UnprocessedKeys
+	}
+	return found, nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
@@ -0,0 +1,662 @@
+// Erase carries out right-to-erasure requests: it removes every stored copy
+// of one log, or of all of a tenant's logs, for good. The read API records
+// each request in ERASURE_TABLE_NAME and invokes this Lambda asynchronously
+// with {"tenant_id": "...", "erasure_id": "..."}; the item is both the audit
+// record of the request and the job's checkpoint. Erased are:
+//
+//   - the log items (with, for one log, its parts) in TABLE_NAME, including
+//     soft-deleted ones, and their copies in SHADOW_TABLE_NAME
+//   - their ingest journal entries and near-duplicate index entries
+//   - their quarantined messages in QUARANTINE_TABLE_NAME
+//   - their OpenSearch documents
+//   - for a tenant erasure, the tenant's token vault entries; one log's
+//     tokens may stand for values of other logs too, so they are kept
+//
+// A tenant erasure pages through the tenant's partitions in phases and,
+// when the invocation nears its deadline, continues in a fresh asynchronous
+// invocation from the checkpoint, so a tenant of any size completes. The
+// audit item keeps who asked, when, what was erased and when it finished,
+// never any content. Firehose deliveries and tenant-owned export copies are
+// outside the pipeline's reach and must be erased where they landed.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/simhash"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+const metricNamespace = "RobustProcessor"
+
+const (
+	// headroom is left before the deadline to checkpoint and hand over
+	headroom = 30 * time.Second
+	// batchWriteLimit is the most requests one BatchWriteItem accepts
+	batchWriteLimit = 25
+)
+
+// Erasure statuses, as stored and as GET /erasures/{erasure_id} reports them
+const (
+	statusPending = "PENDING"
+	statusRunning = "RUNNING"
+	statusDone    = "DONE"
+	statusFailed  = "FAILED"
+)
+
+// Phases of a tenant erasure, in order
+const (
+	phaseLogs       = "logs"
+	phaseJournal    = "journal"
+	phaseVault      = "vault"
+	phaseQuarantine = "quarantine"
+	phaseIndex      = "index"
+)
+
+var (
+	awsCfg                 aws.Config
+	dynamoClient           *dynamodb.Client
+	lambdaClient           *lambdasvc.Client
+	erasureTableName       string
+	tableName              string
+	shadowTableName        string
+	journalTableName       string
+	quarantineTableName    string
+	nearDuplicateTableName string
+	tokenVaultTableName    string
+	searchEndpoint         string
+	searchIndex            = "logs"
+	searchHTTP             = &http.Client{Timeout: 30 * time.Second}
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	awsCfg = cfg
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	lambdaClient = lambdasvc.NewFromConfig(cfg)
+	erasureTableName = os.Getenv("ERASURE_TABLE_NAME")
+	tableName = os.Getenv("TABLE_NAME")
+	shadowTableName = os.Getenv("SHADOW_TABLE_NAME")
+	journalTableName = os.Getenv("JOURNAL_TABLE_NAME")
+	quarantineTableName = os.Getenv("QUARANTINE_TABLE_NAME")
+	nearDuplicateTableName = os.Getenv("NEAR_DUPLICATE_TABLE_NAME")
+	tokenVaultTableName = os.Getenv("TOKEN_VAULT_TABLE_NAME")
+	searchEndpoint = strings.TrimRight(os.Getenv("OPENSEARCH_ENDPOINT"), "/")
+	if index := os.Getenv("OPENSEARCH_INDEX"); index != "" {
+		searchIndex = index
+	}
+}
+
+// erasure is an ERASURE_TABLE_NAME item: the audit record of one request
+// and its progress
+type erasure struct {
+	TenantID  string `dynamodbav:"tenant_id" json:"tenant_id"`
+	ErasureID string `dynamodbav:"erasure_id" json:"erasure_id"`
+	// Scope is "log" for one log (LogID) and its parts, "tenant" for all of
+	// the tenant's logs
+	Scope         string `dynamodbav:"scope" json:"scope"`
+	LogID         string `dynamodbav:"log_id,omitempty" json:"log_id,omitempty"`
+	RequestedAt   string `dynamodbav:"requested_at" json:"requested_at"`
+	RequestedFrom string `dynamodbav:"requested_from,omitempty" json:"requested_from,omitempty"`
+	Status        string `dynamodbav:"status" json:"status"`
+	// Phase and Cursor checkpoint a tenant erasure: the phase in progress
+	// and the last key it erased
+	Phase         string `dynamodbav:"phase,omitempty" json:"-"`
+	Cursor        string `dynamodbav:"cursor,omitempty" json:"-"`
+	RecordsErased int64  `dynamodbav:"records_erased" json:"records_erased"`
+	Quarantined   int64  `dynamodbav:"quarantined_erased" json:"quarantined_erased"`
+	// IndexErased is the OpenSearch documents deleted, -1 when the index
+	// could not be reached or doesn't support the deletion
+	IndexErased   int64  `dynamodbav:"index_erased" json:"index_erased"`
+	CompletedAt   string `dynamodbav:"completed_at,omitempty" json:"completed_at,omitempty"`
+	FailureReason string `dynamodbav:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	UpdatedAt     string `dynamodbav:"updated_at" json:"updated_at"`
+}
+
+// invocation is what the read API (or a hand-over) invokes this Lambda with
+type invocation struct {
+	TenantID  string `json:"tenant_id"`
+	ErasureID string `json:"erasure_id"`
+}
+
+func handler(ctx context.Context, inv invocation) error {
+	if inv.TenantID == "" || inv.ErasureID == "" {
+		return errors.New("tenant_id and erasure_id are required")
+	}
+	e, err := loadErasure(ctx, inv.TenantID, inv.ErasureID)
+	if err != nil {
+		return err
+	}
+	if e.Status == statusDone || e.Status == statusFailed {
+		return nil
+	}
+	e.Status = statusRunning
+	switch e.Scope {
+	case "log":
+		err = eraseLog(ctx, &e)
+	case "tenant":
+		var handedOver bool
+		if handedOver, err = eraseTenant(ctx, &e); handedOver {
+			return err
+		}
+	default:
+		e.Status, e.FailureReason = statusFailed, "unknown scope "+e.Scope
+		return saveErasure(ctx, e)
+	}
+	if err != nil {
+		// Saved progress lets Lambda's retry, or a manual re-invocation,
+		// resume where this attempt stopped
+		_ = saveErasure(ctx, e)
+		emitMetric("ErasureErrors", 1, "Count", nil)
+		return err
+	}
+	e.Status = statusDone
+	e.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	slog.Info("Erasure complete", "tenant_id", e.TenantID, "erasure_id", e.ErasureID, "scope", e.Scope,
+		"records_erased", e.RecordsErased, "quarantined_erased", e.Quarantined, "index_erased", e.IndexErased)
+	emitMetric("RecordsErased", float64(e.RecordsErased), "Count", nil)
+	return saveErasure(ctx, e)
+}
+
+// eraseLog erases one log and its parts
+func eraseLog(ctx context.Context, e *erasure) error {
+	keys, err := logAndParts(ctx, e.TenantID, e.LogID)
+	if err != nil {
+		return err
+	}
+	if err := eraseRecords(ctx, e, keys); err != nil {
+		return err
+	}
+	logIDs := map[string]bool{}
+	for _, k := range keys {
+		logIDs[k.logID] = true
+	}
+	n, err := eraseQuarantined(ctx, e.TenantID, logIDs)
+	e.Quarantined += n
+	if err != nil {
+		return err
+	}
+	e.IndexErased = deleteDocs(ctx, e.TenantID, keys)
+	return nil
+}
+
+// eraseTenant works through the tenant's data phase by phase, handing over
+// to a fresh invocation near the deadline. It reports whether it did.
+func eraseTenant(ctx context.Context, e *erasure) (bool, error) {
+	if e.Phase == "" {
+		e.Phase = phaseLogs
+	}
+	for {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < headroom {
+			return true, handOver(ctx, *e)
+		}
+		var done bool
+		var err error
+		switch e.Phase {
+		case phaseLogs:
+			done, err = eraseLogPage(ctx, e)
+		case phaseJournal:
+			done, err = eraseJournalPage(ctx, e)
+		case phaseVault:
+			done, err = eraseVaultPage(ctx, e)
+		case phaseQuarantine:
+			var n int64
+			n, err = eraseQuarantined(ctx, e.TenantID, nil)
+			e.Quarantined += n
+			done = err == nil
+		case phaseIndex:
+			e.IndexErased = deleteTenantDocs(ctx, e.TenantID)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if done {
+			e.Phase, e.Cursor = nextPhase(e.Phase), ""
+		}
+		if err := saveErasure(ctx, *e); err != nil {
+			return false, err
+		}
+	}
+}
+
+func nextPhase(phase string) string {
+	switch phase {
+	case phaseLogs:
+		return phaseJournal
+	case phaseJournal:
+		return phaseVault
+	case phaseVault:
+		return phaseQuarantine
+	default:
+		return phaseIndex
+	}
+}
+
+// recordKey is one log to erase, with the fingerprint its index entries
+// are keyed by
+type recordKey struct {
+	logID   string
+	simhash string
+}
+
+// logAndParts returns the log and the parts submitted under it
+func logAndParts(ctx context.Context, tenantID, logID string) ([]recordKey, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		ProjectionExpression: aws.String("log_id, simhash"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := []recordKey{{logID: logID, simhash: stringAttr(out.Item, "simhash")}}
+
+	p := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String("parent_index"),
+		KeyConditionExpression: aws.String("parent_id = :p"),
+		FilterExpression:       aws.String("tenant_id = :t"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":p": &types.AttributeValueMemberS{Value: logID},
+			":t": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		ProjectionExpression: aws.String("log_id, simhash"),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			keys = append(keys, recordKey{logID: stringAttr(item, "log_id"), simhash: stringAttr(item, "simhash")})
+		}
+	}
+	return keys, nil
+}
+
+// eraseLogPage erases the next page of the tenant's logs and reports
+// whether it was the last
+func eraseLogPage(ctx context.Context, e *erasure) (bool, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("tenant_id = :t"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: e.TenantID},
+		},
+		ProjectionExpression: aws.String("log_id, simhash"),
+		Limit:                aws.Int32(200),
+	}
+	if e.Cursor != "" {
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: e.TenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: e.Cursor},
+		}
+	}
+	out, err := dynamoClient.Query(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	keys := make([]recordKey, 0, len(out.Items))
+	for _, item := range out.Items {
+		keys = append(keys, recordKey{logID: stringAttr(item, "log_id"), simhash: stringAttr(item, "simhash")})
+	}
+	if err := eraseRecords(ctx, e, keys); err != nil {
+		return false, err
+	}
+	if len(keys) > 0 {
+		e.Cursor = keys[len(keys)-1].logID
+	}
+	return out.LastEvaluatedKey == nil, nil
+}
+
+// eraseJournalPage erases the next page of journal entries left for logs
+// that never reached the table
+func eraseJournalPage(ctx context.Context, e *erasure) (bool, error) {
+	if journalTableName == "" {
+		return true, nil
+	}
+	out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(journalTableName),
+		KeyConditionExpression: aws.String("tenant_id = :t"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: e.TenantID},
+		},
+		ProjectionExpression: aws.String("log_id"),
+		Limit:                aws.Int32(500),
+	})
+	if err != nil {
+		return false, err
+	}
+	var requests []types.WriteRequest
+	for _, item := range out.Items {
+		requests = append(requests, deleteRequest(e.TenantID, "log_id", stringAttr(item, "log_id")))
+	}
+	if err := batchDelete(ctx, journalTableName, requests); err != nil {
+		return false, err
+	}
+	// Erased entries are gone, so the next page starts from the top again
+	return out.LastEvaluatedKey == nil, nil
+}
+
+// eraseVaultPage erases the next page of the tenant's token vault entries
+func eraseVaultPage(ctx context.Context, e *erasure) (bool, error) {
+	if tokenVaultTableName == "" {
+		return true, nil
+	}
+	out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(tokenVaultTableName),
+		KeyConditionExpression: aws.String("tenant_id = :t"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: e.TenantID},
+		},
+		ProjectionExpression:     aws.String("#token"),
+		ExpressionAttributeNames: map[string]string{"#token": "token"},
+		Limit:                    aws.Int32(500),
+	})
+	if err != nil {
+		return false, err
+	}
+	var requests []types.WriteRequest
+	for _, item := range out.Items {
+		requests = append(requests, deleteRequest(e.TenantID, "token", stringAttr(item, "token")))
+	}
+	if err := batchDelete(ctx, tokenVaultTableName, requests); err != nil {
+		return false, err
+	}
+	// As for the journal, the next page starts from the top again
+	return out.LastEvaluatedKey == nil, nil
+}
+
+// eraseRecords deletes logs from the table, shadow table, journal and
+// near-duplicate index. Each table's deletes are idempotent, so a retried
+// page erases nothing twice.
+func eraseRecords(ctx context.Context, e *erasure, keys []recordKey) error {
+	var logs, bands []types.WriteRequest
+	for _, k := range keys {
+		logs = append(logs, deleteRequest(e.TenantID, "log_id", k.logID))
+		if fp, err := simhash.Parse(k.simhash); err == nil {
+			for _, band := range simhash.BandKeys(e.TenantID, fp) {
+				bands = append(bands, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+					"band":   &types.AttributeValueMemberS{Value: band},
+					"log_id": &types.AttributeValueMemberS{Value: k.logID},
+				}}})
+			}
+		}
+	}
+	for _, table := range []string{shadowTableName, journalTableName} {
+		if table != "" {
+			if err := batchDelete(ctx, table, logs); err != nil {
+				return err
+			}
+		}
+	}
+	if nearDuplicateTableName != "" {
+		if err := batchDelete(ctx, nearDuplicateTableName, bands); err != nil {
+			return err
+		}
+	}
+	// The log items go last: until they are gone, a retry can still find
+	// what the others were keyed by
+	if err := batchDelete(ctx, tableName, logs); err != nil {
+		return err
+	}
+	e.RecordsErased += int64(len(keys))
+	return nil
+}
+
+// eraseQuarantined deletes the tenant's quarantined messages: all of them,
+// or those of logIDs
+func eraseQuarantined(ctx context.Context, tenantID string, logIDs map[string]bool) (int64, error) {
+	if quarantineTableName == "" {
+		return 0, nil
+	}
+	p := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(quarantineTableName),
+		KeyConditionExpression: aws.String("tenant_id = :t"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		ProjectionExpression: aws.String("message_id, log_id"),
+	})
+	var requests []types.WriteRequest
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, item := range page.Items {
+			if logIDs == nil || logIDs[stringAttr(item, "log_id")] {
+				requests = append(requests, deleteRequest(tenantID, "message_id", stringAttr(item, "message_id")))
+			}
+		}
+	}
+	return int64(len(requests)), batchDelete(ctx, quarantineTableName, requests)
+}
+
+func deleteRequest(tenantID, sortKey, value string) types.WriteRequest {
+	return types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+		"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		sortKey:     &types.AttributeValueMemberS{Value: value},
+	}}}
+}
+
+// batchDelete runs requests against table in batches, retrying unprocessed
+// ones with a short backoff. Unlike the pipeline's best-effort indexes,
+// erasure fails rather than leave anything behind.
+func batchDelete(ctx context.Context, table string, requests []types.WriteRequest) error {
+	for len(requests) > 0 {
+		n := min(len(requests), batchWriteLimit)
+		pending := requests[:n]
+		requests = requests[n:]
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == 5 {
+				return fmt.Errorf("delete from %s: %d items still unprocessed", table, len(pending))
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(100<<attempt) * time.Millisecond)
+			}
+			out, err := dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{table: pending},
+			})
+			if err != nil {
+				return fmt.Errorf("delete from %s: %w", table, err)
+			}
+			pending = out.UnprocessedItems[table]
+		}
+	}
+	return nil
+}
+
+// deleteDocs removes logs' documents from the OpenSearch index in one bulk
+// call, returning how many were deleted, or -1 on failure
+func deleteDocs(ctx context.Context, tenantID string, keys []recordKey) int64 {
+	if searchEndpoint == "" {
+		return 0
+	}
+	var body bytes.Buffer
+	for _, k := range keys {
+		action, _ := json.Marshal(map[string]map[string]string{"delete": {"_index": searchIndex, "_id": tenantID + "#" + k.logID}})
+		body.Write(action)
+		body.WriteByte('\n')
+	}
+	var result struct {
+		Items []map[string]struct {
+			Result string `json:"result"`
+		} `json:"items"`
+	}
+	if err := searchRequest(ctx, "/_bulk", "application/x-ndjson", body.Bytes(), &result); err != nil {
+		slog.Error("Index erasure failed", "tenant_id", tenantID, "error", err)
+		emitMetric("IndexErasureFailures", 1, "Count", nil)
+		return -1
+	}
+	var n int64
+	for _, item := range result.Items {
+		if item["delete"].Result == "deleted" {
+			n++
+		}
+	}
+	return n
+}
+
+// deleteTenantDocs removes every document of the tenant from the index with
+// a delete by query, which serverless collections don't offer: there the
+// erasure reports -1 and the documents must be removed another way
+func deleteTenantDocs(ctx context.Context, tenantID string) int64 {
+	if searchEndpoint == "" {
+		return 0
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{"term": map[string]string{"tenant_id": tenantID}},
+	})
+	var result struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := searchRequest(ctx, "/"+searchIndex+"/_delete_by_query?conflicts=proceed&refresh=true", "application/json", body, &result); err != nil {
+		slog.Error("Index erasure failed", "tenant_id", tenantID, "error", err)
+		emitMetric("IndexErasureFailures", 1, "Count", nil)
+		return -1
+	}
+	return result.Deleted
+}
+
+// searchRequest makes one signed POST to the OpenSearch endpoint
+func searchRequest(ctx context.Context, path, contentType string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, searchEndpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	service := "es"
+	if strings.Contains(searchEndpoint, ".aoss.") {
+		service = "aoss"
+	}
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), service, awsCfg.Region, time.Now()); err != nil {
+		return err
+	}
+	resp, err := searchHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("opensearch %s: status %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func loadErasure(ctx context.Context, tenantID, erasureID string) (erasure, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(erasureTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id":  &types.AttributeValueMemberS{Value: tenantID},
+			"erasure_id": &types.AttributeValueMemberS{Value: erasureID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return erasure{}, err
+	}
+	if out.Item == nil {
+		return erasure{}, fmt.Errorf("erasure %s of %s not found", erasureID, tenantID)
+	}
+	var e erasure
+	err = attributevalue.UnmarshalMap(out.Item, &e)
+	return e, err
+}
+
+func saveErasure(ctx context.Context, e erasure) error {
+	e.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(e)
+	if err != nil {
+		return err
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(erasureTableName), Item: item})
+	if err != nil {
+		return fmt.Errorf("save erasure %s: %w", e.ErasureID, err)
+	}
+	return nil
+}
+
+// handOver checkpoints the erasure and continues it in a fresh asynchronous
+// invocation
+func handOver(ctx context.Context, e erasure) error {
+	if err := saveErasure(ctx, e); err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(invocation{TenantID: e.TenantID, ErasureID: e.ErasureID})
+	_, err := lambdaClient.Invoke(ctx, &lambdasvc.InvokeInput{
+		FunctionName:   aws.String(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("continue erasure %s: %w", e.ErasureID, err)
+	}
+	slog.Info("Erasure continuing", "tenant_id", e.TenantID, "erasure_id", e.ErasureID, "phase", e.Phase, "records_erased", e.RecordsErased)
+	return nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
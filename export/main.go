@@ -0,0 +1,411 @@
+// Export writes all of a tenant's processed logs to EXPORT_BUCKET as a set
+// of parts and a manifest, so a client downloads a large export in parallel
+// and resumes it part by part instead of fetching one object of gigabytes.
+// The read API records each request in EXPORT_TABLE_NAME and invokes this
+// Lambda asynchronously with {"tenant_id": "...", "export_id": "..."}; the
+// item is both the export's status and the job's checkpoint.
+//
+// Logs are read in log_id order and written, in the read API's redacted
+// view (never original_text), as gzipped NDJSON parts of about
+// EXPORT_PART_BYTES (default 64 MiB) before compression, under
+// <tenant_id>/<export_id>/part-NNNNN.ndjson.gz. Each finished part is added
+// to the item with its record count, size and SHA-256, and the checkpoint
+// moves past it, so a retry or a fresh invocation near the deadline
+// rewrites at most the part in progress, under the same key. Once every log
+// is written, manifest.json lists the parts and the export is DONE. QUEUED
+// stubs and deleted logs are left out.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/logscrub"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const metricNamespace = "RobustProcessor"
+
+// headroom is left before the deadline to finish a part and hand over
+const headroom = time.Minute
+
+// Export statuses, as stored and as GET /exports/{export_id} reports them
+const (
+	statusPending = "PENDING"
+	statusRunning = "RUNNING"
+	statusDone    = "DONE"
+	statusFailed  = "FAILED"
+)
+
+// exportProjection is the redacted view of a log the read API serves, plus
+// deleted_at to leave deleted logs out
+const exportProjection = "tenant_id, log_id, #source, parent_id, batch_id, #status, queued_at, processed_at, modified_data, encryption, policy_version, failed_at, failure_code, simhash, deleted_at"
+
+var (
+	dynamoClient    *dynamodb.Client
+	lambdaClient    *lambdasvc.Client
+	s3Client        *s3.Client
+	exportTableName string
+	tableName       string
+	exportBucket    string
+	// partBytes is the uncompressed size a part is closed at
+	// (EXPORT_PART_BYTES, default 64 MiB)
+	partBytes = 64 << 20
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	lambdaClient = lambdasvc.NewFromConfig(cfg)
+	s3Client = s3.NewFromConfig(cfg)
+	exportTableName = os.Getenv("EXPORT_TABLE_NAME")
+	tableName = os.Getenv("TABLE_NAME")
+	exportBucket = os.Getenv("EXPORT_BUCKET")
+	if n, err := strconv.Atoi(os.Getenv("EXPORT_PART_BYTES")); err == nil && n > 0 {
+		partBytes = n
+	}
+}
+
+// part is one finished object of an export
+type part struct {
+	Number  int    `dynamodbav:"number" json:"part"`
+	Key     string `dynamodbav:"key" json:"key"`
+	Records int64  `dynamodbav:"records" json:"records"`
+	// Bytes and SHA256 are of the object as stored, compressed
+	Bytes  int64  `dynamodbav:"bytes" json:"bytes"`
+	SHA256 string `dynamodbav:"sha256" json:"sha256"`
+	// FirstLogID and LastLogID bound the logs in the part
+	FirstLogID string `dynamodbav:"first_log_id" json:"first_log_id"`
+	LastLogID  string `dynamodbav:"last_log_id" json:"last_log_id"`
+}
+
+// export is an EXPORT_TABLE_NAME item: one request and its progress
+type export struct {
+	TenantID      string `dynamodbav:"tenant_id" json:"tenant_id"`
+	ExportID      string `dynamodbav:"export_id" json:"export_id"`
+	RequestedAt   string `dynamodbav:"requested_at" json:"requested_at"`
+	RequestedFrom string `dynamodbav:"requested_from,omitempty" json:"requested_from,omitempty"`
+	Status        string `dynamodbav:"status" json:"status"`
+	// Cursor is the last log_id covered by a finished part
+	Cursor          string `dynamodbav:"cursor,omitempty" json:"-"`
+	Parts           []part `dynamodbav:"parts" json:"parts"`
+	RecordsExported int64  `dynamodbav:"records_exported" json:"records_exported"`
+	ManifestKey     string `dynamodbav:"manifest_key,omitempty" json:"manifest_key,omitempty"`
+	CompletedAt     string `dynamodbav:"completed_at,omitempty" json:"completed_at,omitempty"`
+	FailureReason   string `dynamodbav:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	UpdatedAt       string `dynamodbav:"updated_at" json:"updated_at"`
+	// ExpiresAt lets the table's TTL drop the item with the bucket's objects
+	ExpiresAt int64 `dynamodbav:"expires_at,omitempty" json:"-"`
+}
+
+// manifest is manifest.json: everything needed to fetch and check the parts
+type manifest struct {
+	TenantID    string `json:"tenant_id"`
+	ExportID    string `json:"export_id"`
+	RequestedAt string `json:"requested_at"`
+	CompletedAt string `json:"completed_at"`
+	Format      string `json:"format"`
+	Records     int64  `json:"records"`
+	Parts       []part `json:"parts"`
+}
+
+// invocation is what the read API (or a hand-over) invokes this Lambda with
+type invocation struct {
+	TenantID string `json:"tenant_id"`
+	ExportID string `json:"export_id"`
+}
+
+func handler(ctx context.Context, inv invocation) error {
+	if inv.TenantID == "" || inv.ExportID == "" {
+		return errors.New("tenant_id and export_id are required")
+	}
+	e, err := loadExport(ctx, inv.TenantID, inv.ExportID)
+	if err != nil {
+		return err
+	}
+	if e.Status == statusDone || e.Status == statusFailed {
+		return nil
+	}
+	e.Status = statusRunning
+	handedOver, err := run(ctx, &e)
+	if handedOver {
+		return err
+	}
+	if err != nil {
+		// Saved progress lets Lambda's retry, or a manual re-invocation,
+		// resume after the last finished part
+		_ = saveExport(ctx, e)
+		emitMetric("ExportErrors", 1, "Count", nil)
+		return err
+	}
+	if err := writeManifest(ctx, &e); err != nil {
+		_ = saveExport(ctx, e)
+		emitMetric("ExportErrors", 1, "Count", nil)
+		return err
+	}
+	e.Status = statusDone
+	slog.Info("Export complete", "tenant_id", e.TenantID, "export_id", e.ExportID,
+		"records", e.RecordsExported, "parts", len(e.Parts))
+	emitMetric("RecordsExported", float64(e.RecordsExported), "Count", nil)
+	return saveExport(ctx, e)
+}
+
+// partWriter gathers the next part of an export
+type partWriter struct {
+	body    bytes.Buffer
+	zw      *gzip.Writer
+	raw     int
+	records int64
+	first   string
+	// last is the last log_id read, written or not: the checkpoint the part
+	// moves the export to
+	last string
+}
+
+func newPartWriter() *partWriter {
+	w := &partWriter{}
+	w.zw = gzip.NewWriter(&w.body)
+	return w
+}
+
+func (w *partWriter) add(logID string, line []byte) {
+	if w.records == 0 {
+		w.first = logID
+	}
+	w.zw.Write(line)
+	w.zw.Write([]byte{'\n'})
+	w.raw += len(line) + 1
+	w.records++
+}
+
+// run pages through the tenant's logs, closing a part whenever it reaches
+// partBytes and handing over to a fresh invocation near the deadline. It
+// reports whether it handed over.
+func run(ctx context.Context, e *export) (bool, error) {
+	w := newPartWriter()
+	w.last = e.Cursor
+	for {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < headroom {
+			if err := finishPart(ctx, e, w); err != nil {
+				return false, err
+			}
+			return true, handOver(ctx, *e)
+		}
+		input := &dynamodb.QueryInput{
+			TableName:                aws.String(tableName),
+			KeyConditionExpression:   aws.String("tenant_id = :t"),
+			ProjectionExpression:     aws.String(exportProjection),
+			ExpressionAttributeNames: map[string]string{"#source": "source", "#status": "status"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":t": &types.AttributeValueMemberS{Value: e.TenantID},
+			},
+			Limit: aws.Int32(500),
+		}
+		if w.last != "" {
+			input.ExclusiveStartKey = map[string]types.AttributeValue{
+				"tenant_id": &types.AttributeValueMemberS{Value: e.TenantID},
+				"log_id":    &types.AttributeValueMemberS{Value: w.last},
+			}
+		}
+		out, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return false, err
+		}
+		for _, item := range out.Items {
+			logID := stringAttr(item, "log_id")
+			w.last = logID
+			if item["deleted_at"] != nil || stringAttr(item, "status") == "QUEUED" {
+				continue
+			}
+			delete(item, "deleted_at")
+			var doc map[string]interface{}
+			if err := attributevalue.UnmarshalMap(item, &doc); err != nil {
+				return false, fmt.Errorf("decode %s: %w", logID, err)
+			}
+			line, err := json.Marshal(doc)
+			if err != nil {
+				return false, fmt.Errorf("encode %s: %w", logID, err)
+			}
+			w.add(logID, line)
+			if w.raw >= partBytes {
+				if err := finishPart(ctx, e, w); err != nil {
+					return false, err
+				}
+				w = newPartWriter()
+				w.last = logID
+			}
+		}
+		if out.LastEvaluatedKey == nil {
+			return false, finishPart(ctx, e, w)
+		}
+	}
+}
+
+// finishPart uploads the part in progress, if it holds any records, and
+// checkpoints the export past everything it read
+func finishPart(ctx context.Context, e *export, w *partWriter) error {
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	if w.records > 0 {
+		number := len(e.Parts) + 1
+		key := fmt.Sprintf("%s/%s/part-%05d.ndjson.gz", e.TenantID, e.ExportID, number)
+		digest := sha256.Sum256(w.body.Bytes())
+		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:          aws.String(exportBucket),
+			Key:             aws.String(key),
+			Body:            bytes.NewReader(w.body.Bytes()),
+			ContentType:     aws.String("application/x-ndjson"),
+			ContentEncoding: aws.String("gzip"),
+		})
+		if err != nil {
+			return fmt.Errorf("write part %d of export %s: %w", number, e.ExportID, err)
+		}
+		e.Parts = append(e.Parts, part{
+			Number:     number,
+			Key:        key,
+			Records:    w.records,
+			Bytes:      int64(w.body.Len()),
+			SHA256:     hex.EncodeToString(digest[:]),
+			FirstLogID: w.first,
+			LastLogID:  w.last,
+		})
+		e.RecordsExported += w.records
+		emitMetric("ExportPartsWritten", 1, "Count", nil)
+	}
+	e.Cursor = w.last
+	return saveExport(ctx, *e)
+}
+
+// writeManifest writes manifest.json, the last object of an export
+func writeManifest(ctx context.Context, e *export) error {
+	e.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	parts := e.Parts
+	if parts == nil {
+		parts = []part{}
+	}
+	body, _ := json.MarshalIndent(manifest{
+		TenantID:    e.TenantID,
+		ExportID:    e.ExportID,
+		RequestedAt: e.RequestedAt,
+		CompletedAt: e.CompletedAt,
+		Format:      "ndjson+gzip",
+		Records:     e.RecordsExported,
+		Parts:       parts,
+	}, "", "  ")
+	key := fmt.Sprintf("%s/%s/manifest.json", e.TenantID, e.ExportID)
+	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(exportBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("write manifest of export %s: %w", e.ExportID, err)
+	}
+	e.ManifestKey = key
+	return nil
+}
+
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func loadExport(ctx context.Context, tenantID, exportID string) (export, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(exportTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"export_id": &types.AttributeValueMemberS{Value: exportID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return export{}, err
+	}
+	if out.Item == nil {
+		return export{}, fmt.Errorf("export %s of %s not found", exportID, tenantID)
+	}
+	var e export
+	err = attributevalue.UnmarshalMap(out.Item, &e)
+	return e, err
+}
+
+func saveExport(ctx context.Context, e export) error {
+	e.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(e)
+	if err != nil {
+		return err
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(exportTableName), Item: item})
+	if err != nil {
+		return fmt.Errorf("save export %s: %w", e.ExportID, err)
+	}
+	return nil
+}
+
+// handOver continues the export, already checkpointed, in a fresh
+// asynchronous invocation
+func handOver(ctx context.Context, e export) error {
+	payload, _ := json.Marshal(invocation{TenantID: e.TenantID, ExportID: e.ExportID})
+	_, err := lambdaClient.Invoke(ctx, &lambdasvc.InvokeInput{
+		FunctionName:   aws.String(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("continue export %s: %w", e.ExportID, err)
+	}
+	slog.Info("Export continuing", "tenant_id", e.TenantID, "export_id", e.ExportID, "parts", len(e.Parts), "records", e.RecordsExported)
+	return nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
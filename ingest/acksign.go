@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Acknowledgement signing: for tenants whose policy sets sign_responses,
+// every 202 carries X-JWS-Signature, a JWS with a detached payload (RFC 7515
+// appendix F) over the response body as sent, signed ES256 with the KMS key
+// ACK_SIGNING_KEY_ID. The protected header names the key (kid) and the time
+// of signing (iat), so an archived acknowledgement proves that the service
+// issued it, and when. Signing runs after the records are queued: a failure
+// leaves the 202 unsigned rather than failing a request that succeeded.
+var (
+	ackKeyID  string
+	kmsClient *kms.Client
+)
+
+const ackSignatureHeader = "X-JWS-Signature"
+
+// signedAck wraps a route so that its 202 responses are signed for the
+// tenants that ask for it
+func signedAck(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		resp, err := next(ctx, request)
+		if err != nil || resp.StatusCode != 202 || ackKeyID == "" {
+			return resp, err
+		}
+		tenantID := ackTenant(ctx, request, resp.Body)
+		if tenantID == "" || !lookupSettings(ctx, tenantID).SignResponses {
+			return resp, nil
+		}
+
+		signCtx, cancel := stage(ctx, "sign")
+		defer cancel()
+		signature, err := signDetached(signCtx, []byte(resp.Body))
+		if err != nil {
+			slog.Error("Failed to sign acknowledgement", "tenant_id", tenantID, "error", err)
+			emitMetric("AckSigningFailures", 1, "Count", nil)
+			return resp, nil
+		}
+		if resp.Headers == nil {
+			resp.Headers = map[string]string{}
+		}
+		resp.Headers[ackSignatureHeader] = signature
+		return resp, nil
+	}
+}
+
+// ackTenant is the tenant an acknowledgement is for: the authenticated
+// tenant, else X-Tenant-ID, else the response's tenant_id
+func ackTenant(ctx context.Context, request events.APIGatewayV2HTTPRequest, body string) string {
+	if tenantID, _ := ctx.Value(authTenantKey{}).(string); tenantID != "" {
+		return tenantID
+	}
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, "x-tenant-id") && v != "" {
+			return v
+		}
+	}
+	var ack struct {
+		TenantID string `json:"tenant_id"`
+	}
+	_ = json.Unmarshal([]byte(body), &ack)
+	return ack.TenantID
+}
+
+// signDetached returns the compact JWS of payload with the payload left
+// out: <protected header>..<signature>. KMS signs the SHA-256 digest of the
+// signing input, since RAW messages are capped at 4 KiB.
+func signDetached(ctx context.Context, payload []byte) (string, error) {
+	header, _ := json.Marshal(map[string]interface{}{
+		"alg": "ES256",
+		"kid": ackKeyID,
+		"iat": time.Now().Unix(),
+	})
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	digest := sha256.Sum256([]byte(protected + "." + base64.RawURLEncoding.EncodeToString(payload)))
+	out, err := kmsClient.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(ackKeyID),
+		Message:          digest[:],
+		MessageType:      kmstypes.MessageTypeDigest,
+		SigningAlgorithm: kmstypes.SigningAlgorithmSpecEcdsaSha256,
+	})
+	if err != nil {
+		return "", err
+	}
+	signature, err := joseSignature(out.Signature)
+	if err != nil {
+		return "", err
+	}
+	return protected + ".." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// joseSignature converts KMS's DER-encoded ECDSA signature to the fixed
+// R||S form JWS requires for ES256
+func joseSignature(der []byte) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("decode signature: %w", err)
+	}
+	raw := make([]byte, 64)
+	sig.R.FillBytes(raw[:32])
+	sig.S.FillBytes(raw[32:])
+	return raw, nil
+}
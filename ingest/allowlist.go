@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"strings"
+)
+
+// sourceIPKey carries the caller's address, API Gateway's sourceIp, in a
+// request's context
+type sourceIPKey struct{}
+
+// allowedSource reports whether the request's source address may submit
+// records for the tenant. A tenant's allowed_ips lists addresses and CIDR
+// blocks ("203.0.113.7", "198.51.100.0/24", "2001:db8::/32"); without one
+// every address is allowed. Entries that don't parse match nothing, so a
+// mistyped list refuses traffic rather than admitting it.
+func allowedSource(ctx context.Context, tenantID string) bool {
+	settingsCtx, cancel := stage(ctx, "policy")
+	defer cancel()
+	allowed := lookupSettings(settingsCtx, tenantID).AllowedIPs
+	if len(allowed) == 0 {
+		return true
+	}
+	source, _ := ctx.Value(sourceIPKey{}).(string)
+	addr, err := netip.ParseAddr(source)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if a, err := netip.ParseAddr(entry); err == nil && a.Unmap() == addr {
+			return true
+		} else {
+			slog.Warn("Invalid allowed_ips entry", "tenant_id", tenantID, "entry", entry)
+		}
+	}
+	return false
+}
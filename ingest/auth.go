@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"robust-processor/internal/apikey"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// apiKeys verifies X-Api-Key and X-Signature against per-tenant credentials
+// in Secrets Manager; nil, and authentication off, unless
+// API_KEY_SECRET_PREFIX is set
+var apiKeys *apikey.Store
+
+// authTenantKey carries the authenticated tenant in a request's context,
+// and wireBodyKey the body as sent, for request signatures
+type (
+	authTenantKey struct{}
+	wireBodyKey   struct{}
+)
+
+// authenticated wraps a route so that it only runs for callers proving they
+// act for the tenant named by X-Tenant-ID, with either an X-Signature over
+// the body or a valid X-Api-Key: 401 otherwise. The route then only accepts
+// records of that tenant (see authorizeTenant). A key the tenant listed as
+// compromised is refused like an invalid one, or with mode "honeypot" given
+// a decoy acceptance (see honeypotResponse). Callers that keep failing are locked
+// out for a while (see lockedOut). Without API_KEY_SECRET_PREFIX nothing is
+// checked, but a signed request is refused rather than accepted unverified.
+func authenticated(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		var tenantID, key, signature string
+		for k, v := range request.Headers {
+			switch strings.ToLower(k) {
+			case "x-tenant-id":
+				tenantID = v
+			case "x-api-key":
+				key = v
+			case "x-signature":
+				signature = v
+			}
+		}
+		if apiKeys == nil && signature == "" {
+			return next(ctx, request)
+		}
+		if apiKeys == nil {
+			return errorResponse(401, "Request signing is not enabled"), nil
+		}
+		if tenantID == "" || (key == "" && signature == "") {
+			emitMetric("AuthRejected", 1, "Count", map[string]string{"reason": "missing_credentials"})
+			return errorResponse(401, "X-Tenant-ID and X-Api-Key or X-Signature are required"), nil
+		}
+
+		// A signed request's key, if any, goes unused and isn't counted
+		sourceIP, tried := request.RequestContext.HTTP.SourceIP, key
+		if signature != "" {
+			tried = ""
+		}
+		subjects := lockoutSubjects(sourceIP, tried)
+		if wait := lockedOut(ctx, subjects); wait > 0 {
+			emitMetric("AuthRejected", 1, "Count", map[string]string{"reason": "locked_out"})
+			resp := errorResponse(429, "Too many failed authentication attempts")
+			resp.Headers = map[string]string{"Retry-After": retryAfterSeconds(wait)}
+			return resp, nil
+		}
+
+		authCtx, cancel := stage(ctx, "auth")
+		defer cancel()
+		var ok bool
+		var err error
+		reason, msg := "invalid_key", "Invalid API key"
+		if signature != "" {
+			// A signed request needs no key: the signature proves the sender
+			wire, _ := ctx.Value(wireBodyKey{}).(string)
+			ok, err = apiKeys.VerifySignature(authCtx, tenantID, []byte(wire), signature)
+			reason, msg = "invalid_signature", "Invalid signature"
+		} else {
+			var verdict apikey.Verdict
+			verdict, err = apiKeys.Classify(authCtx, tenantID, key)
+			switch verdict {
+			case apikey.Valid:
+				ok = true
+			case apikey.Revoked:
+				reason = "compromised_key"
+			case apikey.Honeypot:
+				return honeypotResponse(ctx, request, tenantID, key), nil
+			}
+		}
+		if err != nil {
+			if expired(authCtx) {
+				return budgetResponse("auth", nil), nil
+			}
+			slog.Error("Credential lookup failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error"), nil
+		}
+		if !ok {
+			emitMetric("AuthRejected", 1, "Count", map[string]string{"reason": reason})
+			slog.Warn("Authentication failed", "tenant_id", tenantID, "reason", reason)
+			recordAuthFailure(ctx, subjects, tenantID, sourceIP, tried)
+			return errorResponse(401, msg), nil
+		}
+		return next(context.WithValue(ctx, authTenantKey{}, tenantID), request)
+	}
+}
+
+// authorizeTenant rejects a record of any tenant but the authenticated one,
+// so a key only ever submits on behalf of its own tenant, and a record of a
+// tenant whose allowed_ips exclude the caller's address
+func authorizeTenant(ctx context.Context, tenantID string) error {
+	if authTenant, ok := ctx.Value(authTenantKey{}).(string); ok && tenantID != authTenant {
+		return clientError("tenant_id does not match the API key's tenant")
+	}
+	if !allowedSource(ctx, tenantID) {
+		emitMetric("SourceIPRejected", 1, "Count", map[string]string{"tenant_id": tenantID})
+		slog.Warn("Source address not allowed", "tenant_id", tenantID)
+		return clientError("Source address is not allowed for this tenant")
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"robust-processor/internal/prefilter"
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	// maxBatchRecords bounds the records accepted in one batch request
+	maxBatchRecords = 500
+	// sendBatchLimit and sendBatchBytes are SQS's SendMessageBatch limits
+	sendBatchLimit = 10
+	sendBatchBytes = 256 * 1024
+)
+
+// Item statuses: rejected items are invalid and must be fixed before they
+// are resent; failed items were valid and may be retried as they are
+const (
+	itemAccepted = "accepted"
+	itemRejected = "rejected"
+	itemFailed   = "failed"
+)
+
+// batchItem is the outcome of one record of a batch, in request order
+type batchItem struct {
+	Index    int    `json:"index"`
+	Line     int    `json:"line,omitempty"`
+	Status   string `json:"status"`
+	LogID    string `json:"log_id,omitempty"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// handleBatch accepts a JSON array of records in the native JSON upload
+// shape. Each record is validated and published independently, so one bad
+// record doesn't fail the rest: the response is 202 when all were accepted
+// and 207 otherwise, with a status per record. X-Schema applies to every
+// record. Multi-part records are not accepted in batches.
+func handleBatch(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	headers := make(map[string]string)
+	for k, v := range request.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	if r := prefilterConfig.Check(headers, request.Body); r != nil {
+		prefilter.Record(r, "handler")
+		return errorResponse(r.Status, r.Message), nil
+	}
+	body, err := batchBody(headers["content-type"], request.Body)
+	if err != nil {
+		status := 400
+		var merr mediaError
+		if errors.As(err, &merr) {
+			status = merr.status
+		}
+		return errorResponse(status, err.Error()), nil
+	}
+
+	var records []json.RawMessage
+	err = jsonArrayRecords(strings.NewReader(body), func(i int, raw json.RawMessage) error {
+		if i == maxBatchRecords {
+			return errTooManyRecords
+		}
+		records = append(records, raw)
+		return nil
+	})
+	if err != nil {
+		return streamErrorResponse(err, "Body must be a JSON array of records"), nil
+	}
+	if len(records) == 0 {
+		return errorResponse(400, "Empty batch"), nil
+	}
+
+	items, batch, payloads := prepareItems(ctx, headers, records)
+	sizes := make([]int, len(records))
+	for i, raw := range records {
+		sizes[i] = len(raw)
+	}
+	status, response := submitBatch(ctx, items, batch, payloads, sizes)
+	return batchResponse(status, response), nil
+}
+
+// prepareItems validates each record of a batch and encodes the valid ones.
+// Items of invalid records are rejected, or failed when the record could
+// not be checked; the rest are left without a status for submitBatch.
+func prepareItems(ctx context.Context, headers map[string]string, records []json.RawMessage) ([]batchItem, []LogEvent, []string) {
+	items := make([]batchItem, len(records))
+	batch := make([]LogEvent, len(records))
+	payloads := make([]string, len(records))
+	for i, raw := range records {
+		items[i] = batchItem{Index: i}
+		event, err := prepareRecord(ctx, headers, raw)
+		items[i].LogID, items[i].TenantID = event.LogID, event.TenantID
+		if err != nil {
+			var cerr clientError
+			if errors.As(err, &cerr) {
+				items[i].Status, items[i].Error = itemRejected, cerr.Error()
+				continue
+			}
+			items[i].Status, items[i].Error = itemFailed, "Internal server error"
+			if ctx.Err() != nil {
+				items[i].Error = "Request deadline exceeded"
+				continue
+			}
+			slog.Error("Batch record failed", "tenant_id", event.TenantID, "index", i, "error", err)
+			continue
+		}
+		// The contract the worker will check the message against
+		payload, _ := json.Marshal(event.LogEvent)
+		if err := model.Validate(payload); err != nil {
+			items[i].Status, items[i].Error = itemRejected, err.Error()
+			continue
+		}
+		batch[i], payloads[i] = event, string(payload)
+	}
+	return items, batch, payloads
+}
+
+// submitBatch rate-limits, journals, stubs, publishes and meters the batch
+// items that have no status yet, sizes being each record's request bytes,
+// and returns the response status and body: 202 when every item was
+// accepted, 429 when none was and a tenant was over its limit, else 207
+func submitBatch(ctx context.Context, items []batchItem, batch []LogEvent, payloads []string, sizes []int) (int, map[string]interface{}) {
+	// Each tenant in the batch is charged one request and its records' bytes;
+	// a tenant over its limit has its items failed, to be retried later
+	tenantBytes := map[string]int{}
+	var tenants []string
+	for i, item := range items {
+		if item.Status == "" {
+			if _, ok := tenantBytes[batch[i].TenantID]; !ok {
+				tenants = append(tenants, batch[i].TenantID)
+			}
+			tenantBytes[batch[i].TenantID] += sizes[i]
+		}
+	}
+	var retryAfter time.Duration
+	for _, tenantID := range tenants {
+		var limit limitError
+		if err := admit(ctx, tenantID, tenantBytes[tenantID]); !errors.As(err, &limit) {
+			continue
+		}
+		retryAfter = max(retryAfter, limit.retryAfter)
+		for i := range items {
+			if items[i].Status == "" && batch[i].TenantID == tenantID {
+				items[i].Status, items[i].Error = itemFailed, limit.msg
+			}
+		}
+	}
+
+	var valid []LogEvent
+	for i, item := range items {
+		if item.Status == "" {
+			valid = append(valid, batch[i])
+		}
+	}
+	// Records the journal could not take are not published
+	journalCtx, cancelJournal := stage(ctx, "journal")
+	defer cancelJournal()
+	if failed := writeJournal(journalCtx, valid); len(failed) > 0 {
+		msg := "Internal server error"
+		if expired(journalCtx) {
+			msg = "Request deadline exceeded"
+			emitMetric("RequestBudgetExceeded", 1, "Count", map[string]string{"stage": "journal"})
+		}
+		valid = valid[:0]
+		for i := range items {
+			if items[i].Status != "" {
+				continue
+			}
+			if failed[batch[i].TenantID+"#"+batch[i].LogID] {
+				items[i].Status, items[i].Error = itemFailed, msg
+				continue
+			}
+			valid = append(valid, batch[i])
+		}
+	}
+	queuedCtx, cancelQueued := stage(ctx, "queued")
+	defer cancelQueued()
+	writeQueued(queuedCtx, valid)
+
+	publishCtx, cancel := stage(ctx, "publish")
+	defer cancel()
+	publishBatch(publishCtx, batch, payloads, items)
+
+	// Usage is metered once per tenant and cost tags
+	type usageKey struct {
+		tenantID string
+		tags     model.CostTags
+	}
+	var accepted []LogEvent
+	usage := map[usageKey][2]int{}
+	counts := map[string]int{}
+	for i, item := range items {
+		counts[item.Status]++
+		if item.Status == itemAccepted {
+			accepted = append(accepted, batch[i])
+			k := usageKey{item.TenantID, batch[i].CostTags}
+			usage[k] = [2]int{usage[k][0] + 1, usage[k][1] + sizes[i]}
+		}
+	}
+	mirror(publishCtx, accepted)
+	meterCtx, cancelMeter := stage(ctx, "meter")
+	defer cancelMeter()
+	for k, u := range usage {
+		meter(meterCtx, k.tenantID, k.tags, u[0], u[1])
+	}
+
+	status := 202
+	if counts[itemAccepted] < len(items) {
+		status = 207
+	}
+	response := map[string]interface{}{
+		"accepted": counts[itemAccepted],
+		"rejected": counts[itemRejected],
+		"failed":   counts[itemFailed],
+		"items":    items,
+	}
+	if retryAfter > 0 {
+		response["retry_after"] = retryAfterSeconds(retryAfter)
+		if counts[itemAccepted] == 0 {
+			status = 429
+		}
+	}
+	return status, response
+}
+
+// batchBody checks that a batch is JSON and returns it as UTF-8
+func batchBody(contentType, body string) (string, error) {
+	mediaType, _, err := parseContentType(contentType)
+	if err != nil {
+		return "", err
+	}
+	if base, _ := suffixBase(mediaType); mediaType != "application/json" && base != "application/json" {
+		return "", mediaError{415, "Batches must be application/json"}
+	}
+	return decodeCharset(contentType, body)
+}
+
+// prepareRecord validates one batch record and assigns its log_id. The
+// record's tenant and log_id are returned even when it is invalid, so the
+// item can be correlated. Invalid records are clientErrors.
+func prepareRecord(ctx context.Context, headers map[string]string, raw json.RawMessage) (LogEvent, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return LogEvent{}, clientError("Record must be a JSON object")
+	}
+	event := decodeJSONEvent(m)
+	event.TenantID, _ = m["tenant_id"].(string)
+	event.Source = jsonNormalizer{}.Source()
+	if _, ok := m["parts"]; ok {
+		return event, clientError("Parts are not supported in batches")
+	}
+	if event.TenantID == "" {
+		return event, clientError("Missing tenant_id")
+	}
+	if err := authorizeTenant(ctx, event.TenantID); err != nil {
+		return event, err
+	}
+	if event.OriginalText == "" {
+		return event, clientError("Missing text content")
+	}
+	if err := checkEncryption(headers, &event); err != nil {
+		return event, err
+	}
+	if err := checkPriority(headers, &event); err != nil {
+		return event, err
+	}
+	tags, err := costTagsFor(ctx, headers, event.TenantID)
+	if err != nil {
+		return event, err
+	}
+	event.CostTags = tags
+	if event.LogID == "" {
+		event.LogID = newLogID(event, eventTime(headers, event))
+	}
+	if ref := headers["x-schema"]; ref != "" {
+		schemaCtx, cancel := stage(ctx, "schema")
+		defer cancel()
+		if err := validateSchema(schemaCtx, &event, ref); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+// publishBatch sends the valid events with SendMessageBatch, grouped by
+// queue and chunked to SQS's limits, and records each outcome in items.
+// Only items without a status yet are sent; large events are claim-checked.
+func publishBatch(ctx context.Context, batch []LogEvent, payloads []string, items []batchItem) {
+	byQueue := map[string][]int{}
+	var queues []string
+	for i := range items {
+		if items[i].Status != "" {
+			continue
+		}
+		q := queueFor(batch[i].LogEvent)
+		if _, ok := byQueue[q]; !ok {
+			queues = append(queues, q)
+		}
+		byQueue[q] = append(byQueue[q], i)
+	}
+
+	for _, q := range queues {
+		var chunk []types.SendMessageBatchRequestEntry
+		size := 0
+		send := func() {
+			if len(chunk) > 0 {
+				sendChunk(ctx, q, chunk, items)
+			}
+			chunk, size = nil, 0
+		}
+		for _, i := range byQueue[q] {
+			body, err := claimCheck(ctx, batch[i].LogEvent, payloads[i])
+			if errors.Is(err, errMessageTooLarge) {
+				items[i].Status, items[i].Error = itemRejected, "Record too large to queue"
+				continue
+			}
+			if err != nil {
+				slog.Error("Claim check failed", "tenant_id", batch[i].TenantID, "index", i, "error", err)
+				items[i].Status, items[i].Error = itemFailed, "Internal server error"
+				continue
+			}
+			payloads[i] = body
+			attrs := messageAttributes(batch[i].LogEvent, payloads[i], batch[i].CostTags)
+			n := len(payloads[i]) + attributeBytes(attrs)
+			if len(chunk) == sendBatchLimit || size+n > sendBatchBytes {
+				send()
+			}
+			group, dedup := model.FIFOParams(q, batch[i].TenantID, batch[i].LogID)
+			chunk = append(chunk, types.SendMessageBatchRequestEntry{
+				Id:                     aws.String(strconv.Itoa(i)),
+				MessageBody:            aws.String(payloads[i]),
+				MessageAttributes:      attrs,
+				MessageGroupId:         group,
+				MessageDeduplicationId: dedup,
+			})
+			size += n
+		}
+		send()
+	}
+}
+
+// sendChunk publishes at most sendBatchLimit entries. Entry ids are item
+// indexes. A failed call fails every entry; otherwise entries fail
+// individually.
+func sendChunk(ctx context.Context, queue string, chunk []types.SendMessageBatchRequestEntry, items []batchItem) {
+	index := func(id *string) int {
+		i, _ := strconv.Atoi(aws.ToString(id))
+		return i
+	}
+	out, err := sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(queue),
+		Entries:  chunk,
+	})
+	if err != nil {
+		msg := "Internal server error"
+		if expired(ctx) {
+			msg = "Request deadline exceeded"
+			emitMetric("RequestBudgetExceeded", 1, "Count", map[string]string{"stage": "publish"})
+		} else {
+			slog.Error("Failed to enqueue batch", "entries", len(chunk), "error", err)
+		}
+		for _, e := range chunk {
+			items[index(e.Id)].Status, items[index(e.Id)].Error = itemFailed, msg
+		}
+		return
+	}
+	for _, f := range out.Failed {
+		slog.Warn("Batch entry failed", "code", aws.ToString(f.Code), "sender_fault", f.SenderFault)
+		items[index(f.Id)].Status, items[index(f.Id)].Error = itemFailed, aws.ToString(f.Message)
+	}
+	for _, e := range chunk {
+		if item := &items[index(e.Id)]; item.Status == "" {
+			item.Status = itemAccepted
+			recordPublished(len(aws.ToString(e.MessageBody)))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// requestBudget bounds a whole request (REQUEST_BUDGET, default 3s) so a slow
+// dependency yields a 504 from us, naming the stage, rather than an opaque
+// API Gateway timeout
+var requestBudget = 3 * time.Second
+
+// stageLimits cap each I/O stage within the budget, so one slow call can't
+// consume what the stages after it need
+var stageLimits = map[string]time.Duration{
+	"auth":    time.Second,
+	"schema":  time.Second,
+	"policy":  time.Second,
+	"journal": 500 * time.Millisecond,
+	"queued":  500 * time.Millisecond,
+	"publish": 2 * time.Second,
+	"meter":   300 * time.Millisecond,
+	"limit":   300 * time.Millisecond,
+	"eta":     200 * time.Millisecond,
+	"sign":    500 * time.Millisecond,
+}
+
+// stage derives the context for one stage: its own limit, further capped by
+// whatever is left of the request budget
+func stage(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, stageLimits[name])
+}
+
+// expired reports whether ctx ran out of time, as opposed to an error of
+// the call made under it
+func expired(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// budgetResponse is the 504 for a request that ran out of time in stage.
+// queued lists the log_ids already published, so a caller retrying a
+// multi-part record can tell which parts made it.
+func budgetResponse(stage string, queued []string) events.APIGatewayV2HTTPResponse {
+	emitMetric("RequestBudgetExceeded", 1, "Count", map[string]string{"stage": stage})
+	body := map[string]interface{}{
+		"error":     "Request deadline exceeded",
+		"stage":     stage,
+		"budget_ms": requestBudget.Milliseconds(),
+	}
+	if len(queued) > 0 {
+		body["queued"] = queued
+	}
+	return jsonResponse(504, body)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"robust-processor/internal/integrity"
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Claim check: SQS refuses messages over 256 KiB, attributes included. An
+// event whose encoding is larger than claimCheckThreshold has its original
+// text stored in CLAIM_CHECK_BUCKET under claims/<tenant_id>/<log_id>, and
+// is published with s3_bucket, s3_key and the text's SHA-256 in its place;
+// the worker reads the text back before processing. Objects expire through
+// the bucket's lifecycle rule, later than the queues' retention, so that
+// redelivered and redriven messages still find them.
+var (
+	s3Client         *s3.Client
+	claimCheckBucket string
+	// claimCheckThreshold leaves room under the SQS limit for attributes
+	claimCheckThreshold = 240 << 10
+)
+
+// errMessageTooLarge is an event that can't be queued, even claim-checked
+var errMessageTooLarge = errors.New("record too large to queue")
+
+// claimCheck returns the message body to publish for event, payload being
+// its encoding: payload itself when small enough, else a pointer to the
+// text stored in the claim check bucket
+func claimCheck(ctx context.Context, event model.LogEvent, payload string) (string, error) {
+	if len(payload) <= claimCheckThreshold {
+		return payload, nil
+	}
+	if claimCheckBucket == "" {
+		return "", errMessageTooLarge
+	}
+
+	key := "claims/" + event.TenantID + "/" + event.LogID
+	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(claimCheckBucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(event.OriginalText),
+		ContentType: aws.String("text/plain; charset=utf-8"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("store claim check: %w", err)
+	}
+	event.S3Bucket, event.S3Key, event.S3SHA256 = claimCheckBucket, key, integrity.ContentHash(event.OriginalText)
+	event.OriginalText = ""
+	pointer, _ := json.Marshal(event)
+	// Fields alone can still be too large
+	if len(pointer) > claimCheckThreshold {
+		return "", errMessageTooLarge
+	}
+	emitMetric("ClaimChecks", 1, "Count", nil)
+	return string(pointer), nil
+}
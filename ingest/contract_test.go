@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"testing"
+
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// contractCase is a request and the queue messages it must become, each
+// body byte for byte as ingest encodes it. The fixtures are shared with the
+// worker's contract test, which decodes the same messages.
+type contractCase struct {
+	Name     string            `json:"name"`
+	Headers  map[string]string `json:"headers"`
+	Body     string            `json:"body"`
+	Messages []struct {
+		Event      json.RawMessage   `json:"event"`
+		Attributes map[string]string `json:"attributes"`
+	} `json:"messages"`
+}
+
+func TestQueueContract(t *testing.T) {
+	data, err := os.ReadFile("../pkg/model/testdata/contract.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []contractCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("contract-key")
+	defer func(k []byte) { pipelineKey = k }(pipelineKey)
+	pipelineKey = key
+
+	ctx := context.Background()
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			batch, resp := prepare(ctx, events.APIGatewayV2HTTPRequest{Headers: tt.Headers, Body: tt.Body})
+			if resp != nil {
+				t.Fatalf("prepare: %d %s", resp.StatusCode, resp.Body)
+			}
+			if len(batch) != len(tt.Messages) {
+				t.Fatalf("%d events, want %d", len(batch), len(tt.Messages))
+			}
+			for i, event := range batch {
+				input, _, err := queueMessage(ctx, "https://sqs.example/queue", event.LogEvent, event.CostTags)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := tt.Messages[i]
+				body := aws.ToString(input.MessageBody)
+				var compact bytes.Buffer
+				if err := json.Compact(&compact, want.Event); err != nil {
+					t.Fatal(err)
+				}
+				if body != compact.String() {
+					t.Errorf("message %d body = %s, want %s", i, body, compact.String())
+				}
+
+				attrs := map[string]string{}
+				for name, v := range input.MessageAttributes {
+					attrs[name] = aws.ToString(v.StringValue)
+				}
+				signature := attrs[model.SignatureAttribute]
+				delete(attrs, model.SignatureAttribute)
+				if !maps.Equal(attrs, want.Attributes) {
+					t.Errorf("message %d attributes = %v, want %v", i, attrs, want.Attributes)
+				}
+				if !model.VerifySignature(key, body, model.CostTagsFrom(attrs), signature) {
+					t.Errorf("message %d signature %q does not verify", i, signature)
+				}
+			}
+		})
+	}
+}
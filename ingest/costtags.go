@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// costTagsFor returns a request's cost tags: X-Cost-Center and X-Project,
+// each defaulting to the cost_center and project of the tenant's settings.
+// Invalid header values are clientErrors.
+func costTagsFor(ctx context.Context, headers map[string]string, tenantID string) (model.CostTags, error) {
+	tags := model.CostTags{CostCenter: headers["x-cost-center"], Project: headers["x-project"]}
+	if err := tags.Validate(); err != nil {
+		return tags, clientError(err.Error())
+	}
+	if tags.CostCenter == "" || tags.Project == "" {
+		settingsCtx, cancel := stage(ctx, "policy")
+		defer cancel()
+		defaults := lookupSettings(settingsCtx, tenantID).CostTags
+		// Tenant settings are trusted, but an invalid one is dropped rather
+		// than sent on as a dimension
+		if defaults.Validate() != nil {
+			defaults = model.CostTags{}
+		}
+		if tags.CostCenter == "" {
+			tags.CostCenter = defaults.CostCenter
+		}
+		if tags.Project == "" {
+			tags.Project = defaults.Project
+		}
+	}
+	return tags, nil
+}
+
+// pipelineKey signs every published message (see model.Sign); nil when
+// PIPELINE_KEY_CIPHERTEXT is unset
+var pipelineKey []byte
+
+// messageAttributes carries cost tags and the message's signature to the
+// worker, and the event's routing attributes to anyone filtering the queue
+func messageAttributes(event model.LogEvent, payload string, tags model.CostTags) map[string]types.MessageAttributeValue {
+	attrs := tags.Attributes()
+	if pipelineKey != nil {
+		attrs[model.SignatureAttribute] = model.Sign(pipelineKey, payload, tags)
+	}
+	for k, v := range model.RoutingAttributes(event) {
+		attrs[k] = v
+	}
+	values := make(map[string]types.MessageAttributeValue, len(attrs))
+	for k, v := range attrs {
+		values[k] = types.MessageAttributeValue{DataType: aws.String(model.AttributeType(k)), StringValue: aws.String(v)}
+	}
+	return values
+}
+
+// attributeBytes is what message attributes add to a message's size: each
+// name, data type and value
+func attributeBytes(attrs map[string]types.MessageAttributeValue) int {
+	n := 0
+	for k, v := range attrs {
+		n += len(k) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue))
+	}
+	return n
+}
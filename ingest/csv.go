@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"robust-processor/internal/prefilter"
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+// defaultTextColumn is the column read as text when none is named
+const defaultTextColumn = "text"
+
+// csvRow is one data row of a CSV body and the line it starts on. Rows the
+// reader could not parse carry the reason instead of fields.
+type csvRow struct {
+	line   int
+	fields []string
+	err    string
+}
+
+// handleCSV accepts text/csv posted to /logs. The first row names the
+// columns; each further row becomes its own event sharing a batch_id, its
+// text from the column named by X-Text-Column or ?text_column= (default
+// "text") and its tenant from X-Tenant-Column or ?tenant_column=, else
+// X-Tenant-ID. The other columns become fields. Rows are accepted, rejected
+// or failed independently, as in a batch, and the response adds batch_id
+// and the lines that were rejected.
+func handleCSV(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	headers := make(map[string]string)
+	for k, v := range request.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	if r := prefilterConfig.Check(headers, request.Body); r != nil {
+		prefilter.Record(r, "handler")
+		return errorResponse(r.Status, r.Message), nil
+	}
+	body, err := decodeCharset(headers["content-type"], request.Body)
+	if err != nil {
+		status := 400
+		var merr mediaError
+		if errors.As(err, &merr) {
+			status = merr.status
+		}
+		return errorResponse(status, err.Error()), nil
+	}
+
+	textColumn := columnOption(headers, request.QueryStringParameters, "text")
+	if textColumn == "" {
+		textColumn = defaultTextColumn
+	}
+	tenantColumn := columnOption(headers, request.QueryStringParameters, "tenant")
+	if tenantColumn == "" && headers["x-tenant-id"] == "" {
+		return errorResponse(400, "Missing tenant_id (set X-Tenant-ID or X-Tenant-Column)"), nil
+	}
+
+	// The first row names the columns, the rest are data
+	var columns []string
+	var index map[string]int
+	var rows []csvRow
+	err = csvRecords(strings.NewReader(body), func(line int, record []string, perr *csv.ParseError) error {
+		if columns == nil {
+			if perr != nil {
+				return perr
+			}
+			columns, index = slices.Clone(record), make(map[string]int, len(record))
+			for i, name := range columns {
+				name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+				if _, dup := index[name]; dup && name != "" {
+					return clientError("Duplicate CSV column " + strconv.Quote(name))
+				}
+				columns[i], index[name] = name, i
+			}
+			return nil
+		}
+		if len(rows) == maxBatchRecords {
+			return errTooManyRecords
+		}
+		if perr != nil {
+			rows = append(rows, csvRow{line: line, err: "Malformed CSV row: " + perr.Err.Error()})
+			return nil
+		}
+		rows = append(rows, csvRow{line: line, fields: slices.Clone(record)})
+		return nil
+	})
+	var cerr clientError
+	if errors.As(err, &cerr) {
+		return errorResponse(400, cerr.Error()), nil
+	}
+	if err != nil {
+		return streamErrorResponse(err, "Malformed CSV body"), nil
+	}
+	if columns == nil {
+		return errorResponse(400, "Missing CSV header row"), nil
+	}
+	textIndex, ok := index[textColumn]
+	if !ok {
+		return errorResponse(400, "CSV has no text column "+strconv.Quote(textColumn)), nil
+	}
+	tenantIndex := -1
+	if tenantColumn != "" {
+		if tenantIndex, ok = index[tenantColumn]; !ok {
+			return errorResponse(400, "CSV has no tenant column "+strconv.Quote(tenantColumn)), nil
+		}
+	}
+	if len(rows) == 0 {
+		return errorResponse(400, "Empty batch"), nil
+	}
+
+	batchID := uuid.New().String()
+	items := make([]batchItem, len(rows))
+	batch := make([]LogEvent, len(rows))
+	payloads := make([]string, len(rows))
+	sizes := make([]int, len(rows))
+	rejected := []int{}
+	logIDs := newUploadLogIDs()
+	for i, row := range rows {
+		items[i] = batchItem{Index: i, Line: row.line}
+		event, err := csvEvent(ctx, headers, columns, row, textIndex, tenantIndex)
+		items[i].TenantID = event.TenantID
+		if err == nil {
+			event.BatchID = batchID
+			// Resending the file yields the same content IDs, whatever its batch
+			event.LogID = logIDs.next(event, eventTime(headers, event))
+			items[i].LogID = event.LogID
+			payload, _ := json.Marshal(event.LogEvent)
+			if err = model.Validate(payload); err == nil {
+				batch[i], payloads[i], sizes[i] = event, string(payload), len(event.OriginalText)
+				continue
+			}
+			err = clientError(err.Error())
+		}
+		var cerr clientError
+		if errors.As(err, &cerr) {
+			items[i].Status, items[i].Error = itemRejected, cerr.Error()
+			rejected = append(rejected, row.line)
+			continue
+		}
+		items[i].Status, items[i].Error = itemFailed, "Internal server error"
+		if ctx.Err() != nil {
+			items[i].Error = "Request deadline exceeded"
+			continue
+		}
+		slog.Error("CSV row failed", "tenant_id", event.TenantID, "line", row.line, "error", err)
+	}
+
+	status, response := submitBatch(ctx, items, batch, payloads, sizes)
+	response["batch_id"] = batchID
+	response["rejected_lines"] = rejected
+	return batchResponse(status, response), nil
+}
+
+// csvEvent builds the event of one row. Rows must have as many fields as
+// the header; empty fields other than text and tenant are left out.
+func csvEvent(ctx context.Context, headers map[string]string, columns []string, row csvRow, textIndex, tenantIndex int) (LogEvent, error) {
+	event := LogEvent{LogEvent: model.LogEvent{TenantID: headers["x-tenant-id"], Source: "csv_upload"}}
+	if row.err != "" {
+		return event, clientError(row.err)
+	}
+	if tenantIndex >= 0 && tenantIndex < len(row.fields) && strings.TrimSpace(row.fields[tenantIndex]) != "" {
+		event.TenantID = strings.TrimSpace(row.fields[tenantIndex])
+	}
+	if len(row.fields) != len(columns) {
+		return event, clientError(fmt.Sprintf("Row has %d fields, the header %d", len(row.fields), len(columns)))
+	}
+	event.OriginalText = row.fields[textIndex]
+	event.Fields = map[string]string{}
+	for i, v := range row.fields {
+		if i == textIndex || i == tenantIndex || columns[i] == "" || v == "" {
+			continue
+		}
+		event.Fields[columns[i]] = v
+	}
+	event.Fields["line"] = strconv.Itoa(row.line)
+
+	if event.TenantID == "" {
+		return event, clientError("Missing tenant_id")
+	}
+	if err := authorizeTenant(ctx, event.TenantID); err != nil {
+		return event, err
+	}
+	if strings.TrimSpace(event.OriginalText) == "" {
+		return event, clientError("Missing text content")
+	}
+	if err := checkEncryption(headers, &event); err != nil {
+		return event, err
+	}
+	if err := checkPriority(headers, &event); err != nil {
+		return event, err
+	}
+	tags, err := costTagsFor(ctx, headers, event.TenantID)
+	if err != nil {
+		return event, err
+	}
+	event.CostTags = tags
+	return event, nil
+}
+
+// columnOption reads a column mapping from its X-<Name>-Column header or,
+// failing that, its ?<name>_column= query parameter
+func columnOption(headers, query map[string]string, name string) string {
+	if v := strings.TrimSpace(headers["x-"+name+"-column"]); v != "" {
+		return v
+	}
+	return strings.TrimSpace(query[name+"_column"])
+}
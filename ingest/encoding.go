@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// decodeBody undoes API Gateway's base64 encoding of binary bodies and a
+// gzip Content-Encoding, so every route reads the body as the client wrote
+// it. Decompression stops one byte past MaxDecompressedBytes, which the
+// route's prefilter check then refuses with 413, so a small bomb can't
+// exhaust memory. Content-Encoding is left on the request so the check
+// knows which limit applies. The body as sent, still compressed, is
+// returned for request signatures, which cover the bytes on the wire.
+func decodeBody(request *events.APIGatewayV2HTTPRequest) (string, *mediaError) {
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return "", &mediaError{status: 400, msg: "Body is not valid base64"}
+		}
+		request.Body, request.IsBase64Encoded = string(decoded), false
+	}
+	wire := request.Body
+
+	var encoding string
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, "content-encoding") {
+			encoding = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	switch encoding {
+	case "", "identity":
+		return wire, nil
+	case "gzip", "x-gzip":
+	default:
+		return "", &mediaError{status: 415, msg: "Unsupported Content-Encoding " + encoding}
+	}
+
+	zr, err := gzip.NewReader(strings.NewReader(request.Body))
+	if err != nil {
+		return "", &mediaError{status: 400, msg: "Body is not valid gzip"}
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, io.LimitReader(zr, prefilterConfig.MaxDecompressedBytes+1)); err != nil {
+		return "", &mediaError{status: 400, msg: "Body is not valid gzip"}
+	}
+	request.Body = out.String()
+	return wire, nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import "robust-processor/pkg/model"
+
+// checkEncryption settles how an event's text is protected: X-Encryption
+// applies to records that don't say, and the only mode is "client", text
+// the tenant encrypted itself. The worker stores such text untouched and
+// redacts only the fields, which must be plaintext.
+func checkEncryption(headers map[string]string, event *LogEvent) error {
+	if event.Encryption == "" {
+		event.Encryption = headers["x-encryption"]
+	}
+	if event.Encryption != "" && event.Encryption != model.ClientEncrypted {
+		return clientError("Unsupported encryption " + event.Encryption + `; only "client" is accepted`)
+	}
+	return nil
+}
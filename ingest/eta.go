@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Completion estimates: the backlog ahead of a new record divided by the
+// pipeline's aggregate throughput. PROCESSING_BYTES_PER_SEC is the measured
+// worker throughput across all concurrent environments; the backlog is the
+// queue depth times the average size of recently published messages.
+var processingBytesPerSec = 1 << 20
+
+// backlogTTL bounds how stale a cached queue depth may be
+const backlogTTL = 15 * time.Second
+
+var (
+	backlogMu        sync.Mutex
+	backlogDepth     = map[string]int{}
+	backlogCheckedAt = map[string]time.Time{}
+	avgMessageBytes  float64
+)
+
+// recordPublished folds a published message's size into the running average
+func recordPublished(bytes int) {
+	backlogMu.Lock()
+	defer backlogMu.Unlock()
+	if avgMessageBytes == 0 {
+		avgMessageBytes = float64(bytes)
+		return
+	}
+	avgMessageBytes = 0.9*avgMessageBytes + 0.1*float64(bytes)
+}
+
+// estimateCompletion returns when a record of the given size published to
+// queue should be processed, and the queue depth it was based on. ok is
+// false when the depth is unavailable, in which case no estimate is given.
+func estimateCompletion(ctx context.Context, queue string, bytes int) (eta time.Time, depth int, ok bool) {
+	depth, ok = queueDepth(ctx, queue)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	backlogMu.Lock()
+	backlogBytes := float64(depth)*avgMessageBytes + float64(bytes)
+	backlogMu.Unlock()
+	wait := time.Duration(backlogBytes / float64(processingBytesPerSec) * float64(time.Second))
+	return time.Now().Add(wait).UTC(), depth, true
+}
+
+// queueDepth counts visible and in-flight messages, cached for backlogTTL
+func queueDepth(ctx context.Context, queue string) (int, bool) {
+	backlogMu.Lock()
+	depth, cached := backlogDepth[queue]
+	fresh := cached && time.Since(backlogCheckedAt[queue]) < backlogTTL
+	backlogMu.Unlock()
+	if fresh {
+		return depth, true
+	}
+
+	out, err := sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(queue),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		},
+	})
+	if err != nil {
+		slog.Warn("Queue depth unavailable", "error", err)
+		return depth, cached
+	}
+	depth = 0
+	for _, name := range []types.QueueAttributeName{
+		types.QueueAttributeNameApproximateNumberOfMessages,
+		types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+	} {
+		n, _ := strconv.Atoi(out.Attributes[string(name)])
+		depth += n
+	}
+
+	backlogMu.Lock()
+	backlogDepth[queue] = depth
+	backlogCheckedAt[queue] = time.Now()
+	backlogMu.Unlock()
+	return depth, true
+}
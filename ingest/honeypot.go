@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"robust-processor/internal/honeypot"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+var (
+	// honeypotQueueURL receives every request made with a honeypot key, for
+	// security to review; nothing consumes it. Unset, requests are only
+	// counted and logged.
+	honeypotQueueURL string
+	// honeypotDelay holds each honeypot response back (HONEYPOT_DELAY,
+	// default 2s), within the request budget, to slow the caller down
+	honeypotDelay = honeypot.DefaultDelay
+)
+
+// honeypotResponse answers a request made with a key the tenant flagged as
+// a honeypot: the request is captured, security alerted through the
+// HoneypotRequests metric, and the caller sent, after a delay, a response
+// shaped like a real acceptance. Nothing is journaled, stubbed, metered or
+// queued for processing, so the decoy log_ids never resolve.
+func honeypotResponse(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID, key string) events.APIGatewayV2HTTPResponse {
+	capture := honeypot.NewCapture(request, tenantID, key)
+	slog.Warn("Honeypot key used", "tenant_id", tenantID, "key_digest", capture.KeyDigest,
+		"source_ip", capture.SourceIP, "path", capture.Path)
+	emitMetric("HoneypotRequests", 1, "Count", map[string]string{"tenant_id": tenantID})
+
+	if honeypotQueueURL != "" {
+		captureCtx, cancel := stage(ctx, "publish")
+		defer cancel()
+		if err := capture.Send(captureCtx, sqsClient, honeypotQueueURL); err != nil {
+			slog.Error("Failed to capture honeypot request", "tenant_id", tenantID, "error", err)
+			emitMetric("HoneypotCaptureFailures", 1, "Count", nil)
+		}
+	}
+
+	// The tarpit ends in time to answer within the budget
+	honeypot.Tarpit(ctx, honeypotDelay)
+	return decoyResponse(request, tenantID)
+}
+
+// decoyResponse is the 202 the route would send had every record been
+// accepted, with fresh log_ids
+func decoyResponse(request events.APIGatewayV2HTTPRequest, tenantID string) events.APIGatewayV2HTTPResponse {
+	path := strings.TrimSuffix(request.RawPath, "/")
+	if path == "/preview" {
+		// Previews queue nothing to fake; a failure gives away nothing
+		return errorResponse(500, "Internal server error")
+	}
+
+	// Records are numbered by line where the real route numbers them
+	var lines []int
+	batchID := ""
+	switch mediaType := requestMediaType(request.Headers); {
+	case path == "/logs/batch":
+		var records []json.RawMessage
+		_ = json.Unmarshal([]byte(request.Body), &records)
+		lines = make([]int, len(records))
+	case mediaType == "application/x-ndjson" || mediaType == "application/ndjson":
+		lines = nonBlankLines(request.Body)
+	case mediaType == "text/csv":
+		if lines = nonBlankLines(request.Body); len(lines) > 0 {
+			lines = lines[1:]
+		}
+	case mediaType == "multipart/form-data":
+		if up, err := parseUpload(request.Headers["content-type"], request.Body); err == nil {
+			records, _ := splitUpload(up.text, splitLine)
+			for _, r := range records {
+				lines = append(lines, r.number)
+			}
+		}
+		batchID = uuid.New().String()
+	default:
+		return jsonResponse(202, map[string]interface{}{
+			"status":    "accepted",
+			"log_id":    decoyLogID(),
+			"tenant_id": tenantID,
+			"message":   "Processing queued",
+		})
+	}
+
+	items := make([]batchItem, len(lines))
+	for i, line := range lines {
+		items[i] = batchItem{Index: i, Line: line, Status: itemAccepted, LogID: decoyLogID(), TenantID: tenantID}
+	}
+	response := map[string]interface{}{
+		"accepted": len(items),
+		"rejected": 0,
+		"failed":   0,
+		"items":    items,
+	}
+	if batchID != "" {
+		response["batch_id"] = batchID
+	}
+	return batchResponse(202, response)
+}
+
+// decoyLogID is a log_id of the configured strategy's form; content IDs are
+// derived from a random key, so no two decoys share one
+func decoyLogID() string {
+	return newLogID(LogEvent{}, "", uuid.New().String())
+}
+
+// nonBlankLines returns the 1-based numbers of the non-blank lines of s
+func nonBlankLines(s string) []int {
+	var lines []int
+	for i, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/integrity"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// journalTableName is the ingest journal: one entry per accepted record,
+// written before it is published, so support can show whether a disputed
+// record ever entered the system long after its stub or item is gone.
+// Entries hold the text's SHA-256, as receipts do, never the text. Unset
+// disables it.
+var journalTableName string
+
+// journalRetention is how long entries live before DynamoDB TTL removes them
+// (JOURNAL_RETENTION, default 90 days)
+var journalRetention = 90 * 24 * time.Hour
+
+// writeJournal records each event in the journal and returns the
+// tenant_id#log_id keys it could not record. Unlike stubs, entries are not
+// best effort: a record without one must not be published.
+func writeJournal(ctx context.Context, batch []LogEvent) map[string]bool {
+	if journalTableName == "" || len(batch) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	acceptedAt := now.Format(time.RFC3339Nano)
+	expiresAt := strconv.FormatInt(now.Add(journalRetention).Unix(), 10)
+
+	// A key may repeat within a batch; one entry covers every copy
+	pending := map[string]bool{}
+	var requests []types.WriteRequest
+	for _, event := range batch {
+		key := event.TenantID + "#" + event.LogID
+		if pending[key] {
+			continue
+		}
+		pending[key] = true
+		item := map[string]types.AttributeValue{
+			"tenant_id":      &types.AttributeValueMemberS{Value: event.TenantID},
+			"log_id":         &types.AttributeValueMemberS{Value: event.LogID},
+			"source":         &types.AttributeValueMemberS{Value: event.Source},
+			"content_sha256": &types.AttributeValueMemberS{Value: integrity.ContentHash(event.OriginalText)},
+			"accepted_at":    &types.AttributeValueMemberS{Value: acceptedAt},
+			"expires_at":     &types.AttributeValueMemberN{Value: expiresAt},
+		}
+		if event.ParentID != "" {
+			item["parent_id"] = &types.AttributeValueMemberS{Value: event.ParentID}
+		}
+		if event.BatchID != "" {
+			item["batch_id"] = &types.AttributeValueMemberS{Value: event.BatchID}
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	for start := 0; start < len(requests); start += batchWriteLimit {
+		chunk := requests[start:min(start+batchWriteLimit, len(requests))]
+		// Throttled writes come back unprocessed; retry them while the stage lasts
+		for len(chunk) > 0 && ctx.Err() == nil {
+			out, err := dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{journalTableName: chunk},
+			})
+			if err != nil {
+				slog.Error("Failed to write journal", "entries", len(chunk), "error", err)
+				break
+			}
+			for _, r := range chunk {
+				pending[journalKey(r)] = false
+			}
+			chunk = out.UnprocessedItems[journalTableName]
+			for _, r := range chunk {
+				pending[journalKey(r)] = true
+			}
+		}
+	}
+
+	failed := map[string]bool{}
+	for key, unwritten := range pending {
+		if unwritten {
+			failed[key] = true
+		}
+	}
+	if len(failed) > 0 {
+		emitMetric("JournalFailures", float64(len(failed)), "Count", nil)
+	}
+	return failed
+}
+
+func journalKey(r types.WriteRequest) string {
+	tenant, _ := r.PutRequest.Item["tenant_id"].(*types.AttributeValueMemberS)
+	logID, _ := r.PutRequest.Item["log_id"].(*types.AttributeValueMemberS)
+	return tenant.Value + "#" + logID.Value
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// Lockouts: failed authentications are counted per source address and per
+// API key tried, in USAGE_TABLE_NAME under the tenant_id auth#ip#<address>
+// or auth#key#<digest> (a prefix of the key's SHA-256) and the period
+// "failures". Once a subject has failed authFailureLimit times, each further
+// failure locks it out for twice as long as the last, from authLockout up to
+// authLockoutMax; a locked-out caller is refused with 429 before its
+// credentials are looked at. Counts are forgotten after authFailureWindow
+// without a failure. The first lockout of a run publishes an
+// "Authentication Lockout" event to USAGE_EVENT_BUS, which delivers it to
+// the security alerts topic. Like the rate limiter, lockouts fail open.
+const (
+	lockoutDetailType = "Authentication Lockout"
+	lockoutPeriod     = "failures"
+)
+
+var (
+	// authFailureLimit is the failures a subject may have without a lockout
+	// (AUTH_FAILURE_LIMIT, default 5)
+	authFailureLimit int64 = 5
+	// authLockout and authLockoutMax bound a lockout (AUTH_LOCKOUT, default
+	// 30s; AUTH_LOCKOUT_MAX, default 15m)
+	authLockout    = 30 * time.Second
+	authLockoutMax = 15 * time.Minute
+	// authFailureWindow is how long a subject's failures are remembered
+	// after its last one (AUTH_FAILURE_WINDOW, default 1h)
+	authFailureWindow = time.Hour
+)
+
+// authFailures is a subject's item in the usage table
+type authFailures struct {
+	Subject     string `dynamodbav:"tenant_id"`
+	Failures    int64  `dynamodbav:"failures"`
+	LastFailure int64  `dynamodbav:"last_failure"`
+	ExpiresAt   int64  `dynamodbav:"expires_at"`
+}
+
+// lockedUntil is when the subject's current lockout ends; before now when
+// there is none
+func (f authFailures) lockedUntil() time.Time {
+	if f.Failures < authFailureLimit {
+		return time.Time{}
+	}
+	return time.Unix(f.LastFailure, 0).Add(lockoutFor(f.Failures))
+}
+
+// lockoutFor is the lockout the failure-th failure earns: authLockout at
+// the limit, doubling with every failure after it, up to authLockoutMax
+func lockoutFor(failures int64) time.Duration {
+	d := authLockout
+	for n := authFailureLimit; n < failures && d < authLockoutMax; n++ {
+		d *= 2
+	}
+	return min(d, authLockoutMax)
+}
+
+// lockoutEvent is the detail of an Authentication Lockout event
+type lockoutEvent struct {
+	// Subject is "ip" or "key"; SourceIP or KeyDigest identifies it
+	Subject     string `json:"subject"`
+	SourceIP    string `json:"source_ip,omitempty"`
+	KeyDigest   string `json:"key_digest,omitempty"`
+	TenantID    string `json:"tenant_id"`
+	Failures    int64  `json:"failures"`
+	LockedUntil string `json:"locked_until"`
+}
+
+// lockoutSubjects are the usage table subjects a request is counted under,
+// keyed by kind: its source address, and the API key it presented
+func lockoutSubjects(sourceIP, key string) map[string]string {
+	subjects := map[string]string{}
+	if sourceIP != "" {
+		subjects["ip"] = "auth#ip#" + sourceIP
+	}
+	if key != "" {
+		subjects["key"] = "auth#key#" + keyDigest(key)
+	}
+	return subjects
+}
+
+// keyDigest is the prefix of a key's SHA-256 that stands for it in the
+// usage table and in lockout events
+func keyDigest(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:8])
+}
+
+// lockedOut returns how long the request's subjects remain locked out, or
+// 0 when none is
+func lockedOut(ctx context.Context, subjects map[string]string) time.Duration {
+	if usageTableName == "" || len(subjects) == 0 {
+		return 0
+	}
+	limitCtx, cancel := stage(ctx, "limit")
+	defer cancel()
+
+	keys := make([]map[string]types.AttributeValue, 0, len(subjects))
+	for _, subject := range subjects {
+		keys = append(keys, map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: subject},
+			"period":    &types.AttributeValueMemberS{Value: lockoutPeriod},
+		})
+	}
+	out, err := dynamoClient.BatchGetItem(limitCtx, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{
+			usageTableName: {Keys: keys, ProjectionExpression: aws.String("tenant_id, failures, last_failure, expires_at")},
+		},
+	})
+	if err != nil {
+		slog.Warn("Lockout check failed", "error", err)
+		emitMetric("LockoutCheckFailures", 1, "Count", nil)
+		return 0
+	}
+	var items []authFailures
+	if err := attributevalue.UnmarshalListOfMaps(out.Responses[usageTableName], &items); err != nil {
+		slog.Warn("Invalid lockout item", "error", err)
+		return 0
+	}
+	now := time.Now()
+	var wait time.Duration
+	for _, f := range items {
+		if f.ExpiresAt <= now.Unix() {
+			continue
+		}
+		wait = max(wait, f.lockedUntil().Sub(now))
+	}
+	return wait
+}
+
+// recordAuthFailure counts a failed authentication against each of the
+// request's subjects, announcing any it locks out for the first time
+func recordAuthFailure(ctx context.Context, subjects map[string]string, tenantID, sourceIP, key string) {
+	if usageTableName == "" {
+		return
+	}
+	limitCtx, cancel := stage(ctx, "limit")
+	defer cancel()
+
+	for kind, subject := range subjects {
+		f, err := addFailure(limitCtx, subject)
+		if err != nil {
+			slog.Warn("Failed to record authentication failure", "subject", kind, "error", err)
+			emitMetric("LockoutCheckFailures", 1, "Count", nil)
+			continue
+		}
+		if f.Failures < authFailureLimit {
+			continue
+		}
+		emitMetric("AuthLockouts", 1, "Count", map[string]string{"subject": kind})
+		if f.Failures > authFailureLimit {
+			continue
+		}
+		e := lockoutEvent{
+			Subject:     kind,
+			TenantID:    tenantID,
+			Failures:    f.Failures,
+			LockedUntil: f.lockedUntil().UTC().Format(time.RFC3339),
+		}
+		if kind == "ip" {
+			e.SourceIP = sourceIP
+		} else {
+			e.KeyDigest = keyDigest(key)
+		}
+		announceLockout(ctx, e)
+	}
+}
+
+// addFailure adds one failure to a subject's count, starting it afresh when
+// the last one is older than authFailureWindow: the table's TTL may leave
+// an expired item in place for a while
+func addFailure(ctx context.Context, subject string) (authFailures, error) {
+	now := time.Now()
+	key := map[string]types.AttributeValue{
+		"tenant_id": &types.AttributeValueMemberS{Value: subject},
+		"period":    &types.AttributeValueMemberS{Value: lockoutPeriod},
+	}
+	values := map[string]types.AttributeValue{
+		":one": &types.AttributeValueMemberN{Value: "1"},
+		":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		":exp": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(authFailureWindow).Unix(), 10)},
+	}
+	out, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(usageTableName),
+		Key:                       key,
+		UpdateExpression:          aws.String("ADD failures :one SET last_failure = :now, expires_at = :exp"),
+		ConditionExpression:       aws.String("attribute_not_exists(expires_at) OR expires_at > :now"),
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if errors.As(err, &conditional) {
+		out, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(usageTableName),
+			Key:                       key,
+			UpdateExpression:          aws.String("SET failures = :one, last_failure = :now, expires_at = :exp"),
+			ExpressionAttributeValues: values,
+			ReturnValues:              types.ReturnValueAllNew,
+		})
+	}
+	if err != nil {
+		return authFailures{}, err
+	}
+	var f authFailures
+	err = attributevalue.UnmarshalMap(out.Attributes, &f)
+	return f, err
+}
+
+// announceLockout publishes one lockout. There is no retry: a lost event is
+// counted, and AuthLockouts still records the lockout.
+func announceLockout(ctx context.Context, e lockoutEvent) {
+	slog.Warn("Authentication lockout", "subject", e.Subject, "source_ip", e.SourceIP, "key_digest", e.KeyDigest,
+		"tenant_id", e.TenantID, "locked_until", e.LockedUntil)
+	if usageEventBus == "" {
+		return
+	}
+	detail, _ := json.Marshal(e)
+	out, err := eventBridgeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{{
+			EventBusName: aws.String(usageEventBus),
+			Source:       aws.String(usageSource),
+			DetailType:   aws.String(lockoutDetailType),
+			Detail:       aws.String(string(detail)),
+		}},
+	})
+	if err != nil || out.FailedEntryCount > 0 {
+		slog.Warn("Failed to announce lockout", "subject", e.Subject, "error", err)
+		emitMetric("LockoutEventFailures", 1, "Count", nil)
+	}
+}
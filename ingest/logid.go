@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// logIDStrategy selects how log_ids are generated when the producer sends
+// none: "random" (UUIDv4, the default), "uuidv7", which sorts by ingestion
+// time, or "content", a UUIDv5 derived from the record so that resending the
+// same record yields the same ID. Content IDs can only tell identical texts
+// apart by their event time: without one, distinct occurrences of the same
+// message (a repeated "connection reset", say) collapse into one record, and
+// producers must send an event time or their own log_id to keep them.
+var logIDStrategy = "random"
+
+// logIDNamespace scopes content-derived IDs to this service
+var logIDNamespace = uuid.MustParse("c87a3a6b-da9d-4b6e-87b6-17d821a108be")
+
+// newLogID generates a log_id for event. Content IDs hash tenant, source,
+// parent, text and event time, plus disambiguators such as a part's
+// position so identical parts of one record stay distinct.
+func newLogID(event LogEvent, eventTime string, extra ...string) string {
+	switch logIDStrategy {
+	case "content":
+		return contentLogID(event, eventTime, extra)
+	case "uuidv7":
+		// NewV7 only fails if the random source does
+		if id, err := uuid.NewV7(); err == nil {
+			return id.String()
+		}
+	}
+	return uuid.New().String()
+}
+
+func contentLogID(event LogEvent, eventTime string, extra []string) string {
+	var key []byte
+	for _, v := range append([]string{event.TenantID, event.Source, event.ParentID, event.OriginalText, eventTime}, extra...) {
+		key = binary.AppendUvarint(key, uint64(len(v)))
+		key = append(key, v...)
+	}
+	return uuid.NewSHA1(logIDNamespace, key).String()
+}
+
+// eventTime is the producer's timestamp for a record: the X-Event-Time header,
+// else a timestamp or time field set by the normalizer
+func eventTime(headers map[string]string, event LogEvent) string {
+	if t := headers["x-event-time"]; t != "" {
+		return t
+	}
+	if t := event.Fields["timestamp"]; t != "" {
+		return t
+	}
+	return event.Fields["time"]
+}
+
+// partKey disambiguates a part's content ID by its position in the upload
+func partKey(i int) string {
+	return "part:" + strconv.Itoa(i)
+}
+
+// uploadLogIDs generates the log_ids of one upload's records. Content IDs
+// are those of the same records sent singly, except that a repeat of
+// identical content is told apart by how many came before it, not by its
+// line, so adding or moving other lines leaves an ID unchanged.
+type uploadLogIDs struct {
+	seen map[string]int
+}
+
+func newUploadLogIDs() uploadLogIDs {
+	return uploadLogIDs{seen: map[string]int{}}
+}
+
+func (u uploadLogIDs) next(event LogEvent, eventTime string) string {
+	id := newLogID(event, eventTime)
+	if logIDStrategy != "content" {
+		return id
+	}
+	n := u.seen[id]
+	u.seen[id] = n + 1
+	if n == 0 {
+		return id
+	}
+	return newLogID(event, eventTime, "occurrence:"+strconv.Itoa(n))
+}
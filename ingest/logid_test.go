@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"robust-processor/pkg/model"
+)
+
+func TestUploadLogIDs(t *testing.T) {
+	defer func(s string) { logIDStrategy = s }(logIDStrategy)
+	logIDStrategy = "content"
+
+	event := func(text string) LogEvent {
+		return LogEvent{LogEvent: model.LogEvent{TenantID: "acme", Source: "file_upload", OriginalText: text}}
+	}
+	ids := func(lines ...string) []string {
+		u := newUploadLogIDs()
+		var out []string
+		for _, l := range lines {
+			out = append(out, u.next(event(l), "2024-05-01T12:00:00Z"))
+		}
+		return out
+	}
+
+	got := ids("a", "b", "a")
+	if single := newLogID(event("a"), "2024-05-01T12:00:00Z"); got[0] != single {
+		t.Errorf("first a = %s, want %s as when sent singly", got[0], single)
+	}
+	if got[2] == got[0] {
+		t.Errorf("repeated a got the same ID %s", got[0])
+	}
+	// Lines added or moved elsewhere in the file leave the IDs alone
+	moved := ids("c", "a", "c", "b", "a")
+	if moved[1] != got[0] || moved[3] != got[1] || moved[4] != got[2] {
+		t.Errorf("IDs changed with other lines: %v, then %v", got, moved)
+	}
+}
@@ -3,28 +3,50 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"robust-processor/internal/apikey"
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/pipelinekey"
+	"robust-processor/internal/prefilter"
+	"robust-processor/internal/tenantpolicy"
+	"robust-processor/pkg/model"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/google/uuid"
 )
 
-// LogEvent is the normalized internal format for all ingested data
+// LogEvent is a normalized record with the sub-documents submitted with it.
+// Only the embedded model.LogEvent is published.
 type LogEvent struct {
-	TenantID     string `json:"tenant_id"`
-	LogID        string `json:"log_id"`
-	OriginalText string `json:"original_text"`
-	Source       string `json:"source"`
+	model.LogEvent
+	// Parts are sub-documents awaiting their own events
+	Parts []LogEvent
+	// CostTags travel as message attributes; parts share the record's
+	CostTags model.CostTags
+	// TypedFields are Fields as decoded, before non-string values were
+	// encoded as strings, for schema validation; nil for formats whose
+	// values are all strings
+	TypedFields map[string]interface{}
 }
 
 var sqsClient *sqs.Client
+var dynamoClient *dynamodb.Client
 var queueURL string
+var prefilterConfig prefilter.Config
 
 func init() {
 	cfg, err := config.LoadDefaultConfig(context.TODO())
@@ -32,81 +54,316 @@ func init() {
 		panic("configuration error: " + err.Error())
 	}
 	sqsClient = sqs.NewFromConfig(cfg)
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	eventBridgeClient = eventbridge.NewFromConfig(cfg)
+	s3Client = s3.NewFromConfig(cfg)
+	if pipelineKey, err = pipelinekey.FromEnv(context.TODO(), cfg); err != nil {
+		panic("configuration error: " + err.Error())
+	}
 	queueURL = os.Getenv("QUEUE_URL")
+	claimCheckBucket = os.Getenv("CLAIM_CHECK_BUCKET")
+	tableName = os.Getenv("TABLE_NAME")
+	journalTableName = os.Getenv("JOURNAL_TABLE_NAME")
+	if d, err := time.ParseDuration(os.Getenv("JOURNAL_RETENTION")); err == nil && d > 0 {
+		journalRetention = d
+	}
+	prefilterConfig = prefilter.FromEnv()
+	policies = &tenantpolicy.Store{Table: os.Getenv("POLICY_TABLE_NAME"), Client: dynamoClient}
+	schemaTableName = os.Getenv("SCHEMA_TABLE_NAME")
+	usageTableName = os.Getenv("USAGE_TABLE_NAME")
+	usageEventBus = os.Getenv("USAGE_EVENT_BUS")
+	if s := os.Getenv("LOG_ID_STRATEGY"); s != "" {
+		logIDStrategy = s
+	}
+	stagingQueueURL = os.Getenv("STAGING_QUEUE_URL")
+	stagingTenants = parseTenantList(os.Getenv("STAGING_TENANTS"))
+	priorityQueueURL = os.Getenv("PRIORITY_QUEUE_URL")
+	shadowQueueURL = os.Getenv("SHADOW_QUEUE_URL")
+	shadowSampleRate, _ = strconv.ParseFloat(os.Getenv("SHADOW_SAMPLE_RATE"), 64)
+	if n, err := strconv.Atoi(os.Getenv("PROCESSING_BYTES_PER_SEC")); err == nil && n > 0 {
+		processingBytesPerSec = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("REQUEST_BUDGET")); err == nil && d > 0 {
+		requestBudget = d
+	}
+	if prefix := os.Getenv("API_KEY_SECRET_PREFIX"); prefix != "" {
+		ttl, _ := time.ParseDuration(os.Getenv("API_KEY_CACHE_TTL"))
+		apiKeys = apikey.New(cfg, prefix, ttl)
+	}
+	honeypotQueueURL = os.Getenv("HONEYPOT_QUEUE_URL")
+	if d, err := time.ParseDuration(os.Getenv("HONEYPOT_DELAY")); err == nil && d >= 0 {
+		honeypotDelay = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("AUTH_FAILURE_LIMIT"), 10, 64); err == nil && n > 0 {
+		authFailureLimit = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("AUTH_LOCKOUT")); err == nil && d > 0 {
+		authLockout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("AUTH_LOCKOUT_MAX")); err == nil && d > 0 {
+		authLockoutMax = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("AUTH_FAILURE_WINDOW")); err == nil && d > 0 {
+		authFailureWindow = d
+	}
+	if ackKeyID = os.Getenv("ACK_SIGNING_KEY_ID"); ackKeyID != "" {
+		kmsClient = kms.NewFromConfig(cfg)
+	}
+}
+
+// handleLogs accepts one record (and its parts), or an uploaded file, NDJSON
+// stream or CSV table of records, for asynchronous processing
+func handleLogs(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	// File uploads, NDJSON and CSV are split into records and accepted like a batch
+	switch requestMediaType(request.Headers) {
+	case "multipart/form-data":
+		return handleUpload(ctx, request)
+	case "application/x-ndjson", "application/ndjson":
+		return handleNDJSON(ctx, request)
+	case "text/csv":
+		return handleCSV(ctx, request)
+	}
+	batch, fail := prepare(ctx, request)
+	if fail != nil {
+		return *fail, nil
+	}
+	logEvent := batch[0]
+	var limit limitError
+	if err := admit(ctx, logEvent.TenantID, len(request.Body)); errors.As(err, &limit) {
+		return limitResponse(limit), nil
+	}
+	var partIDs []string
+	for _, part := range batch[1:] {
+		partIDs = append(partIDs, part.LogID)
+	}
+
+	journalCtx, cancelJournal := stage(ctx, "journal")
+	defer cancelJournal()
+	if failed := writeJournal(journalCtx, batch); len(failed) > 0 {
+		if expired(journalCtx) {
+			return budgetResponse("journal", nil), nil
+		}
+		return errorResponse(500, "Internal server error"), nil
+	}
+
+	queuedCtx, cancelQueued := stage(ctx, "queued")
+	defer cancelQueued()
+	writeQueued(queuedCtx, batch)
+
+	// Publish to SQS
+	queue := queueFor(logEvent.LogEvent)
+	publishCtx, cancel := stage(ctx, "publish")
+	defer cancel()
+	var queued []string
+	for _, event := range batch {
+		if err := publish(publishCtx, queue, event.LogEvent, event.CostTags); err != nil {
+			if expired(publishCtx) {
+				return budgetResponse("publish", queued), nil
+			}
+			if errors.Is(err, errMessageTooLarge) {
+				return errorResponse(413, "Record too large to queue"), nil
+			}
+			slog.Error("Failed to enqueue message", "error", err)
+			return errorResponse(500, "Internal server error"), nil
+		}
+		queued = append(queued, event.LogID)
+	}
+	mirror(publishCtx, batch)
+	meterCtx, cancelMeter := stage(ctx, "meter")
+	defer cancelMeter()
+	meter(meterCtx, logEvent.TenantID, logEvent.CostTags, len(batch), len(request.Body))
+
+	// Return 202 Accepted immediately (non-blocking)
+	response := map[string]interface{}{
+		"status":    "accepted",
+		"log_id":    logEvent.LogID,
+		"tenant_id": logEvent.TenantID,
+		"message":   "Processing queued",
+	}
+	if len(partIDs) > 0 {
+		response["parts"] = partIDs
+	}
+	etaCtx, cancelETA := stage(ctx, "eta")
+	defer cancelETA()
+	if eta, depth, ok := estimateCompletion(etaCtx, queue, len(request.Body)); ok {
+		response["estimated_completion"] = eta.Format(time.RFC3339)
+		response["queue_depth"] = depth
+	}
+	return jsonResponse(202, response), nil
 }
 
-func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+// prepare turns a request into the events to publish, the record followed
+// by its parts: prefilter, normalization, validation and ID assignment. On
+// failure it returns the response to send instead.
+func prepare(ctx context.Context, request events.APIGatewayV2HTTPRequest) ([]LogEvent, *events.APIGatewayV2HTTPResponse) {
+	fail := func(status int, msg string) ([]LogEvent, *events.APIGatewayV2HTTPResponse) {
+		resp := errorResponse(status, msg)
+		return nil, &resp
+	}
+
 	// Normalize headers (case-insensitive)
 	headers := make(map[string]string)
 	for k, v := range request.Headers {
 		headers[strings.ToLower(k)] = v
 	}
 
-	contentType := headers["content-type"]
-	var logEvent LogEvent
-	logEvent.LogID = uuid.New().String()
+	// Cheap structural checks first, before anything is parsed or queued
+	if r := prefilterConfig.Check(headers, request.Body); r != nil {
+		prefilter.Record(r, "handler")
+		return fail(r.Status, r.Message)
+	}
 
-	// Parse based on Content-Type
-	if strings.Contains(contentType, "application/json") {
-		logEvent.Source = "json_upload"
-		var bodyMap map[string]interface{}
-		if err := json.Unmarshal([]byte(request.Body), &bodyMap); err != nil {
-			return events.APIGatewayV2HTTPResponse{StatusCode: 400, Body: `{"error":"Invalid JSON"}`}, nil
-		}
-		if tid, ok := bodyMap["tenant_id"].(string); ok {
-			logEvent.TenantID = tid
-		}
-		if txt, ok := bodyMap["text"].(string); ok {
-			logEvent.OriginalText = txt
-		}
-		if lid, ok := bodyMap["log_id"].(string); ok {
-			logEvent.LogID = lid
+	// Parse based on ?format= hint or Content-Type, transcoding to UTF-8
+	req := ingestRequest{Headers: headers, Query: request.QueryStringParameters, Body: request.Body}
+	normalizer, err := selectNormalizer(req)
+	if err == nil {
+		req.Body, err = decodeCharset(headers["content-type"], req.Body)
+	}
+	if err != nil {
+		status := 400
+		var merr mediaError
+		if errors.As(err, &merr) {
+			status = merr.status
 		}
-	} else if strings.Contains(contentType, "text/plain") {
-		logEvent.Source = "text_upload"
-		logEvent.TenantID = headers["x-tenant-id"]
-		logEvent.OriginalText = request.Body
-	} else {
-		return events.APIGatewayV2HTTPResponse{StatusCode: 400, Body: `{"error":"Unsupported Content-Type"}`}, nil
+		return fail(status, err.Error())
 	}
+	logEvent, err := normalizer.Normalize(req)
+	if err != nil {
+		return fail(400, err.Error())
+	}
+	// Parsing can't be interrupted, but a budget it used up is not spent again
+	if expired(ctx) {
+		resp := budgetResponse("parse", nil)
+		return nil, &resp
+	}
+	logEvent.Source = normalizer.Source()
 
 	// Validate tenant_id
 	if logEvent.TenantID == "" {
-		return events.APIGatewayV2HTTPResponse{StatusCode: 400, Body: `{"error":"Missing tenant_id"}`}, nil
+		return fail(400, "Missing tenant_id")
+	}
+	if err := authorizeTenant(ctx, logEvent.TenantID); err != nil {
+		return fail(403, err.Error())
 	}
 
 	// Validate text content
 	if logEvent.OriginalText == "" {
-		return events.APIGatewayV2HTTPResponse{StatusCode: 400, Body: `{"error":"Missing text content"}`}, nil
+		return fail(400, "Missing text content")
+	}
+	if err := checkEncryption(headers, &logEvent); err != nil {
+		return fail(400, err.Error())
+	}
+	if err := checkPriority(headers, &logEvent); err != nil {
+		return fail(400, err.Error())
 	}
 
-	// Publish to SQS
-	payload, _ := json.Marshal(logEvent)
-	_, err := sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-		MessageBody: aws.String(string(payload)),
-		QueueUrl:    aws.String(queueURL),
-	})
+	tags, err := costTagsFor(ctx, headers, logEvent.TenantID)
+	if err != nil {
+		return fail(400, err.Error())
+	}
+	logEvent.CostTags = tags
+
+	eventTime := eventTime(headers, logEvent)
+	if logEvent.LogID == "" {
+		logEvent.LogID = newLogID(logEvent, eventTime)
+	}
+
+	// Validate fields against the tenant's registered schema
+	if ref := headers["x-schema"]; ref != "" {
+		schemaCtx, cancel := stage(ctx, "schema")
+		defer cancel()
+		if err := validateSchema(schemaCtx, &logEvent, ref); err != nil {
+			var cerr clientError
+			if errors.As(err, &cerr) {
+				return fail(400, cerr.Error())
+			}
+			if expired(schemaCtx) {
+				resp := budgetResponse("schema", nil)
+				return nil, &resp
+			}
+			slog.Error("Schema lookup failed", "tenant_id", logEvent.TenantID, "schema", ref, "error", err)
+			return fail(500, "Internal server error")
+		}
+	}
+
+	// Each part becomes its own event, linked to this one by parent_id
+	batch := []LogEvent{logEvent}
+	for i, part := range logEvent.Parts {
+		if part.OriginalText == "" {
+			return fail(400, fmt.Sprintf("Missing text content in part %d", i+1))
+		}
+		part.TenantID = logEvent.TenantID
+		part.Source = logEvent.Source
+		part.ParentID, part.Part = logEvent.LogID, i+1
+		part.CostTags = logEvent.CostTags
+		if part.Encryption == "" {
+			part.Encryption = logEvent.Encryption
+		}
+		if err := checkEncryption(nil, &part); err != nil {
+			return fail(400, err.Error())
+		}
+		// Parts share their record's lane
+		part.Priority = logEvent.Priority
+		if part.LogID == "" {
+			part.LogID = newLogID(part, eventTime, partKey(i))
+		}
+		batch = append(batch, part)
+	}
+	return batch, nil
+}
 
+// publish enqueues one event on queue with its cost tags
+func publish(ctx context.Context, queue string, event model.LogEvent, tags model.CostTags) error {
+	input, size, err := queueMessage(ctx, queue, event, tags)
 	if err != nil {
-		slog.Error("Failed to enqueue message", "error", err)
-		return events.APIGatewayV2HTTPResponse{StatusCode: 500, Body: `{"error":"Internal server error"}`}, nil
+		return err
+	}
+	_, err = sqsClient.SendMessage(ctx, input)
+	if err == nil {
+		recordPublished(size)
 	}
+	return err
+}
 
-	// Return 202 Accepted immediately (non-blocking)
-	responseBody, _ := json.Marshal(map[string]string{
-		"status":    "accepted",
-		"log_id":    logEvent.LogID,
-		"tenant_id": logEvent.TenantID,
-		"message":   "Processing queued",
-	})
+// queueMessage builds the message publish sends for event, refusing any
+// that breaks the contract the worker will check it against. Large events
+// are claim-checked; on a FIFO queue the tenant is the message group. size
+// is the encoded event's length.
+func queueMessage(ctx context.Context, queue string, event model.LogEvent, tags model.CostTags) (input *sqs.SendMessageInput, size int, err error) {
+	payload, _ := json.Marshal(event)
+	if err := model.Validate(payload); err != nil {
+		return nil, 0, err
+	}
+	body, err := claimCheck(ctx, event, string(payload))
+	if err != nil {
+		return nil, 0, err
+	}
+	group, dedup := model.FIFOParams(queue, event.TenantID, event.LogID)
+	return &sqs.SendMessageInput{
+		MessageBody:            aws.String(body),
+		QueueUrl:               aws.String(queue),
+		MessageAttributes:      messageAttributes(event, body, tags),
+		MessageGroupId:         group,
+		MessageDeduplicationId: dedup,
+	}, len(payload), nil
+}
 
+func jsonResponse(status int, v interface{}) events.APIGatewayV2HTTPResponse {
+	body, _ := json.Marshal(v)
 	return events.APIGatewayV2HTTPResponse{
-		StatusCode: 202,
+		StatusCode: status,
 		Headers:    map[string]string{"Content-Type": "application/json"},
-		Body:       string(responseBody),
-	}, nil
+		Body:       string(body),
+	}
+}
+
+// errorResponse builds the {"error": msg} body used for all failures
+func errorResponse(status int, msg string) events.APIGatewayV2HTTPResponse {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: string(body)}
 }
 
 func main() {
+	logscrub.Install()
 	lambda.Start(handler)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// mediaError is a Content-Type or charset the handler can't accept: 415 for
+// an unsupported type or charset, 400 for a malformed header or format hint
+type mediaError struct {
+	status int
+	msg    string
+}
+
+func (e mediaError) Error() string { return e.msg }
+
+// parseContentType returns the lower-cased media type and its parameters
+func parseContentType(header string) (string, map[string]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return "", nil, mediaError{status: 415, msg: "Missing Content-Type"}
+	}
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", nil, mediaError{status: 400, msg: "Malformed Content-Type"}
+	}
+	return mediaType, params, nil
+}
+
+// requestMediaType returns the media type of a request's Content-Type, from
+// headers as received, or "" when it is missing or malformed
+func requestMediaType(headers map[string]string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, "content-type") {
+			mediaType, _, _ := mime.ParseMediaType(v)
+			return mediaType
+		}
+	}
+	return ""
+}
+
+// suffixBase maps a structured syntax suffix type (RFC 6839) to the type it
+// is read as: application/vnd.acme+json to application/json
+func suffixBase(mediaType string) (string, bool) {
+	i := strings.LastIndexByte(mediaType, '+')
+	if i < 0 {
+		return "", false
+	}
+	return "application/" + mediaType[i+1:], true
+}
+
+// decodeCharset converts a body to UTF-8 according to the Content-Type's
+// charset parameter. Bodies without one, or declared UTF-8 or US-ASCII, are
+// passed through untouched.
+func decodeCharset(header, body string) (string, error) {
+	if header == "" {
+		return body, nil // ?format= without a Content-Type
+	}
+	_, params, err := parseContentType(header)
+	if err != nil {
+		return "", err
+	}
+	charset := strings.ToLower(params["charset"])
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return body, nil
+	}
+	enc, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || enc == nil {
+		return "", mediaError{status: 415, msg: "Unsupported charset " + charset}
+	}
+	decoded, err := enc.NewDecoder().String(body)
+	if err != nil {
+		return "", mediaError{status: 400, msg: "Body is not valid " + charset}
+	}
+	return decoded, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// Metering: accepted records are counted per tenant and calendar month (UTC)
+// in USAGE_TABLE_NAME, and again per cost center and project when tagged. A
+// tenant's quota is the quota.monthly_records attribute of its
+// TenantPolicies item; when a count crosses one of quotaThresholds a "Quota
+// Threshold Crossed" event goes to USAGE_EVENT_BUS, from where it fans out
+// to SNS (and so to webhook subscriptions).
+const (
+	usageSource     = "robust-processor"
+	usageDetailType = "Quota Threshold Crossed"
+	// settingsTTL bounds how stale cached tenant settings may be
+	settingsTTL = time.Minute
+)
+
+// quotaThresholds are the percentages of quota that are announced
+var quotaThresholds = []int64{80, 100}
+
+var (
+	usageTableName    string
+	usageEventBus     string
+	eventBridgeClient *eventbridge.Client
+)
+
+// tenantQuota is the quota attribute of a TenantPolicies item
+type tenantQuota struct {
+	// MonthlyRecords is the records a tenant may submit per month; 0 is unmetered
+	MonthlyRecords int64 `dynamodbav:"monthly_records"`
+	// RequestsPerMinute and BytesPerDay are enforced rate limits (see
+	// admit); 0 is unlimited
+	RequestsPerMinute int64 `dynamodbav:"requests_per_minute"`
+	BytesPerDay       int64 `dynamodbav:"bytes_per_day"`
+}
+
+// tenantSettings are the attributes of a TenantPolicies item ingest reads:
+// the quota and the default cost tags
+type tenantSettings struct {
+	Quota tenantQuota `dynamodbav:"quota"`
+	model.CostTags
+	// SignResponses asks for signed acknowledgements (see signedAck)
+	SignResponses bool `dynamodbav:"sign_responses"`
+	// AllowedIPs restricts the addresses records may come from (see
+	// allowedSource)
+	AllowedIPs []string `dynamodbav:"allowed_ips"`
+}
+
+type cachedSettings struct {
+	settings  tenantSettings
+	fetchedAt time.Time
+}
+
+var (
+	settingsMu    sync.Mutex
+	settingsCache = map[string]cachedSettings{}
+)
+
+// thresholdCrossing is the detail of a quota threshold event
+type thresholdCrossing struct {
+	TenantID         string `json:"tenant_id"`
+	Period           string `json:"period"`
+	ThresholdPercent int64  `json:"threshold_percent"`
+	Records          int64  `json:"records"`
+	Quota            int64  `json:"quota"`
+}
+
+// meter adds accepted records to the tenant's usage for the month, and to
+// the rollup of their cost tags, and announces any threshold it crossed.
+// The counter is an atomic ADD, so of all concurrent requests exactly one
+// sees each threshold pass. Metering is best effort and never fails the
+// request.
+func meter(ctx context.Context, tenantID string, tags model.CostTags, records, bytes int) {
+	emitMetric("RecordsAccepted", float64(records), "Count", tags.Attributes())
+	if usageTableName == "" {
+		return
+	}
+	period := time.Now().UTC().Format("2006-01")
+	out, err := addUsage(ctx, tenantID, period, records, bytes)
+	if err == nil && !tags.IsZero() {
+		// Rollups sort after the month's total: 2025-01#cost_center#project
+		_, err = addUsage(ctx, tenantID, period+"#"+tags.CostCenter+"#"+tags.Project, records, bytes)
+	}
+	if err != nil {
+		slog.Warn("Failed to meter usage", "tenant_id", tenantID, "error", err)
+		emitMetric("MeteringFailures", 1, "Count", nil)
+		return
+	}
+	var usage struct {
+		Records int64 `dynamodbav:"records"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Attributes, &usage); err != nil {
+		return
+	}
+
+	quota := lookupSettings(ctx, tenantID).Quota
+	if quota.MonthlyRecords <= 0 {
+		return
+	}
+	before := usage.Records - int64(records)
+	for _, pct := range quotaThresholds {
+		// Ceiling, so 80% of 7 is met at 6 records, not 5
+		limit := (quota.MonthlyRecords*pct + 99) / 100
+		if before < limit && usage.Records >= limit {
+			announceThreshold(ctx, thresholdCrossing{
+				TenantID:         tenantID,
+				Period:           period,
+				ThresholdPercent: pct,
+				Records:          usage.Records,
+				Quota:            quota.MonthlyRecords,
+			})
+		}
+	}
+}
+
+// addUsage atomically adds to one usage item and returns its new counts
+func addUsage(ctx context.Context, tenantID, period string, records, bytes int) (*dynamodb.UpdateItemOutput, error) {
+	return dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usageTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"period":    &types.AttributeValueMemberS{Value: period},
+		},
+		UpdateExpression: aws.String("ADD records :r, bytes :b"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":r": &types.AttributeValueMemberN{Value: strconv.Itoa(records)},
+			":b": &types.AttributeValueMemberN{Value: strconv.Itoa(bytes)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+}
+
+// lookupSettings returns the tenant's settings, cached for settingsTTL. A
+// failed read serves the previous value, or none if there is none.
+func lookupSettings(ctx context.Context, tenantID string) tenantSettings {
+	settingsMu.Lock()
+	cached, ok := settingsCache[tenantID]
+	settingsMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < settingsTTL {
+		return cached.settings
+	}
+	if policies.Table == "" {
+		return tenantSettings{}
+	}
+
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(policies.Table),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		ProjectionExpression: aws.String("quota, cost_center, project, sign_responses, allowed_ips"),
+	})
+	if err != nil {
+		slog.Warn("Failed to load tenant settings", "tenant_id", tenantID, "error", err)
+		return cached.settings
+	}
+	var settings tenantSettings
+	if err := attributevalue.UnmarshalMap(out.Item, &settings); err != nil {
+		slog.Warn("Invalid tenant settings", "tenant_id", tenantID, "error", err)
+	}
+
+	settingsMu.Lock()
+	settingsCache[tenantID] = cachedSettings{settings: settings, fetchedAt: time.Now()}
+	settingsMu.Unlock()
+	return settings
+}
+
+// announceThreshold publishes one crossing. There is no retry: a lost event
+// is counted, and the crossing stays visible in the usage table.
+func announceThreshold(ctx context.Context, c thresholdCrossing) {
+	slog.Info("Quota threshold crossed", "tenant_id", c.TenantID, "period", c.Period, "threshold_percent", c.ThresholdPercent)
+	if usageEventBus == "" {
+		return
+	}
+	detail, _ := json.Marshal(c)
+	out, err := eventBridgeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{{
+			EventBusName: aws.String(usageEventBus),
+			Source:       aws.String(usageSource),
+			DetailType:   aws.String(usageDetailType),
+			Detail:       aws.String(string(detail)),
+		}},
+	})
+	if err != nil || out.FailedEntryCount > 0 {
+		slog.Warn("Failed to announce quota threshold", "tenant_id", c.TenantID, "error", err)
+		emitMetric("QuotaEventFailures", 1, "Count", nil)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"robust-processor/internal/prefilter"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// handleNDJSON accepts application/x-ndjson posted to /logs: one record per
+// line in the JSON upload shape, blank lines skipped. Lines are validated
+// and published independently, as in a batch; every item carries its line
+// number and the response lists the lines that were rejected.
+func handleNDJSON(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	headers := make(map[string]string)
+	for k, v := range request.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	if r := prefilterConfig.Check(headers, request.Body); r != nil {
+		prefilter.Record(r, "handler")
+		return errorResponse(r.Status, r.Message), nil
+	}
+	body, err := decodeCharset(headers["content-type"], request.Body)
+	if err != nil {
+		status := 400
+		var merr mediaError
+		if errors.As(err, &merr) {
+			status = merr.status
+		}
+		return errorResponse(status, err.Error()), nil
+	}
+
+	var records []json.RawMessage
+	var lines []int
+	err = ndjsonRecords(strings.NewReader(body), func(line int, raw json.RawMessage) error {
+		if len(records) == maxBatchRecords {
+			return errTooManyRecords
+		}
+		records = append(records, raw)
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		return streamErrorResponse(err, "Malformed NDJSON body"), nil
+	}
+	if len(records) == 0 {
+		return errorResponse(400, "Empty batch"), nil
+	}
+
+	items, batch, payloads := prepareItems(ctx, headers, records)
+	sizes := make([]int, len(records))
+	rejected := []int{}
+	for i := range items {
+		items[i].Line = lines[i]
+		sizes[i] = len(records[i])
+		if items[i].Status == itemRejected {
+			rejected = append(rejected, lines[i])
+		}
+	}
+	status, response := submitBatch(ctx, items, batch, payloads, sizes)
+	response["rejected_lines"] = rejected
+	return batchResponse(status, response), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Normalizer converts one input format into the canonical LogEvent. Each
+// format lives in its own normalize_<source>.go file and registers itself
+// from init, so adding a format touches nothing else.
+type Normalizer interface {
+	// Source is recorded on every event this normalizer produces
+	Source() string
+	// Normalize fills tenant, text and any format-specific fields. LogID and
+	// Source are assigned by the handler unless the format supplies an ID.
+	Normalize(req ingestRequest) (LogEvent, error)
+}
+
+// ingestRequest is the transport-independent view normalizers work from
+type ingestRequest struct {
+	Headers map[string]string // lower-cased names
+	Query   map[string]string
+	Body    string
+}
+
+// clientError is a normalization failure reported to the caller as a 400
+type clientError string
+
+func (e clientError) Error() string { return string(e) }
+
+type registration struct {
+	normalizer Normalizer
+	mediaTypes []string
+}
+
+var registry []registration
+
+// register makes a normalizer selectable by its source name (via ?format=)
+// and by any of the given Content-Types
+func register(n Normalizer, mediaTypes ...string) {
+	registry = append(registry, registration{normalizer: n, mediaTypes: mediaTypes})
+}
+
+// selectNormalizer picks the normalizer for a request: an explicit ?format=
+// hint wins, otherwise the Content-Type's media type decides. A registered
+// type matches exactly (parameters aside, case-insensitive); failing that a
+// structured syntax suffix falls back to its base type, so
+// application/problem+json or application/vnd.acme+json are read as JSON.
+func selectNormalizer(req ingestRequest) (Normalizer, error) {
+	if format := req.Query["format"]; format != "" {
+		for _, r := range registry {
+			if r.normalizer.Source() == format || strings.TrimSuffix(r.normalizer.Source(), "_upload") == format {
+				return r.normalizer, nil
+			}
+		}
+		return nil, mediaError{status: 400, msg: "Unknown format " + strconv.Quote(format)}
+	}
+
+	mediaType, _, err := parseContentType(req.Headers["content-type"])
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range registry {
+		if slices.Contains(r.mediaTypes, mediaType) {
+			return r.normalizer, nil
+		}
+	}
+	if base, ok := suffixBase(mediaType); ok {
+		for _, r := range registry {
+			if slices.Contains(r.mediaTypes, base) {
+				return r.normalizer, nil
+			}
+		}
+	}
+	return nil, mediaError{status: 415, msg: "Unsupported Content-Type " + mediaType}
+}
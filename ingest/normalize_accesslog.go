@@ -0,0 +1,42 @@
+package main
+
+import (
+	"regexp"
+
+	"robust-processor/pkg/model"
+)
+
+// accessLogNormalizer parses an Apache/Nginx combined (or common) log line,
+// keeping the line as text and the request parts as fields
+type accessLogNormalizer struct{}
+
+var accessLogPattern = regexp.MustCompile(
+	`^(\S+) \S+ (\S+) \[([^\]]+)\] "(\S+) (\S+) [^"]*" (\d{3}) (\d+|-)(?: "([^"]*)" "([^"]*)")?`)
+
+func init() { register(accessLogNormalizer{}, "text/x-access-log") }
+
+func (accessLogNormalizer) Source() string { return "access_log" }
+
+func (accessLogNormalizer) Normalize(req ingestRequest) (LogEvent, error) {
+	event := LogEvent{LogEvent: model.LogEvent{TenantID: req.Headers["x-tenant-id"], OriginalText: req.Body}}
+	m := accessLogPattern.FindStringSubmatch(req.Body)
+	if m == nil {
+		return event, clientError("Invalid access log line")
+	}
+	event.Fields = map[string]string{
+		"remote_addr": m[1],
+		"user":        m[2],
+		"time":        m[3],
+		"method":      m[4],
+		"path":        m[5],
+		"status":      m[6],
+		"bytes":       m[7],
+	}
+	if m[8] != "" {
+		event.Fields["referer"] = m[8]
+	}
+	if m[9] != "" {
+		event.Fields["user_agent"] = m[9]
+	}
+	return event, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"robust-processor/pkg/model"
+)
+
+// gelfNormalizer accepts Graylog Extended Log Format messages. The tenant
+// comes from the _tenant_id additional field or X-Tenant-ID; other
+// additional fields are carried over without their underscore prefix.
+type gelfNormalizer struct{}
+
+func init() { register(gelfNormalizer{}, "application/gelf+json", "application/x-gelf") }
+
+func (gelfNormalizer) Source() string { return "gelf" }
+
+func (gelfNormalizer) Normalize(req ingestRequest) (LogEvent, error) {
+	event := LogEvent{LogEvent: model.LogEvent{TenantID: req.Headers["x-tenant-id"]}}
+	var msg map[string]interface{}
+	if err := json.Unmarshal([]byte(req.Body), &msg); err != nil {
+		return event, clientError("Invalid GELF message")
+	}
+
+	event.OriginalText, _ = msg["full_message"].(string)
+	if event.OriginalText == "" {
+		event.OriginalText, _ = msg["short_message"].(string)
+	}
+
+	event.Fields = map[string]string{}
+	event.TypedFields = map[string]interface{}{}
+	for _, key := range []string{"host", "level", "timestamp"} {
+		if v, ok := msg[key]; ok {
+			event.Fields[key], event.TypedFields[key] = fmt.Sprint(v), v
+		}
+	}
+	for key, v := range msg {
+		if !strings.HasPrefix(key, "_") || key == "_id" {
+			continue
+		}
+		if key == "_tenant_id" {
+			if tid, ok := v.(string); ok && tid != "" {
+				event.TenantID = tid
+			}
+			continue
+		}
+		name := strings.TrimPrefix(key, "_")
+		event.Fields[name], event.TypedFields[name] = fmt.Sprint(v), v
+	}
+	return event, nil
+}
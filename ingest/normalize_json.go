@@ -0,0 +1,73 @@
+package main
+
+import "encoding/json"
+
+// maxParts bounds the sub-documents accepted with one parent record
+const maxParts = 100
+
+// jsonNormalizer handles the native {"tenant_id", "text", "log_id", "fields"}
+// upload. Non-string field values are kept as their JSON encoding, and
+// validated against a schema with the types they were sent with. An
+// optional "parts" array carries sub-documents (e.g. a ticket's comments),
+// each with its own text, log_id and fields. "encryption": "client" marks
+// text the tenant encrypted itself; parts inherit it, and the record's
+// "priority".
+type jsonNormalizer struct{}
+
+func init() { register(jsonNormalizer{}, "application/json") }
+
+func (jsonNormalizer) Source() string { return "json_upload" }
+
+func (jsonNormalizer) Normalize(req ingestRequest) (LogEvent, error) {
+	var bodyMap map[string]interface{}
+	if err := json.Unmarshal([]byte(req.Body), &bodyMap); err != nil {
+		return LogEvent{}, clientError("Invalid JSON")
+	}
+	event := decodeJSONEvent(bodyMap)
+	if tid, ok := bodyMap["tenant_id"].(string); ok {
+		event.TenantID = tid
+	}
+
+	parts, _ := bodyMap["parts"].([]interface{})
+	if len(parts) > maxParts {
+		return event, clientError("Too many parts")
+	}
+	for _, p := range parts {
+		partMap, ok := p.(map[string]interface{})
+		if !ok {
+			return event, clientError("Invalid part")
+		}
+		event.Parts = append(event.Parts, decodeJSONEvent(partMap))
+	}
+	return event, nil
+}
+
+// decodeJSONEvent reads the per-document keys shared by records and parts
+func decodeJSONEvent(m map[string]interface{}) LogEvent {
+	var event LogEvent
+	if txt, ok := m["text"].(string); ok {
+		event.OriginalText = txt
+	}
+	if lid, ok := m["log_id"].(string); ok {
+		event.LogID = lid
+	}
+	if enc, ok := m["encryption"].(string); ok {
+		event.Encryption = enc
+	}
+	if p, ok := m["priority"].(string); ok {
+		event.Priority = p
+	}
+	if fields, ok := m["fields"].(map[string]interface{}); ok && len(fields) > 0 {
+		event.Fields = make(map[string]string, len(fields))
+		event.TypedFields = fields
+		for k, v := range fields {
+			if str, ok := v.(string); ok {
+				event.Fields[k] = str
+				continue
+			}
+			encoded, _ := json.Marshal(v)
+			event.Fields[k] = string(encoded)
+		}
+	}
+	return event
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"robust-processor/pkg/model"
+)
+
+// syslogNormalizer accepts a single syslog line as rsyslog and syslog-ng
+// forward it, in RFC 5424 or RFC 3164 (BSD) form. The <PRI> prefix is decoded
+// into facility and severity and the header into timestamp, host, app_name
+// and, where present, procid and msgid; the message is kept as the text.
+// Timestamps are kept as sent, since RFC 3164 ones carry no year or zone.
+type syslogNormalizer struct{}
+
+var (
+	// syslog5424Header is VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID,
+	// followed by the structured data and message
+	syslog5424Header = regexp.MustCompile(`^1 (\S+) (\S+) (\S+) (\S+) (\S+) (.*)$`)
+	// syslog3164Header is TIMESTAMP HOSTNAME TAG: MSG; rsyslog's forwarding
+	// templates put an RFC 3339 timestamp where BSD syslog has "Mmm dd hh:mm:ss"
+	syslog3164Header = regexp.MustCompile(
+		`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (\S+) ([^\s:\[]+)(?:\[([^\]]*)\])?: ?(.*)$`)
+)
+
+func init() { register(syslogNormalizer{}, "application/syslog") }
+
+func (syslogNormalizer) Source() string { return "syslog" }
+
+func (syslogNormalizer) Normalize(req ingestRequest) (LogEvent, error) {
+	line := strings.TrimRight(req.Body, "\r\n")
+	event := LogEvent{LogEvent: model.LogEvent{TenantID: req.Headers["x-tenant-id"], OriginalText: line}}
+
+	if !strings.HasPrefix(line, "<") {
+		return event, nil
+	}
+	end := strings.IndexByte(line, '>')
+	pri, err := strconv.Atoi(line[1:max(end, 1)])
+	if end < 2 || end > 4 || err != nil || pri > 191 {
+		return event, clientError("Invalid syslog priority")
+	}
+	rest := line[end+1:]
+	event.OriginalText = rest
+	event.Fields = map[string]string{
+		"facility": strconv.Itoa(pri / 8),
+		"severity": strconv.Itoa(pri % 8),
+	}
+
+	var msg string
+	if m := syslog5424Header.FindStringSubmatch(rest); m != nil {
+		sd, tail, ok := splitStructuredData(m[6])
+		if !ok {
+			return event, clientError("Invalid syslog structured data")
+		}
+		setSyslogField(event.Fields, "timestamp", m[1])
+		setSyslogField(event.Fields, "host", m[2])
+		setSyslogField(event.Fields, "app_name", m[3])
+		setSyslogField(event.Fields, "procid", m[4])
+		setSyslogField(event.Fields, "msgid", m[5])
+		setSyslogField(event.Fields, "structured_data", sd)
+		msg = strings.TrimPrefix(tail, "\ufeff")
+	} else if m := syslog3164Header.FindStringSubmatch(rest); m != nil {
+		event.Fields["timestamp"] = m[1]
+		event.Fields["host"] = m[2]
+		event.Fields["app_name"] = m[3]
+		setSyslogField(event.Fields, "procid", m[4])
+		msg = m[5]
+	}
+	// A line without a recognizable header, or with an empty message, keeps
+	// everything after the priority as its text
+	if msg != "" {
+		event.OriginalText = msg
+	}
+	return event, nil
+}
+
+// setSyslogField records a header value unless it is the nil value "-"
+func setSyslogField(fields map[string]string, key, value string) {
+	if value != "" && value != "-" {
+		fields[key] = value
+	}
+}
+
+// splitStructuredData separates RFC 5424 structured data, "-" or one or more
+// [id param="value" ...] elements, from the message that follows it. Inside
+// a quoted value \" and \] are escapes.
+func splitStructuredData(s string) (sd, msg string, ok bool) {
+	if s == "-" || strings.HasPrefix(s, "- ") {
+		return "-", strings.TrimPrefix(s[1:], " "), true
+	}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		closed, quoted := false, false
+		for i++; i < len(s) && !closed; i++ {
+			switch {
+			case quoted && s[i] == '\\':
+				i++
+			case s[i] == '"':
+				quoted = !quoted
+			case !quoted && s[i] == ']':
+				closed = true
+			}
+		}
+		if !closed {
+			return "", "", false
+		}
+	}
+	if i == 0 || (i < len(s) && s[i] != ' ') {
+		return "", "", false
+	}
+	return s[:i], strings.TrimPrefix(s[i:], " "), true
+}
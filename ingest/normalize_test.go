@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+type normalizeCase struct {
+	name    string
+	headers map[string]string
+	body    string
+	// err is the clientError expected; the other fields are then unchecked
+	err    string
+	tenant string
+	text   string
+	fields map[string]string
+	parts  int
+}
+
+// normalizeCases are keyed by Source; every registered normalizer must
+// have some, malformed input among them
+var normalizeCases = map[string][]normalizeCase{
+	"text_upload": {
+		{name: "plain", headers: map[string]string{"x-tenant-id": "acme"}, body: "hello", tenant: "acme", text: "hello"},
+		{name: "kept as sent", headers: map[string]string{"x-tenant-id": "acme"}, body: " \x00\xff{not json\n", tenant: "acme", text: " \x00\xff{not json\n"},
+		{name: "no tenant", body: "hello", text: "hello"},
+	},
+	"json_upload": {
+		{name: "record", body: `{"tenant_id":"acme","text":"hi","fields":{"a":"b","n":1,"o":{"x":true}}}`,
+			tenant: "acme", text: "hi", fields: map[string]string{"a": "b", "n": "1", "o": `{"x":true}`}},
+		{name: "parts", body: `{"tenant_id":"acme","text":"ticket","parts":[{"text":"c1"},{"text":"c2","log_id":"x"}]}`,
+			tenant: "acme", text: "ticket", parts: 2},
+		{name: "tenant not a string", body: `{"tenant_id":7,"text":"hi"}`, text: "hi"},
+		{name: "malformed", body: `{"tenant_id":"acme",`, err: "Invalid JSON"},
+		{name: "array", body: `[{"text":"hi"}]`, err: "Invalid JSON"},
+		{name: "bad part", body: `{"tenant_id":"acme","text":"hi","parts":["c1"]}`, err: "Invalid part"},
+		{name: "too many parts", body: `{"text":"hi","parts":[` + repeatJSON(`{"text":"p"}`, maxParts+1) + `]}`, err: "Too many parts"},
+	},
+	"syslog": {
+		{name: "rfc 5424", headers: map[string]string{"x-tenant-id": "acme"},
+			body:   "<165>1 2024-05-01T12:00:00Z web01 app 42 ID47 [ex@1 k=\"v\\]\"] started\r\n",
+			tenant: "acme", text: "started",
+			fields: map[string]string{"facility": "20", "severity": "5", "timestamp": "2024-05-01T12:00:00Z", "host": "web01",
+				"app_name": "app", "procid": "42", "msgid": "ID47", "structured_data": `[ex@1 k="v\]"]`}},
+		{name: "rfc 5424 nil values", body: "<14>1 2024-05-01T12:00:00Z host - - - - msg",
+			text: "msg", fields: map[string]string{"facility": "1", "severity": "6", "timestamp": "2024-05-01T12:00:00Z", "host": "host"}},
+		{name: "rfc 3164", body: "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed",
+			text: "'su root' failed", fields: map[string]string{"facility": "4", "severity": "2", "timestamp": "Oct 11 22:14:15",
+				"host": "mymachine", "app_name": "su", "procid": "230"}},
+		{name: "no header", body: "<13>just text", text: "just text", fields: map[string]string{"facility": "1", "severity": "5"}},
+		{name: "no priority", body: "plain line", text: "plain line"},
+		{name: "priority too large", body: "<192>1 - - - - - - x", err: "Invalid syslog priority"},
+		{name: "priority not a number", body: "<ab>x", err: "Invalid syslog priority"},
+		{name: "unclosed priority", body: "<13", err: "Invalid syslog priority"},
+		{name: "empty priority", body: "<>x", err: "Invalid syslog priority"},
+		{name: "unclosed structured data", body: `<13>1 2024-05-01T12:00:00Z h a p m [ex@1 k="v] msg`, err: "Invalid syslog structured data"},
+		{name: "structured data not followed by a space", body: "<13>1 2024-05-01T12:00:00Z h a p m [ex@1]msg", err: "Invalid syslog structured data"},
+	},
+	"gelf": {
+		{name: "full message", headers: map[string]string{"x-tenant-id": "acme"},
+			body:   `{"version":"1.1","host":"web01","short_message":"short","full_message":"full","level":3,"_user":"u1","_id":"skip"}`,
+			tenant: "acme", text: "full", fields: map[string]string{"host": "web01", "level": "3", "user": "u1"}},
+		{name: "tenant field", headers: map[string]string{"x-tenant-id": "header"},
+			body:   `{"short_message":"short","_tenant_id":"acme","timestamp":1700000000.5}`,
+			tenant: "acme", text: "short", fields: map[string]string{"timestamp": "1.7000000005e+09"}},
+		{name: "empty tenant field", headers: map[string]string{"x-tenant-id": "header"},
+			body: `{"short_message":"short","_tenant_id":""}`, tenant: "header", text: "short", fields: map[string]string{}},
+		{name: "malformed", body: `{"short_message":`, err: "Invalid GELF message"},
+		{name: "not an object", body: `"short"`, err: "Invalid GELF message"},
+	},
+	"access_log": {
+		{name: "combined", headers: map[string]string{"x-tenant-id": "acme"},
+			body:   `203.0.113.7 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/4.08"`,
+			tenant: "acme", text: `203.0.113.7 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/4.08"`,
+			fields: map[string]string{"remote_addr": "203.0.113.7", "user": "frank", "time": "10/Oct/2000:13:55:36 -0700", "method": "GET",
+				"path": "/a.gif", "status": "200", "bytes": "2326", "referer": "http://example.com/", "user_agent": "Mozilla/4.08"}},
+		{name: "common", body: `::1 - - [10/Oct/2000:13:55:36 -0700] "POST /login HTTP/1.1" 302 -`,
+			text: `::1 - - [10/Oct/2000:13:55:36 -0700] "POST /login HTTP/1.1" 302 -`,
+			fields: map[string]string{"remote_addr": "::1", "user": "-", "time": "10/Oct/2000:13:55:36 -0700", "method": "POST",
+				"path": "/login", "status": "302", "bytes": "-"}},
+		{name: "malformed", body: "GET /a.gif 200", err: "Invalid access log line"},
+		{name: "bad status", body: `1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 2000 1`, err: "Invalid access log line"},
+	},
+}
+
+func repeatJSON(item string, n int) string {
+	s := item
+	for range n - 1 {
+		s += "," + item
+	}
+	return s
+}
+
+func TestNormalizers(t *testing.T) {
+	for _, r := range registry {
+		n := r.normalizer
+		cases, ok := normalizeCases[n.Source()]
+		if !ok {
+			t.Errorf("normalizer %s has no test cases", n.Source())
+			continue
+		}
+		for _, tt := range cases {
+			t.Run(n.Source()+"/"+tt.name, func(t *testing.T) {
+				headers := tt.headers
+				if headers == nil {
+					headers = map[string]string{}
+				}
+				event, err := n.Normalize(ingestRequest{Headers: headers, Query: map[string]string{}, Body: tt.body})
+				if tt.err != "" {
+					var cerr clientError
+					if !errors.As(err, &cerr) || cerr.Error() != tt.err {
+						t.Fatalf("err = %v, want clientError %q", err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if event.TenantID != tt.tenant {
+					t.Errorf("tenant = %q, want %q", event.TenantID, tt.tenant)
+				}
+				if event.OriginalText != tt.text {
+					t.Errorf("text = %q, want %q", event.OriginalText, tt.text)
+				}
+				if !maps.Equal(event.Fields, tt.fields) {
+					t.Errorf("fields = %v, want %v", event.Fields, tt.fields)
+				}
+				if len(event.Parts) != tt.parts {
+					t.Errorf("%d parts, want %d", len(event.Parts), tt.parts)
+				}
+			})
+		}
+	}
+}
+
+func TestSelectNormalizer(t *testing.T) {
+	tests := []struct {
+		contentType string
+		format      string
+		want        string
+		status      int
+	}{
+		{contentType: "text/plain; charset=utf-8", want: "text_upload"},
+		{contentType: "Application/JSON", want: "json_upload"},
+		{contentType: "application/problem+json", want: "json_upload"},
+		{contentType: "application/gelf+json", want: "gelf"},
+		{contentType: "application/x-gelf", want: "gelf"},
+		{contentType: "application/syslog", want: "syslog"},
+		{contentType: "text/x-access-log", want: "access_log"},
+		{contentType: "application/json", format: "text", want: "text_upload"},
+		{contentType: "text/plain", format: "syslog", want: "syslog"},
+		{contentType: "application/xml", status: 415},
+		{contentType: "text/plain", format: "yaml", status: 400},
+	}
+	for _, tt := range tests {
+		req := ingestRequest{Headers: map[string]string{"content-type": tt.contentType}, Query: map[string]string{"format": tt.format}}
+		n, err := selectNormalizer(req)
+		if tt.status != 0 {
+			var merr mediaError
+			if !errors.As(err, &merr) || merr.status != tt.status {
+				t.Errorf("%s ?format=%s: err = %v, want status %d", tt.contentType, tt.format, err, tt.status)
+			}
+			continue
+		}
+		if err != nil || n.Source() != tt.want {
+			t.Errorf("%s ?format=%s: got %v, %v; want %s", tt.contentType, tt.format, n, err, tt.want)
+		}
+	}
+}
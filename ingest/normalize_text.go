@@ -0,0 +1,17 @@
+package main
+
+import "robust-processor/pkg/model"
+
+// textNormalizer takes the raw body as text, with the tenant in X-Tenant-ID
+type textNormalizer struct{}
+
+func init() { register(textNormalizer{}, "text/plain") }
+
+func (textNormalizer) Source() string { return "text_upload" }
+
+func (textNormalizer) Normalize(req ingestRequest) (LogEvent, error) {
+	return LogEvent{LogEvent: model.LogEvent{
+		TenantID:     req.Headers["x-tenant-id"],
+		OriginalText: req.Body,
+	}}, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"robust-processor/internal/tenantpolicy"
+	"robust-processor/pkg/model"
+	"robust-processor/pkg/pii"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// policies supplies the tenant's redaction rules for previews
+var policies *tenantpolicy.Store
+
+type previewRecord struct {
+	LogID      string            `json:"log_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Text       string            `json:"text"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Redactions map[string]int    `json:"redactions,omitempty"`
+}
+
+// handlePreview normalizes a request exactly like POST /logs and returns
+// each record as the tenant's redaction rules and schema would store it,
+// without queueing anything. Transforms are applied only by the worker, so
+// fields may differ there.
+func handlePreview(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	batch, fail := prepare(ctx, request)
+	if fail != nil {
+		return *fail, nil
+	}
+	tenantID := batch[0].TenantID
+	policyCtx, cancel := stage(ctx, "policy")
+	defer cancel()
+	r, version, err := policies.Redactor(policyCtx, tenantID)
+	if err != nil {
+		var bad tenantpolicy.InvalidError
+		if errors.As(err, &bad) {
+			return errorResponse(422, bad.Error()), nil
+		}
+		if expired(policyCtx) {
+			return budgetResponse("policy", nil), nil
+		}
+		slog.Error("Policy lookup failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error"), nil
+	}
+
+	// prepare validated against these schemas, so they are cached
+	schemas := map[string]*pii.Schema{}
+	for _, event := range batch {
+		if event.SchemaID == "" || schemas[event.SchemaID] != nil {
+			continue
+		}
+		name, version, _ := pii.ParseRef(event.SchemaID)
+		schema, err := loadSchema(ctx, tenantID, name, version)
+		if err != nil {
+			slog.Error("Schema lookup failed", "tenant_id", tenantID, "schema", event.SchemaID, "error", err)
+			return errorResponse(500, "Internal server error"), nil
+		}
+		schemas[event.SchemaID] = schema
+	}
+
+	records := make([]previewRecord, len(batch))
+	for i, event := range batch {
+		counts := map[string]int{}
+		rec := previewRecord{LogID: event.LogID, ParentID: event.ParentID, Text: event.OriginalText}
+		// As in the worker, client-encrypted text is left as sent
+		if event.Encryption != model.ClientEncrypted {
+			rec.Text = r.RedactCounting(event.OriginalText, counts)
+		}
+		rec.Fields = pii.RedactFields(event.Fields, r, schemas[event.SchemaID], counts)
+		if len(counts) > 0 {
+			rec.Redactions = counts
+		}
+		records[i] = rec
+	}
+	return jsonResponse(200, map[string]interface{}{
+		"tenant_id":      tenantID,
+		"source":         batch[0].Source,
+		"policy_version": version,
+		"records":        records,
+	}), nil
+}
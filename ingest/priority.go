@@ -0,0 +1,20 @@
+package main
+
+import "robust-processor/pkg/model"
+
+// checkPriority settles an event's priority: X-Priority applies to records
+// that don't say. "high" events go to the priority lane when there is one
+// (see queueFor); "normal" is the same as none and is dropped.
+func checkPriority(headers map[string]string, event *LogEvent) error {
+	if event.Priority == "" {
+		event.Priority = headers["x-priority"]
+	}
+	switch event.Priority {
+	case model.PriorityHigh:
+		return nil
+	case "", model.PriorityNormal:
+		event.Priority = ""
+		return nil
+	}
+	return clientError("Unsupported priority " + event.Priority + `; use "high" or "normal"`)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// batchWriteLimit is the most items one BatchWriteItem call accepts
+	batchWriteLimit = 25
+	// queuedTTL expires stubs whose message never reached the worker, once
+	// SQS (14 days at most) can no longer deliver it
+	queuedTTL = 15 * 24 * time.Hour
+	// queuedHourLayout buckets stubs by UTC hour in the sparse queued_index,
+	// which the reconciliation job reads to find records never processed
+	queuedHourLayout = "2006-01-02T15"
+)
+
+// tableName is the logs table, where each accepted record gets a QUEUED
+// stub so GET /logs/{log_id} answers before the worker has run
+var tableName string
+
+// queuedWriters bounds the stub writes in flight for one request
+const queuedWriters = 10
+
+// stubCondition lets a stub replace nothing, another stub, or a FAILED
+// record that wasn't deleted, so a failed record can be resent
+const stubCondition = "attribute_not_exists(log_id) OR #status = :queued OR (#status = :failed AND attribute_not_exists(deleted_at))"
+
+var stubValues = map[string]types.AttributeValue{
+	":queued": &types.AttributeValueMemberS{Value: "QUEUED"},
+	":failed": &types.AttributeValueMemberS{Value: "FAILED"},
+}
+
+// writeQueued stores a QUEUED stub for each event. Stubs are written before
+// the events are published, so the worker's result always replaces the
+// stub and never the other way round. A stub is only written under
+// stubCondition, which the worker's condition in internal/worker/dedupe.go
+// then accepts: a resent log_id that is already processed or soft-deleted
+// keeps its record, and the worker drops the resend as a duplicate. Stubs carry
+// no content. Writing them is best effort: without one, the lookup is a
+// 404 until the record is processed and the reconciliation job cannot
+// notice it going missing.
+func writeQueued(ctx context.Context, batch []LogEvent) {
+	if tableName == "" {
+		return
+	}
+	now := time.Now().UTC()
+	queuedAt := now.Format(time.RFC3339)
+	queuedHour := now.Format(queuedHourLayout)
+	expiresAt := strconv.FormatInt(now.Add(queuedTTL).Unix(), 10)
+
+	// A key sent twice in one request gets one stub
+	seen := make(map[string]bool, len(batch))
+	items := make([]map[string]types.AttributeValue, 0, len(batch))
+	for _, event := range batch {
+		key := event.TenantID + "#" + event.LogID
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		item := map[string]types.AttributeValue{
+			"tenant_id":   &types.AttributeValueMemberS{Value: event.TenantID},
+			"log_id":      &types.AttributeValueMemberS{Value: event.LogID},
+			"source":      &types.AttributeValueMemberS{Value: event.Source},
+			"status":      &types.AttributeValueMemberS{Value: "QUEUED"},
+			"queued_at":   &types.AttributeValueMemberS{Value: queuedAt},
+			"queued_hour": &types.AttributeValueMemberS{Value: queuedHour},
+			"expires_at":  &types.AttributeValueMemberN{Value: expiresAt},
+		}
+		if event.ParentID != "" {
+			item["parent_id"] = &types.AttributeValueMemberS{Value: event.ParentID}
+		}
+		if event.Part > 0 {
+			item["part"] = &types.AttributeValueMemberN{Value: strconv.Itoa(event.Part)}
+		}
+		if event.BatchID != "" {
+			item["batch_id"] = &types.AttributeValueMemberS{Value: event.BatchID}
+		}
+		items = append(items, item)
+	}
+
+	// BatchWriteItem can't be conditional, so each stub is its own put
+	var failed, kept atomic.Int64
+	slots := make(chan struct{}, queuedWriters)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName:                 aws.String(tableName),
+				Item:                      item,
+				ConditionExpression:       aws.String(stubCondition),
+				ExpressionAttributeNames:  map[string]string{"#status": "status"},
+				ExpressionAttributeValues: stubValues,
+			})
+			var conditional *types.ConditionalCheckFailedException
+			switch {
+			case errors.As(err, &conditional):
+				kept.Add(1)
+			case err != nil:
+				slog.Warn("Failed to write queued status", "error", err)
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := failed.Load(); n > 0 {
+		emitMetric("QueuedStatusFailures", float64(n), "Count", nil)
+	}
+	if n := kept.Load(); n > 0 {
+		emitMetric("QueuedStubsSkipped", float64(n), "Count", nil)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Rate limits: a tenant's quota may also set requests_per_minute and
+// bytes_per_day. Each is a fixed-window counter in USAGE_TABLE_NAME, under
+// the period minute#<YYYY-MM-DDTHH:MM> or day#<YYYY-MM-DD> (UTC), raised by
+// a conditional ADD so that concurrent requests can't overshoot: a token
+// bucket's refill can't be computed in an update expression. Counters
+// expire through the table's TTL once their window has passed. A request
+// over a limit is refused with 429 and Retry-After, the end of the window.
+// The limiter fails open: when the counters can't be read, requests pass.
+
+// limitError is a request refused for a tenant's rate limit
+type limitError struct {
+	retryAfter time.Duration
+	msg        string
+}
+
+func (e limitError) Error() string { return e.msg }
+
+// admit counts one request of size bytes against the tenant's limits
+func admit(ctx context.Context, tenantID string, size int) error {
+	if usageTableName == "" {
+		return nil
+	}
+	quota := lookupSettings(ctx, tenantID).Quota
+	if quota.RequestsPerMinute <= 0 && quota.BytesPerDay <= 0 {
+		return nil
+	}
+	limitCtx, cancel := stage(ctx, "limit")
+	defer cancel()
+
+	now := time.Now().UTC()
+	if quota.RequestsPerMinute > 0 {
+		end := now.Truncate(time.Minute).Add(time.Minute)
+		period := "minute#" + now.Format("2006-01-02T15:04")
+		if err := addWithin(limitCtx, tenantID, period, "requests", 1, quota.RequestsPerMinute, end); err != nil {
+			return limited(tenantID, "requests_per_minute", end.Sub(now), err)
+		}
+	}
+	if quota.BytesPerDay > 0 {
+		end := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		period := "day#" + now.Format("2006-01-02")
+		if err := addWithin(limitCtx, tenantID, period, "bytes", int64(size), quota.BytesPerDay, end); err != nil {
+			return limited(tenantID, "bytes_per_day", end.Sub(now), err)
+		}
+	}
+	return nil
+}
+
+// errOverLimit is addWithin refusing to pass a limit
+var errOverLimit = errors.New("over limit")
+
+// addWithin adds n to a window's counter unless that would take it past
+// limit. The window's item expires an hour after it ends.
+func addWithin(ctx context.Context, tenantID, period, counter string, n, limit int64, end time.Time) error {
+	if n > limit {
+		return errOverLimit
+	}
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usageTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"period":    &types.AttributeValueMemberS{Value: period},
+		},
+		UpdateExpression:         aws.String("ADD #counter :n SET expires_at = :exp"),
+		ConditionExpression:      aws.String("attribute_not_exists(#counter) OR #counter <= :max"),
+		ExpressionAttributeNames: map[string]string{"#counter": counter},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":n":   &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)},
+			":max": &types.AttributeValueMemberN{Value: strconv.FormatInt(limit-n, 10)},
+			":exp": &types.AttributeValueMemberN{Value: strconv.FormatInt(end.Add(time.Hour).Unix(), 10)},
+		},
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if errors.As(err, &conditional) {
+		return errOverLimit
+	}
+	return err
+}
+
+// limited turns addWithin's outcome into admit's: a limitError when over the
+// limit, nothing (fail open) when the counter couldn't be updated
+func limited(tenantID, limit string, retryAfter time.Duration, err error) error {
+	if !errors.Is(err, errOverLimit) {
+		slog.Warn("Rate limit check failed", "tenant_id", tenantID, "limit", limit, "error", err)
+		emitMetric("RateLimitFailures", 1, "Count", nil)
+		return nil
+	}
+	emitMetric("RequestsThrottled", 1, "Count", map[string]string{"limit": limit})
+	return limitError{retryAfter: retryAfter, msg: "Rate limit exceeded (" + limit + ")"}
+}
+
+// retryAfterSeconds renders a wait for the Retry-After header, rounded up
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// limitResponse is the 429 for a request over its tenant's rate limit
+func limitResponse(err limitError) events.APIGatewayV2HTTPResponse {
+	resp := errorResponse(429, err.msg)
+	resp.Headers = map[string]string{"Retry-After": retryAfterSeconds(err.retryAfter)}
+	return resp
+}
+
+// batchResponse is the response for submitBatch's result, with Retry-After
+// when items were refused for a rate limit
+func batchResponse(status int, response map[string]interface{}) events.APIGatewayV2HTTPResponse {
+	resp := jsonResponse(status, response)
+	if wait, ok := response["retry_after"].(string); ok {
+		resp.Headers["Retry-After"] = wait
+	}
+	return resp
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// handlerFunc serves one route
+type handlerFunc func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
+
+type route struct {
+	method, path string
+	handle       handlerFunc
+}
+
+// routes are every endpoint of the ingest Lambda. API Gateway forwards each
+// of them to this one function; new endpoints are added here, not as new
+// Lambdas. POST /ingest is the original path, kept for existing clients.
+// Every route but /health takes records and is authenticated, and those
+// that queue them may sign their acknowledgements.
+var routes = []route{
+	{"POST", "/logs", authenticated(signedAck(handleLogs))},
+	{"POST", "/logs/batch", authenticated(signedAck(handleBatch))},
+	{"POST", "/ingest", authenticated(signedAck(handleLogs))},
+	{"POST", "/preview", authenticated(handlePreview)},
+	{"GET", "/health", handleHealth},
+}
+
+// handler dispatches by method and path: 404 for unknown paths, 405 with
+// an Allow header for a known path under another method. Every route runs
+// within the request budget and gets the body decoded and decompressed.
+func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestBudget)
+	defer cancel()
+	wire, merr := decodeBody(&request)
+	if merr != nil {
+		return errorResponse(merr.status, merr.msg), nil
+	}
+	ctx = context.WithValue(ctx, wireBodyKey{}, wire)
+	ctx = context.WithValue(ctx, sourceIPKey{}, request.RequestContext.HTTP.SourceIP)
+
+	method := request.RequestContext.HTTP.Method
+	path := strings.TrimSuffix(request.RawPath, "/")
+
+	var allowed []string
+	for _, r := range routes {
+		if r.path != path {
+			continue
+		}
+		if r.method == method {
+			return r.handle(ctx, request)
+		}
+		allowed = append(allowed, r.method)
+	}
+	if len(allowed) == 0 {
+		return errorResponse(404, "Not found"), nil
+	}
+	resp := errorResponse(405, "Method not allowed")
+	resp.Headers = map[string]string{"Allow": strings.Join(allowed, ", ")}
+	return resp, nil
+}
+
+// handleHealth is a liveness check; it touches no dependencies
+func handleHealth(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return jsonResponse(200, map[string]string{"status": "ok"}), nil
+}
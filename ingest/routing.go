@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+
+	"robust-processor/pkg/model"
+)
+
+// Pilot tenants listed in STAGING_TENANTS are published to STAGING_QUEUE_URL,
+// which a staging build of the worker consumes, so new detectors can be
+// tried on real traffic without exposing every tenant. Other tenants' high
+// priority events go to PRIORITY_QUEUE_URL when set, whose own worker keeps
+// interactive traffic moving while bulk loads fill the main queue.
+var (
+	stagingQueueURL  string
+	stagingTenants   map[string]bool
+	priorityQueueURL string
+)
+
+// parseTenantList reads a comma-separated tenant list
+func parseTenantList(s string) map[string]bool {
+	tenants := map[string]bool{}
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tenants[t] = true
+		}
+	}
+	return tenants
+}
+
+// queueFor returns the queue an event is published to
+func queueFor(event model.LogEvent) string {
+	if stagingQueueURL != "" && stagingTenants[event.TenantID] {
+		return stagingQueueURL
+	}
+	if priorityQueueURL != "" && event.Priority == model.PriorityHigh {
+		return priorityQueueURL
+	}
+	return queueURL
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"robust-processor/pkg/pii"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Schema registry: tenants store named, versioned JSON Schemas describing
+// their event fields and reference one per request with `X-Schema:
+// name@version`. Versions are immutable, so compiled schemas are cached for
+// the life of the execution environment.
+
+var schemaTableName string
+
+var errUnknownSchema = errors.New("unknown schema")
+
+var (
+	schemaMu    sync.Mutex
+	schemaCache = map[string]*pii.Schema{}
+)
+
+// validateSchema checks an event's fields against the referenced tenant
+// schema and, on success, tags the event with the schema id
+func validateSchema(ctx context.Context, event *LogEvent, ref string) error {
+	name, version, err := pii.ParseRef(ref)
+	if err != nil {
+		return clientError("X-Schema must be name@version")
+	}
+	schema, err := loadSchema(ctx, event.TenantID, name, version)
+	if errors.Is(err, errUnknownSchema) {
+		return clientError("Unknown schema " + ref)
+	}
+	if err != nil {
+		return err
+	}
+
+	fields := event.TypedFields
+	if fields == nil {
+		fields = pii.StringFields(event.Fields)
+	}
+	if err := schema.Validate(fields); err != nil {
+		var verr pii.ValidationError
+		if errors.As(err, &verr) {
+			return clientError(verr.Error())
+		}
+		return err
+	}
+
+	event.SchemaID = fmt.Sprintf("%s@%d", name, version)
+	return nil
+}
+
+func loadSchema(ctx context.Context, tenantID, name string, version int) (*pii.Schema, error) {
+	key := fmt.Sprintf("%s@%d", pii.RegistryKey(tenantID, name), version)
+	schemaMu.Lock()
+	schema, ok := schemaCache[key]
+	schemaMu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	if schemaTableName == "" {
+		return nil, errUnknownSchema
+	}
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(schemaTableName),
+		Key: map[string]types.AttributeValue{
+			"schema_name": &types.AttributeValueMemberS{Value: pii.RegistryKey(tenantID, name)},
+			"version":     &types.AttributeValueMemberN{Value: strconv.Itoa(version)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := out.Item["schema"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, errUnknownSchema
+	}
+
+	schema, err = pii.Compile(key, doc.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaMu.Lock()
+	schemaCache[key] = schema
+	schemaMu.Unlock()
+	return schema, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"robust-processor/pkg/pii"
+)
+
+// A JSON record's fields are validated with the types they were sent with,
+// though they are queued as strings
+func TestValidateSchemaTypes(t *testing.T) {
+	schema, err := pii.Compile("cart@1", `{"type": "object", "properties": {"quantity": {"type": "integer"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := pii.RegistryKey("acme", "cart") + "@1"
+	schemaMu.Lock()
+	schemaCache[key] = schema
+	schemaMu.Unlock()
+	defer func() {
+		schemaMu.Lock()
+		delete(schemaCache, key)
+		schemaMu.Unlock()
+	}()
+
+	tests := []struct {
+		body  string
+		valid bool
+	}{
+		{`{"tenant_id":"acme","text":"hi","fields":{"quantity":3}}`, true},
+		{`{"tenant_id":"acme","text":"hi","fields":{"quantity":"3"}}`, false},
+	}
+	for _, tt := range tests {
+		event, err := jsonNormalizer{}.Normalize(ingestRequest{Body: tt.body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateSchema(context.Background(), &event, "cart@1")
+		var cerr clientError
+		if tt.valid && err != nil || !tt.valid && !errors.As(err, &cerr) {
+			t.Errorf("%s: err = %v, want valid %v", tt.body, err, tt.valid)
+		}
+		if tt.valid && (event.SchemaID != "cart@1" || event.Fields["quantity"] != "3") {
+			t.Errorf("%s: schema %q, fields %v", tt.body, event.SchemaID, event.Fields)
+		}
+	}
+}
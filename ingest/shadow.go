@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+)
+
+// Shadow mode mirrors a sampled share of requests (SHADOW_SAMPLE_RATE, 0-1)
+// to SHADOW_QUEUE_URL with shadow set, so a candidate worker can process real
+// traffic into the shadow table for load and correctness testing
+var (
+	shadowQueueURL   string
+	shadowSampleRate float64
+)
+
+// mirror copies a request's events to the shadow queue when sampled. The
+// whole request is mirrored, parts included, or none of it. Shadow delivery
+// is best effort and never fails the request.
+func mirror(ctx context.Context, batch []LogEvent) {
+	if shadowQueueURL == "" || rand.Float64() >= shadowSampleRate {
+		return
+	}
+	for _, event := range batch {
+		shadow := event.LogEvent
+		shadow.Shadow = true
+		if err := publish(ctx, shadowQueueURL, shadow, event.CostTags); err != nil {
+			slog.Warn("Shadow mirror failed", "tenant_id", shadow.TenantID, "log_id", shadow.LogID, "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Size limits for multi-record bodies. Defaults match the API Gateway payload
+// cap and the SQS message cap; both can be lowered via env.
+var (
+	maxBodyBytes   int64 = 6 << 20
+	maxRecordBytes int64 = 256 << 10
+)
+
+var (
+	errBodyTooLarge   = errors.New("request body too large")
+	errRecordTooLarge = errors.New("record too large")
+	errNotArray       = errors.New("body is not a JSON array")
+	// errTooManyRecords is returned by record callbacks past maxBatchRecords
+	errTooManyRecords = errors.New("too many records")
+)
+
+func init() {
+	maxBodyBytes = envInt64("MAX_BODY_BYTES", maxBodyBytes)
+	maxRecordBytes = envInt64("MAX_RECORD_BYTES", maxRecordBytes)
+}
+
+// envInt64 reads a positive integer from env, falling back to def
+func envInt64(name string, def int64) int64 {
+	if n, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// limitedReader returns errBodyTooLarge once more than n bytes have been read
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func newBodyReader(r io.Reader) *limitedReader {
+	return &limitedReader{r: r, n: maxBodyBytes}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	// Read one byte past the limit so an exact-sized body still succeeds
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// jsonArrayRecords streams a JSON array, calling fn with each element's
+// 0-based index and raw bytes. A body that isn't an array is errNotArray.
+// Records are never accumulated, so memory is bounded by the largest single
+// record.
+func jsonArrayRecords(r io.Reader, fn func(i int, raw json.RawMessage) error) error {
+	br := bufio.NewReader(newBodyReader(r))
+	if first, err := peekNonSpace(br); err != nil || first != '[' {
+		return errNotArray
+	}
+	dec := json.NewDecoder(br)
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for i := 0; dec.More(); i++ {
+		start := dec.InputOffset()
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		if dec.InputOffset()-start > maxRecordBytes {
+			return errRecordTooLarge
+		}
+		if err := fn(i, raw); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// ndjsonRecords streams newline-delimited JSON, calling fn with the 1-based
+// line number and raw bytes of each non-blank line. Lines aren't parsed, so
+// a malformed one is left for fn to reject.
+func ndjsonRecords(r io.Reader, fn func(line int, raw json.RawMessage) error) error {
+	scanner := bufio.NewScanner(newBodyReader(r))
+	// A buffer larger than the limit would raise it
+	scanner.Buffer(make([]byte, 0, min(64<<10, maxRecordBytes)), int(maxRecordBytes))
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		// The scanner reuses its buffer
+		if err := fn(n, json.RawMessage(bytes.Clone(line))); err != nil {
+			return err
+		}
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return errRecordTooLarge
+	}
+	return scanner.Err()
+}
+
+// csvRecords streams CSV rows, header included, calling fn with the 1-based
+// line each starts on. A row the reader can't parse is passed as its
+// *csv.ParseError, with no fields, and reading goes on with the next row.
+// The record slice is reused between calls and must not be retained by fn.
+func csvRecords(r io.Reader, fn func(line int, record []string, perr *csv.ParseError) error) error {
+	reader := csv.NewReader(newBodyReader(r))
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) && perr.Err != nil && !errors.Is(perr.Err, errBodyTooLarge) {
+			if err := fn(perr.StartLine, nil, perr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var size int64
+		for _, field := range record {
+			size += int64(len(field))
+		}
+		if size > maxRecordBytes {
+			return errRecordTooLarge
+		}
+		line, _ := reader.FieldPos(0)
+		if err := fn(line, record, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// streamErrorResponse answers a multi-record body its reader stopped on:
+// 413 for a body or record over its limit, 400 with msg for anything else
+func streamErrorResponse(err error, msg string) events.APIGatewayV2HTTPResponse {
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		return errorResponse(413, "Request body too large")
+	case errors.Is(err, errRecordTooLarge):
+		return errorResponse(413, fmt.Sprintf("Record too large (max %d bytes)", maxRecordBytes))
+	case errors.Is(err, errTooManyRecords):
+		return errorResponse(400, fmt.Sprintf("Too many records (max %d)", maxBatchRecords))
+	}
+	return errorResponse(400, msg)
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, br.UnreadByte()
+		}
+	}
+}
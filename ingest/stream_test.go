@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func withLimits(t *testing.T, body, record int64) {
+	t.Helper()
+	oldBody, oldRecord := maxBodyBytes, maxRecordBytes
+	maxBodyBytes, maxRecordBytes = body, record
+	t.Cleanup(func() { maxBodyBytes, maxRecordBytes = oldBody, oldRecord })
+}
+
+func TestJSONArrayRecords(t *testing.T) {
+	withLimits(t, 64, 16)
+	tests := []struct {
+		name string
+		body string
+		want []string
+		err  error
+	}{
+		{"array", ` [{"a":1}, 2, "x"]`, []string{`{"a":1}`, `2`, `"x"`}, nil},
+		{"empty", `[]`, nil, nil},
+		{"object", `{"a":1}`, nil, errNotArray},
+		{"ndjson", "{}\n{}", nil, errNotArray},
+		{"record too large", `[{"text":"0123456789abcdef"}]`, nil, errRecordTooLarge},
+		{"body too large", `[` + strings.Repeat(`1,`, 40) + `1]`, nil, errBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := jsonArrayRecords(strings.NewReader(tt.body), func(i int, raw json.RawMessage) error {
+				if i != len(got) {
+					t.Errorf("index %d, want %d", i, len(got))
+				}
+				got = append(got, string(raw))
+				return nil
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNDJSONRecords(t *testing.T) {
+	withLimits(t, 64, 16)
+	var lines []int
+	var raws []string
+	err := ndjsonRecords(strings.NewReader("{\"a\":1}\r\n\n  \nnot json\n{}"), func(line int, raw json.RawMessage) error {
+		lines, raws = append(lines, line), append(raws, string(raw))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []int{1, 4, 5}) || !slices.Equal(raws, []string{`{"a":1}`, "not json", "{}"}) {
+		t.Errorf("got lines %v records %q", lines, raws)
+	}
+
+	err = ndjsonRecords(strings.NewReader("{}\n"+strings.Repeat("x", 20)+"\n"), func(int, json.RawMessage) error { return nil })
+	if !errors.Is(err, errRecordTooLarge) {
+		t.Errorf("long line: err = %v, want errRecordTooLarge", err)
+	}
+	err = ndjsonRecords(strings.NewReader(strings.Repeat("{}\n", 30)), func(int, json.RawMessage) error { return nil })
+	if !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("long body: err = %v, want errBodyTooLarge", err)
+	}
+}
+
+func TestCSVRecords(t *testing.T) {
+	withLimits(t, 64, 16)
+	var lines []int
+	var rows [][]string
+	var malformed []int
+	err := csvRecords(strings.NewReader("text,n\nhello,1\n\"bad\"x,2\nbye,3\n"), func(line int, record []string, perr *csv.ParseError) error {
+		if perr != nil {
+			malformed = append(malformed, line)
+			return nil
+		}
+		lines, rows = append(lines, line), append(rows, slices.Clone(record))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []int{1, 2, 4}) || !slices.Equal(malformed, []int{3}) {
+		t.Errorf("got lines %v, malformed %v", lines, malformed)
+	}
+	if len(rows) != 3 || rows[2][0] != "bye" {
+		t.Errorf("got rows %q", rows)
+	}
+
+	noop := func(int, []string, *csv.ParseError) error { return nil }
+	if err := csvRecords(strings.NewReader("a,b\n"+strings.Repeat("x", 20)+",y\n"), noop); !errors.Is(err, errRecordTooLarge) {
+		t.Errorf("long row: err = %v, want errRecordTooLarge", err)
+	}
+	if err := csvRecords(strings.NewReader(strings.Repeat("a,b\n", 30)), noop); !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("long body: err = %v, want errBodyTooLarge", err)
+	}
+}
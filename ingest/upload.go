@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+
+	"robust-processor/internal/prefilter"
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+const (
+	// uploadField is the form field holding the log file
+	uploadField = "file"
+	// maxFormValue bounds the other form fields (tenant_id, split)
+	maxFormValue = 1024
+)
+
+// Split modes: one record per line, or per paragraph so that multi-line
+// entries such as stack traces stay whole
+const (
+	splitLine      = "line"
+	splitBlankLine = "blank_line"
+)
+
+// upload is a parsed multipart/form-data request
+type upload struct {
+	tenantID    string
+	split       string
+	filename    string
+	contentType string
+	text        string
+}
+
+// handleUpload accepts a log file posted as multipart/form-data to /logs.
+// The file part is split into records, one per line unless split is
+// blank_line, and each becomes its own event sharing a batch_id. The
+// tenant comes from a tenant_id form field or X-Tenant-ID, the split mode
+// from a split form field or ?split=. Records are accepted, rejected or
+// failed independently, as in a batch, and the response adds batch_id.
+func handleUpload(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	headers := make(map[string]string)
+	for k, v := range request.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	if r := prefilterConfig.Check(headers, request.Body); r != nil {
+		prefilter.Record(r, "handler")
+		return errorResponse(r.Status, r.Message), nil
+	}
+	up, err := parseUpload(headers["content-type"], request.Body)
+	if err == nil {
+		up.text, err = decodeCharset(up.contentType, up.text)
+	}
+	if err != nil {
+		status := 400
+		var merr mediaError
+		if errors.As(err, &merr) {
+			status = merr.status
+		}
+		return errorResponse(status, err.Error()), nil
+	}
+	if up.tenantID == "" {
+		up.tenantID = headers["x-tenant-id"]
+	}
+	if up.split == "" {
+		up.split = request.QueryStringParameters["split"]
+	}
+
+	if up.tenantID == "" {
+		return errorResponse(400, "Missing tenant_id"), nil
+	}
+	if err := authorizeTenant(ctx, up.tenantID); err != nil {
+		return errorResponse(403, err.Error()), nil
+	}
+	lines, err := splitUpload(up.text, up.split)
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+	if len(lines) == 0 {
+		return errorResponse(400, "Missing text content"), nil
+	}
+	if len(lines) > maxBatchRecords {
+		return errorResponse(400, fmt.Sprintf("Too many records (max %d); split the file", maxBatchRecords)), nil
+	}
+	tags, err := costTagsFor(ctx, headers, up.tenantID)
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+	// Every line of a file is protected and prioritized alike
+	var protection LogEvent
+	if err := checkEncryption(headers, &protection); err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+	if err := checkPriority(headers, &protection); err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+
+	batchID := uuid.New().String()
+	at := eventTime(headers, LogEvent{})
+	items := make([]batchItem, len(lines))
+	batch := make([]LogEvent, len(lines))
+	payloads := make([]string, len(lines))
+	sizes := make([]int, len(lines))
+	logIDs := newUploadLogIDs()
+	for i, l := range lines {
+		event := LogEvent{LogEvent: model.LogEvent{
+			TenantID:     up.tenantID,
+			OriginalText: l.text,
+			Source:       "file_upload",
+			BatchID:      batchID,
+			Fields:       map[string]string{"line": strconv.Itoa(l.number)},
+			Encryption:   protection.Encryption,
+			Priority:     protection.Priority,
+		}, CostTags: tags}
+		if up.filename != "" {
+			event.Fields["filename"] = up.filename
+		}
+		// Resending the file yields the same content IDs, whatever its batch
+		event.LogID = logIDs.next(event, at)
+		items[i] = batchItem{Index: i, Line: l.number, LogID: event.LogID, TenantID: event.TenantID}
+		payload, _ := json.Marshal(event.LogEvent)
+		if err := model.Validate(payload); err != nil {
+			items[i].Status, items[i].Error = itemRejected, err.Error()
+			continue
+		}
+		batch[i], payloads[i], sizes[i] = event, string(payload), len(l.text)
+	}
+
+	status, response := submitBatch(ctx, items, batch, payloads, sizes)
+	response["batch_id"] = batchID
+	return batchResponse(status, response), nil
+}
+
+// parseUpload reads the form: exactly one file part and the optional
+// tenant_id and split fields. Other fields are ignored.
+func parseUpload(contentType, body string) (upload, error) {
+	_, params, err := parseContentType(contentType)
+	if err != nil {
+		return upload{}, err
+	}
+	if params["boundary"] == "" {
+		return upload{}, mediaError{status: 400, msg: "Missing multipart boundary"}
+	}
+
+	var up upload
+	found := false
+	reader := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return upload{}, clientError("Malformed multipart body")
+		}
+		switch part.FormName() {
+		case uploadField:
+			if found {
+				return upload{}, clientError("Only one file may be uploaded per request")
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return upload{}, clientError("Malformed multipart body")
+			}
+			found = true
+			up.filename, up.contentType, up.text = part.FileName(), part.Header.Get("Content-Type"), string(data)
+		case "tenant_id", "split":
+			data, err := io.ReadAll(io.LimitReader(part, maxFormValue+1))
+			if err != nil || len(data) > maxFormValue {
+				return upload{}, clientError("Malformed form field " + strconv.Quote(part.FormName()))
+			}
+			if part.FormName() == "tenant_id" {
+				up.tenantID = strings.TrimSpace(string(data))
+			} else {
+				up.split = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if !found {
+		return upload{}, clientError("Missing file part " + strconv.Quote(uploadField))
+	}
+	return up, nil
+}
+
+// uploadLine is one record of an upload and the line it starts on
+type uploadLine struct {
+	number int
+	text   string
+}
+
+// splitUpload splits a file into records, dropping blank ones. Lines end
+// in \n or \r\n; blank_line records keep their inner line breaks.
+func splitUpload(text, mode string) ([]uploadLine, error) {
+	if mode == "" {
+		mode = splitLine
+	}
+	if mode != splitLine && mode != splitBlankLine {
+		return nil, clientError(fmt.Sprintf("Unknown split %q (use %s or %s)", mode, splitLine, splitBlankLine))
+	}
+
+	var records []uploadLine
+	var current []string
+	start := 0
+	flush := func() {
+		if len(current) > 0 {
+			records = append(records, uploadLine{number: start, text: strings.Join(current, "\n")})
+		}
+		current = nil
+	}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if mode == splitLine {
+			records = append(records, uploadLine{number: i + 1, text: line})
+			continue
+		}
+		if len(current) == 0 {
+			start = i + 1
+		}
+		current = append(current, line)
+	}
+	flush()
+	return records, nil
+}
@@ -0,0 +1,298 @@
+// Package apikey authenticates callers by per-tenant credentials kept in
+// Secrets Manager: API keys, and secrets for HMAC-SHA256 request signatures.
+// Each tenant has one secret, named <prefix><tenant_id>, whose string is
+// {"keys": ["...", ...], "signing_secrets": ["...", ...]}; listing two of
+// either lets a tenant rotate without a window in which neither works.
+// Rotate moves replaced credentials to "previous_keys" and
+// "previous_signing_secrets", as {"value": "...", "until": "..."}, where
+// they keep working until their RFC 3339 "until". A
+// key known to be compromised is listed in "compromised_keys" as
+// {"key": "...", "mode": "reject" | "honeypot"}, which overrides "keys": it
+// is rejected, or with "honeypot" classified for callers to feign
+// acceptance, so whoever holds it learns nothing from the response.
+// Credentials are cached in memory, API keys only as SHA-256 digests, and
+// re-read once the cache is older than its TTL, or sooner when one doesn't
+// match, so a new credential works within seconds. The cache holds at most
+// maxCachedTenants tenants, those without a secret included.
+package apikey
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	// DefaultTTL is how long fetched keys are trusted without a re-read
+	DefaultTTL = 5 * time.Minute
+	// minRefresh bounds the re-reads unknown keys can cause per tenant
+	minRefresh = 30 * time.Second
+	// maxCachedTenants bounds the cache. Tenants without a secret are
+	// cached too, so unknown tenant IDs don't each cost a Secrets Manager
+	// read, and without a bound every one ever sent would stay in memory.
+	maxCachedTenants = 10000
+)
+
+// Store verifies API keys and request signatures against the tenants' secrets
+type Store struct {
+	// Prefix names the secrets: <Prefix><tenant_id>
+	Prefix string
+	TTL    time.Duration
+
+	secrets *secretsClient
+	// The cache is least recently used first out once it holds
+	// maxCachedTenants; order runs from most to least recently used
+	mu    sync.Mutex
+	cache map[string]*list.Element
+	order *list.List
+}
+
+type cachedKeys struct {
+	tenantID string
+	credentials
+	fetchedAt time.Time
+}
+
+// stale reports whether the cached credentials must be re-read: they are
+// older than ttl, or a replaced credential among them has retired
+func (c cachedKeys) stale(ttl time.Duration) bool {
+	return time.Since(c.fetchedAt) >= ttl || (!c.retireAt.IsZero() && !time.Now().Before(c.retireAt))
+}
+
+// credentials are a tenant's current API key digests and signing secrets,
+// with the replaced ones still in their overlap, and the digests of its
+// compromised keys with their mode
+type credentials struct {
+	digests     [][sha256.Size]byte
+	signing     [][]byte
+	compromised map[[sha256.Size]byte]string
+	// retireAt is when the first replaced credential among them stops
+	// working; zero when there are none
+	retireAt time.Time
+}
+
+// Verdict classifies an API key
+type Verdict int
+
+const (
+	// Invalid keys are unknown to the tenant
+	Invalid Verdict = iota
+	// Valid keys are among the tenant's current keys
+	Valid
+	// Revoked keys are compromised and to be rejected
+	Revoked
+	// Honeypot keys are compromised and to be answered as if valid, while
+	// nothing they send is processed
+	Honeypot
+)
+
+// Compromised key modes, as listed in a tenant's secret
+const (
+	ModeReject   = "reject"
+	ModeHoneypot = "honeypot"
+)
+
+// New returns a Store reading secrets with cfg's credentials and region
+func New(cfg aws.Config, prefix string, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{Prefix: prefix, TTL: ttl, secrets: newSecretsClient(cfg), cache: map[string]*list.Element{}, order: list.New()}
+}
+
+// Verify reports whether key is one of the tenant's current keys and not
+// compromised. A tenant without a secret has no valid keys.
+func (s *Store) Verify(ctx context.Context, tenantID, key string) (bool, error) {
+	verdict, err := s.Classify(ctx, tenantID, key)
+	return verdict == Valid, err
+}
+
+// Classify reports whether key is valid, compromised or unknown to the
+// tenant. Compromised keys are matched before current ones, so listing a
+// key as compromised takes effect without removing it from "keys".
+func (s *Store) Classify(ctx context.Context, tenantID, key string) (Verdict, error) {
+	if tenantID == "" || key == "" {
+		return Invalid, nil
+	}
+	digest := sha256.Sum256([]byte(key))
+	verdict := Invalid
+	_, err := s.check(ctx, tenantID, func(c credentials) bool {
+		verdict = Invalid
+		switch mode, ok := c.compromised[digest]; {
+		case ok && mode == ModeHoneypot:
+			verdict = Honeypot
+		case ok:
+			verdict = Revoked
+		case matches(c.digests, digest):
+			verdict = Valid
+		}
+		return verdict != Invalid
+	})
+	if err != nil {
+		return Invalid, err
+	}
+	return verdict, nil
+}
+
+// VerifySignature reports whether signature, hex and optionally prefixed
+// "sha256=", is the HMAC-SHA256 of body under one of the tenant's signing
+// secrets
+func (s *Store) VerifySignature(ctx context.Context, tenantID string, body []byte, signature string) (bool, error) {
+	sum, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if tenantID == "" || err != nil || len(sum) != sha256.Size {
+		return false, nil
+	}
+	return s.check(ctx, tenantID, func(c credentials) bool {
+		found := false
+		for _, secret := range c.signing {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(body)
+			found = hmac.Equal(mac.Sum(nil), sum) || found
+		}
+		return found
+	})
+}
+
+// check runs match against the tenant's cached credentials, re-reading them
+// when the cache is stale, or when match fails and they are old enough
+func (s *Store) check(ctx context.Context, tenantID string, match func(credentials) bool) (bool, error) {
+	cached, ok := s.cached(tenantID)
+	age := time.Since(cached.fetchedAt)
+	if ok && !cached.stale(s.TTL) {
+		if match(cached.credentials) {
+			return true, nil
+		}
+		if age < minRefresh {
+			return false, nil
+		}
+	}
+
+	creds, err := s.fetch(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+	s.store(cachedKeys{tenantID: tenantID, credentials: creds, fetchedAt: time.Now()})
+	return match(creds), nil
+}
+
+func (s *Store) cached(tenantID string) (cachedKeys, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.cache[tenantID]
+	if !ok {
+		return cachedKeys{}, false
+	}
+	s.order.MoveToFront(el)
+	return *el.Value.(*cachedKeys), true
+}
+
+func (s *Store) store(c cachedKeys) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.cache[c.tenantID]; ok {
+		*el.Value.(*cachedKeys) = c
+		s.order.MoveToFront(el)
+		return
+	}
+	s.cache[c.tenantID] = s.order.PushFront(&c)
+	if s.order.Len() > maxCachedTenants {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.cache, oldest.Value.(*cachedKeys).tenantID)
+	}
+}
+
+// forget drops a tenant's cached credentials
+func (s *Store) forget(tenantID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.cache[tenantID]; ok {
+		s.order.Remove(el)
+		delete(s.cache, tenantID)
+	}
+}
+
+// fetch reads a tenant's credentials; a missing secret yields none
+func (s *Store) fetch(ctx context.Context, tenantID string) (credentials, error) {
+	value, err := s.secrets.getSecretValue(ctx, s.Prefix+tenantID)
+	if errors.Is(err, errSecretNotFound) {
+		return credentials{}, nil
+	}
+	if err != nil {
+		return credentials{}, err
+	}
+	var secret tenantSecret
+	if err := json.Unmarshal([]byte(value), &secret); err != nil {
+		return credentials{}, fmt.Errorf("decode credentials of %s: %w", tenantID, err)
+	}
+	var creds credentials
+	now := time.Now()
+	for _, k := range secret.Keys {
+		if k != "" {
+			creds.digests = append(creds.digests, sha256.Sum256([]byte(k)))
+		}
+	}
+	for _, k := range secret.PreviousKeys {
+		if k.Value != "" && creds.overlaps(k, now) {
+			creds.digests = append(creds.digests, sha256.Sum256([]byte(k.Value)))
+		}
+	}
+	for _, k := range secret.SigningSecrets {
+		if k != "" {
+			creds.signing = append(creds.signing, []byte(k))
+		}
+	}
+	for _, k := range secret.PreviousSigningSecrets {
+		if k.Value != "" && creds.overlaps(k, now) {
+			creds.signing = append(creds.signing, []byte(k.Value))
+		}
+	}
+	for _, k := range secret.Compromised {
+		if k.Key == "" {
+			continue
+		}
+		if creds.compromised == nil {
+			creds.compromised = map[[sha256.Size]byte]string{}
+		}
+		// Anything but an explicit honeypot is rejected
+		mode := ModeReject
+		if k.Mode == ModeHoneypot {
+			mode = ModeHoneypot
+		}
+		creds.compromised[sha256.Sum256([]byte(k.Key))] = mode
+	}
+	return creds, nil
+}
+
+// overlaps reports whether a replaced credential still works at now, and
+// if so brings retireAt forward to its end
+func (c *credentials) overlaps(r retired, now time.Time) bool {
+	if !now.Before(r.Until) {
+		return false
+	}
+	if c.retireAt.IsZero() || r.Until.Before(c.retireAt) {
+		c.retireAt = r.Until
+	}
+	return true
+}
+
+// matches compares digests in constant time, so a response's timing says
+// nothing about how close a guess was
+func matches(digests [][sha256.Size]byte, digest [sha256.Size]byte) bool {
+	found := 0
+	for _, d := range digests {
+		found |= subtle.ConstantTimeCompare(d[:], digest[:])
+	}
+	return found == 1
+}
@@ -0,0 +1,41 @@
+package apikey
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCacheBounded(t *testing.T) {
+	// Without a secrets client any read from Secrets Manager would panic,
+	// so every answer below comes from the cache
+	s := &Store{TTL: DefaultTTL, cache: map[string]*list.Element{}, order: list.New()}
+	for i := range maxCachedTenants + 10 {
+		// Tenants without a secret are cached as having no credentials
+		s.store(cachedKeys{tenantID: strconv.Itoa(i), fetchedAt: time.Now()})
+		// Tenant 0 is read after every store, so it stays the most recently used
+		if _, ok := s.cached("0"); !ok {
+			t.Fatalf("tenant 0 evicted after %d stores", i+1)
+		}
+	}
+	if len(s.cache) != maxCachedTenants || s.order.Len() != maxCachedTenants {
+		t.Errorf("cache holds %d tenants (%d ordered), want %d", len(s.cache), s.order.Len(), maxCachedTenants)
+	}
+	for i := 1; i <= 10; i++ {
+		if _, ok := s.cached(strconv.Itoa(i)); ok {
+			t.Errorf("tenant %d still cached", i)
+		}
+	}
+
+	verdict, err := s.Classify(context.Background(), "11", "some-key")
+	if err != nil || verdict != Invalid {
+		t.Errorf("tenant without a secret: %v, %v; want Invalid from the cache", verdict, err)
+	}
+
+	s.forget("11")
+	if _, ok := s.cached("11"); ok || len(s.cache) != s.order.Len() {
+		t.Errorf("forgotten tenant still cached: %d entries, %d ordered", len(s.cache), s.order.Len())
+	}
+}
@@ -0,0 +1,138 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// tenantSecret is the part of a tenant's secret credentials are read from;
+// compromised keys and anything else in it are left as they are by Rotate
+type tenantSecret struct {
+	Keys                   []string  `json:"keys"`
+	SigningSecrets         []string  `json:"signing_secrets"`
+	PreviousKeys           []retired `json:"previous_keys"`
+	PreviousSigningSecrets []retired `json:"previous_signing_secrets"`
+	Compromised            []struct {
+		Key  string `json:"key"`
+		Mode string `json:"mode"`
+	} `json:"compromised_keys"`
+}
+
+// retired is a replaced credential, working until Until
+type retired struct {
+	Value string    `json:"value"`
+	Until time.Time `json:"until"`
+}
+
+// Rotation is what Rotate did. The new credentials are only ever returned
+// here, to be handed to the tenant; Fingerprint identifies the key in logs
+// and audit records without revealing it.
+type Rotation struct {
+	APIKey        string
+	SigningSecret string
+	// Fingerprint is the first 16 hex digits of the new key's SHA-256
+	Fingerprint string
+	// Retired counts the credentials moved into their overlap, and Dropped
+	// those whose overlap had ended
+	Retired int
+	Dropped int
+}
+
+// Rotate replaces the tenant's API keys, when keys is set, and signing
+// secrets, when signing is, by one fresh random credential each. Only
+// credentials the tenant has are rotated: a tenant that doesn't sign
+// requests gets no signing secret. The replaced ones move to the previous
+// lists and keep working for overlap, so senders can switch without a
+// window in which neither works; replaced credentials whose overlap has
+// ended are dropped. Services see the change within their cache TTL.
+func (s *Store) Rotate(ctx context.Context, tenantID string, keys, signing bool, overlap time.Duration) (Rotation, error) {
+	secretID := s.Prefix + tenantID
+	value, err := s.secrets.getSecretValue(ctx, secretID)
+	if errors.Is(err, errSecretNotFound) {
+		return Rotation{}, fmt.Errorf("tenant %s has no secret %s", tenantID, secretID)
+	}
+	if err != nil {
+		return Rotation{}, err
+	}
+	var raw map[string]json.RawMessage
+	var secret tenantSecret
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return Rotation{}, fmt.Errorf("decode credentials of %s: %w", tenantID, err)
+	}
+	if err := json.Unmarshal([]byte(value), &secret); err != nil {
+		return Rotation{}, fmt.Errorf("decode credentials of %s: %w", tenantID, err)
+	}
+
+	var r Rotation
+	now := time.Now().UTC()
+	until := now.Add(overlap)
+	if keys && len(secret.Keys) > 0 {
+		if r.APIKey, err = newCredential(); err != nil {
+			return Rotation{}, err
+		}
+		digest := sha256.Sum256([]byte(r.APIKey))
+		r.Fingerprint = hex.EncodeToString(digest[:8])
+		secret.PreviousKeys = r.retire(secret.PreviousKeys, secret.Keys, now, until)
+		secret.Keys = []string{r.APIKey}
+		raw["keys"], _ = json.Marshal(secret.Keys)
+		raw["previous_keys"], _ = json.Marshal(secret.PreviousKeys)
+	}
+	if signing && len(secret.SigningSecrets) > 0 {
+		if r.SigningSecret, err = newCredential(); err != nil {
+			return Rotation{}, err
+		}
+		secret.PreviousSigningSecrets = r.retire(secret.PreviousSigningSecrets, secret.SigningSecrets, now, until)
+		secret.SigningSecrets = []string{r.SigningSecret}
+		raw["signing_secrets"], _ = json.Marshal(secret.SigningSecrets)
+		raw["previous_signing_secrets"], _ = json.Marshal(secret.PreviousSigningSecrets)
+	}
+	if r.APIKey == "" && r.SigningSecret == "" {
+		return r, nil
+	}
+
+	updated, err := json.Marshal(raw)
+	if err != nil {
+		return Rotation{}, err
+	}
+	if err := s.secrets.putSecretValue(ctx, secretID, string(updated)); err != nil {
+		return Rotation{}, err
+	}
+	s.forget(tenantID)
+	return r, nil
+}
+
+// retire returns previous without the credentials whose overlap has ended,
+// and with current added, working until until
+func (r *Rotation) retire(previous []retired, current []string, now, until time.Time) []retired {
+	kept := []retired{}
+	for _, p := range previous {
+		if now.Before(p.Until) {
+			kept = append(kept, p)
+		} else {
+			r.Dropped++
+		}
+	}
+	for _, c := range current {
+		if c != "" {
+			kept = append(kept, retired{Value: c, Until: until})
+			r.Retired++
+		}
+	}
+	return kept
+}
+
+// newCredential returns 256 random bits, URL-safe base64 encoded
+func newCredential() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
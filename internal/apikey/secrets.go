@@ -0,0 +1,110 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// errSecretNotFound is Secrets Manager's ResourceNotFoundException
+var errSecretNotFound = errors.New("secret not found")
+
+// secretsClient makes the Secrets Manager calls needed, GetSecretValue and,
+// for rotation, PutSecretValue, over its JSON protocol with SigV4 signing from the SDK's core module. The
+// service's SDK module is not a dependency of this module.
+type secretsClient struct {
+	cfg    aws.Config
+	signer *v4.Signer
+	http   aws.HTTPClient
+}
+
+func newSecretsClient(cfg aws.Config) *secretsClient {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &secretsClient{cfg: cfg, signer: v4.NewSigner(), http: client}
+}
+
+// getSecretValue returns the current SecretString of a secret
+func (c *secretsClient) getSecretValue(ctx context.Context, secretID string) (string, error) {
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := c.call(ctx, "GetSecretValue", map[string]string{"SecretId": secretID}, &out); err != nil {
+		return "", fmt.Errorf("get secret %s: %w", secretID, err)
+	}
+	return out.SecretString, nil
+}
+
+// putSecretValue stores value as the secret's new current version
+func (c *secretsClient) putSecretValue(ctx context.Context, secretID, value string) error {
+	in := map[string]string{"SecretId": secretID, "SecretString": value}
+	if err := c.call(ctx, "PutSecretValue", in, nil); err != nil {
+		return fmt.Errorf("put secret %s: %w", secretID, err)
+	}
+	return nil
+}
+
+// call makes one Secrets Manager API call, decoding the response into out
+// unless it is nil
+func (c *secretsClient) call(ctx context.Context, action string, in, out interface{}) error {
+	body, _ := json.Marshal(in)
+	endpoint := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", c.cfg.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager."+action)
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("retrieve credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "secretsmanager", c.cfg.Region, time.Now()); err != nil {
+		return fmt.Errorf("sign request: %w", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		// __type may be qualified: com.amazonaws.secretsmanager#ResourceNotFoundException
+		code := apiErr.Type[strings.LastIndexByte(apiErr.Type, '#')+1:]
+		if code == "ResourceNotFoundException" {
+			return errSecretNotFound
+		}
+		return fmt.Errorf("%s (%d): %s", code, resp.StatusCode, apiErr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
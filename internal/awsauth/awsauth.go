@@ -0,0 +1,136 @@
+// Package awsauth hands out credentials for tenant-owned AWS resources. A
+// tenant grants us a role in its account; we assume it with a session
+// policy naming exactly that tenant's bucket prefix and table items, so a
+// bug or a confused tenant_id can never use one tenant's credentials on
+// another tenant's data, even where the role itself allows more. Every
+// sink writing to tenant-owned resources gets its credentials here.
+package awsauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// sessionDuration is the life of one set of scoped credentials; the cache
+// renews them shortly before they expire
+const sessionDuration = time.Hour
+
+// Scope is the set of tenant-owned resources one set of credentials may
+// touch. Session policies can only narrow the role's permissions.
+type Scope struct {
+	TenantID string
+	// Bucket and Prefix bound S3 writes to keys under Prefix in Bucket
+	Bucket string
+	Prefix string
+	// Tables are DynamoDB table ARNs; writes are bound to items whose
+	// partition key is TenantID
+	Tables []string
+}
+
+// s3Actions and dynamoActions are all a sink may do; reads are not granted
+var (
+	s3Actions     = []string{"s3:PutObject", "s3:AbortMultipartUpload"}
+	dynamoActions = []string{"dynamodb:PutItem", "dynamodb:UpdateItem", "dynamodb:BatchWriteItem"}
+)
+
+type statement struct {
+	Effect    string                    `json:"Effect"`
+	Action    []string                  `json:"Action"`
+	Resource  []string                  `json:"Resource"`
+	Condition map[string]map[string]any `json:"Condition,omitempty"`
+}
+
+// SessionPolicy returns the inline policy limiting a session to scope
+func SessionPolicy(s Scope) (string, error) {
+	if s.TenantID == "" {
+		return "", errors.New("scope has no tenant")
+	}
+	var statements []statement
+	if s.Bucket != "" {
+		statements = append(statements, statement{
+			Effect:   "Allow",
+			Action:   s3Actions,
+			Resource: []string{"arn:aws:s3:::" + s.Bucket + "/" + s.Prefix + "*"},
+		})
+	}
+	for _, table := range s.Tables {
+		if a, err := arn.Parse(table); err != nil || a.Service != "dynamodb" || !strings.HasPrefix(a.Resource, "table/") {
+			return "", fmt.Errorf("%q is not a DynamoDB table ARN", table)
+		}
+	}
+	if len(s.Tables) > 0 {
+		statements = append(statements, statement{
+			Effect:   "Allow",
+			Action:   dynamoActions,
+			Resource: s.Tables,
+			Condition: map[string]map[string]any{
+				"ForAllValues:StringEquals": {"dynamodb:LeadingKeys": []string{s.TenantID}},
+			},
+		})
+	}
+	if len(statements) == 0 {
+		return "", errors.New("scope names no resources")
+	}
+	doc, err := json.Marshal(map[string]any{"Version": "2012-10-17", "Statement": statements})
+	return string(doc), err
+}
+
+// Provider caches scoped credentials per role and scope
+type Provider struct {
+	client *sts.Client
+
+	mu    sync.Mutex
+	cache map[string]*aws.CredentialsCache
+}
+
+// NewProvider assumes tenant roles with the credentials of cfg
+func NewProvider(cfg aws.Config) *Provider {
+	return &Provider{client: sts.NewFromConfig(cfg), cache: map[string]*aws.CredentialsCache{}}
+}
+
+// Credentials returns credentials for roleARN limited to scope. The
+// tenant's trust policy must require its tenant_id as the external ID,
+// which stops another tenant from naming the role as its own.
+func (p *Provider) Credentials(roleARN string, scope Scope) (aws.CredentialsProvider, error) {
+	if a, err := arn.Parse(roleARN); err != nil || a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") {
+		return nil, fmt.Errorf("%q is not an IAM role ARN", roleARN)
+	}
+	policy, err := SessionPolicy(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	key := roleARN + "\x00" + policy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if creds, ok := p.cache[key]; ok {
+		return creds, nil
+	}
+	creds := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(p.client, roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = SessionName(scope.TenantID)
+		o.ExternalID = aws.String(scope.TenantID)
+		o.Policy = aws.String(policy)
+		o.Duration = sessionDuration
+	}))
+	p.cache[key] = creds
+	return creds, nil
+}
+
+var sessionNameInvalid = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// SessionName names a tenant's sessions, so CloudTrail in the tenant's
+// account shows whose data each call was for
+func SessionName(tenantID string) string {
+	name := "tenant-" + sessionNameInvalid.ReplaceAllString(tenantID, "_")
+	return name[:min(len(name), 64)]
+}
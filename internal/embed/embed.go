@@ -0,0 +1,173 @@
+// Package embed turns redacted text into vectors for semantic search. The
+// worker embeds each record it indexes in OpenSearch and the read API embeds
+// each search query, so both must use the same model: a Bedrock model
+// (EMBEDDING_MODEL_ID) or an external endpoint (EMBEDDING_ENDPOINT). Only
+// redacted text is ever sent.
+package embed
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	// DefaultDimensions is the vector size unless EMBEDDING_DIMENSIONS says
+	// otherwise; Titan Text Embeddings V2 also offers 256 and 512
+	DefaultDimensions = 1024
+	// maxInputBytes keeps one input well inside Titan V2's 8,192 token
+	// limit; longer text is embedded by its beginning
+	maxInputBytes = 20000
+)
+
+// Client embeds text with the configured model
+type Client struct {
+	cfg        aws.Config
+	modelID    string
+	endpoint   string
+	dimensions int
+	http       *http.Client
+}
+
+// Configured reports whether an embedding model is set
+func Configured() bool {
+	return os.Getenv("EMBEDDING_MODEL_ID") != "" || os.Getenv("EMBEDDING_ENDPOINT") != ""
+}
+
+// FromEnv returns a Client for the configured model, or nil when neither
+// EMBEDDING_ENDPOINT nor EMBEDDING_MODEL_ID is set. The endpoint wins when
+// both are.
+func FromEnv(cfg aws.Config) (*Client, error) {
+	c := &Client{
+		cfg:        cfg,
+		modelID:    os.Getenv("EMBEDDING_MODEL_ID"),
+		endpoint:   os.Getenv("EMBEDDING_ENDPOINT"),
+		dimensions: DefaultDimensions,
+		http:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if c.modelID == "" && c.endpoint == "" {
+		return nil, nil
+	}
+	if c.endpoint != "" {
+		if u, err := url.Parse(c.endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, errors.New("EMBEDDING_ENDPOINT must be an https URL")
+		}
+	}
+	if s := os.Getenv("EMBEDDING_DIMENSIONS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, errors.New("EMBEDDING_DIMENSIONS must be a positive number")
+		}
+		c.dimensions = n
+	}
+	return c, nil
+}
+
+// Dimensions is the size of every vector the client returns
+func (c *Client) Dimensions() int { return c.dimensions }
+
+// Embed returns text's vector. Text beyond maxInputBytes is cut at a
+// character boundary.
+func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
+	if len(text) > maxInputBytes {
+		cut := maxInputBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	var vector []float32
+	var err error
+	if c.endpoint != "" {
+		vector, err = c.external(ctx, text)
+	} else {
+		vector, err = c.bedrock(ctx, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(vector) != c.dimensions {
+		return nil, fmt.Errorf("embedding has %d dimensions, want %d", len(vector), c.dimensions)
+	}
+	return vector, nil
+}
+
+// bedrock calls InvokeModel in the Titan Text Embeddings request shape,
+// signed like the worker's other direct calls; the Bedrock SDK module is not
+// a dependency of this module
+func (c *Client) bedrock(ctx context.Context, text string) ([]float32, error) {
+	body, _ := json.Marshal(map[string]interface{}{"inputText": text, "dimensions": c.dimensions, "normalize": true})
+	endpoint := fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/invoke", c.cfg.Region, c.modelID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "bedrock", c.cfg.Region, time.Now()); err != nil {
+		return nil, err
+	}
+	var out struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	if err := c.do(req, "bedrock", &out); err != nil {
+		return nil, err
+	}
+	return out.Embedding, nil
+}
+
+// external posts {"input": text, "dimensions": n} to EMBEDDING_ENDPOINT and
+// reads {"embedding": [...]}
+func (c *Client) external(ctx context.Context, text string) ([]float32, error) {
+	body, _ := json.Marshal(map[string]interface{}{"input": text, "dimensions": c.dimensions})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var out struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	if err := c.do(req, "embedding endpoint", &out); err != nil {
+		return nil, err
+	}
+	return out.Embedding, nil
+}
+
+func (c *Client) do(req *http.Request, name string, out interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", name, resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode %s response: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Package failure maps internal errors to the stable codes tenants see on
+// FAILED records. Error strings from the AWS SDK or anywhere else in the
+// pipeline can name tables, keys and request IDs, so they stay in our logs;
+// tenants get a code and its documented message. Codes are part of the
+// public API: add new ones, never rename or repurpose them.
+package failure
+
+import (
+	"errors"
+
+	"github.com/aws/smithy-go"
+)
+
+// Code is a tenant-facing failure reason
+type Code string
+
+const (
+	// InvalidMessage: the record is not valid JSON or breaks the queue contract
+	InvalidMessage Code = "invalid_message"
+	// PolicyInvalid: the tenant's policy cannot be decoded or compiled
+	PolicyInvalid Code = "policy_invalid"
+	// SchemaUnavailable: the schema the record was validated against cannot be loaded
+	SchemaUnavailable Code = "schema_unavailable"
+	// EncryptionKeyUnavailable: the tenant's KMS key is disabled, deleted or no longer grants access
+	EncryptionKeyUnavailable Code = "encryption_key_unavailable"
+	// DependencyUnavailable: storage or another AWS service kept failing
+	DependencyUnavailable Code = "dependency_unavailable"
+	// Internal: anything else
+	Internal Code = "internal_error"
+)
+
+var messages = map[Code]string{
+	InvalidMessage:           "The record is malformed and cannot be processed; fix it and resend it.",
+	PolicyInvalid:            "The tenant's redaction policy is invalid; correct the policy and resend the record.",
+	SchemaUnavailable:        "The schema the record was validated against could not be loaded; resend the record.",
+	EncryptionKeyUnavailable: "The tenant's encryption key is disabled or no longer grants access; restore access to the key and resend the record.",
+	DependencyUnavailable:    "A storage service was unavailable while the record was processed; resend the record.",
+	Internal:                 "The record could not be processed; resend it or contact support with its log_id.",
+}
+
+// Error tags an internal error with the code it is reported as
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Wrap tags err with code; a nil err stays nil
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the code err is reported as: the outermost Wrap, else
+// DependencyUnavailable for an AWS API error, else Internal
+func CodeOf(err error) Code {
+	var tagged *Error
+	if errors.As(err, &tagged) {
+		return tagged.Code
+	}
+	var api smithy.APIError
+	if errors.As(err, &api) {
+		return DependencyUnavailable
+	}
+	return Internal
+}
+
+// Message returns the documented explanation of a code. Codes this build
+// does not know, such as one stored by a newer worker, read as Internal.
+func Message(code Code) string {
+	if m, ok := messages[code]; ok {
+		return m
+	}
+	return messages[Internal]
+}
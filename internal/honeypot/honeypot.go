@@ -0,0 +1,93 @@
+// Package honeypot handles requests made with an API key a tenant flagged
+// as a honeypot (see apikey.Honeypot), the same way in every service that
+// takes API keys: the request is captured to the honeypot queue for
+// security to review and answered, after a delay, with a decoy the service
+// builds, so whoever holds the key can't tell it was found out.
+package honeypot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// DefaultDelay is how long decoys are held back unless HONEYPOT_DELAY says
+// otherwise
+const DefaultDelay = 2 * time.Second
+
+// maxCapturedBody bounds the body kept of a request, leaving room for the
+// rest of the capture within SQS's message limit
+const maxCapturedBody = 200 << 10
+
+// Capture is what the honeypot queue receives of a request. The key itself
+// is never kept, only a prefix of its digest to tell keys apart.
+type Capture struct {
+	TenantID   string            `json:"tenant_id"`
+	KeyDigest  string            `json:"key_digest"`
+	ReceivedAt string            `json:"received_at"`
+	SourceIP   string            `json:"source_ip"`
+	UserAgent  string            `json:"user_agent"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Query      map[string]string `json:"query,omitempty"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	Truncated  bool              `json:"truncated,omitempty"`
+}
+
+// NewCapture records a request made with key, without its credentials
+func NewCapture(request events.APIGatewayV2HTTPRequest, tenantID, key string) Capture {
+	digest := sha256.Sum256([]byte(key))
+	c := Capture{
+		TenantID:   tenantID,
+		KeyDigest:  hex.EncodeToString(digest[:4]),
+		ReceivedAt: time.Now().UTC().Format(time.RFC3339),
+		SourceIP:   request.RequestContext.HTTP.SourceIP,
+		UserAgent:  request.RequestContext.HTTP.UserAgent,
+		Method:     request.RequestContext.HTTP.Method,
+		Path:       request.RawPath,
+		Query:      request.QueryStringParameters,
+		Headers:    map[string]string{},
+		Body:       request.Body,
+	}
+	for k, v := range request.Headers {
+		if k = strings.ToLower(k); k != "x-api-key" && k != "authorization" {
+			c.Headers[k] = v
+		}
+	}
+	if len(c.Body) > maxCapturedBody {
+		c.Body, c.Truncated = c.Body[:maxCapturedBody], true
+	}
+	return c
+}
+
+// Send queues the capture on queueURL
+func (c Capture) Send(ctx context.Context, client *sqs.Client, queueURL string) error {
+	body, _ := json.Marshal(c)
+	_, err := client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// Tarpit waits delay, or less so that the decoy still goes out before
+// ctx's deadline, as a slow but healthy service would answer
+func Tarpit(ctx context.Context, delay time.Duration) {
+	if deadline, ok := ctx.Deadline(); ok {
+		delay = min(delay, time.Until(deadline)-200*time.Millisecond)
+	}
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package integrity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ReceiptAlgorithm is the KMS signing algorithm receipts are signed with
+const ReceiptAlgorithm = "ECDSA_SHA_256"
+
+// Receipt attests that a specific document was redacted under a specific
+// policy version. The worker signs its canonical encoding with a KMS
+// asymmetric key; anyone holding the public key can verify it offline.
+type Receipt struct {
+	TenantID      string `json:"tenant_id"`
+	LogID         string `json:"log_id"`
+	OriginalHash  string `json:"original_sha256"`
+	RedactedHash  string `json:"redacted_sha256"`
+	PolicyVersion int    `json:"policy_version"`
+	ProcessedAt   string `json:"processed_at"`
+	KeyID         string `json:"key_id"`
+}
+
+// NewReceipt builds the receipt for a processed document
+func NewReceipt(tenantID, logID, original, redacted string, policyVersion int, processedAt, keyID string) Receipt {
+	return Receipt{
+		TenantID:      tenantID,
+		LogID:         logID,
+		OriginalHash:  ContentHash(original),
+		RedactedHash:  ContentHash(redacted),
+		PolicyVersion: policyVersion,
+		ProcessedAt:   processedAt,
+		KeyID:         keyID,
+	}
+}
+
+// Canonical is the exact byte string that is signed and stored. Field order
+// is fixed by the struct, so the encoding is deterministic.
+func (r Receipt) Canonical() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// ContentHash is the hex SHA-256 of a text, as receipts and the ingest
+// journal record it
+func ContentHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+// Package logscrub keeps payload PII out of our own logs. Error strings from
+// parsers and AWS SDKs, and any attribute someone adds later, can quote the
+// text being processed, so every service logs through a handler that runs
+// the built-in redactor over the message and all string values, and drops
+// content attributes (original_text, body, ...) outright, at every level.
+// cmd/logcheck is the static half: it fails on log calls given record text.
+package logscrub
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"robust-processor/pkg/redact"
+)
+
+// contentKeys are attribute keys whose values are record content; they are
+// replaced whole, since redaction only removes what the detectors know
+var contentKeys = map[string]bool{
+	"original_text": true,
+	"text":          true,
+	"body":          true,
+	"payload":       true,
+	"modified_data": true,
+}
+
+const omitted = "[OMITTED]"
+
+// Install makes a scrubbing text handler on stderr the default logger. Call
+// it first thing in main.
+func Install() {
+	slog.SetDefault(slog.New(NewHandler(slog.NewTextHandler(os.Stderr, nil))))
+}
+
+// Handler scrubs records before passing them to the wrapped handler
+type Handler struct {
+	next slog.Handler
+}
+
+// NewHandler wraps next with scrubbing
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{next: next}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	scrubbed := slog.NewRecord(r.Time, r.Level, redact.Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		scrubbed.AddAttrs(scrub(a))
+		return true
+	})
+	return h.next.Handle(ctx, scrubbed)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = scrub(a)
+	}
+	return &Handler{next: h.next.WithAttrs(out)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name)}
+}
+
+// scrub redacts one attribute. Errors, Stringers and other values that
+// render as text are resolved to their string first; numbers, times and
+// booleans pass through.
+func scrub(a slog.Attr) slog.Attr {
+	if contentKeys[a.Key] {
+		return slog.String(a.Key, omitted)
+	}
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redact.Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		out := make([]any, len(group))
+		for i, g := range group {
+			out[i] = scrub(g)
+		}
+		return slog.Group(a.Key, out...)
+	case slog.KindAny:
+		return slog.String(a.Key, redact.Redact(v.String()))
+	default:
+		return slog.Attr{Key: a.Key, Value: v}
+	}
+}
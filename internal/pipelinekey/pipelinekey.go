@@ -0,0 +1,55 @@
+// Package pipelinekey loads the key ingest signs queue messages with (see
+// model.Sign). The key is stored only encrypted under a KMS key, in
+// PIPELINE_KEY_CIPHERTEXT, and decrypted once per execution environment;
+// services that publish or accept messages need kms:Decrypt on that key.
+package pipelinekey
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// EncryptionContext must match the context the key was encrypted with
+var EncryptionContext = map[string]string{"purpose": "pipeline-signing"}
+
+// FromEnv decrypts PIPELINE_KEY_CIPHERTEXT. Without it signing is disabled
+// and a nil key is returned.
+func FromEnv(ctx context.Context, cfg aws.Config) ([]byte, error) {
+	return decrypt(ctx, cfg, "PIPELINE_KEY_CIPHERTEXT")
+}
+
+// PreviousFromEnv decrypts PIPELINE_KEY_PREVIOUS_CIPHERTEXT, the key that
+// signed before the last rotation. Services that verify messages accept it
+// too, so messages still queued when the key changes aren't taken for
+// forgeries; without it a nil key is returned.
+func PreviousFromEnv(ctx context.Context, cfg aws.Config) ([]byte, error) {
+	return decrypt(ctx, cfg, "PIPELINE_KEY_PREVIOUS_CIPHERTEXT")
+}
+
+func decrypt(ctx context.Context, cfg aws.Config, name string) ([]byte, error) {
+	encoded := os.Getenv(name)
+	if encoded == "" {
+		return nil, nil
+	}
+	blob, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64: %w", name, err)
+	}
+	out, err := kms.NewFromConfig(cfg).Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    blob,
+		EncryptionContext: EncryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", name, err)
+	}
+	if len(out.Plaintext) < 32 {
+		return nil, errors.New("pipeline key must be at least 32 bytes")
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,128 @@
+// Package prefilter rejects obviously invalid ingest requests (oversized,
+// unauthenticated, malformed) before they cost a queue message or any
+// downstream work. The checks are cheap and need no I/O, so they run both in
+// the API Gateway authorizer (./prefilter), which only sees headers, and as
+// the first step of the ingest handler, which also sees the body.
+package prefilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rejection is a request refused by a check, with the status to return and
+// the reason it is counted under
+type Rejection struct {
+	Status  int
+	Reason  string
+	Message string
+}
+
+// Config holds the limits the checks enforce
+type Config struct {
+	// MaxBodyBytes caps the declared and the actual body size
+	MaxBodyBytes int64
+	// MaxDecompressedBytes caps the body of a request sent with a
+	// Content-Encoding once it is decompressed
+	MaxDecompressedBytes int64
+	// RequireAuth rejects requests carrying none of an Authorization,
+	// X-Api-Key or X-Signature header. Credentials are verified downstream;
+	// this only keeps anonymous traffic away from the handler.
+	RequireAuth bool
+}
+
+// FromEnv reads MAX_BODY_BYTES (default 6 MiB, the API Gateway payload cap),
+// MAX_DECOMPRESSED_BYTES (default 24 MiB) and PREFILTER_REQUIRE_AUTH
+func FromEnv() Config {
+	c := Config{MaxBodyBytes: 6 << 20, MaxDecompressedBytes: 24 << 20}
+	if n, err := strconv.ParseInt(os.Getenv("MAX_BODY_BYTES"), 10, 64); err == nil && n > 0 {
+		c.MaxBodyBytes = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("MAX_DECOMPRESSED_BYTES"), 10, 64); err == nil && n > 0 {
+		c.MaxDecompressedBytes = n
+	}
+	c.RequireAuth, _ = strconv.ParseBool(os.Getenv("PREFILTER_REQUIRE_AUTH"))
+	return c
+}
+
+// CheckHeaders runs the checks that need only the (lower-cased) headers
+func (c Config) CheckHeaders(headers map[string]string) *Rejection {
+	if c.RequireAuth && headers["authorization"] == "" && headers["x-api-key"] == "" && headers["x-signature"] == "" {
+		return &Rejection{Status: 401, Reason: "unauthenticated", Message: "Missing credentials"}
+	}
+	if cl := headers["content-length"]; cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			return &Rejection{Status: 400, Reason: "bad_content_length", Message: "Invalid Content-Length"}
+		}
+		if n > c.MaxBodyBytes {
+			return tooLarge(c.MaxBodyBytes)
+		}
+	}
+	return nil
+}
+
+// Check runs every check. body is the decoded request body, decompressed
+// when the request has a Content-Encoding.
+func (c Config) Check(headers map[string]string, body string) *Rejection {
+	if r := c.CheckHeaders(headers); r != nil {
+		return r
+	}
+	limit := c.MaxBodyBytes
+	if encoding := headers["content-encoding"]; encoding != "" && encoding != "identity" {
+		limit = c.MaxDecompressedBytes
+	}
+	if int64(len(body)) > limit {
+		return tooLarge(limit)
+	}
+	if strings.TrimSpace(body) == "" {
+		return &Rejection{Status: 400, Reason: "empty_body", Message: "Empty request body"}
+	}
+	// A JSON body must at least open an object or array; full parsing is the
+	// normalizer's job
+	if isUTF8JSON(headers["content-type"]) {
+		if first := strings.TrimLeft(body, " \t\r\n")[0]; first != '{' && first != '[' {
+			return &Rejection{Status: 400, Reason: "malformed_json", Message: "Request body is not a JSON object or array"}
+		}
+	}
+	return nil
+}
+
+// isUTF8JSON reports a JSON media type (including +json suffix types) whose
+// body can be inspected as is; other charsets are checked after transcoding
+func isUTF8JSON(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return false
+	}
+	charset := strings.ToLower(params["charset"])
+	return charset == "" || charset == "utf-8" || charset == "us-ascii"
+}
+
+func tooLarge(limit int64) *Rejection {
+	return &Rejection{Status: 413, Reason: "oversized", Message: fmt.Sprintf("Payload too large (limit %d bytes)", limit)}
+}
+
+// Record emits the PrefilterRejected metric for r, by reason and by the
+// stage that caught it ("authorizer" or "handler")
+func Record(r *Rejection, stage string) {
+	line, _ := json.Marshal(map[string]interface{}{
+		"PrefilterRejected": 1,
+		"reason":            r.Reason,
+		"stage":             stage,
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  "RobustProcessor",
+				"Dimensions": [][]string{{"reason", "stage"}},
+				"Metrics":    []map[string]string{{"Name": "PrefilterRejected", "Unit": "Count"}},
+			}},
+		},
+	})
+	fmt.Println(string(line))
+}
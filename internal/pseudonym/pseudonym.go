@@ -0,0 +1,92 @@
+// Package pseudonym replaces values with tenant-scoped pseudonyms: keyed
+// hashes that are deterministic, so equal values still match in filters and
+// aggregations, but can't be reversed, or matched against another tenant's,
+// without the key. The key is stored only encrypted under a KMS key, in
+// PSEUDONYM_KEY_CIPHERTEXT, like the pipeline key; each tenant's pseudonyms
+// use a subkey derived from it.
+package pseudonym
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// EncryptionContext must match the context the key was encrypted with
+var EncryptionContext = map[string]string{"purpose": "pseudonymization"}
+
+// Prefix marks a pseudonym, so it can't be mistaken for a plaintext value
+const Prefix = "ps_"
+
+// Configured reports whether PSEUDONYM_KEY_CIPHERTEXT is set
+func Configured() bool {
+	return os.Getenv("PSEUDONYM_KEY_CIPHERTEXT") != ""
+}
+
+// FromEnv decrypts PSEUDONYM_KEY_CIPHERTEXT. Without it pseudonyms are
+// unavailable and a nil key is returned.
+func FromEnv(ctx context.Context, cfg aws.Config) ([]byte, error) {
+	encoded := os.Getenv("PSEUDONYM_KEY_CIPHERTEXT")
+	if encoded == "" {
+		return nil, nil
+	}
+	blob, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("PSEUDONYM_KEY_CIPHERTEXT is not base64: %w", err)
+	}
+	out, err := kms.NewFromConfig(cfg).Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    blob,
+		EncryptionContext: EncryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decrypt pseudonym key: %w", err)
+	}
+	if len(out.Plaintext) < 32 {
+		return nil, errors.New("pseudonym key must be at least 32 bytes")
+	}
+	return out.Plaintext, nil
+}
+
+// Token returns the pseudonym of value for tenantID: Prefix and 128 bits of
+// HMAC-SHA256 under the tenant's subkey. The field a value came from is not
+// part of it, so the same user token matches across fields.
+func Token(key []byte, tenantID, value string) string {
+	return TokenAt(key, tenantID, 0, value)
+}
+
+// TokenAt returns the pseudonym of value under the tenant's subkey of the
+// given generation. Rotating a tenant's pseudonyms moves it to the next
+// generation, whose pseudonyms are unrelated to the last one's; generation
+// 0 is the subkey pseudonyms had before rotation existed.
+func TokenAt(key []byte, tenantID string, generation int, value string) string {
+	label := "tenant:" + tenantID
+	if generation > 0 {
+		// The generation comes first, so no tenant ID can produce the label
+		label = "tenant@" + strconv.Itoa(generation) + ":" + tenantID
+	}
+	sub := hmac.New(sha256.New, key)
+	sub.Write([]byte(label))
+	h := hmac.New(sha256.New, sub.Sum(nil))
+	h.Write([]byte(value))
+	return Prefix + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Tag returns a shorter keyed digest of value for tenantID, 64 bits as 16
+// hex digits, for tokens written into redacted text. Tags come from a
+// subkey of their own, so a value's tag and pseudonym can't be linked.
+func Tag(key []byte, tenantID, value string) string {
+	sub := hmac.New(sha256.New, key)
+	sub.Write([]byte("tag:" + tenantID))
+	h := hmac.New(sha256.New, sub.Sum(nil))
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,98 @@
+// Package simhash fingerprints text so that near-duplicates have nearby
+// fingerprints: the Hamming distance between two fingerprints grows with how
+// much their texts differ. Text is compared as overlapping three-word
+// shingles, lowercased and with every digit read as 0, so records that
+// differ only in timestamps, counters or IDs (a log storm, or the same
+// document leaked twice with different line numbers) come out identical or
+// nearly so.
+package simhash
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Bands is how many pieces a fingerprint is indexed by. Two fingerprints
+	// within Bands-1 bits of each other agree on at least one piece, so
+	// looking up each piece finds every near-duplicate up to MaxDistance.
+	Bands = 4
+	// MaxDistance is the largest distance the band index is complete for
+	MaxDistance = Bands - 1
+	// shingle is the number of words hashed together
+	shingle = 3
+)
+
+// Fingerprint returns the 64-bit SimHash of text, or 0 when it has no words
+func Fingerprint(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+	for i, w := range words {
+		words[i] = strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return '0'
+			}
+			return r
+		}, w)
+	}
+
+	var weights [64]int
+	n := max(len(words)-shingle+1, 1)
+	for i := 0; i < n; i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:min(i+shingle, len(words))], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var fp uint64
+	for bit, w := range weights {
+		if w > 0 {
+			fp |= 1 << bit
+		}
+	}
+	return fp
+}
+
+// Distance is the number of bits in which a and b differ
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Format renders a fingerprint as 16 hex digits, as it is stored
+func Format(fp uint64) string {
+	return fmt.Sprintf("%016x", fp)
+}
+
+// Parse reads a stored fingerprint
+func Parse(s string) (uint64, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("fingerprint %q is not 16 hex digits", s)
+	}
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// BandKeys returns the keys fp is indexed under for tenantID, one per band:
+// tenant#band#piece
+func BandKeys(tenantID string, fp uint64) []string {
+	keys := make([]string, Bands)
+	width := 64 / Bands
+	for i := range keys {
+		piece := (fp >> (i * width)) & (1<<width - 1)
+		keys[i] = fmt.Sprintf("%s#%d#%0*x", tenantID, i, width/4, piece)
+	}
+	return keys
+}
@@ -0,0 +1,102 @@
+// Package tenantpolicy loads the redaction part of tenant policies for
+// services other than the worker, which need the same rules without the
+// worker's pipeline settings (transforms, hash chain, ...).
+package tenantpolicy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"robust-processor/pkg/redact"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// policyTTL matches the worker's: a policy edit reaches both within a minute
+const policyTTL = time.Minute
+
+// storedPolicy is the part of a TenantPolicies item redaction needs
+type storedPolicy struct {
+	Version int `dynamodbav:"version"`
+	redact.Policy
+}
+
+type cachedRedactor struct {
+	redactor  *redact.Redactor
+	version   int
+	fetchedAt time.Time
+}
+
+// Store loads and compiles tenant policies, caching each compiled Redactor
+// until its TTL passes and recompiling only on a version change. With no
+// Table every tenant gets redact.Default.
+type Store struct {
+	Table  string
+	Client *dynamodb.Client
+
+	mu       sync.Mutex
+	byTenant map[string]cachedRedactor
+}
+
+// InvalidError marks a stored policy that cannot be decoded or compiled; it
+// is the tenant's to fix, unlike a failed read
+type InvalidError struct{ err error }
+
+func (e InvalidError) Error() string { return e.err.Error() }
+
+func (e InvalidError) Unwrap() error { return e.err }
+
+// Redactor returns the tenant's compiled policy and its version. Tenants
+// without a stored policy get redact.Default at version 0.
+func (s *Store) Redactor(ctx context.Context, tenantID string) (*redact.Redactor, int, error) {
+	if s.Table == "" {
+		return redact.Default, 0, nil
+	}
+
+	s.mu.Lock()
+	cached, ok := s.byTenant[tenantID]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < policyTTL {
+		return cached.redactor, cached.version, nil
+	}
+
+	out, err := s.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		},
+	})
+	if err != nil {
+		if ok {
+			// Keep redacting with the last known policy, as the worker does
+			return cached.redactor, cached.version, nil
+		}
+		return nil, 0, fmt.Errorf("load policy for %s: %w", tenantID, err)
+	}
+	var policy storedPolicy
+	if out.Item != nil {
+		if err := attributevalue.UnmarshalMap(out.Item, &policy); err != nil {
+			return nil, 0, InvalidError{fmt.Errorf("decode policy for %s: %w", tenantID, err)}
+		}
+	}
+
+	redactor := cached.redactor
+	if !ok || cached.version != policy.Version {
+		if redactor, err = redact.Compile(policy.Policy); err != nil {
+			return nil, 0, InvalidError{fmt.Errorf("policy for %s: %w", tenantID, err)}
+		}
+	}
+
+	s.mu.Lock()
+	if s.byTenant == nil {
+		s.byTenant = map[string]cachedRedactor{}
+	}
+	s.byTenant[tenantID] = cachedRedactor{redactor: redactor, version: policy.Version, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return redactor, policy.Version, nil
+}
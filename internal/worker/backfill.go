@@ -0,0 +1,257 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// Backfill replays stored, already-redacted records of one tenant and time
+// range into sinks, e.g. to fill a newly enabled OpenSearch index. Records
+// are read without original_text and go through the sink layer only. A job
+// is started by invoking the worker with
+//
+//	{"backfill": {"job_id": "acme-os", "tenant_id": "acme_corp",
+//	  "from": "2025-01-01T00:00:00Z", "to": "2025-02-01T00:00:00Z",
+//	  "sinks": ["opensearch"], "rate": 200}}
+//
+// Progress is checkpointed in BACKFILL_TABLE_NAME after every page. When the
+// invocation nears its deadline the job re-invokes the function
+// asynchronously to continue from the checkpoint, so any range completes.
+
+const (
+	backfillPageSize   = 100
+	backfillRate       = 100 // records per second when the job sets none
+	backfillHeadroom   = 15 * time.Second
+	backfillStatusDone = "DONE"
+)
+
+var backfillTableName string
+
+type backfillEvent struct {
+	Backfill *backfillJob `json:"backfill"`
+}
+
+type backfillJob struct {
+	JobID    string `json:"job_id"`
+	TenantID string `json:"tenant_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	// Sinks names the sinks to fill; empty means every configured sink
+	Sinks []string `json:"sinks"`
+	// Rate caps records per second so the backfill can't starve live traffic
+	Rate int `json:"rate"`
+}
+
+// backfillCheckpoint is a job's progress as stored in the checkpoint table
+type backfillCheckpoint struct {
+	JobID     string `dynamodbav:"job_id"`
+	LastLogID string `dynamodbav:"last_log_id"`
+	Copied    int    `dynamodbav:"copied"`
+	Status    string `dynamodbav:"status"`
+	UpdatedAt string `dynamodbav:"updated_at"`
+}
+
+var lambdaClient = sync.OnceValue(func() *lambdasvc.Client {
+	return lambdasvc.NewFromConfig(awsConfig())
+})
+
+func parseBackfill(payload json.RawMessage) (*backfillJob, bool) {
+	var event backfillEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.Backfill == nil {
+		return nil, false
+	}
+	return event.Backfill, true
+}
+
+// runBackfill copies the job's records page by page until the range is
+// exhausted or the invocation is close to timing out
+func runBackfill(ctx context.Context, job backfillJob) (backfillCheckpoint, error) {
+	if backfillTableName == "" {
+		return backfillCheckpoint{}, fmt.Errorf("backfill requires BACKFILL_TABLE_NAME")
+	}
+	if job.JobID == "" || job.TenantID == "" || job.From == "" || job.To == "" {
+		return backfillCheckpoint{}, fmt.Errorf("backfill requires job_id, tenant_id, from and to")
+	}
+	targets := make([]*bufferedSink, 0, len(sinks))
+	for _, s := range sinks {
+		if len(job.Sinks) == 0 || slices.Contains(job.Sinks, s.sink.Name()) {
+			targets = append(targets, s)
+		}
+	}
+	if len(targets) == 0 {
+		return backfillCheckpoint{}, fmt.Errorf("backfill: none of %v is configured", job.Sinks)
+	}
+	rate := job.Rate
+	if rate <= 0 {
+		rate = backfillRate
+	}
+
+	cp, err := loadCheckpoint(ctx, job.JobID)
+	if err != nil || cp.Status == backfillStatusDone {
+		return cp, err
+	}
+
+	for {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backfillHeadroom {
+			return cp, continueBackfill(ctx, job)
+		}
+
+		start := time.Now()
+		records, next, err := readBackfillPage(ctx, job, cp.LastLogID)
+		if err != nil {
+			return cp, err
+		}
+		for _, record := range records {
+			shared, err := encodeSinkDoc(record)
+			if err != nil {
+				return cp, err
+			}
+			for _, s := range targets {
+				doc, err := docFor(ctx, s.sink, record, shared)
+				if err != nil {
+					return cp, err
+				}
+				s.add(ctx, pendingDoc{doc: doc, messageID: record.LogID})
+			}
+		}
+		for _, s := range targets {
+			if failed := s.flush(ctx); len(failed) > 0 {
+				// The page is retried from the unchanged checkpoint; sinks
+				// dedupe on document id, so redelivery is harmless
+				return cp, fmt.Errorf("backfill %s: %d records undelivered to %s", job.JobID, len(failed), s.sink.Name())
+			}
+		}
+
+		cp.Copied += len(records)
+		cp.LastLogID = next
+		if next == "" {
+			cp.Status = backfillStatusDone
+		}
+		if err := saveCheckpoint(ctx, cp); err != nil {
+			return cp, err
+		}
+		emitMetric("BackfillRecords", float64(len(records)), "Count", map[string]string{"job_id": job.JobID})
+		if cp.Status == backfillStatusDone {
+			slog.Info("Backfill complete", "job_id", job.JobID, "copied", cp.Copied)
+			return cp, nil
+		}
+
+		// Pace pages so the job averages at most rate records per second
+		if pause := time.Duration(len(records))*time.Second/time.Duration(rate) - time.Since(start); pause > 0 {
+			time.Sleep(pause)
+		}
+	}
+}
+
+// readBackfillPage reads the next page of the tenant's partition after
+// lastLogID, keeping records processed within the job's range and not
+// deleted. next is the log_id to resume after, empty once the partition is
+// exhausted.
+func readBackfillPage(ctx context.Context, job backfillJob, lastLogID string) (records []sinkRecord, next string, err error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("tenant_id = :t"),
+		FilterExpression:       aws.String("processed_at BETWEEN :from AND :to AND attribute_not_exists(deleted_at)"),
+		ProjectionExpression:   aws.String("tenant_id, log_id, #source, parent_id, modified_data, #fields, labels, ip_locations, processed_at"),
+		ExpressionAttributeNames: map[string]string{
+			"#source": "source",
+			"#fields": "fields",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t":    &types.AttributeValueMemberS{Value: job.TenantID},
+			":from": &types.AttributeValueMemberS{Value: job.From},
+			":to":   &types.AttributeValueMemberS{Value: job.To},
+		},
+		Limit: aws.Int32(backfillPageSize),
+	}
+	if lastLogID != "" {
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: job.TenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: lastLogID},
+		}
+	}
+	out, err := dynamo().Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("backfill read: %w", err)
+	}
+	// sinkRecord's json tags match the stored attribute names
+	err = attributevalue.UnmarshalListOfMapsWithOptions(out.Items, &records, func(o *attributevalue.DecoderOptions) {
+		o.TagKey = "json"
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("backfill decode: %w", err)
+	}
+	if key, ok := out.LastEvaluatedKey["log_id"].(*types.AttributeValueMemberS); ok {
+		next = key.Value
+	}
+	return records, next, nil
+}
+
+func loadCheckpoint(ctx context.Context, jobID string) (backfillCheckpoint, error) {
+	out, err := dynamo().GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(backfillTableName),
+		Key:            map[string]types.AttributeValue{"job_id": &types.AttributeValueMemberS{Value: jobID}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return backfillCheckpoint{}, fmt.Errorf("load checkpoint %s: %w", jobID, err)
+	}
+	cp := backfillCheckpoint{JobID: jobID}
+	if out.Item != nil {
+		if err := attributevalue.UnmarshalMap(out.Item, &cp); err != nil {
+			return backfillCheckpoint{}, fmt.Errorf("decode checkpoint %s: %w", jobID, err)
+		}
+	}
+	return cp, nil
+}
+
+func saveCheckpoint(ctx context.Context, cp backfillCheckpoint) error {
+	cp.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(cp)
+	if err != nil {
+		return err
+	}
+	_, err = dynamo().PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(backfillTableName), Item: item})
+	if err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.JobID, err)
+	}
+	return nil
+}
+
+// continueBackfill hands the job to a fresh asynchronous invocation
+func continueBackfill(ctx context.Context, job backfillJob) error {
+	payload, _ := json.Marshal(backfillEvent{Backfill: &job})
+	_, err := lambdaClient().Invoke(ctx, &lambdasvc.InvokeInput{
+		FunctionName:   aws.String(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("continue backfill %s: %w", job.JobID, err)
+	}
+	slog.Info("Backfill continuing", "job_id", job.JobID)
+	return nil
+}
+
+// backfillStatus is the handler's response to a backfill invocation
+func backfillStatus(cp backfillCheckpoint) map[string]string {
+	status := cp.Status
+	if status == "" {
+		status = "RUNNING"
+	}
+	return map[string]string{"job_id": cp.JobID, "status": status, "copied": strconv.Itoa(cp.Copied)}
+}
@@ -0,0 +1,49 @@
+//go:build bench
+
+package worker
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Benchmark build of the worker: `make bench-arm64` (or bench-amd64) produces
+// a binary that measures redaction throughput on whatever host runs it, so
+// x86 and Graviton instances can be compared on the exact production code.
+// It runs before the Lambda runtime is involved and exits when done.
+
+var benchCorpora = []struct {
+	name string
+	text string
+}{
+	{"clean", strings.Repeat("Request served in 42ms by node web-07 status ok path /api/v1/items\n", 1500)},
+	{"pii", strings.Repeat("User 800-555-0199 jane.doe@example.com ssn 123-45-6789 logged in\n", 1500)},
+}
+
+func init() {
+	fmt.Printf("goos=%s goarch=%s cpus=%d go=%s\n", runtime.GOOS, runtime.GOARCH, runtime.NumCPU(), runtime.Version())
+	for _, corpus := range benchCorpora {
+		text := corpus.text
+		serial := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				defaultPolicy.redactor.Redact(text)
+			}
+		})
+		parallel := testing.Benchmark(func(b *testing.B) {
+			b.SetBytes(int64(len(text)))
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					defaultPolicy.redactor.Redact(text)
+				}
+			})
+		})
+		fmt.Printf("%-6s serial   %s %s\n", corpus.name, serial, serial.MemString())
+		fmt.Printf("%-6s parallel %s\n", corpus.name, parallel)
+	}
+	os.Exit(0)
+}
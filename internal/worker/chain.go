@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/integrity"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// chainRetries bounds how often a seal is retried after losing the race for
+// the chain head to a concurrent writer, on top of one retry per message the
+// batch processes alongside it
+const chainRetries = 5
+
+var chainTableName string
+
+// putSealed stores item as the next entry of its tenant/day hash chain. The
+// item write and the chain head advance happen in one transaction,
+// conditional on the head being unchanged since it was read, so concurrent
+// workers can never fork a chain, and on the record being unprocessed, so a
+// redelivered message returns errDuplicate instead of sealing it twice.
+func putSealed(ctx context.Context, item map[string]types.AttributeValue, record integrity.Record, processedAt time.Time) error {
+	chainID := integrity.ChainID(record.TenantID, processedAt)
+	digest := integrity.Digest(record)
+
+	attempts := chainRetries + concurrency
+	for attempt := 0; attempt < attempts; attempt++ {
+		seq, prevHash, err := chainHead(ctx, chainID)
+		if err != nil {
+			return err
+		}
+		hash := integrity.Link(prevHash, digest)
+
+		item["chain_id"] = &types.AttributeValueMemberS{Value: chainID}
+		item["chain_seq"] = &types.AttributeValueMemberN{Value: strconv.Itoa(seq + 1)}
+		item["chain_prev"] = &types.AttributeValueMemberS{Value: prevHash}
+		item["chain_hash"] = &types.AttributeValueMemberS{Value: hash}
+
+		headCondition := "attribute_not_exists(chain_id)"
+		values := map[string]types.AttributeValue{
+			":seq":  &types.AttributeValueMemberN{Value: strconv.Itoa(seq + 1)},
+			":hash": &types.AttributeValueMemberS{Value: hash},
+		}
+		if seq > 0 {
+			headCondition = "chain_seq = :prev"
+			values[":prev"] = &types.AttributeValueMemberN{Value: strconv.Itoa(seq)}
+		}
+
+		_, err = dynamo().TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Update: &types.Update{
+					TableName:                 aws.String(chainTableName),
+					Key:                       map[string]types.AttributeValue{"chain_id": &types.AttributeValueMemberS{Value: chainID}},
+					ConditionExpression:       aws.String(headCondition),
+					UpdateExpression:          aws.String("SET chain_seq = :seq, chain_hash = :hash"),
+					ExpressionAttributeValues: values,
+				}},
+				{Put: &types.Put{
+					TableName:                 aws.String(tableName),
+					Item:                      item,
+					ConditionExpression:       aws.String(unprocessedCondition),
+					ExpressionAttributeNames:  unprocessedNames,
+					ExpressionAttributeValues: unprocessedValues,
+				}},
+			},
+		})
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			// The record itself is already sealed: a redelivery must not
+			// append it to the chain a second time
+			if len(canceled.CancellationReasons) > 1 && aws.ToString(canceled.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+				return errDuplicate
+			}
+			continue // Another record took this position; rebuild on the new head
+		}
+		return err
+	}
+	return fmt.Errorf("chain %s: head contended after %d attempts", chainID, attempts)
+}
+
+// chainHead returns the current length and last hash of a chain
+func chainHead(ctx context.Context, chainID string) (int, string, error) {
+	out, err := dynamo().GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(chainTableName),
+		Key:            map[string]types.AttributeValue{"chain_id": &types.AttributeValueMemberS{Value: chainID}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || out.Item == nil {
+		return 0, "", err
+	}
+	seqAttr, _ := out.Item["chain_seq"].(*types.AttributeValueMemberN)
+	hashAttr, _ := out.Item["chain_hash"].(*types.AttributeValueMemberS)
+	if seqAttr == nil || hashAttr == nil {
+		return 0, "", fmt.Errorf("chain %s: malformed head", chainID)
+	}
+	seq, err := strconv.Atoi(seqAttr.Value)
+	return seq, hashAttr.Value, err
+}
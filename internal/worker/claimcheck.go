@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"robust-processor/internal/failure"
+	"robust-processor/internal/integrity"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// claimCheckBucket is where ingest stores the text of events too large for
+// an SQS message (CLAIM_CHECK_BUCKET); claim checks naming any other bucket
+// are refused
+var claimCheckBucket string
+
+// hydrate reads back the original text of a claim-checked event and clears
+// the pointer, so the event is processed as if the text had been inline. A
+// missing object or one whose hash doesn't match fails the record; a read
+// error is retried.
+func hydrate(ctx context.Context, event *LogEvent) error {
+	if claimCheckBucket == "" || event.S3Bucket != claimCheckBucket {
+		return failure.Wrap(failure.InvalidMessage, fmt.Errorf("claim check in unexpected bucket %q", event.S3Bucket))
+	}
+	out, err := s3Client().GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(event.S3Bucket),
+		Key:    aws.String(event.S3Key),
+	})
+	var missing *s3types.NoSuchKey
+	if errors.As(err, &missing) {
+		return failure.Wrap(failure.InvalidMessage, fmt.Errorf("claim check %s has expired", event.S3Key))
+	}
+	if err != nil {
+		return fmt.Errorf("read claim check %s: %w", event.S3Key, err)
+	}
+	defer out.Body.Close()
+	text, err := io.ReadAll(out.Body)
+	if err != nil {
+		return fmt.Errorf("read claim check %s: %w", event.S3Key, err)
+	}
+	if integrity.ContentHash(string(text)) != event.S3SHA256 {
+		return failure.Wrap(failure.InvalidMessage, fmt.Errorf("claim check %s does not match its hash", event.S3Key))
+	}
+	event.OriginalText = string(text)
+	event.S3Bucket, event.S3Key, event.S3SHA256 = "", "", ""
+	emitMetric("ClaimChecksHydrated", 1, "Count", nil)
+	return nil
+}
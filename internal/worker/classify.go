@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"regexp"
+
+	"robust-processor/pkg/redact"
+)
+
+// classifier labels records by the kind of sensitive content they carry, so
+// tenants can triage data flows instead of only seeing redacted output.
+// Classification reads the text before redaction.
+type classifier struct {
+	label   string
+	pattern *regexp.Regexp
+	// match, when set, is a further check that labels what pattern misses
+	match func(s string) bool
+}
+
+func (c classifier) matches(s string) bool {
+	return c.pattern.MatchString(s) || c.match != nil && c.match(s)
+}
+
+var classifiers = []classifier{
+	{
+		label: "contains-credentials",
+		pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|client[_-]?secret)\s*[:=]` +
+			`|\bAKIA[0-9A-Z]{16}\b|-----BEGIN [A-Z ]*PRIVATE KEY-----|\bBearer\s+[A-Za-z0-9\-._~+/]{20,}`),
+	},
+	{
+		label:   "contains-financial",
+		pattern: regexp.MustCompile(`(?i)\b(?:iban|swift code|routing number|account number|credit card|card number|cvv)\b`),
+		// Numbers count only when they check out, not every long digit run:
+		// timestamps and order IDs are not financial
+		match: func(s string) bool { return containsIBAN(s) || redact.ContainsCard(s) },
+	},
+	{
+		label: "contains-health-terms",
+		pattern: regexp.MustCompile(`(?i)\b(?:diagnos[ie]s|prescriptions?|patient|hiv|diabetes|cancer|oncology|medications?` +
+			`|icd-10|allerg(?:y|ies)|pregnan(?:t|cy)|mental health|blood pressure)\b`),
+	},
+}
+
+// classify returns the labels whose patterns match the text or any field
+func classify(text string, fields map[string]string) []string {
+	var labels []string
+	for _, c := range classifiers {
+		matched := c.matches(text)
+		for _, v := range fields {
+			if matched {
+				break
+			}
+			matched = c.matches(v)
+		}
+		if matched {
+			labels = append(labels, c.label)
+		}
+	}
+	return labels
+}
+
+// ibanPattern is an IBAN in its electronic form: country code, check digits
+// and an alphanumeric account number, upper case and without spaces
+var ibanPattern = regexp.MustCompile(`\b[A-Z]{2}\d{2}[A-Z0-9]{11,30}\b`)
+
+// containsIBAN reports whether s holds an IBAN with valid check digits
+func containsIBAN(s string) bool {
+	for _, m := range ibanPattern.FindAllString(s, -1) {
+		if ibanChecksum(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// ibanChecksum applies ISO 13616's check: with the first four characters
+// moved to the end and letters read as 10-35, the number is 1 mod 97
+func ibanChecksum(iban string) bool {
+	rem := 0
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' {
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		} else {
+			rem = (rem*10 + int(c-'0')) % 97
+		}
+	}
+	return rem == 1
+}
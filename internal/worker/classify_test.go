@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestClassifyFinancial(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"card", "paid with 4111 1111 1111 1111 today", true},
+		{"iban", "transfer to DE89370400440532013000 queued", true},
+		{"keyword", "Routing number on file", true},
+		{"iban with a bad checksum", "transfer to DE89370400440532013001 queued", false},
+		{"iban in lower case", "transfer to de89370400440532013000 queued", false},
+		{"epoch milliseconds", "request finished at 1714564800000", false},
+		{"compact timestamp", "batch 20240501120000123 closed", false},
+		{"order id", "order 100234567890123 shipped", false},
+		{"reference code", "ticket XY12ABCDEF123456 sent", false},
+	}
+	for _, tt := range tests {
+		got := slices.Contains(classify(tt.text, nil), "contains-financial")
+		if got != tt.want {
+			t.Errorf("%s: %q labelled financial = %v, want %v", tt.name, tt.text, got, tt.want)
+		}
+		got = slices.Contains(classify("", map[string]string{"note": tt.text}), "contains-financial")
+		if got != tt.want {
+			t.Errorf("%s: field %q labelled financial = %v, want %v", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// processStart approximates the start of the execution environment for the
+// cold start metric; package vars are initialized before init() runs
+var processStart = time.Now()
+
+// awsConfig loads the shared SDK config on first use
+var awsConfig = sync.OnceValue(func() aws.Config {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	return cfg
+})
+
+// dynamo builds the DynamoDB client on first use. Optional clients should
+// follow the same pattern so they cost nothing until a message needs them.
+var dynamo = sync.OnceValue(func() *dynamodb.Client {
+	return dynamodb.NewFromConfig(awsConfig())
+})
+
+// firehoseClient is only needed when a Firehose sink is configured
+var firehoseClient = sync.OnceValue(func() *firehose.Client {
+	return firehose.NewFromConfig(awsConfig())
+})
+
+// s3Client is only needed for profiling and S3 lookup tables
+var s3Client = sync.OnceValue(func() *s3.Client {
+	return s3.NewFromConfig(awsConfig())
+})
+
+// sqsClient is only needed to move forged messages to the DLQ
+var sqsClient = sync.OnceValue(func() *sqs.Client {
+	return sqs.NewFromConfig(awsConfig())
+})
+
+var (
+	clientsReady = make(chan struct{})
+	coldStart    sync.Once
+)
+
+// warmClients builds the always-needed clients in the background while the
+// Lambda runtime bootstraps, instead of serially before it can start
+func warmClients() {
+	defer close(clientsReady)
+	dynamo()
+}
+
+// reportColdStart emits, once per execution environment, how long it took
+// from process start until the clients were usable by the first invocation
+func reportColdStart() {
+	coldStart.Do(func() {
+		<-clientsReady
+		emitMetric("ColdStartDuration", float64(time.Since(processStart).Milliseconds()), "Milliseconds", nil)
+	})
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// comprehendMaxBytes is DetectPiiEntities' limit on the text of one request
+const comprehendMaxBytes = 100 << 10
+
+// piiEntity is one entity found by Comprehend. Offsets count characters
+// (code points), not bytes.
+type piiEntity struct {
+	Type        string  `json:"Type"`
+	Score       float64 `json:"Score"`
+	BeginOffset int     `json:"BeginOffset"`
+	EndOffset   int     `json:"EndOffset"`
+}
+
+// comprehendHTTP is only needed when a tenant escalates records
+var comprehendHTTP = sync.OnceValue(func() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+})
+
+// detectPIIEntities makes the one Comprehend call escalation needs over its
+// JSON protocol, signed like the OpenSearch sink; the service's SDK module
+// is not a dependency of this module. text must fit comprehendMaxBytes.
+func detectPIIEntities(ctx context.Context, text, language string) ([]piiEntity, error) {
+	body, _ := json.Marshal(map[string]string{"Text": text, "LanguageCode": language})
+	cfg := awsConfig()
+	endpoint := fmt.Sprintf("https://comprehend.%s.amazonaws.com/", cfg.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Comprehend_20171127.DetectPiiEntities")
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "comprehend", cfg.Region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := comprehendHTTP().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		code := apiErr.Type[strings.LastIndexByte(apiErr.Type, '#')+1:]
+		return nil, fmt.Errorf("comprehend: %s (%d): %s", code, resp.StatusCode, apiErr.Message)
+	}
+	var out struct {
+		Entities []piiEntity `json:"Entities"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("decode comprehend response: %w", err)
+	}
+	return out.Entities, nil
+}
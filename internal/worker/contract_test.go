@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"reflect"
+	"testing"
+
+	"robust-processor/pkg/model"
+)
+
+// contractCase is a request and the queue messages ingest makes of it;
+// ingest's contract test encodes the same fixtures
+type contractCase struct {
+	Name     string `json:"name"`
+	Messages []struct {
+		Event      json.RawMessage   `json:"event"`
+		Attributes map[string]string `json:"attributes"`
+	} `json:"messages"`
+}
+
+func TestQueueContract(t *testing.T) {
+	data, err := os.ReadFile("../../pkg/model/testdata/contract.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []contractCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("contract-key")
+	defer func(k, p []byte, loaded bool, dlq string) {
+		pipelineKey, previousPipelineKey, pipelineKeyLoaded, dlqURL = k, p, loaded, dlq
+	}(pipelineKey, previousPipelineKey, pipelineKeyLoaded, dlqURL)
+	pipelineKey, previousPipelineKey, pipelineKeyLoaded, dlqURL = key, nil, true, ""
+
+	ctx := context.Background()
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			for i, m := range tt.Messages {
+				var body bytes.Buffer
+				if err := json.Compact(&body, m.Event); err != nil {
+					t.Fatal(err)
+				}
+				attrs := maps.Clone(m.Attributes)
+				attrs[model.SignatureAttribute] = model.Sign(key, body.String(), model.CostTagsFrom(attrs))
+				event, rejected, err := decodeMessage(ctx, Message{ID: "m1", Body: body.String(), Attributes: attrs})
+				if rejected || err != nil {
+					t.Fatalf("message %d: rejected = %v, err = %v", i, rejected, err)
+				}
+				var want LogEvent
+				if err := json.Unmarshal(m.Event, &want); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(event, want) {
+					t.Errorf("message %d = %+v, want %+v", i, event, want)
+				}
+				// The tags are signed with the body, so moving a message
+				// to another cost center breaks it
+				attrs[model.CostCenterAttribute] = "other"
+				_, rejected, err = decodeMessage(ctx, Message{ID: "m1", Body: body.String(), Attributes: attrs})
+				if !rejected || !errors.Is(err, errForged) {
+					t.Errorf("message %d with altered tags: rejected = %v, err = %v", i, rejected, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Cost estimation: every processed record stores what processing it is
+// estimated to have cost as its cost attribute: compute time, Comprehend
+// units and stored bytes, priced at costRates. The same figures are added to
+// the tenant's monthly usage in USAGE_TABLE_NAME, next to the records and
+// bytes ingest meters there (and to the month's cost tag rollup), so that
+// pricing and per-tenant margins rest on measured data. Compute is the
+// record's wall time at the function's memory size, so shared waits, such
+// as lookups, are charged to every record waiting on them.
+var usageTableName string
+
+// costRates are list prices in USD, overridable by environment variable
+var costRates = struct {
+	lambdaGBSecond float64 // COST_LAMBDA_GB_SECOND
+	comprehendUnit float64 // COST_COMPREHEND_UNIT, per 100 characters
+	writeUnit      float64 // COST_WRITE_UNIT, per KiB written on demand
+	storageGBMonth float64 // COST_STORAGE_GB_MONTH
+	memoryGB       float64 // the function's memory size
+}{
+	lambdaGBSecond: 0.0000166667,
+	comprehendUnit: 0.0001,
+	writeUnit:      0.00000125,
+	storageGBMonth: 0.25,
+	memoryGB:       0.125,
+}
+
+func init() {
+	for name, rate := range map[string]*float64{
+		"COST_LAMBDA_GB_SECOND": &costRates.lambdaGBSecond,
+		"COST_COMPREHEND_UNIT":  &costRates.comprehendUnit,
+		"COST_WRITE_UNIT":       &costRates.writeUnit,
+		"COST_STORAGE_GB_MONTH": &costRates.storageGBMonth,
+	} {
+		if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && v >= 0 {
+			*rate = v
+		}
+	}
+	if mb, err := strconv.Atoi(os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")); err == nil && mb > 0 {
+		costRates.memoryGB = float64(mb) / 1024
+	}
+}
+
+// recordCost is a record's cost attribute
+type recordCost struct {
+	ComputeMs       int64
+	ComprehendUnits int64
+	StorageBytes    int64
+	// MicroUSD is the estimated total in millionths of a dollar, an integer
+	// so that rollups add up exactly
+	MicroUSD int64
+}
+
+// comprehendUnits is what Comprehend bills for one request: 100-character
+// units, at least 3
+func comprehendUnits(chars int) int64 {
+	return max(3, int64((chars+99)/100))
+}
+
+// estimateCost prices a record's processing
+func estimateCost(compute time.Duration, units int64, item map[string]types.AttributeValue) recordCost {
+	c := recordCost{ComputeMs: compute.Milliseconds(), ComprehendUnits: units, StorageBytes: int64(itemBytes(item))}
+	usd := compute.Seconds()*costRates.memoryGB*costRates.lambdaGBSecond +
+		float64(units)*costRates.comprehendUnit +
+		math.Ceil(float64(c.StorageBytes)/1024)*costRates.writeUnit +
+		float64(c.StorageBytes)/(1<<30)*costRates.storageGBMonth
+	c.MicroUSD = int64(math.Round(usd * 1e6))
+	return c
+}
+
+// attribute is the cost as stored on the record
+func (c recordCost) attribute() types.AttributeValue {
+	n := func(v int64) types.AttributeValue {
+		return &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}
+	}
+	return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"compute_ms":       n(c.ComputeMs),
+		"comprehend_units": n(c.ComprehendUnits),
+		"storage_bytes":    n(c.StorageBytes),
+		"micro_usd":        n(c.MicroUSD),
+	}}
+}
+
+// itemBytes approximates an item's size as DynamoDB bills it: attribute
+// names plus values
+func itemBytes(item map[string]types.AttributeValue) int {
+	n := 0
+	for name, v := range item {
+		n += len(name) + valueBytes(v)
+	}
+	return n
+}
+
+func valueBytes(v types.AttributeValue) int {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return len(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		n := 0
+		for _, s := range v.Value {
+			n += len(s)
+		}
+		return n
+	case *types.AttributeValueMemberM:
+		return 3 + itemBytes(v.Value)
+	case *types.AttributeValueMemberL:
+		n := 3
+		for _, e := range v.Value {
+			n += 1 + valueBytes(e)
+		}
+		return n
+	default:
+		return 1
+	}
+}
+
+// costKey is one usage item a batch's costs are added to
+type costKey struct {
+	tenantID string
+	period   string
+}
+
+var (
+	costMu      sync.Mutex
+	pendingCost = map[costKey]recordCost{}
+)
+
+// rollUpCost buffers a record's cost until the batch is done, under the
+// tenant's month and, when tagged, its cost tag rollup
+func rollUpCost(tenantID string, tags model.CostTags, processedAt time.Time, c recordCost) {
+	if usageTableName == "" {
+		return
+	}
+	period := processedAt.Format("2006-01")
+	keys := []costKey{{tenantID, period}}
+	if !tags.IsZero() {
+		keys = append(keys, costKey{tenantID, period + "#" + tags.CostCenter + "#" + tags.Project})
+	}
+	costMu.Lock()
+	for _, k := range keys {
+		sum := pendingCost[k]
+		sum.ComputeMs += c.ComputeMs
+		sum.ComprehendUnits += c.ComprehendUnits
+		sum.StorageBytes += c.StorageBytes
+		sum.MicroUSD += c.MicroUSD
+		pendingCost[k] = sum
+	}
+	costMu.Unlock()
+}
+
+// flushCosts adds the batch's costs to the usage table, one atomic ADD per
+// tenant and period. Rollups are best effort, like completion events: the
+// records already carry their own cost.
+func flushCosts(ctx context.Context) {
+	costMu.Lock()
+	pending := pendingCost
+	pendingCost = map[costKey]recordCost{}
+	costMu.Unlock()
+
+	for k, c := range pending {
+		_, err := dynamo().UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(usageTableName),
+			Key: map[string]types.AttributeValue{
+				"tenant_id": &types.AttributeValueMemberS{Value: k.tenantID},
+				"period":    &types.AttributeValueMemberS{Value: k.period},
+			},
+			UpdateExpression: aws.String("ADD compute_ms :c, comprehend_units :u, storage_bytes :s, cost_micro_usd :d"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":c": &types.AttributeValueMemberN{Value: strconv.FormatInt(c.ComputeMs, 10)},
+				":u": &types.AttributeValueMemberN{Value: strconv.FormatInt(c.ComprehendUnits, 10)},
+				":s": &types.AttributeValueMemberN{Value: strconv.FormatInt(c.StorageBytes, 10)},
+				":d": &types.AttributeValueMemberN{Value: strconv.FormatInt(c.MicroUSD, 10)},
+			},
+		})
+		if err != nil {
+			slog.Warn("Failed to roll up processing cost", "tenant_id", k.tenantID, "period", k.period, "error", err)
+			emitMetric("CostRollupFailures", 1, "Count", nil)
+		}
+	}
+}
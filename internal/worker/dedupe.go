@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// errDuplicate reports that a record is already stored: SQS delivered its
+// message again after it was processed
+var errDuplicate = errors.New("record already processed")
+
+// Processed records are written only over nothing or over ingest's QUEUED
+// stub, so a redelivered message cannot overwrite its record or be counted
+// twice. Ingest writes its stub under the same condition, so a resend through
+// ingest is processed again only while the record is QUEUED or FAILED.
+const unprocessedCondition = "attribute_not_exists(log_id) OR #status = :queued"
+
+var (
+	unprocessedNames  = map[string]string{"#status": "status"}
+	unprocessedValues = map[string]types.AttributeValue{":queued": &types.AttributeValueMemberS{Value: "QUEUED"}}
+)
+
+// putRecord stores a processed item unless its record was already processed
+func putRecord(ctx context.Context, item map[string]types.AttributeValue) error {
+	_, err := dynamo().PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(tableName),
+		Item:                      item,
+		ConditionExpression:       aws.String(unprocessedCondition),
+		ExpressionAttributeNames:  unprocessedNames,
+		ExpressionAttributeValues: unprocessedValues,
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if errors.As(err, &conditional) {
+		return errDuplicate
+	}
+	return err
+}
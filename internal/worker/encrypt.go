@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"robust-processor/internal/envelope"
+	"robust-processor/internal/failure"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// validateKeyARN accepts the full ARN of a KMS key, so a key in the
+// tenant's own account is named unambiguously
+func validateKeyARN(s string) error {
+	a, err := arn.Parse(s)
+	if err != nil || a.Service != "kms" || !strings.HasPrefix(a.Resource, "key/") {
+		return errors.New("kms_key_arn must be a KMS key ARN (arn:aws:kms:<region>:<account>:key/<id>)")
+	}
+	return nil
+}
+
+// sealOriginal replaces the item's original_text with its encryption under
+// the tenant's key. A key the tenant revoked fails the record with
+// encryption_key_unavailable rather than storing the text in the clear.
+func sealOriginal(ctx context.Context, item map[string]types.AttributeValue, keyARN, tenantID, logID, text string) error {
+	sealed, err := envelope.Seal(ctx, kmsClient(), keyARN, tenantID, logID, text)
+	if err != nil {
+		if envelope.KeyUnavailable(err) {
+			emitMetric("EncryptionKeyUnavailable", 1, "Count", map[string]string{"tenant_id": tenantID})
+			return failure.Wrap(failure.EncryptionKeyUnavailable, err)
+		}
+		return err
+	}
+	attrs, err := attributevalue.MarshalMap(sealed)
+	if err != nil {
+		return err
+	}
+	delete(item, "original_text")
+	for k, v := range attrs {
+		item[k] = v
+	}
+	return nil
+}
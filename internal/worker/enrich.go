@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Enrichment annotates events from reference data before they are redacted
+// and stored. Lookups are strictly time-boxed and fail open: a slow or
+// broken lookup table costs the annotation, never the record.
+const (
+	enrichTimeout  = 200 * time.Millisecond
+	lookupCacheTTL = 5 * time.Minute
+	// maxLookupEntries bounds the lookup cache: DynamoDB tables are cached
+	// per key, so without a bound every distinct key ever seen stays in memory
+	maxLookupEntries = 10000
+)
+
+// Enrichment maps the value of Field through a lookup table into Target.
+// Table is either s3://bucket/key (a JSON object of key -> value, loaded
+// whole) or dynamodb://TableName (items keyed by "key" with a "value"
+// string attribute, looked up per key).
+type Enrichment struct {
+	Field  string `dynamodbav:"field"`
+	Target string `dynamodbav:"target"`
+	Table  string `dynamodbav:"table"`
+}
+
+func validateEnrichment(e Enrichment) error {
+	if e.Field == "" || e.Target == "" {
+		return fmt.Errorf("enrichment %q: field and target are required", e.Table)
+	}
+	if !strings.HasPrefix(e.Table, "s3://") && !strings.HasPrefix(e.Table, "dynamodb://") {
+		return fmt.Errorf("enrichment %q: table must be s3:// or dynamodb://", e.Table)
+	}
+	return nil
+}
+
+type lookupEntry struct {
+	cacheKey  string
+	values    map[string]string // whole S3 table, or a single DynamoDB key
+	fetchedAt time.Time
+}
+
+// The lookup cache is least recently used first out once it holds
+// maxLookupEntries; lookupOrder runs from most to least recently used
+var (
+	lookupMu    sync.Mutex
+	lookupCache = map[string]*list.Element{}
+	lookupOrder = list.New()
+)
+
+func cachedLookup(cacheKey string) (lookupEntry, bool) {
+	lookupMu.Lock()
+	defer lookupMu.Unlock()
+	el, ok := lookupCache[cacheKey]
+	if !ok {
+		return lookupEntry{}, false
+	}
+	lookupOrder.MoveToFront(el)
+	return *el.Value.(*lookupEntry), true
+}
+
+func storeLookup(entry lookupEntry) {
+	lookupMu.Lock()
+	defer lookupMu.Unlock()
+	if el, ok := lookupCache[entry.cacheKey]; ok {
+		*el.Value.(*lookupEntry) = entry
+		lookupOrder.MoveToFront(el)
+		return
+	}
+	lookupCache[entry.cacheKey] = lookupOrder.PushFront(&entry)
+	if lookupOrder.Len() > maxLookupEntries {
+		oldest := lookupOrder.Back()
+		lookupOrder.Remove(oldest)
+		delete(lookupCache, oldest.Value.(*lookupEntry).cacheKey)
+	}
+}
+
+// applyEnrichments fills enrichment targets on the event, skipping any
+// lookup that misses, errors or exceeds enrichTimeout
+func applyEnrichments(ctx context.Context, event *LogEvent, enrichments []Enrichment) {
+	for _, e := range enrichments {
+		key, ok := event.Fields[e.Field]
+		if !ok {
+			continue
+		}
+		lookupCtx, cancel := context.WithTimeout(ctx, enrichTimeout)
+		value, found, err := lookup(lookupCtx, e.Table, key)
+		cancel()
+		if err != nil {
+			slog.Warn("Enrichment lookup failed", "tenant_id", event.TenantID, "table", e.Table, "error", err)
+			emitMetric("EnrichmentFailure", 1, "Count", map[string]string{"table": e.Table})
+			continue
+		}
+		if found {
+			event.Fields[e.Target] = value
+		}
+	}
+}
+
+func lookup(ctx context.Context, table, key string) (string, bool, error) {
+	cacheKey := table
+	if strings.HasPrefix(table, "dynamodb://") {
+		cacheKey = table + "#" + key
+	}
+
+	entry, ok := cachedLookup(cacheKey)
+	if !ok || time.Since(entry.fetchedAt) > lookupCacheTTL {
+		values, err := fetchLookup(ctx, table, key)
+		if err != nil {
+			if !ok {
+				return "", false, err
+			}
+			// Serve the stale table rather than dropping the annotation
+			slog.Warn("Lookup refresh failed, using cached table", "table", table, "error", err)
+		} else {
+			entry = lookupEntry{cacheKey: cacheKey, values: values, fetchedAt: time.Now()}
+			storeLookup(entry)
+		}
+	}
+
+	value, found := entry.values[key]
+	return value, found, nil
+}
+
+func fetchLookup(ctx context.Context, table, key string) (map[string]string, error) {
+	if name, ok := strings.CutPrefix(table, "dynamodb://"); ok {
+		out, err := dynamo().GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(name),
+			Key:       map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		values := map[string]string{}
+		if v, ok := out.Item["value"].(*types.AttributeValueMemberS); ok {
+			values[key] = v.Value
+		}
+		return values, nil
+	}
+
+	bucket, objectKey, _ := strings.Cut(strings.TrimPrefix(table, "s3://"), "/")
+	out, err := s3Client().GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	var values map[string]string
+	if err := json.NewDecoder(out.Body).Decode(&values); err != nil {
+		return nil, fmt.Errorf("lookup table %s: %w", table, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLookupCacheBounded(t *testing.T) {
+	for i := range maxLookupEntries + 10 {
+		key := strconv.Itoa(i)
+		storeLookup(lookupEntry{cacheKey: key, values: map[string]string{key: "v"}, fetchedAt: time.Now()})
+		// Key 0 is read after every store, so it stays the most recently used
+		if _, ok := cachedLookup("0"); !ok {
+			t.Fatalf("key 0 evicted after %d stores", i+1)
+		}
+	}
+	if len(lookupCache) != maxLookupEntries || lookupOrder.Len() != maxLookupEntries {
+		t.Errorf("cache holds %d entries (%d ordered), want %d", len(lookupCache), lookupOrder.Len(), maxLookupEntries)
+	}
+	// The least recently used entries went first
+	for i := 1; i <= 10; i++ {
+		if _, ok := cachedLookup(strconv.Itoa(i)); ok {
+			t.Errorf("key %d still cached", i)
+		}
+	}
+	if _, ok := cachedLookup(strconv.Itoa(11)); !ok {
+		t.Error("key 11 evicted")
+	}
+
+	// Storing a cached key again replaces it in place
+	storeLookup(lookupEntry{cacheKey: "0", values: map[string]string{"0": "w"}, fetchedAt: time.Now()})
+	if entry, _ := cachedLookup("0"); entry.values["0"] != "w" || len(lookupCache) != maxLookupEntries {
+		t.Errorf("re-store: value %q, %d entries", entry.values["0"], len(lookupCache))
+	}
+}
@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"robust-processor/internal/failure"
+)
+
+// Escalation: the regex engine redacts every record; records whose redacted
+// text still looks risky are then sent to Comprehend's PII detector, which
+// catches what patterns can't (names, addresses, free-form dates) at a cost
+// per character. A tenant's escalation policy sets the risk score at which a
+// record is escalated, so only the few records likely to need it pay for it.
+type Escalation struct {
+	// Threshold is the risk score, 0-1, at or above which a record is
+	// escalated; 0 means 0.5
+	Threshold float64 `dynamodbav:"threshold"`
+	// MinConfidence ignores entities Comprehend scores lower; 0 means 0.8
+	MinConfidence float64 `dynamodbav:"min_confidence"`
+	// Language is the text's language code for Comprehend; "" means "en"
+	Language string `dynamodbav:"language"`
+}
+
+// Risk signals, read from the text after regex redaction so that what the
+// patterns already caught doesn't count. Keywords announce a sensitive value
+// nearby; near misses are values shaped almost like one the patterns know.
+var (
+	riskKeywords = regexp.MustCompile(`(?i)\b(?:ssn|social security|dob|d\.o\.b|date of birth|birth ?date|passport` +
+		`|driver'?s? licen[cs]e|national id|tax id|mrn|medical record|home address|maiden name)\b`)
+	nearMisses = []*regexp.Regexp{
+		// Digit runs split by spaces, dots or slashes: IDs, dates, phone numbers
+		regexp.MustCompile(`\b\d[\d .\-/]{4,18}\d\b`),
+		// Spelled-out email addresses
+		regexp.MustCompile(`(?i)\b[\w.+-]+\s*(?:\(at\)|\[at\]|\sat\s)\s*[\w-]+\s*(?:\(dot\)|\[dot\]|\sdot\s)\s*[a-z]{2,}\b`),
+		// Street addresses
+		regexp.MustCompile(`(?i)\b\d{1,5}\s+(?:[a-z]+\s+){1,3}(?:st|street|ave|avenue|rd|road|blvd|boulevard|ln|lane|dr|drive|way|court|ct)\b`),
+	}
+)
+
+const (
+	// keywordRisk is the score each keyword adds
+	keywordRisk = 0.35
+	// nearMissRisk is the score each near miss adds to a record of up to
+	// densityWords words; longer records dilute it
+	nearMissRisk = 0.2
+	densityWords = 25
+)
+
+// riskScore rates how likely text is to hold PII the patterns missed, 0-1
+func riskScore(text string) float64 {
+	if text == "" {
+		return 0
+	}
+	score := keywordRisk * float64(len(riskKeywords.FindAllStringIndex(text, -1)))
+	misses := 0
+	for _, p := range nearMisses {
+		misses += len(p.FindAllStringIndex(text, -1))
+	}
+	words := max(len(strings.Fields(text)), densityWords)
+	score += nearMissRisk * float64(misses) * densityWords / float64(words)
+	return math.Min(score, 1)
+}
+
+// validateEscalation checks the bounds of an escalation policy
+func validateEscalation(e Escalation) error {
+	if e.Threshold < 0 || e.Threshold > 1 {
+		return fmt.Errorf("escalation threshold must be between 0 and 1")
+	}
+	if e.MinConfidence < 0 || e.MinConfidence > 1 {
+		return fmt.Errorf("escalation min_confidence must be between 0 and 1")
+	}
+	return nil
+}
+
+// escalates reports whether a record with the given risk score is escalated
+func (e *Escalation) escalates(score float64) bool {
+	threshold := e.Threshold
+	if threshold == 0 {
+		threshold = 0.5
+	}
+	return score >= threshold
+}
+
+// escalate redacts the entities Comprehend finds in already-redacted text,
+// writing placeholder over each and counting them in counts as ml_<type>.
+// It also returns the Comprehend units the calls were billed.
+// Text beyond one request's limit is sent in chunks split at whitespace. A
+// failed call fails the record: storing it with only the regex pass would
+// quietly weaken the tenant's policy.
+func escalate(ctx context.Context, e *Escalation, text, placeholder string, counts map[string]int) (string, int64, error) {
+	language, minConfidence := e.Language, e.MinConfidence
+	if language == "" {
+		language = "en"
+	}
+	if minConfidence == 0 {
+		minConfidence = 0.8
+	}
+
+	var b strings.Builder
+	var units int64
+	for _, chunk := range comprehendChunks(text) {
+		entities, err := detectPIIEntities(ctx, chunk, language)
+		if err != nil {
+			emitMetric("EscalationFailures", 1, "Count", nil)
+			return "", 0, failure.Wrap(failure.DependencyUnavailable, err)
+		}
+		units += comprehendUnits(utf8.RuneCountInString(chunk))
+		// Map character offsets to byte offsets in one pass
+		runeAt := make([]int, 0, len(chunk)+1)
+		for i := range chunk {
+			runeAt = append(runeAt, i)
+		}
+		runeAt = append(runeAt, len(chunk))
+
+		slices.SortFunc(entities, func(a, b piiEntity) int { return a.BeginOffset - b.BeginOffset })
+		last := 0
+		for _, entity := range entities {
+			if entity.Score < minConfidence || entity.BeginOffset < 0 || entity.EndOffset > len(runeAt)-1 || entity.BeginOffset >= entity.EndOffset {
+				continue
+			}
+			start, end := runeAt[entity.BeginOffset], runeAt[entity.EndOffset]
+			if start < last {
+				continue
+			}
+			b.WriteString(chunk[last:start])
+			b.WriteString(placeholder)
+			counts["ml_"+strings.ToLower(entity.Type)]++
+			last = end
+		}
+		b.WriteString(chunk[last:])
+	}
+	emitMetric("RecordsEscalated", 1, "Count", nil)
+	return b.String(), units, nil
+}
+
+// comprehendChunks splits text into pieces that fit one request, at the
+// last whitespace before the limit where there is one, else at a character
+// boundary. An entity straddling a split may be missed.
+func comprehendChunks(text string) []string {
+	var chunks []string
+	for len(text) > comprehendMaxBytes {
+		cut := comprehendMaxBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if ws := strings.LastIndexAny(text[:cut], " \t\n"); ws > comprehendMaxBytes/2 {
+			cut = ws + 1
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	return append(chunks, text)
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// Completion events: every processed record is announced on the EventBridge
+// bus named by COMPLETION_EVENT_BUS, for live dashboards and other consumers.
+// Events carry no content, redacted or otherwise.
+const (
+	completionSource     = "robust-processor"
+	completionDetailType = "Log Processed"
+	// putEventsLimit is the most entries one PutEvents call accepts
+	putEventsLimit = 10
+)
+
+var completionBus = os.Getenv("COMPLETION_EVENT_BUS")
+
+// completion is the detail of a completion event
+type completion struct {
+	TenantID    string   `json:"tenant_id"`
+	LogID       string   `json:"log_id"`
+	Source      string   `json:"source"`
+	ParentID    string   `json:"parent_id,omitempty"`
+	BatchID     string   `json:"batch_id,omitempty"`
+	Status      string   `json:"status"`
+	ProcessedAt string   `json:"processed_at"`
+	Labels      []string `json:"labels,omitempty"`
+	// Redactions counts the record's redactions by detector, for alert rules
+	Redactions map[string]int `json:"redactions,omitempty"`
+}
+
+var eventBridgeClient = sync.OnceValue(func() *eventbridge.Client {
+	return eventbridge.NewFromConfig(awsConfig())
+})
+
+var (
+	completionMu      sync.Mutex
+	pendingCompletion []types.PutEventsRequestEntry
+)
+
+// announceCompletion buffers a completion event until the batch is done
+func announceCompletion(c completion) {
+	if completionBus == "" {
+		return
+	}
+	detail, _ := json.Marshal(c)
+	completionMu.Lock()
+	pendingCompletion = append(pendingCompletion, types.PutEventsRequestEntry{
+		EventBusName: aws.String(completionBus),
+		Source:       aws.String(completionSource),
+		DetailType:   aws.String(completionDetailType),
+		Detail:       aws.String(string(detail)),
+	})
+	completionMu.Unlock()
+}
+
+// flushCompletions publishes buffered events. Delivery is best effort: the
+// records are already stored, so a failed announcement is counted, not retried.
+func flushCompletions(ctx context.Context) {
+	completionMu.Lock()
+	entries := pendingCompletion
+	pendingCompletion = nil
+	completionMu.Unlock()
+
+	failed := 0
+	for start := 0; start < len(entries); start += putEventsLimit {
+		chunk := entries[start:min(start+putEventsLimit, len(entries))]
+		out, err := eventBridgeClient().PutEvents(ctx, &eventbridge.PutEventsInput{Entries: chunk})
+		if err != nil {
+			slog.Warn("Completion events failed", "events", len(chunk), "error", err)
+			failed += len(chunk)
+			continue
+		}
+		failed += int(out.FailedEntryCount)
+	}
+	if failed > 0 {
+		emitMetric("CompletionEventFailures", float64(failed), "Count", nil)
+	}
+}
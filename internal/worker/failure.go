@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"robust-processor/internal/failure"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// recordFailure notes why a message failed on its record's QUEUED stub, as
+// last_failure. Only the failure code is stored, never the error text. If the
+// message is dead-lettered, the quarantine consumer turns the stub into a
+// FAILED record with this code; a later success overwrites it. Best effort:
+// without it the FAILED record reads internal_error.
+func recordFailure(ctx context.Context, message Message, err error) {
+	var event LogEvent
+	if json.Unmarshal([]byte(message.Body), &event) != nil || event.TenantID == "" || event.LogID == "" || event.Shadow {
+		return
+	}
+	_, uerr := dynamo().UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: event.TenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: event.LogID},
+		},
+		UpdateExpression:         aws.String("SET last_failure = :code"),
+		ConditionExpression:      aws.String("#status = :queued"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":code":   &types.AttributeValueMemberS{Value: string(failure.CodeOf(err))},
+			":queued": &types.AttributeValueMemberS{Value: "QUEUED"},
+		},
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if uerr != nil && !errors.As(uerr, &conditional) {
+		slog.Warn("Failed to record failure", "message_id", message.ID, "error", uerr)
+	}
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"encoding/csv"
+	"io"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"robust-processor/pkg/redact"
+)
+
+// IP geolocation: before IP addresses are redacted, tenants with geoip
+// enabled get the coarse location (country, plus region where the dataset
+// has one) of each address recorded instead. Their policies always run the
+// ip detector (see redactionProfile), so the raw address is never stored;
+// addresses are found with its pattern, so exactly those redacted are
+// located.
+
+//go:embed geoip.csv
+var geoipData string
+
+type geoRange struct {
+	start, end uint32
+	location   string
+}
+
+// geoRanges parses the embedded dataset on first use, keeping it off the
+// cold start path for tenants that never enable geolocation
+var geoRanges = sync.OnceValue(func() []geoRange {
+	reader := csv.NewReader(strings.NewReader(geoipData))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var ranges []geoRange
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			slog.Error("GeoIP dataset unreadable", "error", err)
+			return nil
+		}
+		if len(record) < 3 {
+			continue
+		}
+		start, err1 := netip.ParseAddr(record[0])
+		end, err2 := netip.ParseAddr(record[1])
+		if err1 != nil || err2 != nil || !start.Is4() || !end.Is4() {
+			continue
+		}
+		location := record[2]
+		// City-level datasets carry continent,country,region,...
+		if len(record) >= 5 && len(record[2]) == 2 && len(record[3]) == 2 {
+			location = record[3] + "/" + record[4]
+		} else if len(record) == 4 && record[3] != "" {
+			location = record[2] + "/" + record[3]
+		}
+		ranges = append(ranges, geoRange{start: ipv4Int(start), end: ipv4Int(end), location: location})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	return ranges
+})
+
+func ipv4Int(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// geolocate returns the distinct coarse locations of the IPv4 addresses in
+// text, in order of first appearance
+func geolocate(text string) []string {
+	ranges := geoRanges()
+	if len(ranges) == 0 || !strings.Contains(text, ".") {
+		return nil
+	}
+
+	var locations []string
+	for _, m := range redact.IPv4Pattern.FindAllString(text, -1) {
+		addr, err := netip.ParseAddr(m)
+		if err != nil {
+			continue
+		}
+		ip := ipv4Int(addr)
+		i := sort.Search(len(ranges), func(i int) bool { return ranges[i].start > ip }) - 1
+		if i < 0 || ip > ranges[i].end || ranges[i].location == "ZZ" {
+			continue
+		}
+		if !slices.Contains(locations, ranges[i].location) {
+			locations = append(locations, ranges[i].location)
+		}
+	}
+	return locations
+}
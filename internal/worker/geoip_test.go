@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"testing"
+
+	"robust-processor/pkg/redact"
+)
+
+// A geoip tenant keeps only the location, so its profiles redact IPs
+// even when they don't enable the ip detector
+func TestGeoIPRedactsAddresses(t *testing.T) {
+	const text = "login from 203.0.113.7"
+	for _, p := range []redact.Policy{{}, {EnabledDetectors: []string{"ip"}}, {CustomPatterns: []redact.CustomPattern{{Name: "x", Pattern: "xyz"}}}} {
+		r, err := redact.Compile(redactionProfile(p, true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := r.Redact(text), "login from [REDACTED]"; got != want {
+			t.Errorf("%+v: Redact = %q, want %q", p, got, want)
+		}
+	}
+	r, err := redact.Compile(redactionProfile(redact.Policy{}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Redact(text); got != text {
+		t.Errorf("without geoip: Redact = %q, want it unchanged", got)
+	}
+}
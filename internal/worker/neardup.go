@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"robust-processor/internal/simhash"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Near-duplicates: every record's redacted text is fingerprinted and the
+// fingerprint stored on it as simhash. For tenants with near_duplicates,
+// the fingerprint is also indexed in NEAR_DUPLICATE_TABLE_NAME under each of
+// its band keys, where GET /logs/{log_id}/similar looks a record's
+// neighbours up. Redacted text is what is compared, so two leaks of one
+// document match even where their PII differs.
+var nearDuplicateTableName string
+
+var (
+	fingerprintMu      sync.Mutex
+	pendingFingerprint []types.WriteRequest
+)
+
+// indexFingerprint buffers a record's band index entries until the batch is
+// done. Entries expire with the record.
+func indexFingerprint(tenantID, logID string, fp uint64, expiresAt types.AttributeValue) {
+	if nearDuplicateTableName == "" {
+		return
+	}
+	fingerprint := &types.AttributeValueMemberS{Value: simhash.Format(fp)}
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+	for _, band := range simhash.BandKeys(tenantID, fp) {
+		item := map[string]types.AttributeValue{
+			"band":    &types.AttributeValueMemberS{Value: band},
+			"log_id":  &types.AttributeValueMemberS{Value: logID},
+			"simhash": fingerprint,
+		}
+		if expiresAt != nil {
+			item["expires_at"] = expiresAt
+		}
+		pendingFingerprint = append(pendingFingerprint, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+}
+
+// flushFingerprints writes the batch's index entries, 25 to a call. The
+// index is best effort, like completion events: a record whose entries are
+// lost is still stored, only missing from its neighbours' lookups.
+func flushFingerprints(ctx context.Context) {
+	fingerprintMu.Lock()
+	pending := pendingFingerprint
+	pendingFingerprint = nil
+	fingerprintMu.Unlock()
+
+	for len(pending) > 0 {
+		n := min(len(pending), 25)
+		requests := pending[:n]
+		pending = pending[n:]
+		var err error
+		for attempt := 0; len(requests) > 0 && attempt < 3 && err == nil; attempt++ {
+			var out *dynamodb.BatchWriteItemOutput
+			out, err = dynamo().BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{nearDuplicateTableName: requests},
+			})
+			if err == nil {
+				requests = out.UnprocessedItems[nearDuplicateTableName]
+			}
+		}
+		if len(requests) > 0 {
+			slog.Warn("Failed to index fingerprints", "entries", len(requests), "error", err)
+			emitMetric("FingerprintIndexFailures", float64(len(requests)), "Count", nil)
+		}
+	}
+}
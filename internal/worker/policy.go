@@ -0,0 +1,396 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"robust-processor/internal/embed"
+	"robust-processor/internal/failure"
+	"robust-processor/internal/pseudonym"
+	"robust-processor/pkg/redact"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// policyTTL bounds how long a fetched tenant policy is trusted before the
+// version is re-read from the policy table
+const policyTTL = time.Minute
+
+var policyTableName string
+
+// TenantPolicy is a tenant's redaction configuration as stored in the policy
+// table. The embedded redact.Policy's attributes sit at the top level.
+type TenantPolicy struct {
+	TenantID string `dynamodbav:"tenant_id"`
+	Version  int    `dynamodbav:"version"`
+	redact.Policy
+	Transforms  []Transform  `dynamodbav:"transforms"`
+	Enrichments []Enrichment `dynamodbav:"enrichments"`
+	// GeoIP records the coarse location of IP addresses before they are redacted
+	GeoIP bool `dynamodbav:"geoip"`
+	// HashChain seals every record into a tamper-evident per-day hash chain
+	HashChain bool `dynamodbav:"hash_chain"`
+	// Receipts stores a KMS-signed attestation of each redaction with the record
+	Receipts bool `dynamodbav:"receipts"`
+	// KMSKeyARN is the tenant's own KMS key; when set, original text is only
+	// stored encrypted under it (see internal/envelope)
+	KMSKeyARN string `dynamodbav:"kms_key_arn"`
+	// Export copies processed records to a bucket the tenant owns
+	Export *TenantExport `dynamodbav:"export"`
+	// Sources overrides parts of the policy for events of one source, keyed
+	// by the event's source field (e.g. "syslog", "json_upload")
+	Sources map[string]SourcePolicy `dynamodbav:"sources"`
+	// Escalation sends risky records to an ML detector after the regex pass
+	Escalation *Escalation `dynamodbav:"escalation"`
+	// SearchPseudonyms names fields indexed in OpenSearch as pseudonyms, so
+	// they can be filtered on without being readable (see internal/pseudonym)
+	SearchPseudonyms []string `dynamodbav:"search_pseudonyms"`
+	// PseudonymGeneration selects the tenant's pseudonym subkey; rdpctl
+	// tenant rotate-secrets moves it on (see pseudonym.TokenAt)
+	PseudonymGeneration int `dynamodbav:"pseudonym_generation"`
+	// SemanticSearch indexes an embedding of each record's redacted text in
+	// OpenSearch, for GET /logs/search (see internal/embed)
+	SemanticSearch bool `dynamodbav:"semantic_search"`
+	// NearDuplicates indexes each record's fingerprint, for
+	// GET /logs/{log_id}/similar (see internal/simhash)
+	NearDuplicates bool `dynamodbav:"near_duplicates"`
+	// RetentionDays expires the tenant's processed records after so many
+	// days through the table's TTL; 0 keeps them, and unset applies
+	// defaultRetention
+	RetentionDays *int `dynamodbav:"retention_days"`
+	// StoreOriginal false stores only the redacted text and a SHA-256 of the
+	// original, never the original itself; unset follows STORE_ORIGINAL
+	StoreOriginal *bool `dynamodbav:"store_original"`
+	// Tokenize writes a deterministic token for each redacted value, such
+	// as [EMAIL:3f9a0c12d4e5b687], instead of the placeholder, and keeps the
+	// value in the token vault for authorized de-tokenization
+	Tokenize bool `dynamodbav:"tokenize"`
+}
+
+// SourcePolicy is the part of a tenant's policy that can differ by source
+type SourcePolicy struct {
+	// RetentionDays expires the source's processed records after so many
+	// days through the table's TTL; 0 applies the tenant's retention
+	RetentionDays int `dynamodbav:"retention_days"`
+	// Redaction replaces the tenant's redaction profile for the source
+	Redaction *redact.Policy `dynamodbav:"redaction"`
+	// Sinks names where the source's records go besides DynamoDB, out of
+	// "firehose", "opensearch" and "export"; unset means all of them
+	Sinks []string `dynamodbav:"sinks"`
+}
+
+// sinkNames are the names SourcePolicy.Sinks may select
+var sinkNames = map[string]bool{"firehose": true, "opensearch": true, "export": true}
+
+// compiledPolicy is a TenantPolicy with all patterns compiled, ready to apply
+type compiledPolicy struct {
+	version     int
+	redactor    *redact.Redactor
+	transforms  []Transform
+	enrichments []Enrichment
+	geoip       bool
+	hashChain   bool
+	receipts    bool
+	kmsKeyARN   string
+	export      *TenantExport
+	sources     map[string]*compiledSource
+	escalation  *Escalation
+	// searchPseudonyms is the set of SearchPseudonyms
+	searchPseudonyms    map[string]bool
+	pseudonymGeneration int
+	semanticSearch      bool
+	nearDuplicates      bool
+	// retention is how long processed records are kept; 0 keeps them
+	retention time.Duration
+	// storeOriginal keeps original_text on the stored item
+	storeOriginal bool
+	tokenize      bool
+}
+
+// compiledSource is a SourcePolicy ready to apply
+type compiledSource struct {
+	retention time.Duration
+	redactor  *redact.Redactor
+	// sinks is the selected sink names; nil selects every sink
+	sinks map[string]bool
+}
+
+// allSources applies to sources the policy doesn't name
+var allSources = &compiledSource{}
+
+// forSource returns the overrides for an event's source
+func (p *compiledPolicy) forSource(source string) *compiledSource {
+	if s, ok := p.sources[source]; ok {
+		return s
+	}
+	return allSources
+}
+
+// redactorFor returns the redactor for an event's source
+func (p *compiledPolicy) redactorFor(source string) *redact.Redactor {
+	if s := p.forSource(source); s.redactor != nil {
+		return s.redactor
+	}
+	return p.redactor
+}
+
+// sends reports whether records of the source go to the named sink
+func (s *compiledSource) sends(sink string) bool {
+	return s.sinks == nil || s.sinks[sink]
+}
+
+var defaultPolicy = &compiledPolicy{redactor: redact.Default}
+
+// defaultRetention applies to tenants that set no retention_days
+// (DEFAULT_RETENTION_DAYS, default 90; 0 keeps records). Tenants with
+// hash_chain keep theirs, as expiring records would break the chains.
+var defaultRetention = 90 * 24 * time.Hour
+
+// storeOriginal is STORE_ORIGINAL: "false" stops original_text being stored
+// for every tenant, whatever its policy says. Otherwise tenants opt out with
+// store_original.
+var storeOriginal = true
+
+type cachedPolicy struct {
+	policy    TenantPolicy
+	fetchedAt time.Time
+}
+
+// Both caches live for the lifetime of the execution environment, so warm
+// invocations skip the policy table read and regex compilation entirely
+var (
+	policyMu         sync.Mutex
+	fetchedByTenant  = map[string]cachedPolicy{}
+	compiledByTenant = map[string]*compiledPolicy{}
+)
+
+// policyFor returns the compiled redaction policy for a tenant. Compiled
+// policies are cached by tenant and policy version; a version bump in the
+// policy table triggers a single recompile on the next message.
+func policyFor(ctx context.Context, tenantID string) (*compiledPolicy, error) {
+	if policyTableName == "" {
+		return defaultPolicy, nil
+	}
+
+	policy, err := fetchPolicy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if policy.builtinOnly() {
+		return defaultPolicy, nil
+	}
+
+	policyMu.Lock()
+	compiled, ok := compiledByTenant[tenantID]
+	policyMu.Unlock()
+	if ok && compiled.version == policy.Version {
+		emitMetric("PolicyCacheHit", 1, "Count", nil)
+		return compiled, nil
+	}
+	emitMetric("PolicyCacheHit", 0, "Count", nil)
+
+	start := time.Now()
+	compiled, err = compilePolicy(policy)
+	if err != nil {
+		return nil, failure.Wrap(failure.PolicyInvalid, err)
+	}
+	emitMetric("PolicyCompileTime", float64(time.Since(start).Microseconds())/1000, "Milliseconds", nil)
+
+	policyMu.Lock()
+	compiledByTenant[tenantID] = compiled
+	policyMu.Unlock()
+	return compiled, nil
+}
+
+// builtinOnly reports whether the policy configures nothing beyond the defaults
+func (p TenantPolicy) builtinOnly() bool {
+	return p.Policy.IsDefault() && len(p.Transforms) == 0 && len(p.Enrichments) == 0 &&
+		!p.GeoIP && !p.HashChain && !p.Receipts && p.KMSKeyARN == "" && p.Export == nil && len(p.Sources) == 0 &&
+		p.Escalation == nil && len(p.SearchPseudonyms) == 0 && !p.SemanticSearch &&
+		!p.NearDuplicates && p.RetentionDays == nil && p.StoreOriginal == nil && !p.Tokenize
+}
+
+// fetchPolicy reads a tenant's policy, serving from cache within policyTTL. A
+// tenant with no stored policy gets the zero policy (built-ins only).
+func fetchPolicy(ctx context.Context, tenantID string) (TenantPolicy, error) {
+	policyMu.Lock()
+	cached, ok := fetchedByTenant[tenantID]
+	policyMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < policyTTL {
+		return cached.policy, nil
+	}
+
+	out, err := dynamo().GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(policyTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		},
+	})
+	if err != nil {
+		if ok {
+			// Keep redacting with the last known policy rather than failing the batch
+			slog.Warn("Policy refresh failed, using cached policy", "tenant_id", tenantID, "error", err)
+			return cached.policy, nil
+		}
+		return TenantPolicy{}, err
+	}
+
+	policy := TenantPolicy{TenantID: tenantID}
+	if out.Item != nil {
+		if err := attributevalue.UnmarshalMap(out.Item, &policy); err != nil {
+			return TenantPolicy{}, failure.Wrap(failure.PolicyInvalid, fmt.Errorf("decode policy for %s: %w", tenantID, err))
+		}
+	}
+
+	policyMu.Lock()
+	fetchedByTenant[tenantID] = cachedPolicy{policy: policy, fetchedAt: time.Now()}
+	policyMu.Unlock()
+	return policy, nil
+}
+
+// compilePolicy fails on any invalid pattern: redacting with a partial policy
+// would silently leak whatever the broken pattern was meant to catch
+func compilePolicy(policy TenantPolicy) (*compiledPolicy, error) {
+	redactor, err := redact.Compile(redactionProfile(policy.Policy, policy.GeoIP))
+	if err != nil {
+		return nil, fmt.Errorf("policy for %s: %w", policy.TenantID, err)
+	}
+	compiled := &compiledPolicy{version: policy.Version, redactor: redactor}
+	for _, t := range policy.Transforms {
+		if err := validateTransform(t); err != nil {
+			return nil, fmt.Errorf("policy for %s: %w", policy.TenantID, err)
+		}
+	}
+	for _, e := range policy.Enrichments {
+		if err := validateEnrichment(e); err != nil {
+			return nil, fmt.Errorf("policy for %s: %w", policy.TenantID, err)
+		}
+	}
+	compiled.transforms = policy.Transforms
+	compiled.enrichments = policy.Enrichments
+	if policy.GeoIP && len(geoRanges()) == 0 {
+		return nil, fmt.Errorf("policy for %s: geoip requires the GeoIP dataset (make geoip)", policy.TenantID)
+	}
+	compiled.geoip = policy.GeoIP
+	if policy.HashChain && chainTableName == "" {
+		return nil, fmt.Errorf("policy for %s: hash_chain requires CHAIN_TABLE_NAME", policy.TenantID)
+	}
+	compiled.hashChain = policy.HashChain
+	if policy.Receipts && receiptKeyID == "" {
+		return nil, fmt.Errorf("policy for %s: receipts require RECEIPT_KEY_ID", policy.TenantID)
+	}
+	compiled.receipts = policy.Receipts
+	if policy.KMSKeyARN != "" {
+		if err := validateKeyARN(policy.KMSKeyARN); err != nil {
+			return nil, fmt.Errorf("policy for %s: %w", policy.TenantID, err)
+		}
+	}
+	compiled.kmsKeyARN = policy.KMSKeyARN
+	if policy.Export != nil {
+		if err := validateExport(*policy.Export); err != nil {
+			return nil, fmt.Errorf("policy for %s: %w", policy.TenantID, err)
+		}
+	}
+	compiled.export = policy.Export
+	if policy.Escalation != nil {
+		if err := validateEscalation(*policy.Escalation); err != nil {
+			return nil, fmt.Errorf("policy for %s: %w", policy.TenantID, err)
+		}
+	}
+	compiled.escalation = policy.Escalation
+	if len(policy.SearchPseudonyms) > 0 && !pseudonym.Configured() {
+		return nil, fmt.Errorf("policy for %s: search_pseudonyms require PSEUDONYM_KEY_CIPHERTEXT", policy.TenantID)
+	}
+	for _, field := range policy.SearchPseudonyms {
+		if compiled.searchPseudonyms == nil {
+			compiled.searchPseudonyms = map[string]bool{}
+		}
+		compiled.searchPseudonyms[field] = true
+	}
+	compiled.pseudonymGeneration = policy.PseudonymGeneration
+	if policy.SemanticSearch && !embed.Configured() {
+		return nil, fmt.Errorf("policy for %s: semantic_search requires EMBEDDING_MODEL_ID or EMBEDDING_ENDPOINT", policy.TenantID)
+	}
+	compiled.semanticSearch = policy.SemanticSearch
+	compiled.nearDuplicates = policy.NearDuplicates
+	switch {
+	case policy.RetentionDays == nil && !policy.HashChain:
+		compiled.retention = defaultRetention
+	case policy.RetentionDays == nil:
+	case *policy.RetentionDays < 0:
+		return nil, fmt.Errorf("policy for %s: retention_days must not be negative", policy.TenantID)
+	case *policy.RetentionDays > 0 && policy.HashChain:
+		return nil, fmt.Errorf("policy for %s: retention_days can't be combined with hash_chain", policy.TenantID)
+	default:
+		compiled.retention = time.Duration(*policy.RetentionDays) * 24 * time.Hour
+	}
+	compiled.storeOriginal = storeOriginal && (policy.StoreOriginal == nil || *policy.StoreOriginal)
+	if policy.Tokenize {
+		switch {
+		case !pseudonym.Configured() || tokenVaultTableName == "":
+			return nil, fmt.Errorf("policy for %s: tokenize requires PSEUDONYM_KEY_CIPHERTEXT and TOKEN_VAULT_TABLE_NAME", policy.TenantID)
+		case !compiled.storeOriginal:
+			// The vault would keep what redaction-only storage discards
+			return nil, fmt.Errorf("policy for %s: tokenize can't be combined with store_original false", policy.TenantID)
+		}
+	}
+	compiled.tokenize = policy.Tokenize
+	for source, sp := range policy.Sources {
+		cs, err := compileSource(sp, policy.HashChain, policy.GeoIP)
+		if err != nil {
+			return nil, fmt.Errorf("policy for %s: source %q: %w", policy.TenantID, source, err)
+		}
+		if compiled.sources == nil {
+			compiled.sources = map[string]*compiledSource{}
+		}
+		compiled.sources[source] = cs
+	}
+	return compiled, nil
+}
+
+// compileSource validates a source's overrides. Retention can't be combined
+// with hash chaining: records expiring out of a chain would break it.
+func compileSource(sp SourcePolicy, hashChain, geoip bool) (*compiledSource, error) {
+	cs := &compiledSource{}
+	if sp.RetentionDays < 0 {
+		return nil, fmt.Errorf("retention_days must not be negative")
+	}
+	if sp.RetentionDays > 0 && hashChain {
+		return nil, fmt.Errorf("retention_days can't be combined with hash_chain")
+	}
+	cs.retention = time.Duration(sp.RetentionDays) * 24 * time.Hour
+	if sp.Redaction != nil {
+		redactor, err := redact.Compile(redactionProfile(*sp.Redaction, geoip))
+		if err != nil {
+			return nil, err
+		}
+		cs.redactor = redactor
+	}
+	if sp.Sinks != nil {
+		cs.sinks = make(map[string]bool, len(sp.Sinks))
+		for _, name := range sp.Sinks {
+			if !sinkNames[name] {
+				return nil, fmt.Errorf("unknown sink %q", name)
+			}
+			cs.sinks[name] = true
+		}
+	}
+	return cs, nil
+}
+
+// redactionProfile is p as the worker compiles it: tenants with geoip keep
+// only the coarse location of an address, so their profiles redact IPs
+// whether or not they enable the opt-in ip detector themselves
+func redactionProfile(p redact.Policy, geoip bool) redact.Policy {
+	if geoip && !slices.Contains(p.EnabledDetectors, "ip") {
+		p.EnabledDetectors = append(slices.Clone(p.EnabledDetectors), "ip")
+	}
+	return p
+}
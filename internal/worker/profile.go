@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// On-demand profiling: setting PROFILE=cpu, heap or cpu,heap on the function
+// captures profiles for every batch and uploads them to PROFILE_BUCKET, so
+// production load can be profiled with a config change instead of a special
+// build. Leave PROFILE unset in normal operation.
+var (
+	profileCPU    bool
+	profileHeap   bool
+	profileBucket string
+)
+
+func init() {
+	for _, mode := range strings.Split(os.Getenv("PROFILE"), ",") {
+		switch strings.TrimSpace(mode) {
+		case "cpu":
+			profileCPU = true
+		case "heap":
+			profileHeap = true
+		}
+	}
+	profileBucket = os.Getenv("PROFILE_BUCKET")
+	if profileBucket == "" {
+		profileCPU, profileHeap = false, false
+	}
+}
+
+// startProfiling begins any requested profiles and returns the function that
+// stops them and uploads the results
+func startProfiling() func(ctx context.Context) {
+	if !profileCPU && !profileHeap {
+		return func(context.Context) {}
+	}
+
+	var cpu bytes.Buffer
+	cpuStarted := false
+	if profileCPU {
+		if err := pprof.StartCPUProfile(&cpu); err != nil {
+			slog.Warn("CPU profile not started", "error", err)
+		} else {
+			cpuStarted = true
+		}
+	}
+
+	return func(ctx context.Context) {
+		if cpuStarted {
+			pprof.StopCPUProfile()
+			uploadProfile(ctx, "cpu", cpu.Bytes())
+		}
+		if profileHeap {
+			var heap bytes.Buffer
+			runtime.GC() // Heap profiles reflect the state as of the last GC
+			if err := pprof.Lookup("heap").WriteTo(&heap, 0); err == nil {
+				uploadProfile(ctx, "heap", heap.Bytes())
+			}
+		}
+	}
+}
+
+// uploadProfile stores a profile at profiles/<function>/<timestamp>-<request>-<kind>.pprof
+func uploadProfile(ctx context.Context, kind string, data []byte) {
+	requestID := "local"
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		requestID = lc.AwsRequestID
+	}
+	key := fmt.Sprintf("profiles/%s/%s-%s-%s.pprof",
+		lambdacontext.FunctionName, time.Now().UTC().Format("20060102T150405Z"), requestID, kind)
+
+	_, err := s3Client().PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(profileBucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		slog.Warn("Profile upload failed", "kind", kind, "error", err)
+		return
+	}
+	slog.Info("Profile uploaded", "bucket", profileBucket, "key", key)
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"robust-processor/internal/integrity"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// receiptKeyID is the KMS asymmetric (ECC_NIST_P256) key receipts are signed with
+var receiptKeyID string
+
+// kmsClient is only needed for tenants with signed receipts or their own
+// encryption key
+var kmsClient = sync.OnceValue(func() *kms.Client {
+	return kms.NewFromConfig(awsConfig())
+})
+
+// signReceipt signs a receipt, returning its canonical encoding and the
+// base64 signature to store with the record
+func signReceipt(ctx context.Context, receipt integrity.Receipt) (payload, signature string, err error) {
+	canonical := receipt.Canonical()
+	out, err := kmsClient().Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(receiptKeyID),
+		Message:          canonical,
+		MessageType:      kmstypes.MessageTypeRaw,
+		SigningAlgorithm: kmstypes.SigningAlgorithmSpec(integrity.ReceiptAlgorithm),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("sign receipt for %s: %w", receipt.LogID, err)
+	}
+	return string(canonical), base64.StdEncoding.EncodeToString(out.Signature), nil
+}
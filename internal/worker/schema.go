@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"robust-processor/internal/failure"
+	"robust-processor/pkg/pii"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Schema-aware redaction: properties marked "x-pii": true in the tenant
+// schema an event was validated against at ingest are replaced wholesale,
+// whatever their content. Schema versions are immutable, so lookups are
+// cached for the life of the execution environment.
+
+var schemaTableName string
+
+var (
+	schemaMu    sync.Mutex
+	schemaCache = map[string]*pii.Schema{}
+)
+
+// loadSchema returns the schema an event was validated against
+func loadSchema(ctx context.Context, tenantID, schemaID string) (*pii.Schema, error) {
+	name, version, err := pii.ParseRef(schemaID)
+	if err != nil {
+		return nil, failure.Wrap(failure.SchemaUnavailable, fmt.Errorf("schema_id %q: %w", schemaID, err))
+	}
+	key := fmt.Sprintf("%s@%d", pii.RegistryKey(tenantID, name), version)
+	schemaMu.Lock()
+	schema, ok := schemaCache[key]
+	schemaMu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	out, err := dynamo().GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(schemaTableName),
+		Key: map[string]types.AttributeValue{
+			"schema_name": &types.AttributeValueMemberS{Value: pii.RegistryKey(tenantID, name)},
+			"version":     &types.AttributeValueMemberN{Value: fmt.Sprint(version)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := out.Item["schema"].(*types.AttributeValueMemberS)
+	if !ok {
+		// Ingest validated against this schema, so it must exist; retry rather
+		// than store fields unredacted
+		return nil, failure.Wrap(failure.SchemaUnavailable, fmt.Errorf("schema %s not found", key))
+	}
+
+	schema, err = pii.Compile(key, doc.Value)
+	if err != nil {
+		return nil, failure.Wrap(failure.SchemaUnavailable, err)
+	}
+
+	schemaMu.Lock()
+	schemaCache[key] = schema
+	schemaMu.Unlock()
+	return schema, nil
+}
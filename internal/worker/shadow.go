@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// shadowTableName receives mirrored (shadow) messages. Shadow results are
+// kept out of the production table, hash chains and sinks, so they can be
+// compared with production output without affecting it.
+var shadowTableName string
+
+var errNoShadowTable = errors.New("shadow message received without SHADOW_TABLE_NAME")
+
+// shadowRetention is how long shadow items live before DynamoDB TTL removes them
+const shadowRetention = 7 * 24 * time.Hour
+
+func putShadow(ctx context.Context, item map[string]types.AttributeValue) error {
+	if shadowTableName == "" {
+		return errNoShadowTable
+	}
+	expiresAt := time.Now().Add(shadowRetention).Unix()
+	item["expires_at"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)}
+	_, err := dynamo().PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(shadowTableName),
+		Item:      item,
+	})
+	return err
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"robust-processor/internal/failure"
+	"robust-processor/internal/pipelinekey"
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// dlqURL is where messages failing signature verification are moved, so
+// they are quarantined at once instead of being retried first
+var dlqURL string
+
+// errForged marks a message whose signature is missing or does not verify
+var errForged = errors.New("message signature missing or invalid")
+
+// The pipeline keys are loaded on first use and, unlike the OnceValue
+// clients, retried after a failed load. previousPipelineKey is the key
+// before the last rotation, still accepted; nil when there is none.
+var (
+	pipelineKeyMu       sync.Mutex
+	pipelineKey         []byte
+	previousPipelineKey []byte
+	pipelineKeyLoaded   bool
+)
+
+func loadPipelineKey(ctx context.Context) ([]byte, []byte, error) {
+	pipelineKeyMu.Lock()
+	defer pipelineKeyMu.Unlock()
+	if !pipelineKeyLoaded {
+		key, err := pipelinekey.FromEnv(ctx, awsConfig())
+		if err != nil {
+			return nil, nil, err
+		}
+		previous, err := pipelinekey.PreviousFromEnv(ctx, awsConfig())
+		if err != nil {
+			return nil, nil, err
+		}
+		pipelineKey, previousPipelineKey, pipelineKeyLoaded = key, previous, true
+	}
+	return pipelineKey, previousPipelineKey, nil
+}
+
+// rejectForged checks a message's signature when signing is configured.
+// A message that fails is moved to the DLQ untouched and reported as
+// rejected; without DLQ_URL it fails with errForged and reaches the DLQ
+// through retries. Nothing in a forged message is trusted, so the record
+// it names is left alone.
+func rejectForged(ctx context.Context, message Message) (rejected bool, err error) {
+	key, previous, err := loadPipelineKey(ctx)
+	if err != nil || key == nil {
+		return false, err
+	}
+	tags := model.CostTagsFrom(message.Attributes)
+	signature := message.Attributes[model.SignatureAttribute]
+	if model.VerifySignature(key, message.Body, tags, signature) {
+		return false, nil
+	}
+	if previous != nil && model.VerifySignature(previous, message.Body, tags, signature) {
+		emitMetric("MessagesSignedWithPreviousKey", 1, "Count", nil)
+		return false, nil
+	}
+
+	slog.Warn("Rejected message with invalid signature", "message_id", message.ID)
+	emitMetric("MessagesForged", 1, "Count", nil)
+	if dlqURL == "" {
+		return true, failure.Wrap(failure.InvalidMessage, errForged)
+	}
+	attrs := make(map[string]sqstypes.MessageAttributeValue, len(message.Attributes))
+	for name, v := range message.Attributes {
+		attrs[name] = sqstypes.MessageAttributeValue{DataType: aws.String(model.AttributeType(name)), StringValue: aws.String(v)}
+	}
+	group, dedup := model.FIFOParams(dlqURL, message.Group, message.ID)
+	_, err = sqsClient().SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               aws.String(dlqURL),
+		MessageBody:            aws.String(message.Body),
+		MessageAttributes:      attrs,
+		MessageGroupId:         group,
+		MessageDeduplicationId: dedup,
+	})
+	if err != nil {
+		return true, fmt.Errorf("move forged message to DLQ: %w", errors.Join(errForged, err))
+	}
+	return true, nil
+}
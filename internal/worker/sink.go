@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// sinkRecord is the redacted view of a processed item sent to secondary
+// sinks. original_text never leaves DynamoDB.
+type sinkRecord struct {
+	TenantID     string            `json:"tenant_id"`
+	LogID        string            `json:"log_id"`
+	Source       string            `json:"source"`
+	ParentID     string            `json:"parent_id,omitempty"`
+	BatchID      string            `json:"batch_id,omitempty"`
+	Encryption   string            `json:"encryption,omitempty"`
+	ModifiedData string            `json:"modified_data"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	Labels       []string          `json:"labels,omitempty"`
+	IPLocations  []string          `json:"ip_locations,omitempty"`
+	ProcessedAt  string            `json:"processed_at"`
+}
+
+// sinkDoc is an encoded sinkRecord with the document id sinks dedupe on
+type sinkDoc struct {
+	ID   string
+	Body []byte
+}
+
+// Sink is a secondary destination that accepts records in bulk
+type Sink interface {
+	Name() string
+	// Limits caps one bulk call by record count and total body bytes
+	Limits() (maxRecords, maxBytes int)
+	// WriteBatch delivers docs in one call, returning the positions of docs
+	// that were rejected; err means the whole call failed
+	WriteBatch(ctx context.Context, docs []sinkDoc) (failed []int, err error)
+}
+
+// docEncoder is a Sink that stores records in its own shape rather than the
+// encoding shared by the others
+type docEncoder interface {
+	encode(ctx context.Context, record sinkRecord) (sinkDoc, error)
+}
+
+// docFor returns the document s stores for record, shared being the shared
+// encoding
+func docFor(ctx context.Context, s Sink, record sinkRecord, shared sinkDoc) (sinkDoc, error) {
+	if e, ok := s.(docEncoder); ok {
+		return e.encode(ctx, record)
+	}
+	return shared, nil
+}
+
+type pendingDoc struct {
+	doc       sinkDoc
+	messageID string
+}
+
+// bufferedSink batches records for one sink over an invocation, turning a
+// network call per record into a few bulk calls. It is flushed whenever
+// full, before the handler returns, and on SIGTERM.
+type bufferedSink struct {
+	sink Sink
+
+	mu      sync.Mutex
+	pending []pendingDoc
+	bytes   int
+	failed  []string // message IDs whose records could not be delivered
+}
+
+// sinks is populated at init from env; empty means DynamoDB only
+var sinks []*bufferedSink
+
+func init() {
+	if stream := os.Getenv("FIREHOSE_STREAM_NAME"); stream != "" {
+		sinks = append(sinks, &bufferedSink{sink: &firehoseSink{stream: stream}})
+	}
+	if endpoint := os.Getenv("OPENSEARCH_ENDPOINT"); endpoint != "" {
+		sinks = append(sinks, &bufferedSink{sink: newOpenSearchSink(endpoint, os.Getenv("OPENSEARCH_INDEX"))})
+	}
+	// Long-running drivers handle SIGTERM themselves and flush between batches
+	if len(sinks) > 0 && os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		go flushOnSigterm()
+	}
+}
+
+// writeToSinks buffers a processed record for every configured sink that
+// selected accepts by name
+func writeToSinks(ctx context.Context, messageID string, record sinkRecord, selected func(name string) bool) error {
+	if len(sinks) == 0 {
+		return nil
+	}
+	shared, err := encodeSinkDoc(record)
+	if err != nil {
+		return err
+	}
+	for _, s := range sinks {
+		if !selected(s.sink.Name()) {
+			continue
+		}
+		doc, err := docFor(ctx, s.sink, record, shared)
+		if err != nil {
+			return err
+		}
+		s.add(ctx, pendingDoc{doc: doc, messageID: messageID})
+	}
+	return nil
+}
+
+func encodeSinkDoc(record sinkRecord) (sinkDoc, error) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return sinkDoc{}, err
+	}
+	return sinkDoc{ID: record.TenantID + "#" + record.LogID, Body: body}, nil
+}
+
+// flushSinks drains every sink and returns the message IDs that must be
+// retried because one of their records was not delivered
+func flushSinks(ctx context.Context) []string {
+	var failed []string
+	for _, s := range sinks {
+		failed = append(failed, s.flush(ctx)...)
+	}
+	return append(failed, flushTenantSinks(ctx)...)
+}
+
+func (b *bufferedSink) add(ctx context.Context, p pendingDoc) {
+	maxRecords, maxBytes := b.sink.Limits()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) > 0 && (len(b.pending) >= maxRecords || b.bytes+len(p.doc.Body) > maxBytes) {
+		b.writeLocked(ctx)
+	}
+	b.pending = append(b.pending, p)
+	b.bytes += len(p.doc.Body)
+}
+
+func (b *bufferedSink) flush(ctx context.Context) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) > 0 {
+		b.writeLocked(ctx)
+	}
+	failed := b.failed
+	b.failed = nil
+	return failed
+}
+
+func (b *bufferedSink) writeLocked(ctx context.Context) {
+	docs := make([]sinkDoc, len(b.pending))
+	for i, p := range b.pending {
+		docs[i] = p.doc
+	}
+
+	start := time.Now()
+	rejected, err := b.sink.WriteBatch(ctx, docs)
+	emitMetric("SinkFlushTime", float64(time.Since(start).Milliseconds()), "Milliseconds", map[string]string{"sink": b.sink.Name()})
+	if err != nil {
+		slog.Error("Sink flush failed", "sink", b.sink.Name(), "records", len(docs), "error", err)
+		for _, p := range b.pending {
+			b.failed = append(b.failed, p.messageID)
+		}
+	} else {
+		for _, i := range rejected {
+			b.failed = append(b.failed, b.pending[i].messageID)
+		}
+	}
+	b.pending = b.pending[:0]
+	b.bytes = 0
+}
+
+// flushOnSigterm drains buffers when the environment shuts down. Lambda only
+// delivers SIGTERM when an extension is registered; elsewhere the
+// end-of-invocation flush is what guarantees delivery.
+func flushOnSigterm() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM)
+	<-sig
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if failed := flushSinks(ctx); len(failed) > 0 {
+		slog.Error("Records undelivered at shutdown", "messages", len(failed))
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,204 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"robust-processor/internal/embed"
+	"robust-processor/internal/failure"
+	"robust-processor/internal/pseudonym"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// openSearchSink indexes records through the _bulk API, signed with the
+// worker's IAM role. Documents are keyed by tenant#log_id, so retries
+// overwrite rather than duplicate.
+type openSearchSink struct {
+	endpoint string
+	index    string
+	service  string // "es" for managed domains, "aoss" for serverless collections
+	client   *http.Client
+}
+
+func newOpenSearchSink(endpoint, index string) *openSearchSink {
+	if index == "" {
+		index = "logs"
+	}
+	service := "es"
+	if strings.Contains(endpoint, ".aoss.") {
+		service = "aoss"
+	}
+	return &openSearchSink{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		index:    index,
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (o *openSearchSink) Name() string { return "opensearch" }
+
+// openSearchDoc is a sinkRecord as the OpenSearch sink indexes it
+type openSearchDoc struct {
+	sinkRecord
+	// Embedding is the vector of ModifiedData, for tenants with
+	// semantic_search; the index maps it as a knn_vector
+	Embedding []float32 `json:"embedding,omitempty"`
+}
+
+// encode indexes the fields the tenant's policy lists in search_pseudonyms
+// as their pseudonyms: equal values still match in term queries and
+// aggregations, and the plaintext never reaches the index. With
+// semantic_search it adds the embedding of the redacted text; client
+// encrypted records have none, since their ciphertext means nothing to a
+// model. Backfills go through here too, so replayed documents match new ones.
+func (o *openSearchSink) encode(ctx context.Context, record sinkRecord) (sinkDoc, error) {
+	policy, err := policyFor(ctx, record.TenantID)
+	if err != nil {
+		return sinkDoc{}, err
+	}
+	if len(policy.searchPseudonyms) > 0 && len(record.Fields) > 0 {
+		key, err := loadPseudonymKey(ctx)
+		if err != nil {
+			return sinkDoc{}, err
+		}
+		fields := make(map[string]string, len(record.Fields))
+		for k, v := range record.Fields {
+			if policy.searchPseudonyms[k] {
+				v = pseudonym.TokenAt(key, record.TenantID, policy.pseudonymGeneration, v)
+			}
+			fields[k] = v
+		}
+		record.Fields = fields
+	}
+	doc := openSearchDoc{sinkRecord: record}
+	if policy.semanticSearch && record.Encryption == "" && record.ModifiedData != "" {
+		if doc.Embedding, err = embedText(ctx, record.ModifiedData); err != nil {
+			return sinkDoc{}, err
+		}
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return sinkDoc{}, err
+	}
+	return sinkDoc{ID: record.TenantID + "#" + record.LogID, Body: body}, nil
+}
+
+// embedder is only needed when a tenant has semantic_search
+var embedder = sync.OnceValues(func() (*embed.Client, error) {
+	return embed.FromEnv(awsConfig())
+})
+
+// embedText embeds a record's redacted text. A failed call fails the
+// record for retry, like a sink failure: indexing it without its vector
+// would leave it out of semantic search for good.
+func embedText(ctx context.Context, text string) ([]float32, error) {
+	client, err := embedder()
+	if err == nil && client == nil {
+		err = errors.New("no embedding model configured")
+	}
+	var vector []float32
+	if err == nil {
+		vector, err = client.Embed(ctx, text)
+	}
+	if err != nil {
+		emitMetric("EmbeddingFailures", 1, "Count", nil)
+		return nil, failure.Wrap(failure.DependencyUnavailable, err)
+	}
+	emitMetric("RecordsEmbedded", 1, "Count", nil)
+	return vector, nil
+}
+
+// The pseudonym key is loaded on first use and retried after a failed load,
+// like the pipeline key
+var (
+	pseudonymKeyMu sync.Mutex
+	pseudonymKey   []byte
+)
+
+func loadPseudonymKey(ctx context.Context) ([]byte, error) {
+	pseudonymKeyMu.Lock()
+	defer pseudonymKeyMu.Unlock()
+	if pseudonymKey == nil {
+		key, err := pseudonym.FromEnv(ctx, awsConfig())
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, fmt.Errorf("PSEUDONYM_KEY_CIPHERTEXT is not set")
+		}
+		pseudonymKey = key
+	}
+	return pseudonymKey, nil
+}
+
+// Limits keeps bulk bodies well under the smallest domain's 10 MiB request cap
+func (o *openSearchSink) Limits() (int, int) { return 1000, 5 << 20 }
+
+func (o *openSearchSink) WriteBatch(ctx context.Context, docs []sinkDoc) ([]int, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, _ := json.Marshal(map[string]map[string]string{"index": {"_index": o.index, "_id": doc.ID}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.Body)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint+"/_bulk", bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	cfg := awsConfig()
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(body.Bytes())
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), o.service, cfg.Region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("opensearch bulk: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	var failed []int
+	if result.Errors {
+		for i, item := range result.Items {
+			for _, res := range item {
+				if res.Status >= 300 {
+					failed = append(failed, i)
+				}
+			}
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"robust-processor/internal/awsauth"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// TenantExport is a bucket in the tenant's own account that its processed
+// records are copied to, written with a role the tenant grants us
+type TenantExport struct {
+	Bucket string `dynamodbav:"bucket"`
+	// Prefix is prepended to every key; include a trailing slash
+	Prefix  string `dynamodbav:"prefix"`
+	RoleARN string `dynamodbav:"role_arn"`
+	// Region is the bucket's, when it differs from ours
+	Region string `dynamodbav:"region"`
+}
+
+func validateExport(e TenantExport) error {
+	if e.Bucket == "" {
+		return errors.New("export needs a bucket")
+	}
+	if a, err := arn.Parse(e.RoleARN); err != nil || a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") {
+		return errors.New("export role_arn must be an IAM role ARN")
+	}
+	return nil
+}
+
+// s3ExportSink writes each flush as one NDJSON object under the export's
+// prefix, with credentials scoped to that prefix
+type s3ExportSink struct {
+	export TenantExport
+	client *s3.Client
+}
+
+func (s *s3ExportSink) Name() string { return "s3_export" }
+
+func (s *s3ExportSink) Limits() (int, int) { return 1000, 8 << 20 }
+
+func (s *s3ExportSink) WriteBatch(ctx context.Context, docs []sinkDoc) ([]int, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		body.Write(doc.Body)
+		body.WriteByte('\n')
+	}
+	key := s.export.Prefix + time.Now().UTC().Format("2006/01/02/") + uuid.New().String() + ".ndjson"
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.export.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	return nil, err
+}
+
+// tenantCredentials assumes tenant roles; only needed for tenant exports
+var tenantCredentials = sync.OnceValue(func() *awsauth.Provider {
+	return awsauth.NewProvider(awsConfig())
+})
+
+// tenantSinks are the buffered export sinks by tenant and export, created
+// on a tenant's first record
+var (
+	tenantSinksMu sync.Mutex
+	tenantSinks   = map[string]*bufferedSink{}
+)
+
+// writeToTenantSink buffers a processed record for the tenant's export
+func writeToTenantSink(ctx context.Context, messageID, tenantID string, export TenantExport, record sinkRecord) error {
+	key := strings.Join([]string{tenantID, export.Bucket, export.Prefix, export.RoleARN, export.Region}, "\x00")
+	tenantSinksMu.Lock()
+	sink, ok := tenantSinks[key]
+	if !ok {
+		creds, err := tenantCredentials().Credentials(export.RoleARN, awsauth.Scope{
+			TenantID: tenantID,
+			Bucket:   export.Bucket,
+			Prefix:   export.Prefix,
+		})
+		if err != nil {
+			tenantSinksMu.Unlock()
+			return err
+		}
+		client := s3.NewFromConfig(awsConfig(), func(o *s3.Options) {
+			o.Credentials = creds
+			if export.Region != "" {
+				o.Region = export.Region
+			}
+		})
+		sink = &bufferedSink{sink: &s3ExportSink{export: export, client: client}}
+		tenantSinks[key] = sink
+	}
+	tenantSinksMu.Unlock()
+
+	doc, err := encodeSinkDoc(record)
+	if err != nil {
+		return err
+	}
+	sink.add(ctx, pendingDoc{doc: doc, messageID: messageID})
+	return nil
+}
+
+// flushTenantSinks drains every tenant export, like flushSinks
+func flushTenantSinks(ctx context.Context) []string {
+	tenantSinksMu.Lock()
+	pending := make([]*bufferedSink, 0, len(tenantSinks))
+	for _, s := range tenantSinks {
+		pending = append(pending, s)
+	}
+	tenantSinksMu.Unlock()
+
+	var failed []string
+	for _, s := range pending {
+		failed = append(failed, s.flush(ctx)...)
+	}
+	return failed
+}
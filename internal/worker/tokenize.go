@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"robust-processor/internal/envelope"
+	"robust-processor/internal/failure"
+	"robust-processor/internal/pseudonym"
+	"robust-processor/pkg/redact"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tokenVaultTableName keeps what each token of tokenizing tenants stands
+// for (TOKEN_VAULT_TABLE_NAME); policies with tokenize need it
+var tokenVaultTableName string
+
+// maxVaulted bounds vaulted, the tokens this environment knows are stored
+const maxVaulted = 100000
+
+var (
+	vaultedMu sync.Mutex
+	vaulted   = map[string]bool{}
+)
+
+// vaultEntry is a TOKEN_VAULT_TABLE_NAME item. The value is stored in the
+// clear, or, for tenants with kms_key_arn, sealed under their key with the
+// token in the place of the log_id, so revoking the key shreds the vault
+// with the originals.
+type vaultEntry struct {
+	TenantID  string `dynamodbav:"tenant_id"`
+	Token     string `dynamodbav:"token"`
+	Detector  string `dynamodbav:"detector"`
+	Value     string `dynamodbav:"value,omitempty"`
+	CreatedAt string `dynamodbav:"created_at"`
+	// Ciphertext, DataKey and KeyARN are the sealed value's envelope.Sealed
+	Ciphertext []byte `dynamodbav:"value_ciphertext,omitempty"`
+	DataKey    []byte `dynamodbav:"value_data_key,omitempty"`
+	KeyARN     string `dynamodbav:"value_key_arn,omitempty"`
+}
+
+// tokenizer collects the tokens one record's redaction writes. A token is
+// the detector's name and the value's tag, e.g. [EMAIL:3f9a0c12d4e5b687]:
+// the same value always gets the same token within a tenant, so tokenized
+// records still match one another.
+type tokenizer struct {
+	key      []byte
+	tenantID string
+	entries  map[string]vaultEntry
+}
+
+// newTokenizer loads the pseudonym key the tags are derived from
+func newTokenizer(ctx context.Context, tenantID string) (*tokenizer, error) {
+	key, err := loadPseudonymKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenizer{key: key, tenantID: tenantID, entries: map[string]vaultEntry{}}, nil
+}
+
+// wrap returns the redactor writing this tokenizer's tokens
+func (t *tokenizer) wrap(r *redact.Redactor) *redact.Redactor {
+	return r.WithTokens(func(detector, match string) string {
+		token := "[" + strings.ToUpper(detector) + ":" + pseudonym.Tag(t.key, t.tenantID, match) + "]"
+		t.entries[token] = vaultEntry{TenantID: t.tenantID, Token: token, Detector: detector, Value: match}
+		return token
+	})
+}
+
+// store writes the record's tokens to the vault before the record itself,
+// so every token stored in redacted text can be reversed. Tokens are
+// written once: a conditional put leaves an existing entry as it is.
+func (t *tokenizer) store(ctx context.Context, keyARN string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for token, e := range t.entries {
+		cacheKey := t.tenantID + "\x00" + token
+		vaultedMu.Lock()
+		known := vaulted[cacheKey]
+		vaultedMu.Unlock()
+		if known {
+			continue
+		}
+		e.CreatedAt = now
+		if keyARN != "" {
+			sealed, err := envelope.Seal(ctx, kmsClient(), keyARN, t.tenantID, token, e.Value)
+			if err != nil {
+				if envelope.KeyUnavailable(err) {
+					emitMetric("EncryptionKeyUnavailable", 1, "Count", map[string]string{"tenant_id": t.tenantID})
+					return failure.Wrap(failure.EncryptionKeyUnavailable, err)
+				}
+				return err
+			}
+			e.Value, e.Ciphertext, e.DataKey, e.KeyARN = "", sealed.Ciphertext, sealed.DataKey, sealed.KeyARN
+		}
+		item, err := attributevalue.MarshalMap(e)
+		if err != nil {
+			return err
+		}
+		_, err = dynamo().PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                aws.String(tokenVaultTableName),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#token)"),
+			ExpressionAttributeNames: map[string]string{"#token": "token"},
+		})
+		var conditional *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditional) {
+			return err
+		}
+		if err == nil {
+			emitMetric("TokensVaulted", 1, "Count", nil)
+		}
+		vaultedMu.Lock()
+		if len(vaulted) >= maxVaulted {
+			clear(vaulted)
+		}
+		vaulted[cacheKey] = true
+		vaultedMu.Unlock()
+	}
+	return nil
+}
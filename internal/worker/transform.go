@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"fmt"
+
+	"robust-processor/pkg/model"
+)
+
+// textField addresses the record text in a transform instead of a named field
+const textField = "text"
+
+// Transform is one declarative step from the tenant policy, applied to the
+// event before redaction. Only these operations exist, so a policy can
+// reshape data but never run arbitrary code.
+//
+//	rename:   Field -> To
+//	drop:     remove Field
+//	truncate: cut Field (or "text") to MaxLength characters
+//	set:      Field = Value (static enrichment, overwrites)
+type Transform struct {
+	Op        string `dynamodbav:"op"`
+	Field     string `dynamodbav:"field"`
+	To        string `dynamodbav:"to"`
+	Value     string `dynamodbav:"value"`
+	MaxLength int    `dynamodbav:"max_length"`
+}
+
+// validateTransform rejects malformed steps at policy compile time, so a bad
+// policy fails loudly once instead of half-applying per message
+func validateTransform(t Transform) error {
+	if t.Field == "" {
+		return fmt.Errorf("transform %q: field is required", t.Op)
+	}
+	switch t.Op {
+	case "rename":
+		if t.To == "" || t.Field == textField || t.To == textField {
+			return fmt.Errorf("transform rename %q: invalid target", t.Field)
+		}
+	case "drop", "set":
+		if t.Field == textField {
+			return fmt.Errorf("transform %s: cannot apply to text", t.Op)
+		}
+	case "truncate":
+		if t.MaxLength <= 0 {
+			return fmt.Errorf("transform truncate %q: max_length must be positive", t.Field)
+		}
+	default:
+		return fmt.Errorf("unknown transform %q", t.Op)
+	}
+	return nil
+}
+
+// applyTransforms runs the policy's transforms in order against the event.
+// marked holds the fields the event's schema marks as PII: a rename carries
+// the mark to the new name, which the schema knows nothing of, so the value
+// is still replaced outright rather than only scrubbed.
+func applyTransforms(event *LogEvent, transforms []Transform, marked map[string]bool) {
+	for _, t := range transforms {
+		// Cutting ciphertext would leave it undecryptable
+		if t.Field == textField && event.Encryption == model.ClientEncrypted {
+			continue
+		}
+		switch t.Op {
+		case "rename":
+			if v, ok := event.Fields[t.Field]; ok {
+				delete(event.Fields, t.Field)
+				event.Fields[t.To] = v
+				if marked[t.Field] {
+					marked[t.To] = true
+				}
+			}
+		case "drop":
+			delete(event.Fields, t.Field)
+		case "set":
+			if event.Fields == nil {
+				event.Fields = map[string]string{}
+			}
+			event.Fields[t.Field] = t.Value
+		case "truncate":
+			if t.Field == textField {
+				event.OriginalText = truncateRunes(event.OriginalText, t.MaxLength)
+			} else if v, ok := event.Fields[t.Field]; ok {
+				event.Fields[t.Field] = truncateRunes(v, t.MaxLength)
+			}
+		}
+	}
+}
+
+// truncateRunes cuts s to at most n characters without splitting a UTF-8 sequence
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
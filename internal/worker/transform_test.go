@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"testing"
+
+	"robust-processor/pkg/pii"
+	"robust-processor/pkg/redact"
+)
+
+// A field the schema marks as PII is replaced outright under whatever
+// name a transform gives it
+func TestRenamedPIIFieldKeepsMark(t *testing.T) {
+	schema, err := pii.Compile("acme#customer@1", `{
+		"type": "object",
+		"properties": {
+			"customer": {"type": "string", "x-pii": true},
+			"plan": {"type": "string"}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marked := map[string]bool{}
+	for _, field := range schema.PIIFields() {
+		marked[field] = true
+	}
+	event := LogEvent{Fields: map[string]string{"customer": "Jane Doe", "plan": "gold"}}
+	applyTransforms(&event, []Transform{
+		{Op: "rename", Field: "customer", To: "account_holder"},
+		{Op: "rename", Field: "plan", To: "tier"},
+	}, marked)
+
+	got := pii.RedactMarkedFields(event.Fields, redact.Default, marked, nil)
+	want := map[string]string{"account_holder": redact.Placeholder, "tier": "gold"}
+	if len(got) != len(want) {
+		t.Fatalf("fields = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// warmupSample exercises every built-in detector so their matchers are warm
+const warmupSample = "call 800-555-0199 or mail ops@example.com, ssn 123-45-6789"
+
+// warmupEvent matches both an EventBridge scheduled event and a manual
+// {"warmup": true} test invocation
+type warmupEvent struct {
+	Source     string `json:"source"`
+	DetailType string `json:"detail-type"`
+	Warmup     bool   `json:"warmup"`
+}
+
+func isWarmup(payload json.RawMessage) bool {
+	var event warmupEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return false
+	}
+	return event.Warmup || (event.Source == "aws.events" && event.DetailType == "Scheduled Event")
+}
+
+// warmup runs the default redaction policy once and opens a connection to
+// DynamoDB, so the first real message pays neither cost
+func warmup(ctx context.Context) {
+	start := time.Now()
+	defaultPolicy.redactor.Redact(warmupSample)
+
+	_, err := dynamo().DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		// Warm-up is best effort; real messages surface real errors
+		slog.Warn("Warmup connection failed", "error", err)
+	}
+	slog.Info("Warmup complete", "duration_ms", time.Since(start).Milliseconds())
+}
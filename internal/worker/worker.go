@@ -0,0 +1,570 @@
+// Package worker is the processing core of the pipeline: it validates queue
+// messages, applies the tenant's policy, redacts and stores each record and
+// fans it out to sinks. The Lambda (./worker) and the long-running poller
+// (./cmd/workerd) are thin drivers around it.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"robust-processor/internal/failure"
+	"robust-processor/internal/integrity"
+	"robust-processor/internal/simhash"
+	"robust-processor/pkg/model"
+	"robust-processor/pkg/pii"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var tableName string
+
+// batchHeadroom is the time a batch keeps back near the invocation deadline
+// to store its last record, flush sinks and return its failures
+const batchHeadroom = 2 * time.Second
+
+// concurrency bounds how many messages of a batch are processed at once
+// (WORKER_CONCURRENCY, default 10: a full SQS batch)
+var concurrency = 10
+
+// Simulated processing latency, disabled unless SIMULATED_DELAY_PER_CHAR is set
+var (
+	simulatedDelayPerChar time.Duration
+	simulatedDelayMax     = 5 * time.Second
+)
+
+func init() {
+	go warmClients()
+	tableName = os.Getenv("TABLE_NAME")
+	policyTableName = os.Getenv("POLICY_TABLE_NAME")
+	schemaTableName = os.Getenv("SCHEMA_TABLE_NAME")
+	chainTableName = os.Getenv("CHAIN_TABLE_NAME")
+	shadowTableName = os.Getenv("SHADOW_TABLE_NAME")
+	receiptKeyID = os.Getenv("RECEIPT_KEY_ID")
+	backfillTableName = os.Getenv("BACKFILL_TABLE_NAME")
+	dlqURL = os.Getenv("DLQ_URL")
+	claimCheckBucket = os.Getenv("CLAIM_CHECK_BUCKET")
+	usageTableName = os.Getenv("USAGE_TABLE_NAME")
+	nearDuplicateTableName = os.Getenv("NEAR_DUPLICATE_TABLE_NAME")
+	tokenVaultTableName = os.Getenv("TOKEN_VAULT_TABLE_NAME")
+	if days, err := strconv.Atoi(os.Getenv("DEFAULT_RETENTION_DAYS")); err == nil && days >= 0 {
+		defaultRetention = time.Duration(days) * 24 * time.Hour
+	}
+	defaultPolicy.retention = defaultRetention
+	storeOriginal = os.Getenv("STORE_ORIGINAL") != "false"
+	defaultPolicy.storeOriginal = storeOriginal
+	if n, err := strconv.Atoi(os.Getenv("WORKER_CONCURRENCY")); err == nil && n > 0 {
+		concurrency = n
+	}
+	simulatedDelayPerChar, _ = time.ParseDuration(os.Getenv("SIMULATED_DELAY_PER_CHAR"))
+	if d, err := time.ParseDuration(os.Getenv("SIMULATED_DELAY_MAX")); err == nil {
+		simulatedDelayMax = d
+	}
+
+	// Provisioned environments initialize ahead of traffic, so init time is
+	// free: finish warming before the first request arrives
+	if os.Getenv("AWS_LAMBDA_INITIALIZATION_TYPE") == "provisioned-concurrency" {
+		warmup(context.Background())
+	}
+}
+
+// LogEvent is the queue message contract shared with the ingest service
+type LogEvent = model.LogEvent
+
+// Handler is the Lambda entry point. It dispatches warm-up pings, backfill
+// jobs and SQS batches; the payload is decoded lazily because those
+// invocations don't share the SQS event shape.
+func Handler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	reportColdStart()
+	if isWarmup(payload) {
+		warmup(ctx)
+		return nil, nil
+	}
+	if job, ok := parseBackfill(payload); ok {
+		cp, err := runBackfill(ctx, *job)
+		if err != nil {
+			return nil, err
+		}
+		return backfillStatus(cp), nil
+	}
+
+	var sqsEvent events.SQSEvent
+	if err := json.Unmarshal(payload, &sqsEvent); err != nil {
+		return nil, err
+	}
+
+	stopProfiling := startProfiling()
+	defer stopProfiling(ctx)
+	return handleBatch(ctx, sqsEvent)
+}
+
+// handleBatch implements Partial Batch Failure pattern for crash recovery
+func handleBatch(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	messages := make([]Message, len(sqsEvent.Records))
+	for i, record := range sqsEvent.Records {
+		messages[i] = Message{ID: record.MessageId, Body: record.Body, Group: record.Attributes["MessageGroupId"], Attributes: map[string]string{}}
+		for name, attr := range record.MessageAttributes {
+			if attr.StringValue != nil {
+				messages[i].Attributes[name] = *attr.StringValue
+			}
+		}
+	}
+
+	var failures []events.SQSBatchItemFailure
+	for _, id := range ProcessBatch(ctx, messages) {
+		// Mark only THIS message as failed - others in batch succeed
+		failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: id})
+	}
+	return events.SQSEventResponse{BatchItemFailures: failures}, nil
+}
+
+// Message is one queued LogEvent, independent of how it was received
+type Message struct {
+	ID   string
+	Body string
+	// Group is the FIFO message group, empty on a standard queue
+	Group string
+	// Attributes are the string message attributes, such as cost tags
+	Attributes map[string]string
+}
+
+// ProcessBatch processes up to WORKER_CONCURRENCY messages at a time and
+// returns the IDs of those that must be retried, in batch order: processing
+// failed, a sink did not accept the record, or the context's deadline came
+// too close to start it. Messages of one FIFO group are processed in order,
+// one at a time, and once one of them is retried so is the rest of its
+// group, so that none overtakes it. Batches must not run concurrently, since
+// sink and completion buffers are shared and flushed per batch.
+func ProcessBatch(ctx context.Context, messages []Message) (failed []string) {
+	headroom := batchHeadroom
+	if simulatedDelayPerChar > 0 {
+		headroom += simulatedDelayMax
+	}
+	// A Lambda timeout mid-batch loses the whole response; hand the rest
+	// back for retry while there is still time to report it
+	deadlineNear := func() bool {
+		deadline, ok := ctx.Deadline()
+		return ok && time.Until(deadline) < headroom
+	}
+
+	retry := make([]bool, len(messages))
+	lanes := groupLanes(messages)
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for n, lane := range lanes {
+		slots <- struct{}{}
+		if deadlineNear() {
+			<-slots
+			deferred := 0
+			for _, rest := range lanes[n:] {
+				for _, j := range rest {
+					retry[j] = true
+				}
+				deferred += len(rest)
+			}
+			slog.Warn("Deadline near, returning unprocessed messages", "messages", deferred)
+			emitMetric("MessagesDeferred", float64(deferred), "Count", nil)
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			for k, i := range lane {
+				if k > 0 && deadlineNear() {
+					for _, j := range lane[k:] {
+						retry[j] = true
+					}
+					emitMetric("MessagesDeferred", float64(len(lane)-k), "Count", nil)
+					return
+				}
+				message := messages[i]
+				if err := processMessage(ctx, message); err != nil {
+					slog.Error("Processing failed", "message_id", message.ID, "error", err)
+					if !errors.Is(err, errForged) {
+						recordFailure(ctx, message, err)
+					}
+					for _, j := range lane[k:] {
+						retry[j] = true
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Records handed to sinks but not delivered are retried with their message
+	for _, id := range flushSinks(ctx) {
+		for i, message := range messages {
+			if message.ID == id {
+				retry[i] = true
+			}
+		}
+	}
+	holdGroups(messages, retry)
+	for i, message := range messages {
+		if retry[i] {
+			failed = append(failed, message.ID)
+		}
+	}
+
+	flushCompletions(ctx)
+	flushCosts(ctx)
+	flushFingerprints(ctx)
+	return failed
+}
+
+// groupLanes splits a batch into lanes processed independently: each
+// message alone, except that a FIFO group's messages share one lane, in
+// batch order
+func groupLanes(messages []Message) [][]int {
+	var lanes [][]int
+	lane := map[string]int{}
+	for i, message := range messages {
+		if message.Group == "" {
+			lanes = append(lanes, []int{i})
+			continue
+		}
+		if n, ok := lane[message.Group]; ok {
+			lanes[n] = append(lanes[n], i)
+			continue
+		}
+		lane[message.Group] = len(lanes)
+		lanes = append(lanes, []int{i})
+	}
+	return lanes
+}
+
+// holdGroups marks for retry every message that follows a retried one in
+// its FIFO group
+func holdGroups(messages []Message, retry []bool) {
+	held := map[string]bool{}
+	for i, message := range messages {
+		if message.Group == "" {
+			continue
+		}
+		if held[message.Group] {
+			retry[i] = true
+		}
+		if retry[i] {
+			held[message.Group] = true
+		}
+	}
+}
+
+// decodeMessage reads the event a message carries: its signature checked
+// (see rejectForged), its body validated against the contract ingest
+// published it under, and a claim-checked text fetched back
+func decodeMessage(ctx context.Context, message Message) (event LogEvent, rejected bool, err error) {
+	if rejected, err := rejectForged(ctx, message); rejected || err != nil {
+		return event, rejected, err
+	}
+	if err := model.Validate([]byte(message.Body)); err != nil {
+		return event, false, failure.Wrap(failure.InvalidMessage, err)
+	}
+	if err := json.Unmarshal([]byte(message.Body), &event); err != nil {
+		return event, false, failure.Wrap(failure.InvalidMessage, err)
+	}
+	if event.S3Key != "" {
+		if err := hydrate(ctx, &event); err != nil {
+			return event, false, err
+		}
+	}
+	return event, false, nil
+}
+
+func processMessage(ctx context.Context, message Message) error {
+	start := time.Now()
+	event, rejected, err := decodeMessage(ctx, message)
+	if rejected || err != nil {
+		return err
+	}
+
+	slog.Info("Processing message",
+		"tenant_id", event.TenantID,
+		"log_id", event.LogID,
+		"text_length", len(event.OriginalText),
+	)
+
+	// SIMULATE HEAVY PROCESSING (opt-in for chaos testing, e.g. 50ms per character)
+	if simulatedDelayPerChar > 0 {
+		sleepDuration := time.Duration(len(event.OriginalText)) * simulatedDelayPerChar
+		if sleepDuration > simulatedDelayMax {
+			sleepDuration = simulatedDelayMax
+		}
+		time.Sleep(sleepDuration)
+	}
+
+	policy, err := policyFor(ctx, event.TenantID)
+	if err != nil {
+		return err
+	}
+
+	// The schema an event was validated against names its PII fields, which
+	// keep their mark through transforms that rename them
+	var schema *pii.Schema
+	if len(event.Fields) > 0 && event.SchemaID != "" {
+		if schema, err = loadSchema(ctx, event.TenantID, event.SchemaID); err != nil {
+			return err
+		}
+	}
+	marked := map[string]bool{}
+	for _, field := range schema.PIIFields() {
+		marked[field] = true
+	}
+
+	// Tenant transforms reshape the event before anything is redacted or stored
+	applyTransforms(&event, policy.transforms, marked)
+	applyEnrichments(ctx, &event, policy.enrichments)
+
+	// Client-encrypted text is opaque: it is stored as sent, and only the
+	// plaintext fields are classified and redacted
+	clientEncrypted := event.Encryption == model.ClientEncrypted
+	text := event.OriginalText
+	if clientEncrypted {
+		text = ""
+	}
+
+	// Classification and coarse location must run while the content is still present
+	labels := classify(text, event.Fields)
+	for _, label := range labels {
+		emitMetric("RecordsLabeled", 1, "Count", map[string]string{"label": label})
+	}
+
+	var locations []string
+	if policy.geoip {
+		locations = geolocate(text)
+	}
+
+	// Redact PII from text, counting redactions per detector, with the
+	// source's redaction profile when it has one
+	source := policy.forSource(event.Source)
+	redactor := policy.redactorFor(event.Source)
+	var tokens *tokenizer
+	if policy.tokenize && !clientEncrypted {
+		if tokens, err = newTokenizer(ctx, event.TenantID); err != nil {
+			return err
+		}
+		redactor = tokens.wrap(redactor)
+	}
+	redactions := map[string]int{}
+	modifiedData := event.OriginalText
+	if !clientEncrypted {
+		modifiedData = redactor.RedactCounting(event.OriginalText, redactions)
+	}
+
+	// Records the patterns may have missed something in go on to the ML detector
+	risk := -1.0
+	var mlUnits int64
+	if policy.escalation != nil && !clientEncrypted {
+		risk = riskScore(modifiedData)
+		if policy.escalation.escalates(risk) {
+			if modifiedData, mlUnits, err = escalate(ctx, policy.escalation, modifiedData, redactor.Placeholder(), redactions); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Structured fields get the same redaction as the text, except fields the
+	// tenant schema marks as PII, which are replaced outright
+	modifiedFields := pii.RedactMarkedFields(event.Fields, redactor, marked, redactions)
+	// Shadow copies are tokenized like production, so the two still
+	// compare, but never write to the production vault
+	if tokens != nil && !event.Shadow {
+		if err := tokens.store(ctx, policy.kmsKeyARN); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	processedAt := now.Format(time.RFC3339)
+
+	// Write to DynamoDB with tenant isolation (partition key = tenant_id)
+	item := map[string]types.AttributeValue{
+		"tenant_id":      &types.AttributeValueMemberS{Value: event.TenantID},
+		"log_id":         &types.AttributeValueMemberS{Value: event.LogID},
+		"source":         &types.AttributeValueMemberS{Value: event.Source},
+		"original_text":  &types.AttributeValueMemberS{Value: event.OriginalText},
+		"modified_data":  &types.AttributeValueMemberS{Value: modifiedData},
+		"processed_at":   &types.AttributeValueMemberS{Value: processedAt},
+		"status":         &types.AttributeValueMemberS{Value: "PROCESSED"},
+		"policy_version": &types.AttributeValueMemberN{Value: strconv.Itoa(policy.version)},
+	}
+	// A source's retention overrides the tenant's
+	retention := policy.retention
+	if source.retention > 0 {
+		retention = source.retention
+	}
+	if retention > 0 {
+		item["expires_at"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(retention).Unix(), 10)}
+	}
+	if len(redactions) > 0 {
+		summary := make(map[string]types.AttributeValue, len(redactions))
+		for name, n := range redactions {
+			summary[name] = &types.AttributeValueMemberN{Value: strconv.Itoa(n)}
+		}
+		item["redactions"] = &types.AttributeValueMemberM{Value: summary}
+	}
+	var fingerprint uint64
+	if !clientEncrypted {
+		if fingerprint = simhash.Fingerprint(modifiedData); fingerprint != 0 {
+			item["simhash"] = &types.AttributeValueMemberS{Value: simhash.Format(fingerprint)}
+		}
+	}
+	if risk >= 0 {
+		item["risk_score"] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(risk, 'f', 2, 64)}
+	}
+	if len(labels) > 0 {
+		item["labels"] = &types.AttributeValueMemberSS{Value: labels}
+	}
+	if len(locations) > 0 {
+		item["ip_locations"] = &types.AttributeValueMemberSS{Value: locations}
+	}
+	if event.ParentID != "" {
+		item["parent_id"] = &types.AttributeValueMemberS{Value: event.ParentID}
+	}
+	if event.Part > 0 {
+		item["part"] = &types.AttributeValueMemberN{Value: strconv.Itoa(event.Part)}
+	}
+	if event.BatchID != "" {
+		item["batch_id"] = &types.AttributeValueMemberS{Value: event.BatchID}
+	}
+	if event.SchemaID != "" {
+		item["schema_id"] = &types.AttributeValueMemberS{Value: event.SchemaID}
+	}
+	if clientEncrypted {
+		item["encryption"] = &types.AttributeValueMemberS{Value: model.ClientEncrypted}
+	}
+	costTags := model.CostTagsFrom(message.Attributes)
+	for name, v := range costTags.Attributes() {
+		item[name] = &types.AttributeValueMemberS{Value: v}
+	}
+	if modifiedFields != nil {
+		fields := make(map[string]types.AttributeValue, len(modifiedFields))
+		for k, v := range modifiedFields {
+			fields[k] = &types.AttributeValueMemberS{Value: v}
+		}
+		item["fields"] = &types.AttributeValueMemberM{Value: fields}
+	}
+	if policy.receipts && !event.Shadow {
+		receipt, signature, err := signReceipt(ctx, integrity.NewReceipt(
+			event.TenantID, event.LogID, event.OriginalText, modifiedData, policy.version, processedAt, receiptKeyID))
+		if err != nil {
+			return err
+		}
+		item["receipt"] = &types.AttributeValueMemberS{Value: receipt}
+		item["receipt_signature"] = &types.AttributeValueMemberS{Value: signature}
+	}
+	// Without the original, the chain seals its hash in its place
+	sealedOriginal := event.OriginalText
+	switch {
+	case !policy.storeOriginal:
+		hash := integrity.ContentHash(event.OriginalText)
+		delete(item, "original_text")
+		item["original_sha256"] = &types.AttributeValueMemberS{Value: hash}
+		sealedOriginal = integrity.UnstoredOriginal(hash)
+	case policy.kmsKeyARN != "":
+		if err := sealOriginal(ctx, item, policy.kmsKeyARN, event.TenantID, event.LogID, event.OriginalText); err != nil {
+			return err
+		}
+	}
+	// The estimate covers everything but the write itself
+	cost := estimateCost(time.Since(start), mlUnits, item)
+	item["cost"] = cost.attribute()
+	switch {
+	case event.Shadow:
+		err = putShadow(ctx, item)
+	case policy.hashChain:
+		err = putSealed(ctx, item, integrity.Record{
+			TenantID:     event.TenantID,
+			LogID:        event.LogID,
+			Source:       event.Source,
+			OriginalText: sealedOriginal,
+			ModifiedData: modifiedData,
+			ProcessedAt:  processedAt,
+		}, now)
+	default:
+		err = putRecord(ctx, item)
+	}
+
+	duplicate := errors.Is(err, errDuplicate)
+	if err != nil && !duplicate {
+		return err
+	}
+	if event.Shadow {
+		slog.Info("Processed shadow copy", "tenant_id", event.TenantID, "log_id", event.LogID)
+		return nil
+	}
+	if policy.nearDuplicates && fingerprint != 0 {
+		indexFingerprint(event.TenantID, event.LogID, fingerprint, item["expires_at"])
+	}
+
+	// A redelivery still writes to sinks, since a sink failure is what retries
+	// a stored record; sinks dedupe on the document id
+	record := sinkRecord{
+		TenantID:     event.TenantID,
+		LogID:        event.LogID,
+		Source:       event.Source,
+		ParentID:     event.ParentID,
+		BatchID:      event.BatchID,
+		Encryption:   event.Encryption,
+		ModifiedData: modifiedData,
+		Fields:       modifiedFields,
+		Labels:       labels,
+		IPLocations:  locations,
+		ProcessedAt:  processedAt,
+	}
+	if err := writeToSinks(ctx, message.ID, record, source.sends); err != nil {
+		return err
+	}
+	if policy.export != nil && source.sends("export") {
+		if err := writeToTenantSink(ctx, message.ID, event.TenantID, *policy.export, record); err != nil {
+			return err
+		}
+	}
+	if duplicate {
+		slog.Info("Duplicate delivery suppressed", "tenant_id", event.TenantID, "log_id", event.LogID, "message_id", message.ID)
+		emitMetric("DuplicatesSuppressed", 1, "Count", nil)
+		return nil
+	}
+
+	announceCompletion(completion{
+		TenantID:    event.TenantID,
+		LogID:       event.LogID,
+		Source:      event.Source,
+		ParentID:    event.ParentID,
+		BatchID:     event.BatchID,
+		Status:      "PROCESSED",
+		ProcessedAt: processedAt,
+		Labels:      labels,
+		Redactions:  redactions,
+	})
+
+	emitMetric("RecordsProcessed", 1, "Count", costTags.Attributes())
+	emitMetric("ProcessingCost", float64(cost.MicroUSD), "None", costTags.Attributes())
+	rollUpCost(event.TenantID, costTags, now, cost)
+	bySource := map[string]string{"tenant_id": event.TenantID, "source": event.Source}
+	emitMetric("SourceRecordsProcessed", 1, "Count", bySource)
+	emitMetric("SourceBytesProcessed", float64(len(event.OriginalText)), "Bytes", bySource)
+	// A tenant or source whose records suddenly stop yielding redactions
+	// usually means a pattern regression or a changed upstream format
+	total := 0
+	for _, n := range redactions {
+		total += n
+	}
+	if total == 0 && !clientEncrypted {
+		emitMetric("RecordsUnredacted", 1, "Count", bySource)
+	}
+	slog.Info("Successfully processed", "tenant_id", event.TenantID, "log_id", event.LogID, "redactions", total)
+	return nil
+}
@@ -4,6 +4,10 @@ terraform {
       source  = "hashicorp/aws"
       version = "~> 5.0"
     }
+    random = {
+      source  = "hashicorp/random"
+      version = "~> 3.6"
+    }
   }
 }
 
@@ -11,6 +15,204 @@ provider "aws" {
   region = "us-east-1"
 }
 
+variable "lambda_architecture" {
+  description = "x86_64, or arm64 for Graviton (build with make build-arm64 / build.ps1 -Arch arm64)"
+  type        = string
+  default     = "x86_64"
+}
+
+variable "worker_profile" {
+  description = "On-demand worker profiling: cpu, heap or cpu,heap (empty disables)"
+  type        = string
+  default     = ""
+}
+
+variable "firehose_stream_name" {
+  description = "Optional Firehose delivery stream receiving redacted records"
+  type        = string
+  default     = ""
+}
+
+variable "opensearch_endpoint" {
+  description = "Optional OpenSearch endpoint (https://...) indexing redacted records"
+  type        = string
+  default     = ""
+}
+
+variable "opensearch_domain_arn" {
+  description = "ARN of the OpenSearch domain or collection behind opensearch_endpoint"
+  type        = string
+  default     = ""
+}
+
+variable "embedding_model_id" {
+  description = "Bedrock model embedding redacted text for semantic search (e.g. amazon.titan-embed-text-v2:0)"
+  type        = string
+  default     = ""
+}
+
+variable "embedding_endpoint" {
+  description = "Optional external embedding endpoint (https://...), used instead of Bedrock"
+  type        = string
+  default     = ""
+}
+
+variable "embedding_dimensions" {
+  description = "Vector size of the embedding model; must match the index's knn_vector mapping"
+  type        = number
+  default     = 1024
+}
+
+variable "enrichment_lookup_arns" {
+  description = "S3 object and DynamoDB table ARNs tenant enrichments may read"
+  type        = list(string)
+  default     = []
+}
+
+variable "log_id_strategy" {
+  description = "How missing log_ids are generated: random, uuidv7 (time-ordered), or content (derived from the record and its event time, so resends converge; identical messages without an event time or log_id are stored once)"
+  type        = string
+  default     = "random"
+}
+
+variable "staging_tenants" {
+  description = "Pilot tenants routed to the staging worker (empty disables the staging pipeline)"
+  type        = list(string)
+  default     = []
+}
+
+variable "staging_worker_zip" {
+  description = "Staging worker build (make worker-staging.zip from the candidate revision)"
+  type        = string
+  default     = "worker-staging.zip"
+}
+
+variable "shadow_sample_rate" {
+  description = "Share of requests (0-1) mirrored to the shadow worker (0 disables shadow mode)"
+  type        = number
+  default     = 0
+}
+
+variable "shadow_worker_zip" {
+  description = "Shadow worker build (make worker-shadow.zip from the candidate revision)"
+  type        = string
+  default     = "worker-shadow.zip"
+}
+
+variable "processing_bytes_per_sec" {
+  description = "Measured worker throughput across all environments, used for estimated_completion in ingest responses"
+  type        = number
+  default     = 1048576
+}
+
+variable "prefilter_authorizer" {
+  description = "Run the prefilter as an API Gateway authorizer on the ingest route, refusing oversized or anonymous requests before ingest is invoked"
+  type        = bool
+  default     = false
+}
+
+variable "require_auth" {
+  description = "Reject ingest requests without an Authorization, X-Api-Key or X-Signature header"
+  type        = bool
+  default     = false
+}
+
+variable "api_key_secret_prefix" {
+  description = "Secrets Manager name prefix of per-tenant API keys (<prefix><tenant_id>); when set, ingest requires a valid X-Api-Key for X-Tenant-ID"
+  type        = string
+  default     = ""
+}
+
+variable "original_reads" {
+  description = "Serve GET /logs/{log_id}/original to tenants whose policy sets original_reads, decrypting originals sealed under their kms_key_arn"
+  type        = bool
+  default     = false
+}
+
+variable "detokenize" {
+  description = "Serve POST /detokenize to tenants whose policy sets detokenize, reversing the tokens their tokenize policy writes"
+  type        = bool
+  default     = false
+}
+
+variable "pipeline_key_slot" {
+  description = "Which of the two pipeline keys signs queue messages, \"a\" or \"b\"; the other is still accepted"
+  type        = string
+  default     = "a"
+}
+
+variable "auth_failure_limit" {
+  description = "Failed authentications a source address or API key may have before it is locked out of ingest"
+  type        = number
+  default     = 5
+}
+
+variable "default_retention_days" {
+  description = "Days processed records are kept for tenants whose policy sets no retention_days; 0 keeps them"
+  type        = number
+  default     = 90
+}
+
+variable "store_original" {
+  description = "Store each record's original text beside its redaction; false stores only a SHA-256 of it, for every tenant"
+  type        = bool
+  default     = true
+}
+
+variable "archive_expired" {
+  description = "Archive records to S3 as the logs table's TTL purges them"
+  type        = bool
+  default     = false
+}
+
+variable "export_retention_days" {
+  description = "Days a tenant export's parts and manifest are kept for download"
+  type        = number
+  default     = 7
+}
+
+variable "delete_recovery_days" {
+  description = "Days a soft-deleted log can be undeleted before it is purged"
+  type        = number
+  default     = 30
+}
+
+variable "worker_concurrency" {
+  description = "Messages of one SQS batch the worker processes at once"
+  type        = number
+  default     = 10
+}
+
+variable "journal_retention_days" {
+  description = "How long ingest journal entries are kept for disputes"
+  type        = number
+  default     = 90
+}
+
+variable "reconcile_sla" {
+  description = "How long an accepted record may stay QUEUED before reconciliation reports it overdue"
+  type        = string
+  default     = "15m"
+}
+
+variable "worker_provisioned_concurrency" {
+  description = "Pre-initialized worker environments (0 disables provisioned concurrency)"
+  type        = number
+  default     = 0
+}
+
+variable "priority_worker_concurrency" {
+  description = "Messages of one batch the priority worker processes at once; above 0 it enables the priority lane for high priority records"
+  type        = number
+  default     = 0
+}
+
+variable "fifo_queue" {
+  description = "Use FIFO queues, grouped by tenant, so each tenant's records are processed in order (replaces the queues; drain them first)"
+  type        = bool
+  default     = false
+}
+
 # STORAGE (DynamoDB)
 
 resource "aws_dynamodb_table" "logs_table" {
@@ -30,147 +232,2517 @@ resource "aws_dynamodb_table" "logs_table" {
     type = "S"
   }
 
+  attribute {
+    name = "parent_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "queued_hour"
+    type = "S"
+  }
+
+  attribute {
+    name = "queued_at"
+    type = "S"
+  }
+
+  attribute {
+    name = "processed_at"
+    type = "S"
+  }
+
+  # Sub-documents by parent, for GET /logs/{log_id}/thread and erasure
+  global_secondary_index {
+    name            = "parent_index"
+    hash_key        = "parent_id"
+    range_key       = "log_id"
+    projection_type = "ALL"
+  }
+
+  # Sparse: only QUEUED stubs carry queued_hour, so it lists records not yet
+  # processed, for the reconciliation job
+  global_secondary_index {
+    name               = "queued_index"
+    hash_key           = "queued_hour"
+    range_key          = "queued_at"
+    projection_type    = "INCLUDE"
+    non_key_attributes = ["source"]
+  }
+
+  # Sparse: processed logs newest first per tenant, for GET /logs/recent,
+  # time-ranged GET /logs and GET /logs/labels. Only the public view is
+  # projected; original_text never enters the index.
+  global_secondary_index {
+    name               = "recent_index"
+    hash_key           = "tenant_id"
+    range_key          = "processed_at"
+    projection_type    = "INCLUDE"
+    non_key_attributes = ["source", "parent_id", "batch_id", "status", "queued_at", "modified_data", "encryption", "policy_version", "labels", "deleted_at"]
+  }
+
+  # Expires QUEUED stubs whose message was never processed, processed logs
+  # past their tenant's retention, and soft-deleted logs once their
+  # recovery window ends
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  # Feeds the expiry archive; old images include original_text, which the
+  # archive drops
+  stream_enabled   = var.archive_expired
+  stream_view_type = var.archive_expired ? "OLD_IMAGE" : null
+
   tags = {
     Project = "robust-processor"
   }
 }
 
-# MESSAGE BROKER (SQS)
+# Recent completions per tenant, tailed by the SSE stream
+resource "aws_dynamodb_table" "feed_table" {
+  name         = "CompletionFeed"
+  billing_mode = "PAY_PER_REQUEST"
 
-resource "aws_sqs_queue" "dlq" {
-  name                      = "ingest-dlq"
-  message_retention_seconds = 1209600 # 14 days
+  hash_key  = "tenant_id"
+  range_key = "seq" # arrival time#log_id
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "seq"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
 }
 
-resource "aws_sqs_queue" "ingest_queue" {
-  name                       = "ingest-queue"
-  visibility_timeout_seconds = 900 # Must be >= Lambda timeout
-  receive_wait_time_seconds  = 20 # Long polling
+# Shadow worker output, same keys as the logs table
+resource "aws_dynamodb_table" "shadow_table" {
+  count        = var.shadow_sample_rate > 0 ? 1 : 0
+  name         = "MultiTenantLogsShadow"
+  billing_mode = "PAY_PER_REQUEST"
 
-  redrive_policy = jsonencode({
-    deadLetterTargetArn = aws_sqs_queue.dlq.arn
-    maxReceiveCount     = 3 # Retry 3x before DLQ
-  })
+  hash_key  = "tenant_id"
+  range_key = "log_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "log_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at" # Set by the worker on every shadow item
+    enabled        = true
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_dynamodb_table" "policy_table" {
+  name         = "TenantPolicies"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "tenant_id" # One redaction policy document per tenant
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_dynamodb_table" "usage_table" {
+  name         = "TenantUsage"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "tenant_id"
+  range_key = "period" # YYYY-MM - accepted records and bytes per month
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "period"
+    type = "S"
+  }
+
+  # Expires rate limit and alert rule windows; monthly usage items carry no
+  # expires_at
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# Fingerprint band index for near-duplicate lookups: one item per band of
+# each record's SimHash, keyed tenant#band#piece
+resource "aws_dynamodb_table" "near_duplicate_table" {
+  name         = "NearDuplicateIndex"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "band"
+  range_key = "log_id"
+
+  attribute {
+    name = "band"
+    type = "S"
+  }
+
+  attribute {
+    name = "log_id"
+    type = "S"
+  }
+
+  # Entries expire with their record
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_dynamodb_table" "schema_table" {
+  name         = "EventSchemas"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "schema_name" # tenant_id#name - schemas are tenant-private
+  range_key = "version"     # Immutable once written
+
+  attribute {
+    name = "schema_name"
+    type = "S"
+  }
+
+  attribute {
+    name = "version"
+    type = "N"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# One entry per accepted record (hash, not content), for disputes
+resource "aws_dynamodb_table" "journal_table" {
+  name         = "IngestJournal"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "tenant_id"
+  range_key = "log_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "log_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# Dead-lettered messages with their raw bodies, for investigation
+resource "aws_dynamodb_table" "quarantine_table" {
+  name         = "Quarantine"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "tenant_id" # _unknown when the body names none
+  range_key = "message_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "message_id"
+    type = "S"
+  }
+
+  # Bodies hold unredacted text; keep them no longer than the DLQ would
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_dynamodb_table" "chain_table" {
+  name         = "IntegrityChains"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "chain_id" # tenant_id#YYYY-MM-DD - head of each hash chain
+
+  attribute {
+    name = "chain_id"
+    type = "S"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_dynamodb_table" "backfill_table" {
+  name         = "BackfillJobs"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "job_id" # checkpoint of one sink backfill job
+
+  attribute {
+    name = "job_id"
+    type = "S"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_dynamodb_table" "bulk_job_table" {
+  name         = "BulkIngestJobs"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key = "job_id" # progress of one bulk ingest object
+
+  attribute {
+    name = "job_id"
+    type = "S"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# Audit trail of erasure requests - kept, never expired
+resource "aws_dynamodb_table" "erasure_table" {
+  name         = "ErasureAudit"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "tenant_id"
+  range_key = "erasure_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "erasure_id"
+    type = "S"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# What each token of tokenizing tenants stands for, sealed under the
+# tenant's key when it has one - cleared by tenant erasure
+resource "aws_dynamodb_table" "token_vault" {
+  name         = "TokenVault"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "tenant_id"
+  range_key = "token"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "token"
+    type = "S"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# Audit trail of secret rotations by rdpctl - kept, never expired; holds no
+# secrets
+resource "aws_dynamodb_table" "rotation_audit" {
+  name         = "SecretRotationAudit"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "tenant_id"
+  range_key = "rotation_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "rotation_id"
+    type = "S"
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# Tenant exports requested through the read API and their progress;
+# expired with the export's objects
+resource "aws_dynamodb_table" "export_table" {
+  name         = "TenantExports"
+  billing_mode = "PAY_PER_REQUEST"
+
+  hash_key  = "tenant_id"
+  range_key = "export_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "export_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+# TENANT EXPORTS (parts and manifests, downloaded through presigned URLs)
+
+resource "aws_s3_bucket" "exports" {
+  bucket_prefix = "robust-processor-exports-"
+  force_destroy = true
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "exports" {
+  bucket = aws_s3_bucket.exports.id
+
+  rule {
+    id     = "expire-exports"
+    status = "Enabled"
+    filter {}
+    expiration {
+      days = var.export_retention_days
+    }
+  }
+}
+
+# PROFILING (on-demand pprof output)
+
+resource "aws_s3_bucket" "profiles" {
+  bucket_prefix = "robust-processor-profiles-"
+  force_destroy = true
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "profiles" {
+  bucket = aws_s3_bucket.profiles.id
+
+  rule {
+    id     = "expire-profiles"
+    status = "Enabled"
+    filter {}
+    expiration {
+      days = 7
+    }
+  }
+}
+
+# CLAIM CHECKS (texts of records too large for an SQS message)
+
+resource "aws_s3_bucket" "claim_checks" {
+  bucket_prefix = "robust-processor-claims-"
+  force_destroy = true
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "claim_checks" {
+  bucket = aws_s3_bucket.claim_checks.id
+
+  rule {
+    id     = "expire-claim-checks"
+    status = "Enabled"
+    filter {}
+    expiration {
+      days = 15 # Outlives the DLQ's 14 days, so redriven messages still hydrate
+    }
+  }
+}
+
+# EXPIRY ARCHIVE (records purged by the logs table's TTL, redacted)
+
+resource "aws_s3_bucket" "archive" {
+  count         = var.archive_expired ? 1 : 0
+  bucket_prefix = "robust-processor-archive-"
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "archive" {
+  count  = var.archive_expired ? 1 : 0
+  bucket = aws_s3_bucket.archive[0].id
+
+  rule {
+    id     = "archive-to-glacier"
+    status = "Enabled"
+    filter {}
+    transition {
+      days          = 30
+      storage_class = "GLACIER_IR"
+    }
+  }
+}
+
+# BULK INGEST (files under <tenant_id>/ are split and queued by BulkIngest)
+
+resource "aws_s3_bucket" "bulk_ingest" {
+  bucket_prefix = "robust-processor-bulk-"
+  force_destroy = true
+}
+
+resource "aws_s3_bucket_notification" "bulk_ingest" {
+  bucket = aws_s3_bucket.bulk_ingest.id
+
+  lambda_function {
+    lambda_function_arn = aws_lambda_function.bulk_ingest_lambda.arn
+    events              = ["s3:ObjectCreated:*"]
+  }
+
+  depends_on = [aws_lambda_permission.bulk_ingest]
+}
+
+# MESSAGE BROKER (SQS)
+
+# A FIFO queue's dead-letter queue must be FIFO too
+resource "aws_sqs_queue" "dlq" {
+  name                      = var.fifo_queue ? "ingest-dlq.fifo" : "ingest-dlq"
+  fifo_queue                = var.fifo_queue
+  message_retention_seconds = 1209600 # 14 days
+}
+
+resource "aws_sqs_queue" "ingest_queue" {
+  name                       = var.fifo_queue ? "ingest-queue.fifo" : "ingest-queue"
+  fifo_queue                 = var.fifo_queue
+  visibility_timeout_seconds = 900 # Must be >= Lambda timeout
+  receive_wait_time_seconds  = 20 # Long polling
+
+  # High-throughput FIFO: limits apply per tenant rather than per queue
+  deduplication_scope   = var.fifo_queue ? "messageGroup" : null
+  fifo_throughput_limit = var.fifo_queue ? "perMessageGroupId" : null
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.dlq.arn
+    maxReceiveCount     = 3 # Retry 3x before DLQ
+  })
+}
+
+# High priority records, consumed by their own worker ahead of bulk traffic
+resource "aws_sqs_queue" "priority_queue" {
+  count                      = var.priority_worker_concurrency > 0 ? 1 : 0
+  name                       = var.fifo_queue ? "ingest-priority-queue.fifo" : "ingest-priority-queue"
+  fifo_queue                 = var.fifo_queue
+  visibility_timeout_seconds = 900
+  receive_wait_time_seconds  = 20
+
+  deduplication_scope   = var.fifo_queue ? "messageGroup" : null
+  fifo_throughput_limit = var.fifo_queue ? "perMessageGroupId" : null
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.dlq.arn
+    maxReceiveCount     = 3
+  })
+}
+
+# Pilot tenants' messages, consumed by the staging worker
+resource "aws_sqs_queue" "staging_queue" {
+  count                      = length(var.staging_tenants) > 0 ? 1 : 0
+  name                       = var.fifo_queue ? "ingest-staging-queue.fifo" : "ingest-staging-queue"
+  fifo_queue                 = var.fifo_queue
+  visibility_timeout_seconds = 900
+  receive_wait_time_seconds  = 20
+
+  deduplication_scope   = var.fifo_queue ? "messageGroup" : null
+  fifo_throughput_limit = var.fifo_queue ? "perMessageGroupId" : null
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.dlq.arn
+    maxReceiveCount     = 3
+  })
+}
+
+# Mirrored copies of sampled traffic, consumed by the shadow worker
+resource "aws_sqs_queue" "shadow_queue" {
+  count                      = var.shadow_sample_rate > 0 ? 1 : 0
+  name                       = "ingest-shadow-queue"
+  visibility_timeout_seconds = 900
+  receive_wait_time_seconds  = 20
+  message_retention_seconds  = 86400 # Shadow results are disposable
+}
+
+# Requests made with honeypot API keys to ingest or the read API, captured for security review; nothing consumes it
+resource "aws_sqs_queue" "honeypot_queue" {
+  count                     = var.api_key_secret_prefix != "" ? 1 : 0
+  name                      = "ingest-honeypot-queue"
+  message_retention_seconds = 1209600 # 14 days
+}
+
+# RECEIPT SIGNING (KMS)
+
+# Asymmetric key signing per-record redaction receipts; auditors verify with its public key
+resource "aws_kms_key" "receipts" {
+  description              = "Signs redaction receipts"
+  key_usage                = "SIGN_VERIFY"
+  customer_master_key_spec = "ECC_NIST_P256"
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_kms_alias" "receipts" {
+  name          = "alias/robust-processor-receipts"
+  target_key_id = aws_kms_key.receipts.key_id
+}
+
+# Signs the 202 acknowledgements of tenants with sign_responses (detached JWS)
+resource "aws_kms_key" "acknowledgements" {
+  description              = "Signs ingest acknowledgements"
+  key_usage                = "SIGN_VERIFY"
+  customer_master_key_spec = "ECC_NIST_P256"
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_kms_alias" "acknowledgements" {
+  name          = "alias/robust-processor-acknowledgements"
+  target_key_id = aws_kms_key.acknowledgements.key_id
+}
+
+# MESSAGE SIGNING (KMS)
+
+# Wraps the HMAC key ingest signs queue messages with; services decrypt it once
+# per execution environment and the key itself never appears in plaintext
+resource "aws_kms_key" "pipeline" {
+  description         = "Wraps the queue message signing key"
+  enable_key_rotation = true
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_kms_alias" "pipeline" {
+  name          = "alias/robust-processor-pipeline"
+  target_key_id = aws_kms_key.pipeline.key_id
+}
+
+# Two pipeline keys: the one in var.pipeline_key_slot signs, and both
+# verify, so switching slots rotates the key without forging queued
+# messages (see README, Secret Rotation)
+resource "random_password" "pipeline_key" {
+  for_each = toset(["a", "b"])
+  length   = 64
+  special  = false
+}
+
+resource "aws_kms_ciphertext" "pipeline_key" {
+  for_each  = random_password.pipeline_key
+  key_id    = aws_kms_key.pipeline.key_id
+  plaintext = each.value.result
+  context   = { purpose = "pipeline-signing" }
+}
+
+moved {
+  from = random_password.pipeline_key
+  to   = random_password.pipeline_key["a"]
+}
+
+moved {
+  from = aws_kms_ciphertext.pipeline_key
+  to   = aws_kms_ciphertext.pipeline_key["a"]
+}
+
+locals {
+  pipeline_key_ciphertext          = aws_kms_ciphertext.pipeline_key[var.pipeline_key_slot].ciphertext_blob
+  pipeline_key_previous_ciphertext = aws_kms_ciphertext.pipeline_key[var.pipeline_key_slot == "a" ? "b" : "a"].ciphertext_blob
+}
+
+# Derives the tenant-scoped pseudonyms OpenSearch indexes for a tenant's
+# search_pseudonyms fields
+resource "random_password" "pseudonym_key" {
+  length  = 64
+  special = false
+}
+
+resource "aws_kms_ciphertext" "pseudonym_key" {
+  key_id    = aws_kms_key.pipeline.key_id
+  plaintext = random_password.pseudonym_key.result
+  context   = { purpose = "pseudonymization" }
+}
+
+# COMPLETION EVENTS (EventBridge)
+
+resource "aws_cloudwatch_event_bus" "completions" {
+  name = "robust-processor-completions"
+}
+
+resource "aws_cloudwatch_event_rule" "completion_feed" {
+  name           = "completion-feed"
+  event_bus_name = aws_cloudwatch_event_bus.completions.name
+  event_pattern = jsonencode({
+    source      = ["robust-processor"]
+    detail-type = ["Log Processed"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "completion_feed" {
+  rule           = aws_cloudwatch_event_rule.completion_feed.name
+  event_bus_name = aws_cloudwatch_event_bus.completions.name
+  arn            = aws_lambda_function.stream_lambda.arn
+}
+
+resource "aws_lambda_permission" "completion_feed" {
+  statement_id  = "AllowFeedFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.stream_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.completion_feed.arn
+}
+
+# QUOTA ALERTS
+# Metering announces 80%/100% quota crossings on the usage bus; the SNS topic
+# fans them out. Tenants' webhooks are HTTPS subscriptions filtered on
+# detail.tenant_id (filter_policy_scope = "MessageBody").
+
+resource "aws_cloudwatch_event_bus" "usage" {
+  name = "robust-processor-usage"
+}
+
+resource "aws_sns_topic" "quota_alerts" {
+  name = "robust-processor-quota-alerts"
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "quota_alerts" {
+  name           = "quota-alerts"
+  event_bus_name = aws_cloudwatch_event_bus.usage.name
+  event_pattern = jsonencode({
+    source      = ["robust-processor"]
+    detail-type = ["Quota Threshold Crossed"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "quota_alerts" {
+  rule           = aws_cloudwatch_event_rule.quota_alerts.name
+  event_bus_name = aws_cloudwatch_event_bus.usage.name
+  arn            = aws_sns_topic.quota_alerts.arn
+}
+
+resource "aws_sns_topic_policy" "quota_alerts" {
+  arn = aws_sns_topic.quota_alerts.arn
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect    = "Allow"
+      Principal = { Service = "events.amazonaws.com" }
+      Action    = "sns:Publish"
+      Resource  = aws_sns_topic.quota_alerts.arn
+      Condition = { ArnEquals = { "aws:SourceArn" = aws_cloudwatch_event_rule.quota_alerts.arn } }
+    }]
+  })
+}
+
+# TENANT ALERT RULES
+# The alerts Lambda evaluates tenants' alert_rules against completion events
+# and announces tripped rules on the usage bus; this topic fans them out to
+# tenants' webhooks the same way as quota alerts.
+
+resource "aws_cloudwatch_event_rule" "alert_rules" {
+  name           = "alert-rules"
+  event_bus_name = aws_cloudwatch_event_bus.completions.name
+  event_pattern = jsonencode({
+    source      = ["robust-processor"]
+    detail-type = ["Log Processed"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "alert_rules" {
+  rule           = aws_cloudwatch_event_rule.alert_rules.name
+  event_bus_name = aws_cloudwatch_event_bus.completions.name
+  arn            = aws_lambda_function.alerts_lambda.arn
+}
+
+resource "aws_lambda_permission" "alert_rules" {
+  statement_id  = "AllowAlertRulesFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.alerts_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.alert_rules.arn
+}
+
+resource "aws_sns_topic" "tenant_alerts" {
+  name = "robust-processor-tenant-alerts"
+
+  tags = {
+    Project = "robust-processor"
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "tenant_alerts" {
+  name           = "tenant-alerts"
+  event_bus_name = aws_cloudwatch_event_bus.usage.name
+  event_pattern = jsonencode({
+    source      = ["robust-processor"]
+    detail-type = ["Alert Rule Triggered"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "tenant_alerts" {
+  rule           = aws_cloudwatch_event_rule.tenant_alerts.name
+  event_bus_name = aws_cloudwatch_event_bus.usage.name
+  arn            = aws_sns_topic.tenant_alerts.arn
+}
+
+resource "aws_sns_topic_policy" "tenant_alerts" {
+  arn = aws_sns_topic.tenant_alerts.arn
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect    = "Allow"
+      Principal = { Service = "events.amazonaws.com" }
+      Action    = "sns:Publish"
+      Resource  = aws_sns_topic.tenant_alerts.arn
+      Condition = { ArnEquals = { "aws:SourceArn" = aws_cloudwatch_event_rule.tenant_alerts.arn } }
+    }]
+  })
+}
+
+# IAM ROLES
+
+# Ingest Lambda Role
+resource "aws_iam_role" "ingest_role" {
+  name = "ingest_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "ingest_basic" {
+  role       = aws_iam_role.ingest_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "ingest_sqs_policy" {
+  name = "ingest_sqs_write"
+  role = aws_iam_role.ingest_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["sqs:SendMessage", "sqs:GetQueueAttributes"]
+        Resource = concat([aws_sqs_queue.ingest_queue.arn], aws_sqs_queue.staging_queue[*].arn, aws_sqs_queue.priority_queue[*].arn, aws_sqs_queue.shadow_queue[*].arn, aws_sqs_queue.honeypot_queue[*].arn)
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = [aws_dynamodb_table.schema_table.arn, aws_dynamodb_table.policy_table.arn]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:UpdateItem", "dynamodb:BatchGetItem"]
+        Resource = aws_dynamodb_table.usage_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchWriteItem"]
+        Resource = aws_dynamodb_table.journal_table.arn
+      },
+      {
+        # QUEUED stubs are conditional puts, never over a stored record
+        Effect   = "Allow"
+        Action   = ["dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.logs_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["events:PutEvents"]
+        Resource = aws_cloudwatch_event_bus.usage.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = aws_kms_key.pipeline.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:PutObject"]
+        Resource = "${aws_s3_bucket.claim_checks.arn}/claims/*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Sign"]
+        Resource = aws_kms_key.acknowledgements.arn
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "ingest_api_keys" {
+  count = var.api_key_secret_prefix != "" ? 1 : 0
+  name  = "ingest_api_key_read"
+  role  = aws_iam_role.ingest_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["secretsmanager:GetSecretValue"]
+      Resource = "arn:aws:secretsmanager:*:*:secret:${var.api_key_secret_prefix}*"
+    }]
+  })
+}
+
+# Worker Lambda Role
+resource "aws_iam_role" "worker_role" {
+  name = "worker_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "worker_basic" {
+  role       = aws_iam_role.worker_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "worker_policy" {
+  name = "worker_processing_policy"
+  role = aws_iam_role.worker_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:GetQueueAttributes"]
+        Resource = concat([aws_sqs_queue.ingest_queue.arn], aws_sqs_queue.staging_queue[*].arn, aws_sqs_queue.priority_queue[*].arn)
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:PutItem", "dynamodb:UpdateItem", "dynamodb:DescribeTable", "dynamodb:Query"]
+        Resource = aws_dynamodb_table.logs_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = [aws_dynamodb_table.policy_table.arn, aws_dynamodb_table.schema_table.arn]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:UpdateItem"]
+        Resource = aws_dynamodb_table.chain_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:PutObject"]
+        Resource = "${aws_s3_bucket.profiles.arn}/profiles/*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["events:PutEvents"]
+        Resource = aws_cloudwatch_event_bus.completions.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Sign"]
+        Resource = aws_kms_key.receipts.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = aws_kms_key.pipeline.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "${aws_s3_bucket.claim_checks.arn}/claims/*"
+      },
+      {
+        # Tenant exports assume a role in the tenant's account, always with a
+        # session policy scoped to that tenant (internal/awsauth)
+        Effect   = "Allow"
+        Action   = ["sts:AssumeRole"]
+        Resource = "arn:aws:iam::*:role/*"
+      },
+      {
+        # Messages failing signature verification are moved straight to the DLQ
+        Effect   = "Allow"
+        Action   = ["sqs:SendMessage"]
+        Resource = aws_sqs_queue.dlq.arn
+      },
+      {
+        # Tenant keys live in tenant accounts and must also grant this role in
+        # their key policy; data keys may only be bound to a record
+        Effect   = "Allow"
+        Action   = ["kms:GenerateDataKey"]
+        Resource = "arn:aws:kms:*:*:key/*"
+        Condition = {
+          "ForAllValues:StringEquals" = { "kms:EncryptionContextKeys" = ["tenant_id", "log_id"] }
+        }
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.backfill_table.arn
+      },
+      {
+        # Backfill jobs continue themselves in a fresh invocation near the timeout
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = aws_lambda_function.worker_lambda.arn
+      },
+      {
+        # Processing cost estimates are added to the tenants' monthly usage
+        Effect   = "Allow"
+        Action   = ["dynamodb:UpdateItem"]
+        Resource = aws_dynamodb_table.usage_table.arn
+      },
+      {
+        # Tenants with near_duplicates index record fingerprints
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchWriteItem"]
+        Resource = aws_dynamodb_table.near_duplicate_table.arn
+      },
+      {
+        # Tenants with tokenize vault their tokens before the record is written
+        Effect   = "Allow"
+        Action   = ["dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.token_vault.arn
+      },
+      {
+        # Tenants with an escalation policy send risky records to Comprehend
+        Effect   = "Allow"
+        Action   = ["comprehend:DetectPiiEntities"]
+        Resource = "*"
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_shadow" {
+  count = var.shadow_sample_rate > 0 ? 1 : 0
+  name  = "worker_shadow_policy"
+  role  = aws_iam_role.worker_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:GetQueueAttributes"]
+        Resource = aws_sqs_queue.shadow_queue[0].arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.shadow_table[0].arn
+      }
+    ]
+  })
+}
+
+# Prefilter (ingest route authorizer) Lambda Role
+resource "aws_iam_role" "prefilter_role" {
+  count = var.prefilter_authorizer ? 1 : 0
+  name  = "prefilter_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "prefilter_basic" {
+  count      = var.prefilter_authorizer ? 1 : 0
+  role       = aws_iam_role.prefilter_role[0].name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Query (read API) Lambda Role
+resource "aws_iam_role" "query_role" {
+  name = "query_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "query_basic" {
+  role       = aws_iam_role.query_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "query_policy" {
+  name = "query_read_policy"
+  role = aws_iam_role.query_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:BatchGetItem", "dynamodb:UpdateItem", "dynamodb:Query"]
+        Resource = aws_dynamodb_table.logs_table.arn
+      },
+      {
+        Effect = "Allow"
+        Action = ["dynamodb:Query"]
+        Resource = [
+          "${aws_dynamodb_table.logs_table.arn}/index/recent_index",
+          "${aws_dynamodb_table.logs_table.arn}/index/parent_index",
+        ]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = aws_kms_key.pipeline.arn
+      },
+      {
+        # Permission flags and pseudonym generations are read per request
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = aws_dynamodb_table.policy_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Query"]
+        Resource = aws_dynamodb_table.near_duplicate_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.erasure_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = aws_lambda_function.erase_lambda.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.export_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = aws_lambda_function.export_lambda.arn
+      },
+      {
+        # Download URLs are signed with this role's credentials
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "${aws_s3_bucket.exports.arn}/*"
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "query_api_keys" {
+  count = var.api_key_secret_prefix != "" ? 1 : 0
+  name  = "query_api_key_read"
+  role  = aws_iam_role.query_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["secretsmanager:GetSecretValue"]
+        Resource = "arn:aws:secretsmanager:*:*:secret:${var.api_key_secret_prefix}*"
+      },
+      {
+        # Requests made with honeypot keys are captured as in ingest
+        Effect   = "Allow"
+        Action   = ["sqs:SendMessage"]
+        Resource = aws_sqs_queue.honeypot_queue[*].arn
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "query_original_reads" {
+  count = var.original_reads ? 1 : 0
+  name  = "query_original_reads"
+  role  = aws_iam_role.query_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        # Tenant keys must also grant this role kms:Decrypt in their key
+        # policy, and only record data keys can be opened
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = "arn:aws:kms:*:*:key/*"
+        Condition = {
+          "ForAllValues:StringEquals" = { "kms:EncryptionContextKeys" = ["tenant_id", "log_id"] }
+        }
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "query_detokenize" {
+  count = var.detokenize ? 1 : 0
+  name  = "query_detokenize"
+  role  = aws_iam_role.query_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchGetItem"]
+        Resource = aws_dynamodb_table.token_vault.arn
+      },
+      {
+        # Vault values are sealed like originals, with the token as log_id
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = "arn:aws:kms:*:*:key/*"
+        Condition = {
+          "ForAllValues:StringEquals" = { "kms:EncryptionContextKeys" = ["tenant_id", "log_id"] }
+        }
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "query_search" {
+  count = var.opensearch_endpoint != "" ? 1 : 0
+  name  = "query_semantic_search"
+  role  = aws_iam_role.query_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["es:ESHttpPost", "aoss:APIAccessAll"]
+      Resource = ["${var.opensearch_domain_arn}", "${var.opensearch_domain_arn}/*"]
+    }]
+  })
+}
+
+resource "aws_iam_role_policy" "query_embedding" {
+  count = var.embedding_model_id != "" ? 1 : 0
+  name  = "query_embedding"
+  role  = aws_iam_role.query_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["bedrock:InvokeModel"]
+      Resource = "arn:aws:bedrock:*::foundation-model/${var.embedding_model_id}"
+    }]
+  })
+}
+
+# Completion stream Lambda Role
+resource "aws_iam_role" "stream_role" {
+  name = "stream_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "stream_basic" {
+  role       = aws_iam_role.stream_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "stream_policy" {
+  name = "stream_feed_policy"
+  role = aws_iam_role.stream_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["dynamodb:PutItem", "dynamodb:Query"]
+      Resource = aws_dynamodb_table.feed_table.arn
+    }]
+  })
+}
+
+# Shadow comparison Lambda Role
+resource "aws_iam_role" "compare_role" {
+  count = var.shadow_sample_rate > 0 ? 1 : 0
+  name  = "compare_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "compare_basic" {
+  count      = var.shadow_sample_rate > 0 ? 1 : 0
+  role       = aws_iam_role.compare_role[0].name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "compare_policy" {
+  count = var.shadow_sample_rate > 0 ? 1 : 0
+  name  = "compare_read_policy"
+  role  = aws_iam_role.compare_role[0].id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Scan"]
+        Resource = aws_dynamodb_table.shadow_table[0].arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchGetItem"]
+        Resource = aws_dynamodb_table.logs_table.arn
+      }
+    ]
+  })
+}
+
+# Reconciliation Lambda Role
+resource "aws_iam_role" "reconcile_role" {
+  name = "reconcile_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "reconcile_basic" {
+  role       = aws_iam_role.reconcile_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "reconcile_policy" {
+  name = "reconcile_read_policy"
+  role = aws_iam_role.reconcile_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["dynamodb:Query"]
+      Resource = "${aws_dynamodb_table.logs_table.arn}/index/queued_index"
+    }]
+  })
+}
+
+# Quarantine (DLQ consumer) Lambda Role
+resource "aws_iam_role" "quarantine_role" {
+  name = "quarantine_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "quarantine_basic" {
+  role       = aws_iam_role.quarantine_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "quarantine_policy" {
+  name = "quarantine_policy"
+  role = aws_iam_role.quarantine_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:GetQueueAttributes"]
+        Resource = aws_sqs_queue.dlq.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.quarantine_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:UpdateItem"]
+        Resource = aws_dynamodb_table.logs_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = aws_kms_key.pipeline.arn
+      }
+    ]
+  })
+}
+
+# Redrive Lambda Role
+resource "aws_iam_role" "redrive_role" {
+  name = "redrive_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "redrive_basic" {
+  role       = aws_iam_role.redrive_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "redrive_policy" {
+  name = "redrive_policy"
+  role = aws_iam_role.redrive_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Query", "dynamodb:Scan", "dynamodb:DeleteItem"]
+        Resource = aws_dynamodb_table.quarantine_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:UpdateItem"]
+        Resource = aws_dynamodb_table.logs_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["sqs:SendMessage"]
+        Resource = aws_sqs_queue.ingest_queue.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = aws_kms_key.pipeline.arn
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role" "undelete_role" {
+  name = "undelete_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "undelete_basic" {
+  role       = aws_iam_role.undelete_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "undelete_policy" {
+  name = "undelete_policy"
+  role = aws_iam_role.undelete_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["dynamodb:GetItem", "dynamodb:Query", "dynamodb:UpdateItem"]
+      Resource = aws_dynamodb_table.logs_table.arn
+    }]
+  })
+}
+
+resource "aws_iam_role" "bulk_ingest_role" {
+  name = "bulk_ingest_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "bulk_ingest_basic" {
+  role       = aws_iam_role.bulk_ingest_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "bulk_ingest_policy" {
+  name = "bulk_ingest_policy"
+  role = aws_iam_role.bulk_ingest_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "${aws_s3_bucket.bulk_ingest.arn}/*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.bulk_job_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["sqs:SendMessage"]
+        Resource = concat([aws_sqs_queue.ingest_queue.arn], aws_sqs_queue.staging_queue[*].arn)
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["kms:Decrypt"]
+        Resource = aws_kms_key.pipeline.arn
+      },
+      {
+        # Long files continue in a fresh invocation of the function itself
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = "arn:aws:lambda:*:*:function:BulkIngest"
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role" "alerts_role" {
+  name = "alerts_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "alerts_basic" {
+  role       = aws_iam_role.alerts_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "alerts_policy" {
+  name = "alerts_policy"
+  role = aws_iam_role.alerts_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = aws_dynamodb_table.policy_table.arn
+      },
+      {
+        # Rule windows are counted beside ingest's rate limit windows
+        Effect   = "Allow"
+        Action   = ["dynamodb:UpdateItem"]
+        Resource = aws_dynamodb_table.usage_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["events:PutEvents"]
+        Resource = aws_cloudwatch_event_bus.usage.arn
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role" "archive_role" {
+  count = var.archive_expired ? 1 : 0
+  name  = "archive_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "archive_basic" {
+  count      = var.archive_expired ? 1 : 0
+  role       = aws_iam_role.archive_role[0].name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "archive_policy" {
+  count = var.archive_expired ? 1 : 0
+  name  = "archive_policy"
+  role  = aws_iam_role.archive_role[0].id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:DescribeStream", "dynamodb:GetRecords", "dynamodb:GetShardIterator", "dynamodb:ListStreams"]
+        Resource = aws_dynamodb_table.logs_table.stream_arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:PutObject"]
+        Resource = "${aws_s3_bucket.archive[0].arn}/*"
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role" "erase_role" {
+  name = "erase_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "erase_basic" {
+  role       = aws_iam_role.erase_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "erase_policy" {
+  name = "erase_policy"
+  role = aws_iam_role.erase_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.erasure_table.arn
+      },
+      {
+        Effect = "Allow"
+        Action = ["dynamodb:GetItem", "dynamodb:Query", "dynamodb:BatchWriteItem"]
+        Resource = [
+          aws_dynamodb_table.logs_table.arn,
+          "${aws_dynamodb_table.logs_table.arn}/index/parent_index",
+          aws_dynamodb_table.shadow_table.arn,
+          aws_dynamodb_table.journal_table.arn,
+          aws_dynamodb_table.quarantine_table.arn,
+          aws_dynamodb_table.near_duplicate_table.arn,
+          aws_dynamodb_table.token_vault.arn
+        ]
+      },
+      {
+        # Tenant erasures continue in a fresh invocation of the function itself
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = "arn:aws:lambda:*:*:function:Erase"
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role" "export_role" {
+  name = "export_lambda_role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "export_basic" {
+  role       = aws_iam_role.export_role.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "export_policy" {
+  name = "export_policy"
+  role = aws_iam_role.export_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem", "dynamodb:PutItem"]
+        Resource = aws_dynamodb_table.export_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Query"]
+        Resource = aws_dynamodb_table.logs_table.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:PutObject"]
+        Resource = "${aws_s3_bucket.exports.arn}/*"
+      },
+      {
+        # Large exports continue in a fresh invocation of the function itself
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = "arn:aws:lambda:*:*:function:Export"
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "erase_opensearch" {
+  count = var.opensearch_endpoint != "" ? 1 : 0
+  name  = "erase_opensearch"
+  role  = aws_iam_role.erase_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["es:ESHttpPost", "aoss:APIAccessAll"]
+      Resource = ["${var.opensearch_domain_arn}", "${var.opensearch_domain_arn}/*"]
+    }]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_firehose" {
+  count = var.firehose_stream_name != "" ? 1 : 0
+  name  = "worker_firehose_sink"
+  role  = aws_iam_role.worker_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = "firehose:PutRecordBatch"
+      Resource = "arn:aws:firehose:*:*:deliverystream/${var.firehose_stream_name}"
+    }]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_opensearch" {
+  count = var.opensearch_endpoint != "" ? 1 : 0
+  name  = "worker_opensearch_sink"
+  role  = aws_iam_role.worker_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["es:ESHttpPost", "aoss:APIAccessAll"]
+      Resource = ["${var.opensearch_domain_arn}", "${var.opensearch_domain_arn}/*"]
+    }]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_embedding" {
+  count = var.embedding_model_id != "" ? 1 : 0
+  name  = "worker_embedding"
+  role  = aws_iam_role.worker_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["bedrock:InvokeModel"]
+      Resource = "arn:aws:bedrock:*::foundation-model/${var.embedding_model_id}"
+    }]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_enrichment" {
+  count = length(var.enrichment_lookup_arns) > 0 ? 1 : 0
+  name  = "worker_enrichment_lookups"
+  role  = aws_iam_role.worker_role.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["s3:GetObject", "dynamodb:GetItem"]
+      Resource = var.enrichment_lookup_arns
+    }]
+  })
+}
+
+# LAMBDA FUNCTIONS
+
+locals {
+  worker_environment = {
+    TABLE_NAME                       = aws_dynamodb_table.logs_table.name
+    POLICY_TABLE_NAME                = aws_dynamodb_table.policy_table.name
+    SCHEMA_TABLE_NAME                = aws_dynamodb_table.schema_table.name
+    CHAIN_TABLE_NAME                 = aws_dynamodb_table.chain_table.name
+    PROFILE                          = var.worker_profile
+    PROFILE_BUCKET                   = aws_s3_bucket.profiles.bucket
+    FIREHOSE_STREAM_NAME             = var.firehose_stream_name
+    OPENSEARCH_ENDPOINT              = var.opensearch_endpoint
+    COMPLETION_EVENT_BUS             = aws_cloudwatch_event_bus.completions.name
+    RECEIPT_KEY_ID                   = aws_kms_key.receipts.arn
+    BACKFILL_TABLE_NAME              = aws_dynamodb_table.backfill_table.name
+    WORKER_CONCURRENCY               = tostring(var.worker_concurrency)
+    DLQ_URL                          = aws_sqs_queue.dlq.url
+    PIPELINE_KEY_CIPHERTEXT          = local.pipeline_key_ciphertext
+    PIPELINE_KEY_PREVIOUS_CIPHERTEXT = local.pipeline_key_previous_ciphertext
+    PSEUDONYM_KEY_CIPHERTEXT         = aws_kms_ciphertext.pseudonym_key.ciphertext_blob
+    CLAIM_CHECK_BUCKET               = aws_s3_bucket.claim_checks.bucket
+    USAGE_TABLE_NAME                 = aws_dynamodb_table.usage_table.name
+    EMBEDDING_MODEL_ID               = var.embedding_model_id
+    EMBEDDING_ENDPOINT               = var.embedding_endpoint
+    EMBEDDING_DIMENSIONS             = tostring(var.embedding_dimensions)
+    NEAR_DUPLICATE_TABLE_NAME        = aws_dynamodb_table.near_duplicate_table.name
+    TOKEN_VAULT_TABLE_NAME           = aws_dynamodb_table.token_vault.name
+    DEFAULT_RETENTION_DAYS           = tostring(var.default_retention_days)
+    STORE_ORIGINAL                   = tostring(var.store_original)
+  }
+}
+
+resource "aws_lambda_function" "ingest_lambda" {
+  filename         = "ingest.zip"
+  function_name    = "IngestAPI"
+  role             = aws_iam_role.ingest_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("ingest.zip") ? filebase64sha256("ingest.zip") : null
+  timeout          = 10
+  memory_size      = 256
+
+  environment {
+    variables = {
+      QUEUE_URL                = aws_sqs_queue.ingest_queue.url
+      TABLE_NAME               = aws_dynamodb_table.logs_table.name
+      JOURNAL_TABLE_NAME       = aws_dynamodb_table.journal_table.name
+      JOURNAL_RETENTION        = "${var.journal_retention_days * 24}h"
+      SCHEMA_TABLE_NAME        = aws_dynamodb_table.schema_table.name
+      LOG_ID_STRATEGY          = var.log_id_strategy
+      STAGING_QUEUE_URL        = join("", aws_sqs_queue.staging_queue[*].url)
+      PRIORITY_QUEUE_URL       = join("", aws_sqs_queue.priority_queue[*].url)
+      STAGING_TENANTS          = join(",", var.staging_tenants)
+      SHADOW_QUEUE_URL         = join("", aws_sqs_queue.shadow_queue[*].url)
+      SHADOW_SAMPLE_RATE       = tostring(var.shadow_sample_rate)
+      PROCESSING_BYTES_PER_SEC = tostring(var.processing_bytes_per_sec)
+      PREFILTER_REQUIRE_AUTH   = tostring(var.require_auth)
+      POLICY_TABLE_NAME        = aws_dynamodb_table.policy_table.name
+      USAGE_TABLE_NAME         = aws_dynamodb_table.usage_table.name
+      USAGE_EVENT_BUS          = aws_cloudwatch_event_bus.usage.name
+      PIPELINE_KEY_CIPHERTEXT  = local.pipeline_key_ciphertext
+      API_KEY_SECRET_PREFIX    = var.api_key_secret_prefix
+      CLAIM_CHECK_BUCKET       = aws_s3_bucket.claim_checks.bucket
+      ACK_SIGNING_KEY_ID       = aws_kms_key.acknowledgements.arn
+      HONEYPOT_QUEUE_URL       = join("", aws_sqs_queue.honeypot_queue[*].url)
+      AUTH_FAILURE_LIMIT       = tostring(var.auth_failure_limit)
+    }
+  }
+}
+
+resource "aws_lambda_function" "worker_lambda" {
+  filename         = "worker.zip"
+  function_name    = "LogWorker"
+  role             = aws_iam_role.worker_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("worker.zip") ? filebase64sha256("worker.zip") : null
+  timeout          = 60
+  memory_size      = 256
+  publish          = true # Versions back the alias used by provisioned concurrency
+
+  environment {
+    variables = local.worker_environment
+  }
+}
+
+# Same worker build on the priority lane, processing more messages at once
+resource "aws_lambda_function" "worker_priority" {
+  count            = var.priority_worker_concurrency > 0 ? 1 : 0
+  filename         = "worker.zip"
+  function_name    = "LogWorkerPriority"
+  role             = aws_iam_role.worker_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("worker.zip") ? filebase64sha256("worker.zip") : null
+  timeout          = 60
+  memory_size      = 256
+
+  environment {
+    variables = merge(local.worker_environment, {
+      WORKER_CONCURRENCY = tostring(var.priority_worker_concurrency)
+    })
+  }
+}
+
+# Staging build of the worker, same role and storage, fed only by pilot tenants
+resource "aws_lambda_function" "worker_staging" {
+  count            = length(var.staging_tenants) > 0 ? 1 : 0
+  filename         = var.staging_worker_zip
+  function_name    = "LogWorkerStaging"
+  role             = aws_iam_role.worker_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists(var.staging_worker_zip) ? filebase64sha256(var.staging_worker_zip) : null
+  timeout          = 60
+  memory_size      = 256
+
+  environment {
+    variables = local.worker_environment
+  }
+}
+
+# Candidate worker build processing mirrored traffic into the shadow table
+resource "aws_lambda_function" "worker_shadow" {
+  count            = var.shadow_sample_rate > 0 ? 1 : 0
+  filename         = var.shadow_worker_zip
+  function_name    = "LogWorkerShadow"
+  role             = aws_iam_role.worker_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists(var.shadow_worker_zip) ? filebase64sha256(var.shadow_worker_zip) : null
+  timeout          = 60
+  memory_size      = 256
+
+  environment {
+    variables = merge(local.worker_environment, {
+      SHADOW_TABLE_NAME = aws_dynamodb_table.shadow_table[0].name
+    })
+  }
+}
+
+# Header-only checks ahead of ingest; no AWS access needed
+resource "aws_lambda_function" "prefilter_lambda" {
+  count            = var.prefilter_authorizer ? 1 : 0
+  filename         = "prefilter.zip"
+  function_name    = "IngestPrefilter"
+  role             = aws_iam_role.prefilter_role[0].arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("prefilter.zip") ? filebase64sha256("prefilter.zip") : null
+  timeout          = 3
+  memory_size      = 128
+
+  environment {
+    variables = {
+      PREFILTER_REQUIRE_AUTH = tostring(var.require_auth)
+    }
+  }
+}
+
+resource "aws_lambda_function" "query_lambda" {
+  filename         = "query.zip"
+  function_name    = "LogQueryAPI"
+  role             = aws_iam_role.query_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("query.zip") ? filebase64sha256("query.zip") : null
+  timeout          = 30 # Covers ?wait= (capped at 25s)
+  memory_size      = 128
+
+  environment {
+    variables = {
+      TABLE_NAME                = aws_dynamodb_table.logs_table.name
+      DELETE_RECOVERY_WINDOW    = "${var.delete_recovery_days * 24}h"
+      API_KEY_SECRET_PREFIX     = var.api_key_secret_prefix
+      PSEUDONYM_KEY_CIPHERTEXT  = aws_kms_ciphertext.pseudonym_key.ciphertext_blob
+      OPENSEARCH_ENDPOINT       = var.opensearch_endpoint
+      EMBEDDING_MODEL_ID        = var.embedding_model_id
+      EMBEDDING_ENDPOINT        = var.embedding_endpoint
+      EMBEDDING_DIMENSIONS      = tostring(var.embedding_dimensions)
+      NEAR_DUPLICATE_TABLE_NAME = aws_dynamodb_table.near_duplicate_table.name
+      ERASURE_TABLE_NAME        = aws_dynamodb_table.erasure_table.name
+      ERASE_FUNCTION_NAME       = aws_lambda_function.erase_lambda.function_name
+      ORIGINAL_READS            = tostring(var.original_reads)
+      EXPORT_TABLE_NAME         = aws_dynamodb_table.export_table.name
+      EXPORT_FUNCTION_NAME      = aws_lambda_function.export_lambda.function_name
+      EXPORT_BUCKET             = aws_s3_bucket.exports.bucket
+      EXPORT_RETENTION          = "${var.export_retention_days * 24}h"
+      POLICY_TABLE_NAME         = aws_dynamodb_table.policy_table.name
+      DETOKENIZE                = tostring(var.detokenize)
+      TOKEN_VAULT_TABLE_NAME    = aws_dynamodb_table.token_vault.name
+      HONEYPOT_QUEUE_URL        = join("", aws_sqs_queue.honeypot_queue[*].url)
+    }
+  }
+}
+
+# Records completion events and serves them as server-sent events
+resource "aws_lambda_function" "stream_lambda" {
+  filename         = "stream.zip"
+  function_name    = "CompletionStream"
+  role             = aws_iam_role.stream_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("stream.zip") ? filebase64sha256("stream.zip") : null
+  timeout          = 330 # STREAM_DURATION plus headroom
+  memory_size      = 128
+
+  environment {
+    variables = {
+      FEED_TABLE_NAME = aws_dynamodb_table.feed_table.name
+      STREAM_DURATION = "5m"
+    }
+  }
+}
+
+# API Gateway HTTP APIs can't stream, so SSE is served from a Function URL
+resource "aws_lambda_function_url" "stream" {
+  function_name      = aws_lambda_function.stream_lambda.function_name
+  authorization_type = "NONE"
+  invoke_mode        = "RESPONSE_STREAM"
+
+  cors {
+    allow_origins = ["*"]
+    allow_methods = ["GET"]
+    allow_headers = ["Last-Event-ID"]
+  }
+}
+
+# Joins shadow and production output and reports divergence rates
+resource "aws_lambda_function" "compare_lambda" {
+  count            = var.shadow_sample_rate > 0 ? 1 : 0
+  filename         = "compare.zip"
+  function_name    = "ShadowCompare"
+  role             = aws_iam_role.compare_role[0].arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("compare.zip") ? filebase64sha256("compare.zip") : null
+  timeout          = 300
+  memory_size      = 256
+
+  environment {
+    variables = {
+      TABLE_NAME        = aws_dynamodb_table.logs_table.name
+      SHADOW_TABLE_NAME = aws_dynamodb_table.shadow_table[0].name
+      COMPARE_WINDOW    = "1h"
+    }
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "shadow_compare" {
+  count               = var.shadow_sample_rate > 0 ? 1 : 0
+  name                = "shadow-compare"
+  schedule_expression = "rate(1 hour)" # Matches COMPARE_WINDOW
+}
+
+resource "aws_cloudwatch_event_target" "shadow_compare" {
+  count = var.shadow_sample_rate > 0 ? 1 : 0
+  rule  = aws_cloudwatch_event_rule.shadow_compare[0].name
+  arn   = aws_lambda_function.compare_lambda[0].arn
+}
+
+resource "aws_lambda_permission" "shadow_compare" {
+  count         = var.shadow_sample_rate > 0 ? 1 : 0
+  statement_id  = "AllowCompareFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.compare_lambda[0].function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.shadow_compare[0].arn
+}
+
+# Flags accepted records still QUEUED past the SLA window
+resource "aws_lambda_function" "reconcile_lambda" {
+  filename         = "reconcile.zip"
+  function_name    = "QueueReconcile"
+  role             = aws_iam_role.reconcile_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("reconcile.zip") ? filebase64sha256("reconcile.zip") : null
+  timeout          = 120
+  memory_size      = 128
+
+  environment {
+    variables = {
+      TABLE_NAME         = aws_dynamodb_table.logs_table.name
+      RECONCILE_SLA      = var.reconcile_sla
+      RECONCILE_LOOKBACK = "6h"
+    }
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "reconcile" {
+  name                = "queue-reconcile"
+  schedule_expression = "rate(15 minutes)"
+}
+
+resource "aws_cloudwatch_event_target" "reconcile" {
+  rule = aws_cloudwatch_event_rule.reconcile.name
+  arn  = aws_lambda_function.reconcile_lambda.arn
+}
+
+resource "aws_lambda_permission" "reconcile" {
+  statement_id  = "AllowReconcileFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.reconcile_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.reconcile.arn
+}
+
+resource "aws_sns_topic" "ops_alerts" {
+  name = "robust-processor-ops-alerts"
+
+  tags = {
+    Project = "robust-processor"
+  }
 }
 
-# IAM ROLES
-
-# Ingest Lambda Role
-resource "aws_iam_role" "ingest_role" {
-  name = "ingest_lambda_role"
-  assume_role_policy = jsonencode({
-    Version = "2012-10-17"
-    Statement = [{
-      Action    = "sts:AssumeRole"
-      Effect    = "Allow"
-      Principal = { Service = "lambda.amazonaws.com" }
-    }]
-  })
+# Any record overdue in a reconciliation run pages the operators
+resource "aws_cloudwatch_metric_alarm" "records_overdue" {
+  alarm_name          = "robust-processor-records-overdue"
+  alarm_description   = "Accepted records still QUEUED past the reconciliation SLA"
+  namespace           = "RobustProcessor"
+  metric_name         = "RecordsOverdue"
+  statistic           = "Maximum"
+  period              = 900
+  evaluation_periods  = 1
+  comparison_operator = "GreaterThanThreshold"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+  alarm_actions       = [aws_sns_topic.ops_alerts.arn]
 }
 
-resource "aws_iam_role_policy_attachment" "ingest_basic" {
-  role       = aws_iam_role.ingest_role.name
-  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+resource "aws_sns_topic" "security_alerts" {
+  name = "robust-processor-security-alerts"
+
+  tags = {
+    Project = "robust-processor"
+  }
 }
 
-resource "aws_iam_role_policy" "ingest_sqs_policy" {
-  name = "ingest_sqs_write"
-  role = aws_iam_role.ingest_role.id
-  policy = jsonencode({
-    Version = "2012-10-17"
-    Statement = [{
-      Effect   = "Allow"
-      Action   = "sqs:SendMessage"
-      Resource = aws_sqs_queue.ingest_queue.arn
-    }]
-  })
+# Any use of a honeypot key pages security
+resource "aws_cloudwatch_metric_alarm" "honeypot_requests" {
+  alarm_name          = "robust-processor-honeypot-requests"
+  alarm_description   = "A compromised API key flagged as a honeypot was used; see the honeypot queue"
+  namespace           = "RobustProcessor"
+  metric_name         = "HoneypotRequests"
+  statistic           = "Sum"
+  period              = 60
+  evaluation_periods  = 1
+  comparison_operator = "GreaterThanThreshold"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+  alarm_actions       = [aws_sns_topic.security_alerts.arn]
 }
 
-# Worker Lambda Role
-resource "aws_iam_role" "worker_role" {
-  name = "worker_lambda_role"
-  assume_role_policy = jsonencode({
-    Version = "2012-10-17"
-    Statement = [{
-      Action    = "sts:AssumeRole"
-      Effect    = "Allow"
-      Principal = { Service = "lambda.amazonaws.com" }
-    }]
+# Lockouts of callers failing ingest authentication go to security as they
+# happen
+resource "aws_cloudwatch_event_rule" "auth_lockouts" {
+  name           = "auth-lockouts"
+  event_bus_name = aws_cloudwatch_event_bus.usage.name
+  event_pattern = jsonencode({
+    source      = ["robust-processor"]
+    detail-type = ["Authentication Lockout"]
   })
 }
 
-resource "aws_iam_role_policy_attachment" "worker_basic" {
-  role       = aws_iam_role.worker_role.name
-  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+resource "aws_cloudwatch_event_target" "auth_lockouts" {
+  rule           = aws_cloudwatch_event_rule.auth_lockouts.name
+  event_bus_name = aws_cloudwatch_event_bus.usage.name
+  arn            = aws_sns_topic.security_alerts.arn
 }
 
-resource "aws_iam_role_policy" "worker_policy" {
-  name = "worker_processing_policy"
-  role = aws_iam_role.worker_role.id
+# Replaces the topic's default policy, so the honeypot alarm is allowed
+# explicitly
+resource "aws_sns_topic_policy" "security_alerts" {
+  arn = aws_sns_topic.security_alerts.arn
   policy = jsonencode({
     Version = "2012-10-17"
     Statement = [
       {
-        Effect   = "Allow"
-        Action   = ["sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:GetQueueAttributes"]
-        Resource = aws_sqs_queue.ingest_queue.arn
+        Effect    = "Allow"
+        Principal = { Service = "events.amazonaws.com" }
+        Action    = "sns:Publish"
+        Resource  = aws_sns_topic.security_alerts.arn
+        Condition = { ArnEquals = { "aws:SourceArn" = aws_cloudwatch_event_rule.auth_lockouts.arn } }
       },
       {
-        Effect   = "Allow"
-        Action   = ["dynamodb:PutItem"]
-        Resource = aws_dynamodb_table.logs_table.arn
+        Effect    = "Allow"
+        Principal = { Service = "cloudwatch.amazonaws.com" }
+        Action    = "sns:Publish"
+        Resource  = aws_sns_topic.security_alerts.arn
+        Condition = { ArnEquals = { "aws:SourceArn" = aws_cloudwatch_metric_alarm.honeypot_requests.arn } }
       }
     ]
   })
 }
 
-# LAMBDA FUNCTIONS
+# Moves dead-lettered messages into the quarantine table
+resource "aws_lambda_function" "quarantine_lambda" {
+  filename         = "quarantine.zip"
+  function_name    = "DLQQuarantine"
+  role             = aws_iam_role.quarantine_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("quarantine.zip") ? filebase64sha256("quarantine.zip") : null
+  timeout          = 30
+  memory_size      = 128
 
-resource "aws_lambda_function" "ingest_lambda" {
-  filename         = "ingest.zip"
-  function_name    = "IngestAPI"
-  role             = aws_iam_role.ingest_role.arn
+  environment {
+    variables = {
+      TABLE_NAME                       = aws_dynamodb_table.logs_table.name
+      QUARANTINE_TABLE_NAME            = aws_dynamodb_table.quarantine_table.name
+      QUARANTINE_RETENTION             = "336h"
+      PIPELINE_KEY_CIPHERTEXT          = local.pipeline_key_ciphertext
+      PIPELINE_KEY_PREVIOUS_CIPHERTEXT = local.pipeline_key_previous_ciphertext
+    }
+  }
+}
+
+resource "aws_lambda_event_source_mapping" "dlq_trigger" {
+  event_source_arn        = aws_sqs_queue.dlq.arn
+  function_name           = aws_lambda_function.quarantine_lambda.arn
+  batch_size              = 10
+  function_response_types = ["ReportBatchItemFailures"]
+}
+
+resource "aws_cloudwatch_metric_alarm" "messages_quarantined" {
+  alarm_name          = "robust-processor-messages-quarantined"
+  alarm_description   = "Messages exhausted their retries and were quarantined"
+  namespace           = "RobustProcessor"
+  metric_name         = "MessagesQuarantined"
+  statistic           = "Sum"
+  period              = 300
+  evaluation_periods  = 1
+  comparison_operator = "GreaterThanThreshold"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+  alarm_actions       = [aws_sns_topic.ops_alerts.arn]
+}
+
+# Re-enqueues quarantined messages; invoked by operators
+resource "aws_lambda_function" "redrive_lambda" {
+  filename         = "redrive.zip"
+  function_name    = "Redrive"
+  role             = aws_iam_role.redrive_role.arn
   handler          = "bootstrap"
   runtime          = "provided.al2023"
-  architectures    = ["x86_64"]
-  source_code_hash = fileexists("ingest.zip") ? filebase64sha256("ingest.zip") : null
-  timeout          = 10
-  memory_size      = 256
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("redrive.zip") ? filebase64sha256("redrive.zip") : null
+  timeout          = 300
+  memory_size      = 128
 
   environment {
     variables = {
-      QUEUE_URL = aws_sqs_queue.ingest_queue.url
+      TABLE_NAME              = aws_dynamodb_table.logs_table.name
+      QUARANTINE_TABLE_NAME   = aws_dynamodb_table.quarantine_table.name
+      QUEUE_URL               = aws_sqs_queue.ingest_queue.url
+      PIPELINE_KEY_CIPHERTEXT = local.pipeline_key_ciphertext
     }
   }
 }
 
-resource "aws_lambda_function" "worker_lambda" {
-  filename         = "worker.zip"
-  function_name    = "LogWorker"
-  role             = aws_iam_role.worker_role.arn
+# Restores soft-deleted logs; invoked by operators
+resource "aws_lambda_function" "undelete_lambda" {
+  filename         = "undelete.zip"
+  function_name    = "Undelete"
+  role             = aws_iam_role.undelete_role.arn
   handler          = "bootstrap"
   runtime          = "provided.al2023"
-  architectures    = ["x86_64"]
-  source_code_hash = fileexists("worker.zip") ? filebase64sha256("worker.zip") : null
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("undelete.zip") ? filebase64sha256("undelete.zip") : null
+  timeout          = 300
+  memory_size      = 128
+
+  environment {
+    variables = {
+      TABLE_NAME = aws_dynamodb_table.logs_table.name
+    }
+  }
+}
+
+# Splits files dropped into the bulk ingest bucket into queued records
+resource "aws_lambda_function" "bulk_ingest_lambda" {
+  filename         = "bulkingest.zip"
+  function_name    = "BulkIngest"
+  role             = aws_iam_role.bulk_ingest_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("bulkingest.zip") ? filebase64sha256("bulkingest.zip") : null
+  timeout          = 900
+  memory_size      = 512
+
+  environment {
+    variables = {
+      BULK_JOB_TABLE_NAME     = aws_dynamodb_table.bulk_job_table.name
+      QUEUE_URL               = aws_sqs_queue.ingest_queue.url
+      STAGING_QUEUE_URL       = join("", aws_sqs_queue.staging_queue[*].url)
+      STAGING_TENANTS         = join(",", var.staging_tenants)
+      PIPELINE_KEY_CIPHERTEXT = local.pipeline_key_ciphertext
+    }
+  }
+}
+
+# Evaluates tenants' alert rules against completion events
+resource "aws_lambda_function" "alerts_lambda" {
+  filename         = "alerts.zip"
+  function_name    = "AlertRules"
+  role             = aws_iam_role.alerts_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("alerts.zip") ? filebase64sha256("alerts.zip") : null
+  timeout          = 30
+  memory_size      = 128
+
+  environment {
+    variables = {
+      POLICY_TABLE_NAME = aws_dynamodb_table.policy_table.name
+      USAGE_TABLE_NAME  = aws_dynamodb_table.usage_table.name
+      USAGE_EVENT_BUS   = aws_cloudwatch_event_bus.usage.name
+    }
+  }
+}
+
+# Archives records as the logs table's TTL purges them
+resource "aws_lambda_function" "archive_lambda" {
+  count            = var.archive_expired ? 1 : 0
+  filename         = "archive.zip"
+  function_name    = "ExpiryArchive"
+  role             = aws_iam_role.archive_role[0].arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("archive.zip") ? filebase64sha256("archive.zip") : null
   timeout          = 60
   memory_size      = 256
 
   environment {
     variables = {
-      TABLE_NAME = aws_dynamodb_table.logs_table.name
+      ARCHIVE_BUCKET = aws_s3_bucket.archive[0].bucket
+    }
+  }
+}
+
+resource "aws_lambda_event_source_mapping" "archive_trigger" {
+  count                              = var.archive_expired ? 1 : 0
+  event_source_arn                   = aws_dynamodb_table.logs_table.stream_arn
+  function_name                      = aws_lambda_function.archive_lambda[0].arn
+  starting_position                  = "TRIM_HORIZON"
+  batch_size                         = 500
+  maximum_batching_window_in_seconds = 60
+
+  # Only the TTL's own deletions; every other write is dropped before invoking
+  filter_criteria {
+    filter {
+      pattern = jsonencode({
+        eventName    = ["REMOVE"]
+        userIdentity = { type = ["Service"], principalId = ["dynamodb.amazonaws.com"] }
+      })
+    }
+  }
+}
+
+# Carries out erasure requests made through the read API
+resource "aws_lambda_function" "erase_lambda" {
+  filename         = "erase.zip"
+  function_name    = "Erase"
+  role             = aws_iam_role.erase_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("erase.zip") ? filebase64sha256("erase.zip") : null
+  timeout          = 900
+  memory_size      = 256
+
+  environment {
+    variables = {
+      ERASURE_TABLE_NAME        = aws_dynamodb_table.erasure_table.name
+      TABLE_NAME                = aws_dynamodb_table.logs_table.name
+      SHADOW_TABLE_NAME         = aws_dynamodb_table.shadow_table.name
+      JOURNAL_TABLE_NAME        = aws_dynamodb_table.journal_table.name
+      QUARANTINE_TABLE_NAME     = aws_dynamodb_table.quarantine_table.name
+      NEAR_DUPLICATE_TABLE_NAME = aws_dynamodb_table.near_duplicate_table.name
+      TOKEN_VAULT_TABLE_NAME    = aws_dynamodb_table.token_vault.name
+      OPENSEARCH_ENDPOINT       = var.opensearch_endpoint
+    }
+  }
+}
+
+# Writes tenant exports requested through the read API
+resource "aws_lambda_function" "export_lambda" {
+  filename         = "export.zip"
+  function_name    = "Export"
+  role             = aws_iam_role.export_role.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = [var.lambda_architecture]
+  source_code_hash = fileexists("export.zip") ? filebase64sha256("export.zip") : null
+  timeout          = 900
+  memory_size      = 512 # Holds one compressed part
+
+  environment {
+    variables = {
+      EXPORT_TABLE_NAME = aws_dynamodb_table.export_table.name
+      TABLE_NAME        = aws_dynamodb_table.logs_table.name
+      EXPORT_BUCKET     = aws_s3_bucket.exports.bucket
     }
   }
 }
 
+resource "aws_lambda_permission" "bulk_ingest" {
+  statement_id  = "AllowBulkIngestFromS3"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.bulk_ingest_lambda.function_name
+  principal     = "s3.amazonaws.com"
+  source_arn    = aws_s3_bucket.bulk_ingest.arn
+}
+
+resource "aws_lambda_alias" "worker_live" {
+  name             = "live"
+  function_name    = aws_lambda_function.worker_lambda.function_name
+  function_version = aws_lambda_function.worker_lambda.version
+}
+
+resource "aws_lambda_provisioned_concurrency_config" "worker" {
+  count                             = var.worker_provisioned_concurrency > 0 ? 1 : 0
+  function_name                     = aws_lambda_alias.worker_live.function_name
+  qualifier                         = aws_lambda_alias.worker_live.name
+  provisioned_concurrent_executions = var.worker_provisioned_concurrency
+}
+
+# Keeps on-demand environments warm between bursts
+resource "aws_cloudwatch_event_rule" "worker_warmup" {
+  name                = "worker-warmup"
+  schedule_expression = "rate(5 minutes)"
+}
+
+resource "aws_cloudwatch_event_target" "worker_warmup" {
+  rule  = aws_cloudwatch_event_rule.worker_warmup.name
+  arn   = aws_lambda_alias.worker_live.arn
+  input = jsonencode({ warmup = true })
+}
+
+resource "aws_lambda_permission" "worker_warmup" {
+  statement_id  = "AllowWarmupFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.worker_lambda.function_name
+  qualifier     = aws_lambda_alias.worker_live.name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.worker_warmup.arn
+}
+
 # SQS -> Worker Lambda Trigger
 resource "aws_lambda_event_source_mapping" "sqs_trigger" {
   event_source_arn                   = aws_sqs_queue.ingest_queue.arn
-  function_name                      = aws_lambda_function.worker_lambda.arn
+  function_name                      = aws_lambda_alias.worker_live.arn
+  batch_size                         = 5
+  function_response_types            = ["ReportBatchItemFailures"]
+  maximum_batching_window_in_seconds = var.fifo_queue ? null : 0 # Not supported on FIFO queues
+}
+
+resource "aws_lambda_event_source_mapping" "shadow_trigger" {
+  count                              = var.shadow_sample_rate > 0 ? 1 : 0
+  event_source_arn                   = aws_sqs_queue.shadow_queue[0].arn
+  function_name                      = aws_lambda_function.worker_shadow[0].arn
   batch_size                         = 5
   function_response_types            = ["ReportBatchItemFailures"]
   maximum_batching_window_in_seconds = 0
 }
 
+resource "aws_lambda_event_source_mapping" "staging_trigger" {
+  count                              = length(var.staging_tenants) > 0 ? 1 : 0
+  event_source_arn                   = aws_sqs_queue.staging_queue[0].arn
+  function_name                      = aws_lambda_function.worker_staging[0].arn
+  batch_size                         = 5
+  function_response_types            = ["ReportBatchItemFailures"]
+  maximum_batching_window_in_seconds = var.fifo_queue ? null : 0
+}
+
+resource "aws_lambda_event_source_mapping" "priority_trigger" {
+  count                              = var.priority_worker_concurrency > 0 ? 1 : 0
+  event_source_arn                   = aws_sqs_queue.priority_queue[0].arn
+  function_name                      = aws_lambda_function.worker_priority[0].arn
+  batch_size                         = 5
+  function_response_types            = ["ReportBatchItemFailures"]
+  maximum_batching_window_in_seconds = var.fifo_queue ? null : 0
+}
+
 # API GATEWAY
 
 resource "aws_apigatewayv2_api" "http_api" {
@@ -178,9 +2750,10 @@ resource "aws_apigatewayv2_api" "http_api" {
   protocol_type = "HTTP"
 
   cors_configuration {
-    allow_origins = ["*"]
-    allow_methods = ["POST"]
-    allow_headers = ["Content-Type", "X-Tenant-ID"]
+    allow_origins  = ["*"]
+    allow_methods  = ["GET", "POST", "DELETE"]
+    allow_headers  = ["Content-Type", "X-Tenant-ID", "X-Schema", "Authorization", "X-Api-Key", "X-Signature", "X-Cost-Center", "X-Project", "X-Text-Column", "X-Tenant-Column", "X-Encryption", "X-Priority"]
+    expose_headers = ["X-JWS-Signature"]
   }
 }
 
@@ -197,12 +2770,144 @@ resource "aws_apigatewayv2_integration" "lambda_integration" {
   payload_format_version = "2.0"
 }
 
+resource "aws_apigatewayv2_authorizer" "prefilter" {
+  count                             = var.prefilter_authorizer ? 1 : 0
+  api_id                            = aws_apigatewayv2_api.http_api.id
+  name                              = "ingest-prefilter"
+  authorizer_type                   = "REQUEST"
+  authorizer_uri                    = aws_lambda_function.prefilter_lambda[0].invoke_arn
+  authorizer_payload_format_version = "2.0"
+  enable_simple_responses           = true
+  authorizer_result_ttl_in_seconds  = 0 # Size checks differ per request, so nothing is cached
+}
+
 resource "aws_apigatewayv2_route" "ingest_route" {
+  api_id             = aws_apigatewayv2_api.http_api.id
+  route_key          = "POST /ingest"
+  target             = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+  authorization_type = var.prefilter_authorizer ? "CUSTOM" : "NONE"
+  authorizer_id      = var.prefilter_authorizer ? aws_apigatewayv2_authorizer.prefilter[0].id : null
+}
+
+# Further ingest endpoints, all served by the same Lambda's router
+resource "aws_apigatewayv2_route" "ingest_routes" {
+  for_each           = toset(["POST /logs", "POST /logs/batch", "POST /preview"])
+  api_id             = aws_apigatewayv2_api.http_api.id
+  route_key          = each.value
+  target             = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+  authorization_type = var.prefilter_authorizer ? "CUSTOM" : "NONE"
+  authorizer_id      = var.prefilter_authorizer ? aws_apigatewayv2_authorizer.prefilter[0].id : null
+}
+
+resource "aws_apigatewayv2_route" "health_route" {
   api_id    = aws_apigatewayv2_api.http_api.id
-  route_key = "POST /ingest"
+  route_key = "GET /health"
   target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
 }
 
+resource "aws_apigatewayv2_integration" "query_integration" {
+  api_id                 = aws_apigatewayv2_api.http_api.id
+  integration_type       = "AWS_PROXY"
+  integration_uri        = aws_lambda_function.query_lambda.invoke_arn
+  payload_format_version = "2.0"
+}
+
+resource "aws_apigatewayv2_route" "status_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/{log_id}"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "recent_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/recent"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "list_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "search_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/search"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "label_stats_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/labels"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "thread_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/{log_id}/thread"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "delete_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "DELETE /logs/{log_id}"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "export_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "POST /exports"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "export_status_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /exports/{export_id}"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "erase_tenant_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "DELETE /tenants/{tenant_id}/logs"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "erasure_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /erasures/{erasure_id}"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "similar_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/{log_id}/similar"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "receipt_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/{log_id}/receipt"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "original_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /logs/{log_id}/original"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "detokenize_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "POST /detokenize"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "pseudonyms_route" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "POST /pseudonyms"
+  target    = "integrations/${aws_apigatewayv2_integration.query_integration.id}"
+}
+
 resource "aws_lambda_permission" "api_gw" {
   statement_id  = "AllowExecutionFromAPIGateway"
   action        = "lambda:InvokeFunction"
@@ -211,6 +2916,23 @@ resource "aws_lambda_permission" "api_gw" {
   source_arn    = "${aws_apigatewayv2_api.http_api.execution_arn}/*/*"
 }
 
+resource "aws_lambda_permission" "api_gw_prefilter" {
+  count         = var.prefilter_authorizer ? 1 : 0
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.prefilter_lambda[0].function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_apigatewayv2_api.http_api.execution_arn}/authorizers/${aws_apigatewayv2_authorizer.prefilter[0].id}"
+}
+
+resource "aws_lambda_permission" "api_gw_query" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.query_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_apigatewayv2_api.http_api.execution_arn}/*/*"
+}
+
 # EVALUATOR ACCESS (to inspect DB)
 
 resource "aws_iam_user" "evaluator" {
@@ -244,8 +2966,63 @@ resource "aws_iam_user_policy" "evaluator_read_only" {
 # OUTPUTS
 
 output "api_endpoint" {
-  value       = "${aws_apigatewayv2_api.http_api.api_endpoint}/ingest"
-  description = "POST your requests here"
+  value       = "${aws_apigatewayv2_api.http_api.api_endpoint}/logs"
+  description = "POST your requests here (/ingest remains an alias)"
+}
+
+output "status_endpoint" {
+  value       = "${aws_apigatewayv2_api.http_api.api_endpoint}/logs/{log_id}?tenant_id=..."
+  description = "GET a log's status; add &wait=10s to wait for completion"
+}
+
+output "stream_url" {
+  value       = "${aws_lambda_function_url.stream.function_url}?tenant_id=..."
+  description = "Server-sent events of a tenant's processing completions"
+}
+
+output "receipt_key_arn" {
+  value       = aws_kms_key.receipts.arn
+  description = "Verify receipts with this key's public key (aws kms get-public-key)"
+}
+
+output "ack_key_arn" {
+  value       = aws_kms_key.acknowledgements.arn
+  description = "Verify signed acknowledgements (X-JWS-Signature) with this key's public key"
+}
+
+output "quota_alert_topic_arn" {
+  value       = aws_sns_topic.quota_alerts.arn
+  description = "Subscribe tenant webhooks here, filtered on detail.tenant_id"
+}
+
+output "tenant_alert_topic_arn" {
+  value       = aws_sns_topic.tenant_alerts.arn
+  description = "Subscribe tenant webhooks here for alert rules, filtered on detail.tenant_id"
+}
+
+output "ops_alert_topic_arn" {
+  value       = aws_sns_topic.ops_alerts.arn
+  description = "Subscribe operators here for overdue-record alarms"
+}
+
+output "security_alert_topic_arn" {
+  value       = aws_sns_topic.security_alerts.arn
+  description = "SNS topic alarmed whenever a honeypot API key is used or an ingest caller is locked out"
+}
+
+output "honeypot_queue_url" {
+  value       = join("", aws_sqs_queue.honeypot_queue[*].url)
+  description = "Requests made with honeypot API keys, for security review"
+}
+
+output "export_bucket" {
+  value       = aws_s3_bucket.exports.bucket
+  description = "Tenant exports requested through POST /exports"
+}
+
+output "archive_bucket" {
+  value       = join("", aws_s3_bucket.archive[*].bucket)
+  description = "Records purged by the logs table's TTL, when archive_expired is set"
 }
 
 output "dynamodb_table" {
@@ -256,10 +3033,23 @@ output "sqs_queue_url" {
   value = aws_sqs_queue.ingest_queue.url
 }
 
+output "profile_bucket" {
+  value = aws_s3_bucket.profiles.bucket
+}
+
+output "bulk_ingest_bucket" {
+  value       = aws_s3_bucket.bulk_ingest.bucket
+  description = "Upload backfill files as <tenant_id>/<name>; progress is in BulkIngestJobs"
+}
+
 output "dlq_url" {
   value = aws_sqs_queue.dlq.url
 }
 
+output "quarantine_table" {
+  value = aws_dynamodb_table.quarantine_table.name
+}
+
 output "evaluator_access_key" {
   description = "Access Key ID for evaluator"
   value       = aws_iam_access_key.evaluator_key.id
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Message attributes carrying a record's cost tags. They travel beside the
+// LogEvent rather than in it, so the contract above is unchanged.
+const (
+	CostCenterAttribute = "cost_center"
+	ProjectAttribute    = "project"
+)
+
+// tagPattern bounds tag values: they become metric dimensions and key parts
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// CostTags attribute a record's usage to an internal cost center and
+// project, so chargeback can split a shared tenant's usage
+type CostTags struct {
+	CostCenter string `dynamodbav:"cost_center,omitempty"`
+	Project    string `dynamodbav:"project,omitempty"`
+}
+
+// CostTagsFrom reads cost tags from message attributes
+func CostTagsFrom(attributes map[string]string) CostTags {
+	return CostTags{CostCenter: attributes[CostCenterAttribute], Project: attributes[ProjectAttribute]}
+}
+
+// IsZero reports whether no tag is set
+func (t CostTags) IsZero() bool { return t == CostTags{} }
+
+// Validate rejects values that aren't short identifiers
+func (t CostTags) Validate() error {
+	for name, v := range t.Attributes() {
+		if !tagPattern.MatchString(v) {
+			return fmt.Errorf("%s must be 1-64 letters, digits, '_', '.' or '-'", name)
+		}
+	}
+	return nil
+}
+
+// Attributes returns the set tags keyed by message attribute name. It also
+// serves as EMF dimensions.
+func (t CostTags) Attributes() map[string]string {
+	attrs := map[string]string{}
+	if t.CostCenter != "" {
+		attrs[CostCenterAttribute] = t.CostCenter
+	}
+	if t.Project != "" {
+		attrs[ProjectAttribute] = t.Project
+	}
+	return attrs
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// FIFO queues: a queue whose URL ends in .fifo needs a message group and a
+// deduplication id on every message. Messages are grouped by tenant, so each
+// tenant's records are processed in the order they were queued, and
+// deduplicated by log_id, so a resend within SQS's five minute window is
+// dropped before it reaches the worker.
+
+// groupPattern is what SQS accepts as a group or deduplication id
+var groupPattern = regexp.MustCompile("^[!-~]{1,128}$")
+
+// IsFIFO reports whether queueURL names a FIFO queue
+func IsFIFO(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
+
+// FIFOParams returns the MessageGroupId and MessageDeduplicationId for a
+// message sent to queueURL, or nils when it isn't a FIFO queue. Values SQS
+// would refuse are replaced by their hash.
+func FIFOParams(queueURL, tenantID, dedupID string) (group, dedup *string) {
+	if !IsFIFO(queueURL) {
+		return nil, nil
+	}
+	g, d := fifoID(tenantID), fifoID(dedupID)
+	return &g, &d
+}
+
+func fifoID(s string) string {
+	if groupPattern.MatchString(s) {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
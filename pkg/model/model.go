@@ -0,0 +1,88 @@
+// Package model defines the message contract between the ingest and worker
+// Lambdas. The contract is codified twice on purpose, as the LogEvent struct
+// and as logevent.schema.json: ingest validates every message before
+// publishing and the worker validates every message it receives, so a field
+// renamed in either binary fails loudly instead of being read as empty.
+package model
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// LogEvent is the normalized record carried on the processing queue
+type LogEvent struct {
+	TenantID     string `json:"tenant_id"`
+	LogID        string `json:"log_id"`
+	OriginalText string `json:"original_text"`
+	Source       string `json:"source"`
+	// Fields holds format-specific structured values (e.g. access log status)
+	Fields map[string]string `json:"fields,omitempty"`
+	// SchemaID is the tenant schema (name@version) the fields were validated against
+	SchemaID string `json:"schema_id,omitempty"`
+	// ParentID links a sub-document to the record it was submitted with
+	ParentID string `json:"parent_id,omitempty"`
+	// Part is a sub-document's 1-based position among its record's parts
+	Part int `json:"part,omitempty"`
+	// BatchID groups the records split from one uploaded file
+	BatchID string `json:"batch_id,omitempty"`
+	// Shadow marks a mirrored copy that must only reach the shadow table
+	Shadow bool `json:"shadow,omitempty"`
+	// Encryption is ClientEncrypted when the tenant encrypted the text
+	// itself: it is stored as sent and only fields are redacted
+	Encryption string `json:"encryption,omitempty"`
+	// Priority is PriorityHigh for interactive records, which may travel
+	// in their own lane ahead of bulk traffic; empty is PriorityNormal
+	Priority string `json:"priority,omitempty"`
+	// S3Bucket and S3Key locate the original text of a record too large for
+	// an SQS message (the claim check); OriginalText is then empty, and
+	// S3SHA256 is the text's hex SHA-256, which the worker verifies
+	S3Bucket string `json:"s3_bucket,omitempty"`
+	S3Key    string `json:"s3_key,omitempty"`
+	S3SHA256 string `json:"s3_sha256,omitempty"`
+}
+
+// ClientEncrypted is the Encryption of text the tenant encrypted itself
+const ClientEncrypted = "client"
+
+// Priorities a record may be sent with
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+)
+
+// Schema is the JSON Schema every queued message must satisfy. Unknown
+// properties are rejected, so new fields must be added here (and deployed to
+// the worker) before ingest starts sending them.
+//
+//go:embed logevent.schema.json
+var Schema []byte
+
+const schemaURL = "urn:robust-processor:logevent"
+
+var compiled = func() *jsonschema.Schema {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(Schema))
+	if err != nil {
+		panic("model: invalid schema: " + err.Error())
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaURL, doc); err != nil {
+		panic("model: invalid schema: " + err.Error())
+	}
+	return compiler.MustCompile(schemaURL)
+}()
+
+// Validate checks an encoded message against the contract
+func Validate(body []byte) error {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("log event contract: %w", err)
+	}
+	if err := compiled.Validate(doc); err != nil {
+		return fmt.Errorf("log event contract: %w", err)
+	}
+	return nil
+}
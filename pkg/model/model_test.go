@@ -0,0 +1,141 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Every LogEvent field must be in the schema and every schema property in
+// LogEvent, or one side of the queue would drop it
+func TestSchemaMatchesLogEvent(t *testing.T) {
+	var schema struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]bool{}
+	typ := reflect.TypeFor[LogEvent]()
+	for i := range typ.NumField() {
+		name, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("LogEvent.%s (%s) is not in the schema", typ.Field(i).Name, name)
+		}
+		if slices.Contains(schema.Required, name) && opts == "omitempty" {
+			t.Errorf("required property %s is omitempty", name)
+		}
+	}
+	for name := range schema.Properties {
+		if !fields[name] {
+			t.Errorf("schema property %s has no LogEvent field", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	tests := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{"minimal", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload"}`, true},
+		{"fields and schema", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload","fields":{"a":"b"},"schema_id":"order@2"}`, true},
+		{"claim check", `{"tenant_id":"acme","log_id":"l1","original_text":"","source":"text_upload","s3_bucket":"b","s3_key":"k","s3_sha256":"` + sha + `"}`, true},
+		{"missing tenant", `{"log_id":"l1","original_text":"hi","source":"json_upload"}`, false},
+		{"empty tenant", `{"tenant_id":"","log_id":"l1","original_text":"hi","source":"json_upload"}`, false},
+		{"empty text", `{"tenant_id":"acme","log_id":"l1","original_text":"","source":"json_upload"}`, false},
+		{"unknown field", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload","tenant":"acme"}`, false},
+		{"non-string field", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload","fields":{"a":1}}`, false},
+		{"unversioned schema", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload","schema_id":"order"}`, false},
+		{"part zero", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload","parent_id":"p","part":0}`, false},
+		{"unknown priority", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload","priority":"urgent"}`, false},
+		{"unknown encryption", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload","encryption":"server"}`, false},
+		{"claim check with text", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"text_upload","s3_bucket":"b","s3_key":"k","s3_sha256":"` + sha + `"}`, false},
+		{"claim check without hash", `{"tenant_id":"acme","log_id":"l1","original_text":"","source":"text_upload","s3_bucket":"b","s3_key":"k"}`, false},
+		{"bucket without key", `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"text_upload","s3_bucket":"b"}`, false},
+		{"not an object", `["acme"]`, false},
+		{"not JSON", `{"tenant_id":`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.body))
+			if tt.valid && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
+
+// Ingest marshals the event, validates and signs it; the worker verifies,
+// validates and unmarshals the same body and must get the event back
+func TestIngestToWorker(t *testing.T) {
+	key := []byte("pipeline-key")
+	tags := CostTags{CostCenter: "cc-1", Project: "search"}
+	events := []LogEvent{
+		{TenantID: "acme", LogID: "l1", OriginalText: "user a@b.com", Source: "json_upload"},
+		{
+			TenantID: "acme", LogID: "l2", OriginalText: "part", Source: "json_upload",
+			Fields: map[string]string{"status": "500"}, SchemaID: "order@1", ParentID: "l1", Part: 2,
+			BatchID: "b1", Shadow: true, Encryption: ClientEncrypted, Priority: PriorityHigh,
+		},
+		{TenantID: "acme", LogID: "l3", Source: "text_upload", S3Bucket: "claims", S3Key: "acme/l3", S3SHA256: strings.Repeat("0f", 32)},
+	}
+	for _, sent := range events {
+		body, err := json.Marshal(sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Validate(body); err != nil {
+			t.Errorf("%s: ingest payload rejected: %v", sent.LogID, err)
+			continue
+		}
+		signature := Sign(key, string(body), tags)
+
+		if !VerifySignature(key, string(body), tags, signature) {
+			t.Errorf("%s: signature does not verify", sent.LogID)
+		}
+		var received LogEvent
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(received, sent) {
+			t.Errorf("%s: worker read %+v, ingest sent %+v", sent.LogID, received, sent)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	key := []byte("pipeline-key")
+	body := `{"tenant_id":"acme","log_id":"l1","original_text":"hi","source":"json_upload"}`
+	tags := CostTags{CostCenter: "cc-1"}
+	signature := Sign(key, body, tags)
+	tests := []struct {
+		name      string
+		key       []byte
+		body      string
+		tags      CostTags
+		signature string
+	}{
+		{"other key", []byte("other-key"), body, tags, signature},
+		{"other tenant", key, strings.Replace(body, "acme", "evil", 1), tags, signature},
+		{"other tags", key, body, CostTags{CostCenter: "cc-2"}, signature},
+		// Length prefixes keep a value from moving between fields
+		{"tags shifted", key, body, CostTags{Project: "cc-1"}, signature},
+		{"no version", key, body, tags, strings.TrimPrefix(signature, signatureVersion)},
+		{"empty", key, body, tags, ""},
+	}
+	for _, tt := range tests {
+		if VerifySignature(tt.key, tt.body, tt.tags, tt.signature) {
+			t.Errorf("%s: signature verified", tt.name)
+		}
+	}
+}
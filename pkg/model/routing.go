@@ -0,0 +1,34 @@
+package model
+
+import "strconv"
+
+// Routing attributes repeat a few of an event's fields as message
+// attributes, so consumers and event source mapping filters can route
+// messages, say a priority tenant's to a dedicated worker, without parsing
+// bodies. They are informational and not signed: the worker only trusts the
+// body.
+const (
+	TenantIDAttribute = "tenant_id"
+	SourceAttribute   = "source"
+	// ContentLengthAttribute is the byte length of original_text, also for
+	// claim-checked events
+	ContentLengthAttribute = "content_length"
+)
+
+// RoutingAttributes returns an event's routing attributes keyed by name
+func RoutingAttributes(e LogEvent) map[string]string {
+	return map[string]string{
+		TenantIDAttribute:      e.TenantID,
+		SourceAttribute:        e.Source,
+		ContentLengthAttribute: strconv.Itoa(len(e.OriginalText)),
+	}
+}
+
+// AttributeType is the SQS data type a message attribute is sent as.
+// content_length is a Number, so filters can match it with numeric ranges.
+func AttributeType(name string) string {
+	if name == ContentLengthAttribute {
+		return "Number"
+	}
+	return "String"
+}
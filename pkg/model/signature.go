@@ -0,0 +1,44 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+)
+
+// SignatureAttribute is the message attribute carrying a message's HMAC.
+// Ingest signs every message it publishes with the pipeline key and the
+// worker refuses messages whose signature doesn't verify, so queue access
+// alone is not enough to inject records under an arbitrary tenant_id.
+const SignatureAttribute = "signature"
+
+// signatureVersion prefixes signatures, so the scheme can change without
+// every in-flight message failing at once
+const signatureVersion = "v1:"
+
+// Sign returns the signature of a message body and the cost tags sent with
+// it: HMAC-SHA256 over the length-prefixed values
+func Sign(key []byte, body string, tags CostTags) string {
+	return signatureVersion + base64.StdEncoding.EncodeToString(mac(key, body, tags))
+}
+
+// VerifySignature reports whether signature is Sign(key, body, tags)
+func VerifySignature(key []byte, body string, tags CostTags, signature string) bool {
+	encoded, ok := strings.CutPrefix(signature, signatureVersion)
+	if !ok {
+		return false
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	return err == nil && hmac.Equal(sum, mac(key, body, tags))
+}
+
+func mac(key []byte, body string, tags CostTags) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, v := range []string{body, tags.CostCenter, tags.Project} {
+		h.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		h.Write([]byte(v))
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,154 @@
+// Package pii holds the PII rules ingest and the worker share on top of the
+// redaction engine in pkg/redact: tenant event schemas, whose properties
+// marked "x-pii": true are replaced wholesale whatever their content, and
+// how a record's structured fields are redacted. Like pkg/redact it has no
+// AWS dependencies; services fetch schema documents from the registry
+// (EventSchemas) themselves and compile them here.
+package pii
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"robust-processor/pkg/redact"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// ErrInvalidRef is returned for a schema reference that isn't name@version
+var ErrInvalidRef = errors.New("schema reference must be name@version")
+
+// ParseRef splits a schema reference, name@version, as sent in X-Schema and
+// stored as a record's schema_id
+func ParseRef(ref string) (name string, version int, err error) {
+	name, v, ok := strings.Cut(ref, "@")
+	version, convErr := strconv.Atoi(v)
+	if !ok || name == "" || convErr != nil || version < 1 {
+		return "", 0, ErrInvalidRef
+	}
+	return name, version, nil
+}
+
+// RegistryKey is the schema_name a tenant's schema is stored under; schemas
+// are tenant-private
+func RegistryKey(tenantID, name string) string {
+	return tenantID + "#" + name
+}
+
+// ValidationError reports fields that don't satisfy a schema. Its message
+// is safe to return to the caller.
+type ValidationError struct {
+	msg string
+}
+
+func (e ValidationError) Error() string { return e.msg }
+
+const schemaURL = "urn:robust-processor:tenant-schema"
+
+// Schema is a compiled tenant event schema
+type Schema struct {
+	compiled *jsonschema.Schema
+	pii      map[string]bool
+}
+
+// Compile parses a schema document; id names it in errors
+func Compile(id, doc string) (*Schema, error) {
+	parsed, err := jsonschema.UnmarshalJSON(strings.NewReader(doc))
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", id, err)
+	}
+	// Each schema gets its own compiler, so one fixed URL serves them all;
+	// ids like tenant#name@1 would be read as a URL fragment
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaURL, parsed); err != nil {
+		return nil, fmt.Errorf("schema %s: %w", id, err)
+	}
+	compiled, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", id, err)
+	}
+
+	s := &Schema{compiled: compiled, pii: map[string]bool{}}
+	root, _ := parsed.(map[string]interface{})
+	if props, ok := root["properties"].(map[string]interface{}); ok {
+		for name, p := range props {
+			if prop, ok := p.(map[string]interface{}); ok && prop["x-pii"] == true {
+				s.pii[name] = true
+			}
+		}
+	}
+	return s, nil
+}
+
+// Validate checks a record's fields against the schema. Fields are values
+// as encoding/json decodes them into interface{}, so properties typed
+// integer or boolean see the numbers and booleans that were sent rather
+// than their string form; see StringFields for formats without types.
+func (s *Schema) Validate(fields map[string]interface{}) error {
+	err := s.compiled.Validate(fields)
+	var verr *jsonschema.ValidationError
+	if errors.As(err, &verr) {
+		return ValidationError{"Schema validation failed: " + strings.ReplaceAll(verr.Error(), "\n", "; ")}
+	}
+	return err
+}
+
+// StringFields is fields for Validate, for formats whose values are all
+// strings
+func StringFields(fields map[string]string) map[string]interface{} {
+	doc := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		doc[k] = v
+	}
+	return doc
+}
+
+// IsPII reports whether the schema marks field as PII. A nil Schema marks
+// nothing.
+func (s *Schema) IsPII(field string) bool {
+	return s != nil && s.pii[field]
+}
+
+// PIIFields returns the fields the schema marks as PII, in no particular
+// order. A nil Schema marks none.
+func (s *Schema) PIIFields() []string {
+	if s == nil {
+		return nil
+	}
+	fields := make([]string, 0, len(s.pii))
+	for name := range s.pii {
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// RedactFields returns a record's fields as stored: the schema's PII fields
+// replaced by the placeholder, every other field redacted like the text.
+// Redactions are added to counts, when non-nil. schema may be nil.
+func RedactFields(fields map[string]string, r *redact.Redactor, schema *Schema, counts map[string]int) map[string]string {
+	return redactFields(fields, r, schema.IsPII, counts)
+}
+
+// RedactMarkedFields is RedactFields with the PII fields named by marked
+// rather than a schema, for fields that were renamed after validation and
+// carry their mark under the new name
+func RedactMarkedFields(fields map[string]string, r *redact.Redactor, marked map[string]bool, counts map[string]int) map[string]string {
+	return redactFields(fields, r, func(field string) bool { return marked[field] }, counts)
+}
+
+func redactFields(fields map[string]string, r *redact.Redactor, isPII func(string) bool, counts map[string]int) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	redacted := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if isPII(k) {
+			redacted[k] = r.Placeholder()
+			continue
+		}
+		redacted[k] = r.RedactCounting(v, counts)
+	}
+	return redacted
+}
@@ -0,0 +1,182 @@
+package pii
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"testing"
+
+	"robust-processor/pkg/model"
+	"robust-processor/pkg/redact"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"properties": {
+		"order_id": {"type": "string", "pattern": "^ord-[0-9]+$"},
+		"email": {"type": "string", "x-pii": true}
+	},
+	"required": ["order_id"]
+}`
+
+// Registry keys hold a '#', which the compiler would read as a URL
+// fragment if the key named the resource
+func TestCompileRegistryKey(t *testing.T) {
+	id := RegistryKey("acme_corp", "order") + "@1"
+	s, err := Compile(id, orderSchema)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", id, err)
+	}
+	if err := s.Validate(map[string]interface{}{"order_id": "ord-42"}); err != nil {
+		t.Errorf("valid record rejected: %v", err)
+	}
+	var verr ValidationError
+	if err := s.Validate(map[string]interface{}{"order_id": "42"}); !errors.As(err, &verr) {
+		t.Errorf("invalid record: got %v, want ValidationError", err)
+	}
+	if !s.IsPII("email") || s.IsPII("order_id") {
+		t.Errorf("x-pii fields not picked up: %v", s.pii)
+	}
+}
+
+// Schemas type fields as sent in JSON, not as the strings they are
+// queued as
+func TestValidateTypes(t *testing.T) {
+	s, err := Compile("cart@1", `{
+		"type": "object",
+		"properties": {"quantity": {"type": "integer"}, "gift": {"type": "boolean"}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fields string
+		valid  bool
+	}{
+		{`{"quantity": 3, "gift": true}`, true},
+		{`{"quantity": 3.0}`, true},
+		{`{"quantity": "3"}`, false},
+		{`{"quantity": 2.5}`, false},
+		{`{"gift": "true"}`, false},
+	}
+	for _, tt := range tests {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.fields), &fields); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Validate(fields); (err == nil) != tt.valid {
+			t.Errorf("Validate(%s) = %v, want valid %v", tt.fields, err, tt.valid)
+		}
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		name    string
+		version int
+	}{
+		{"order@1", "order", 1},
+		{"order.v2@12", "order.v2", 12},
+		{"a@b@3", "", 0},
+		{"order", "", 0},
+		{"order@", "", 0},
+		{"@1", "", 0},
+		{"order@0", "", 0},
+		{"order@-1", "", 0},
+		{"order@x", "", 0},
+	}
+	for _, tt := range tests {
+		name, version, err := ParseRef(tt.ref)
+		if tt.name == "" {
+			if !errors.Is(err, ErrInvalidRef) {
+				t.Errorf("ParseRef(%q) = %q, %d, %v; want ErrInvalidRef", tt.ref, name, version, err)
+			}
+			continue
+		}
+		if err != nil || name != tt.name || version != tt.version {
+			t.Errorf("ParseRef(%q) = %q, %d, %v; want %q, %d", tt.ref, name, version, err, tt.name, tt.version)
+		}
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	s, err := Compile("order@1", orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := redact.Compile(redact.Policy{Placeholders: map[string]string{"phone": "<phone>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{
+		"order_id": "ord-1",
+		// x-pii: replaced whatever it holds
+		"email": "not an address",
+		"note":  "call 800-555-0199 or mail a@b.com",
+	}
+	counts := map[string]int{}
+	got := RedactFields(fields, r, s, counts)
+	want := map[string]string{
+		"order_id": "ord-1",
+		"email":    redact.Placeholder,
+		"note":     "call <phone> or mail [REDACTED]",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if counts["phone"] != 1 || counts["email"] != 1 || len(counts) != 2 {
+		t.Errorf("counts = %v", counts)
+	}
+	if fields["email"] != "not an address" {
+		t.Error("input fields modified")
+	}
+
+	// Without a schema every field is redacted like the text
+	if got := RedactFields(map[string]string{"email": "a@b.com"}, redact.Default, nil, nil); got["email"] != redact.Placeholder {
+		t.Errorf("no schema: got %v", got)
+	}
+	if got := RedactFields(nil, redact.Default, s, nil); got != nil {
+		t.Errorf("no fields: got %v", got)
+	}
+}
+
+// Ingest validates a record's fields and publishes them with its schema_id;
+// the worker reads the event, resolves the same schema from schema_id and
+// redacts the fields. Both sides must agree on the schema and its PII.
+func TestSchemaRoundTrip(t *testing.T) {
+	id := RegistryKey("acme_corp", "order") + "@1"
+	ingest, err := Compile(id, orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := model.LogEvent{
+		TenantID: "acme_corp", LogID: "l1", OriginalText: "order placed", Source: "json_upload",
+		Fields:   map[string]string{"order_id": "ord-7", "email": "jane@example.com"},
+		SchemaID: "order@1",
+	}
+	if err := ingest.Validate(StringFields(sent.Fields)); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	body, _ := json.Marshal(sent)
+	if err := model.Validate(body); err != nil {
+		t.Fatalf("contract: %v", err)
+	}
+
+	var received model.LogEvent
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatal(err)
+	}
+	name, version, err := ParseRef(received.SchemaID)
+	if err != nil || name != "order" || version != 1 {
+		t.Fatalf("worker: ParseRef(%q) = %q, %d, %v", received.SchemaID, name, version, err)
+	}
+	worker, err := Compile(RegistryKey(received.TenantID, name)+"@1", orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := RedactFields(received.Fields, redact.Default, worker, nil)
+	if stored["email"] != redact.Placeholder || stored["order_id"] != "ord-7" {
+		t.Errorf("worker stored %v", stored)
+	}
+}
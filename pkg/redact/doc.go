@@ -0,0 +1,35 @@
+// Package redact is the pipeline's PII detection and redaction engine as a
+// standalone library. It has no AWS or service dependencies, so any Go
+// service can scrub text in-process exactly as the worker does before
+// storage.
+//
+// The built-in detectors find phone numbers, SSNs, email addresses and
+// credit card numbers (13-19 digits passing the Luhn check). IPv4 addresses
+// are found only by policies that enable the opt-in ip detector, as dotted
+// version numbers look the same:
+//
+//	redact.Redact("call 800-555-0199")    // "call [REDACTED]"
+//	redact.Detect("mail ops@example.com") // [{email 5 20 5 20}]
+//
+// A Policy adds custom patterns, a profanity filter, format-preserving masks
+// and custom placeholders. Compile it once and reuse the Redactor:
+//
+//	r, err := redact.Compile(redact.Policy{
+//		CustomPatterns: []redact.CustomPattern{{Name: "order", Pattern: `ORD-\d{6}`}},
+//		Placeholders:   map[string]string{"email": "<email>"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	r.Redact("ORD-123456 for jane@example.com") // "[REDACTED] for <email>"
+//
+// Overlapping matches are resolved before anything is replaced: the higher
+// detector priority wins, then the longer match, then the detector name; a
+// match nested inside the winner is dropped, and whatever a losing match
+// covers beyond it is redacted separately, so no matched text survives.
+// Results never depend on detector registration order. Match offsets are
+// given in bytes and in code points and always fall between characters.
+// Placeholders already present in the input are escaped with a backslash,
+// so redacted output is never ambiguous: a token preceded by an odd number
+// of backslashes is literal input, anything else marks a redaction.
+package redact
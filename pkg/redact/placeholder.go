@@ -0,0 +1,121 @@
+package redact
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTokenLength bounds tenant-defined placeholder tokens
+const maxTokenLength = 64
+
+// applyPlaceholders sets the policy's default and per-detector tokens on r
+// and rejects any set of tokens that would make redacted
+// output ambiguous. A token must:
+//   - contain a character other than letters, digits and spaces, so it
+//     can't be mistaken for ordinary words;
+//   - not be matched by any of the policy's detectors;
+//   - be valid UTF-8, so an occurrence can't start inside a character;
+//   - not contain a backslash, which is reserved for escaping;
+//   - not equal, contain or be contained in another detector's token.
+func applyPlaceholders(compiled *Redactor, policy Policy) error {
+	compiled.placeholder = Placeholder
+	if policy.Placeholder != "" {
+		compiled.placeholder = policy.Placeholder
+	}
+
+	for name, token := range policy.Placeholders {
+		found := false
+		for i := range compiled.detectors {
+			if compiled.detectors[i].name == name {
+				compiled.detectors[i].token = token
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("placeholder for unknown detector %q", name)
+		}
+	}
+
+	owners := map[string]string{compiled.placeholder: "default"}
+	compiled.tokens = []string{compiled.placeholder}
+	for _, d := range compiled.detectors {
+		if d.token == "" {
+			continue
+		}
+		if owner, ok := owners[d.token]; ok {
+			return fmt.Errorf("placeholder %q for %s already used by %s", d.token, d.name, owner)
+		}
+		owners[d.token] = d.name
+		compiled.tokens = append(compiled.tokens, d.token)
+	}
+
+	for i, token := range compiled.tokens {
+		if err := validateToken(token, compiled.detectors); err != nil {
+			return err
+		}
+		for _, other := range compiled.tokens[:i] {
+			if strings.Contains(token, other) || strings.Contains(other, token) {
+				return fmt.Errorf("placeholder %q overlaps %q", token, other)
+			}
+		}
+	}
+	return nil
+}
+
+func validateToken(token string, detectors []detector) error {
+	if token == "" || len(token) > maxTokenLength {
+		return fmt.Errorf("placeholder %q must be 1-%d bytes", token, maxTokenLength)
+	}
+	if !utf8.ValidString(token) {
+		return fmt.Errorf("placeholder %q must be valid UTF-8", token)
+	}
+	if strings.Contains(token, `\`) {
+		return fmt.Errorf("placeholder %q must not contain a backslash", token)
+	}
+	if !strings.ContainsFunc(token, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	}) {
+		return fmt.Errorf("placeholder %q must contain punctuation or a symbol", token)
+	}
+	for _, d := range detectors {
+		if d.pattern.MatchString(token) {
+			return fmt.Errorf("placeholder %q is matched by detector %s", token, d.name)
+		}
+	}
+	return nil
+}
+
+// escapeSpans appends a span for every occurrence of a token already present
+// in the text, extended back over any backslashes right before it. Escaped
+// output doubles those backslashes and adds one more, so a reader can tell
+// tokens apart: a token preceded by an odd number of backslashes is literal
+// input, an even number (usually none) marks a redaction.
+func escapeSpans(text string, tokens []string, spans []span) []span {
+	for _, token := range tokens {
+		for offset := 0; ; {
+			i := strings.Index(text[offset:], token)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			end := start + len(token)
+			for start > 0 && text[start-1] == '\\' {
+				start--
+			}
+			spans = append(spans, span{start: start, end: end, det: -1})
+			offset = end
+		}
+	}
+	return spans
+}
+
+// writeEscaped writes an escape span: its leading backslashes doubled, one
+// more backslash, then the token itself
+func writeEscaped(b *strings.Builder, match string) {
+	token := strings.TrimLeft(match, `\`)
+	n := len(match) - len(token)
+	b.WriteString(strings.Repeat(`\`, 2*n+1))
+	b.WriteString(token)
+}
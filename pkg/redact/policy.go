@@ -0,0 +1,323 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Placeholder is the default token written in place of a match
+const Placeholder = "[REDACTED]"
+
+// Policy configures a Redactor. The zero Policy runs the built-in detectors
+// (phone, ssn, email, credit_card) and writes Placeholder for every match.
+// Field tags let services load policies straight from JSON or DynamoDB.
+type Policy struct {
+	// DisabledDetectors names built-in detectors the policy does not run
+	DisabledDetectors []string `json:"disabled_detectors,omitempty" dynamodbav:"disabled_detectors"`
+	// EnabledDetectors names opt-in detectors the policy also runs: ip,
+	// which finds IPv4 addresses but also dotted version numbers like 1.2.3.4
+	EnabledDetectors []string `json:"enabled_detectors,omitempty" dynamodbav:"enabled_detectors"`
+	// CustomPatterns are redacted in addition to the built-ins
+	CustomPatterns []CustomPattern `json:"custom_patterns,omitempty" dynamodbav:"custom_patterns"`
+	Profanity      ProfanityFilter `json:"profanity,omitempty" dynamodbav:"profanity"`
+	// PreserveFormat masks matches character by character instead of writing
+	// [REDACTED], keeping punctuation and column positions intact
+	PreserveFormat bool `json:"preserve_format,omitempty" dynamodbav:"preserve_format"`
+	// Placeholder replaces [REDACTED] as the default token
+	Placeholder string `json:"placeholder,omitempty" dynamodbav:"placeholder"`
+	// Placeholders sets the token for individual detectors, keyed by name
+	Placeholders map[string]string `json:"placeholders,omitempty" dynamodbav:"placeholders"`
+}
+
+// CustomPattern is a named regex (RE2 syntax) redacted like a built-in
+type CustomPattern struct {
+	Name    string `json:"name" dynamodbav:"name"`
+	Pattern string `json:"pattern" dynamodbav:"pattern"`
+	// Token replaces the pattern's matches; it is validated like any entry
+	// of Policy.Placeholders, which must not also set one for this pattern
+	Token string `json:"token,omitempty" dynamodbav:"token"`
+	// Priority ranks the pattern's matches against overlapping ones; see
+	// the Priority constants
+	Priority int `json:"priority,omitempty" dynamodbav:"priority"`
+}
+
+// Priorities of the built-in detectors. Where matches overlap, the higher
+// priority wins, then the longer match, then the detector name, so results
+// never depend on the order detectors are registered in. Custom patterns
+// default to PriorityCustom, below every built-in: an email inside a URL
+// pattern is still redacted as an email. Profanity ranks lowest.
+const (
+	PriorityCard      = 50
+	PrioritySSN       = 40
+	PriorityEmail     = 30
+	PriorityPhone     = 20
+	PriorityIP        = 20
+	PriorityCustom    = 0
+	PriorityProfanity = -10
+)
+
+// IsDefault reports whether the policy configures nothing beyond the
+// built-ins, i.e. whether Default applies it
+func (p Policy) IsDefault() bool {
+	return len(p.DisabledDetectors) == 0 && len(p.EnabledDetectors) == 0 && len(p.CustomPatterns) == 0 && !p.Profanity.Enabled &&
+		!p.PreserveFormat && p.Placeholder == "" && len(p.Placeholders) == 0
+}
+
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	// anyOf lists bytes of which at least one must appear for the pattern to
+	// possibly match; texts without any are skipped without running the regex
+	anyOf string
+	// token is written in place of a match when set; otherwise replace
+	// computes it, and if both are unset the policy default applies
+	token   string
+	replace func(match string) string
+	// priority ranks overlapping matches, highest first
+	priority int
+	// wholeWords drops matches that don't start and end on a word boundary
+	// (see isWordBoundary)
+	wholeWords bool
+	// refine, when set, returns the parts of each pattern match to redact,
+	// as offsets into the match; otherwise the whole match is redacted
+	refine func(match string) [][2]int
+	// regions, when set, returns the ranges of text the pattern can match
+	// in, each with a byte of context either side for \b; the pattern then
+	// runs over those alone instead of the whole text
+	regions func(text string) [][2]int
+}
+
+// Built-in PII patterns
+var (
+	phonePattern = regexp.MustCompile(`\b\d{3}[-.]?\d{3}[-.]?\d{4}\b`)
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	emailPattern = regexp.MustCompile(`\b[\w.-]+@[\w.-]+\.\w+\b`)
+	// IPv4Pattern is the ip detector's pattern, for services that must find
+	// exactly the addresses it redacts
+	IPv4Pattern = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`)
+	// Runs of at least 13 digits in groups separated by single spaces or
+	// dashes, the shortest that can hold a card number; cardNumbers picks
+	// the card numbers out of each. Shorter runs never reach the Luhn check.
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,}\b`)
+)
+
+// builtinDetectors run for every policy, in this order, ahead of custom patterns
+var builtinDetectors = []detector{
+	{name: "phone", pattern: phonePattern, anyOf: digits, priority: PriorityPhone},
+	{name: "ssn", pattern: ssnPattern, anyOf: digits, priority: PrioritySSN},
+	{name: "email", pattern: emailPattern, anyOf: "@", priority: PriorityEmail},
+	cardDetector,
+}
+
+var cardDetector = detector{name: "credit_card", pattern: cardPattern, anyOf: digits, priority: PriorityCard, refine: cardNumbers, regions: cardRegions}
+
+// optionalDetectors run only for policies that enable them
+var optionalDetectors = []detector{
+	{name: "ip", pattern: IPv4Pattern, anyOf: ".", priority: PriorityIP},
+}
+
+// cardRegions returns the runs of digits, spaces and dashes in text that
+// start with a digit and hold at least 13 digits, which are the only places
+// cardPattern can match. A byte scan finds them far faster than the regexp
+// engine scans the whole text, and most texts have none.
+func cardRegions(text string) [][2]int {
+	var regions [][2]int
+	for i := 0; i < len(text); {
+		if text[i] < '0' || text[i] > '9' {
+			i++
+			continue
+		}
+		start, n := i, 0
+		for ; i < len(text); i++ {
+			if c := text[i]; c >= '0' && c <= '9' {
+				n++
+			} else if c != ' ' && c != '-' {
+				break
+			}
+		}
+		if n >= 13 {
+			regions = append(regions, [2]int{max(start-1, 0), min(i+1, len(text))})
+		}
+	}
+	return regions
+}
+
+// cardNumbers returns the card numbers in a run of digit groups: 13-19
+// digits of whole consecutive groups that pass the Luhn check, leftmost
+// first, then longest. Windows rather than the whole run are checked
+// because a card is often next to other numbers ("exp 12 25", an SSN, an
+// IP), which would otherwise make the run fail the check and leak the card.
+func cardNumbers(run string) [][2]int {
+	type group struct{ start, end int }
+	var groups []group
+	for i := 0; i < len(run); {
+		j := i
+		for j < len(run) && run[j] >= '0' && run[j] <= '9' {
+			j++
+		}
+		groups = append(groups, group{i, j})
+		i = j + 1
+	}
+
+	var cards [][2]int
+	for i := 0; i < len(groups); i++ {
+		count, end := 0, -1
+		for j := i; j < len(groups) && count <= 19; j++ {
+			if count += groups[j].end - groups[j].start; count >= 13 && count <= 19 {
+				if window := run[groups[i].start:groups[j].end]; luhn(window) {
+					end = j
+				}
+			}
+		}
+		if end >= 0 {
+			cards = append(cards, [2]int{groups[i].start, groups[end].end})
+			i = end
+		}
+	}
+	return cards
+}
+
+// ContainsCard reports whether text holds a card number the credit_card
+// detector would redact, so services labelling content agree with
+// redaction on what a card number is
+func ContainsCard(text string) bool {
+	if !strings.ContainsAny(text, digits) {
+		return false
+	}
+	for _, m := range cardDetector.find(text) {
+		if len(cardNumbers(text[m[0]:m[1]])) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// luhn reports whether the digits of a card number candidate pass the Luhn
+// checksum, which rules out most order numbers and other digit runs
+func luhn(match string) bool {
+	sum, double := 0, false
+	for i := len(match) - 1; i >= 0; i-- {
+		c := match[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+const digits = "0123456789"
+
+// Default is the Redactor for the zero Policy
+var Default = &Redactor{
+	detectors:   builtinDetectors,
+	placeholder: Placeholder,
+	tokens:      []string{Placeholder},
+}
+
+// Redactor is a compiled Policy. It is immutable and safe for concurrent use;
+// compile once and reuse it, since compiling costs far more than redacting.
+type Redactor struct {
+	detectors      []detector
+	preserveFormat bool
+	// placeholder is the default token; tokens lists every token the policy
+	// can write, whose existing occurrences in the input are escaped
+	placeholder string
+	tokens      []string
+	// tokenize, when set, replaces the placeholder and mask (see WithTokens)
+	tokenize func(detector, match string) string
+}
+
+// Compile builds a Redactor. It fails on any invalid pattern or ambiguous
+// placeholder: redacting with a partial policy would silently leak whatever
+// the broken pattern was meant to catch.
+func Compile(policy Policy) (*Redactor, error) {
+	if policy.IsDefault() {
+		return Default, nil
+	}
+	r := &Redactor{}
+	known := func(detectors []detector, name string) bool {
+		return slices.ContainsFunc(detectors, func(d detector) bool { return d.name == name })
+	}
+	disabled := map[string]bool{}
+	for _, name := range policy.DisabledDetectors {
+		if !known(builtinDetectors, name) && !known(optionalDetectors, name) {
+			return nil, fmt.Errorf("cannot disable unknown detector %q", name)
+		}
+		disabled[name] = true
+	}
+	enabled := map[string]bool{}
+	for _, name := range policy.EnabledDetectors {
+		if !known(optionalDetectors, name) {
+			return nil, fmt.Errorf("cannot enable unknown detector %q", name)
+		}
+		enabled[name] = true
+	}
+	for _, d := range builtinDetectors {
+		if !disabled[d.name] {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	// Disabling an optional detector wins over enabling it
+	for _, d := range optionalDetectors {
+		if enabled[d.name] && !disabled[d.name] {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	for _, custom := range policy.CustomPatterns {
+		re, err := regexp.Compile(custom.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile pattern %q: %w", custom.Name, err)
+		}
+		if custom.Token != "" && policy.Placeholders[custom.Name] != "" {
+			return nil, fmt.Errorf("pattern %q has both a token and a placeholder", custom.Name)
+		}
+		r.detectors = append(r.detectors, detector{name: custom.Name, pattern: re, token: custom.Token, priority: custom.Priority})
+	}
+	if policy.Profanity.Enabled {
+		d, err := compileProfanity(policy.Profanity)
+		if err != nil {
+			return nil, err
+		}
+		r.detectors = append(r.detectors, d)
+	}
+	r.preserveFormat = policy.PreserveFormat
+	if err := applyPlaceholders(r, policy); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Detectors lists the names of the detectors the Redactor runs, in order
+func (r *Redactor) Detectors() []string {
+	names := make([]string, len(r.detectors))
+	for i, d := range r.detectors {
+		names[i] = d.name
+	}
+	return names
+}
+
+// Placeholder is the token the Redactor writes unless a detector has its own
+func (r *Redactor) Placeholder() string {
+	return r.placeholder
+}
+
+// WithTokens returns a Redactor like r that writes tokenize(detector, match)
+// where r writes its placeholder or mask, so that a caller keeping what each
+// token stands for can reverse the redaction. Detectors with a token or
+// replacement of their own keep it, and occurrences of the returned tokens
+// already in the input are not escaped.
+func (r *Redactor) WithTokens(tokenize func(detector, match string) string) *Redactor {
+	t := *r
+	t.tokenize = tokenize
+	return &t
+}
@@ -0,0 +1,102 @@
+package redact
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// profanityToken is the default replacement for the "token" strategy
+const profanityToken = "[PROFANITY]"
+
+//go:embed profanity.txt
+var defaultProfanityList string
+
+// ProfanityFilter scrubs a wordlist from user-generated content in the same
+// pass as PII redaction. Matching is case-insensitive on word boundaries of
+// any script.
+type ProfanityFilter struct {
+	Enabled bool `json:"enabled" dynamodbav:"enabled"`
+	// Words replaces the embedded default list when set
+	Words []string `json:"words,omitempty" dynamodbav:"words"`
+	// Strategy is "token" (default), writing Token in place of the word, or
+	// "mask", which keeps the first letter and stars the rest ("s***")
+	Strategy string `json:"strategy,omitempty" dynamodbav:"strategy"`
+	Token    string `json:"token,omitempty" dynamodbav:"token"`
+}
+
+// compileProfanity builds the detector for a profanity filter
+func compileProfanity(f ProfanityFilter) (detector, error) {
+	words := f.Words
+	if len(words) == 0 {
+		words = parseWordlist(defaultProfanityList)
+	}
+	alternatives := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			alternatives = append(alternatives, wordAlternative(w))
+		}
+	}
+	if len(alternatives) == 0 {
+		return detector{}, fmt.Errorf("profanity filter has no words")
+	}
+	pattern := regexp.MustCompile(`(?i)(?:` + strings.Join(alternatives, "|") + `)`)
+
+	d := detector{name: "profanity", pattern: pattern, priority: PriorityProfanity, wholeWords: true}
+	switch f.Strategy {
+	case "", "token":
+		token := f.Token
+		if token == "" {
+			token = profanityToken
+		}
+		d.token = token
+	case "mask":
+		d.replace = maskWord
+	default:
+		return detector{}, fmt.Errorf("unknown profanity strategy %q", f.Strategy)
+	}
+	return d, nil
+}
+
+// wordAlternative quotes w for the pattern, anchored with \b at each edge
+// that is an ASCII word character. \b is ASCII-only, so it can't anchor
+// edges like the ß of "ßword"; those rely on the detector's Unicode-aware
+// wholeWords check alone, which also rejects the ASCII matches \b wrongly
+// accepts ("ass" in "assé").
+func wordAlternative(w string) string {
+	alt := regexp.QuoteMeta(w)
+	first, _ := utf8.DecodeRuneInString(w)
+	last, _ := utf8.DecodeLastRuneInString(w)
+	if isASCIIWord(first) {
+		alt = `\b` + alt
+	}
+	if isASCIIWord(last) {
+		alt += `\b`
+	}
+	return alt
+}
+
+func isASCIIWord(r rune) bool {
+	return r == '_' || r < utf8.RuneSelf && (r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+}
+
+// parseWordlist reads one entry per line, skipping blanks and # comments
+func parseWordlist(list string) []string {
+	var words []string
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words
+}
+
+// maskWord keeps the first character of a match and stars the rest
+func maskWord(match string) string {
+	_, size := utf8.DecodeRuneInString(match)
+	return match[:size] + strings.Repeat("*", utf8.RuneCountInString(match[size:]))
+}
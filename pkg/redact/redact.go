@@ -0,0 +1,294 @@
+package redact
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// span is a byte range of the input matched by the detector at index det, or
+// an existing token occurrence to escape when det is negative
+type span struct {
+	start, end int
+	det        int
+}
+
+// spanPool recycles span buffers between messages so large documents with
+// many matches don't grow a fresh slice on every call
+var spanPool = sync.Pool{
+	New: func() interface{} {
+		s := make([]span, 0, 64)
+		return &s
+	},
+}
+
+// Match is one redacted range of a text. Start and End are byte offsets,
+// for slicing the Go string; RuneStart and RuneEnd count code points, for
+// callers whose strings index by character. Both always fall on UTF-8
+// sequence boundaries.
+type Match struct {
+	Detector           string
+	Start, End         int
+	RuneStart, RuneEnd int
+}
+
+// Redact applies the built-in detectors with the default placeholder
+func Redact(text string) string {
+	return Default.Redact(text)
+}
+
+// Detect reports what Redact would redact in text
+func Detect(text string) []Match {
+	return Default.Detect(text)
+}
+
+// Redact replaces every match with the policy's placeholder ([REDACTED]
+// unless the policy sets one), an X mask when the policy preserves format, or
+// the detector's own token or replacement. Occurrences of the policy's tokens
+// already in the input are escaped (see escapeSpans). All detectors run
+// against the original text and matches are applied in a single pass, so the
+// output is built with one allocation regardless of how many detectors the
+// policy has, and text with no matches is returned as-is.
+func (r *Redactor) Redact(text string) string {
+	return r.RedactCounting(text, nil)
+}
+
+// RedactCounting is Redact that also adds the number of redactions per
+// detector to counts, when non-nil
+func (r *Redactor) RedactCounting(text string, counts map[string]int) string {
+	buf := spanPool.Get().(*[]span)
+	spans := collectSpans(text, r, (*buf)[:0])
+	defer func() {
+		*buf = spans[:0]
+		spanPool.Put(buf)
+	}()
+
+	if len(spans) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+	last := 0
+	for _, s := range spans {
+		b.WriteString(text[last:s.start])
+		match := text[s.start:s.end]
+		if s.det < 0 {
+			writeEscaped(&b, match)
+			last = s.end
+			continue
+		}
+		d := r.detectors[s.det]
+		if counts != nil {
+			counts[d.name]++
+		}
+		switch {
+		case d.token != "":
+			b.WriteString(d.token)
+		case d.replace != nil:
+			b.WriteString(d.replace(match))
+		case r.tokenize != nil:
+			b.WriteString(r.tokenize(d.name, match))
+		case r.preserveFormat:
+			writeMasked(&b, match)
+		default:
+			b.WriteString(r.placeholder)
+		}
+		last = s.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Detect reports the ranges Redact replaces, in order and non-overlapping,
+// each attributed to the detector that won it (see resolveOverlaps)
+func (r *Redactor) Detect(text string) []Match {
+	buf := spanPool.Get().(*[]span)
+	spans := collectSpans(text, r, (*buf)[:0])
+	defer func() {
+		*buf = spans[:0]
+		spanPool.Put(buf)
+	}()
+
+	// Spans are sorted, so code points are counted in one pass over text
+	var matches []Match
+	pos, runes := 0, 0
+	runeOffset := func(offset int) int {
+		runes += utf8.RuneCountInString(text[pos:offset])
+		pos = offset
+		return runes
+	}
+	for _, s := range spans {
+		if s.det >= 0 {
+			m := Match{Detector: r.detectors[s.det].name, Start: s.start, End: s.end}
+			m.RuneStart = runeOffset(s.start)
+			m.RuneEnd = runeOffset(s.end)
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// writeMasked writes match with every letter and digit replaced by X, so
+// punctuation, whitespace and the character count survive redaction
+// (800-555-0199 becomes XXX-XXX-XXXX). One X replaces a whole multi-byte
+// letter; bytes that aren't valid UTF-8 are copied as they are.
+func writeMasked(b *strings.Builder, match string) {
+	for i, r := range match {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteByte('X')
+		case r == utf8.RuneError:
+			_, size := utf8.DecodeRuneInString(match[i:])
+			b.WriteString(match[i : i+size])
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// collectSpans appends the matches of every detector to spans, sorted by
+// start offset and non-overlapping (see resolveOverlaps). Escapes that
+// overlap a match are absorbed into it: redaction takes precedence.
+func collectSpans(text string, r *Redactor, spans []span) []span {
+	spans = escapeSpans(text, r.tokens, spans)
+	escapes := len(spans)
+	for i, d := range r.detectors {
+		if d.anyOf != "" && !strings.ContainsAny(text, d.anyOf) {
+			continue
+		}
+		for _, m := range d.find(text) {
+			if d.wholeWords && !(isWordBoundary(text, m[0]) && isWordBoundary(text, m[1])) {
+				continue
+			}
+			if d.refine != nil {
+				for _, part := range d.refine(text[m[0]:m[1]]) {
+					spans = append(spans, span{start: m[0] + part[0], end: m[0] + part[1], det: i})
+				}
+				continue
+			}
+			spans = append(spans, span{start: m[0], end: m[1], det: i})
+		}
+	}
+	if len(spans) < 2 {
+		return spans
+	}
+
+	if matches := spans[escapes:]; overlapping(matches) {
+		resolved := resolveOverlaps(matches, r.detectors)
+		spans = append(spans[:escapes], resolved...)
+	}
+	slices.SortFunc(spans, func(a, b span) int { return a.start - b.start })
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s.start < last.end {
+			last.end = max(last.end, s.end)
+			if last.det < 0 {
+				last.det = s.det
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// find returns the detector's pattern matches in text, searching only its
+// regions when it has them
+func (d detector) find(text string) [][]int {
+	if d.regions == nil {
+		return d.pattern.FindAllStringIndex(text, -1)
+	}
+	var matches [][]int
+	for _, r := range d.regions(text) {
+		for _, m := range d.pattern.FindAllStringIndex(text[r[0]:r[1]], -1) {
+			m[0], m[1] = m[0]+r[0], m[1]+r[0]
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// isWordBoundary reports whether offset in text separates a word from a
+// non-word, with letters, digits and marks of any script counting as word
+// characters. RE2's \b only knows ASCII, so it finds "ass" in "assé".
+func isWordBoundary(text string, offset int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:offset])
+	after, _ := utf8.DecodeRuneInString(text[offset:])
+	return isWordRune(before) != isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// overlapping sorts matches by start and reports whether any two overlap
+func overlapping(matches []span) bool {
+	slices.SortFunc(matches, func(a, b span) int { return a.start - b.start })
+	end := 0
+	for i, m := range matches {
+		if i > 0 && m.start < end {
+			return true
+		}
+		end = max(end, m.end)
+	}
+	return false
+}
+
+// resolveOverlaps makes matches disjoint in one deterministic pass. Matches
+// are ranked by detector priority, then longest first, then by detector
+// name and start, so the result is the same whatever order detectors were
+// registered in; each keeps only the bytes no higher-ranked match has
+// claimed. A match nested in a winner therefore disappears, while the part
+// of a partial overlap (or of an enclosing lower-priority match) outside the
+// winner is still redacted, by its own detector. No matched byte is ever
+// left in the clear.
+func resolveOverlaps(matches []span, detectors []detector) []span {
+	ranked := slices.Clone(matches)
+	slices.SortFunc(ranked, func(a, b span) int {
+		da, db := &detectors[a.det], &detectors[b.det]
+		if da.priority != db.priority {
+			return db.priority - da.priority
+		}
+		if la, lb := a.end-a.start, b.end-b.start; la != lb {
+			return lb - la
+		}
+		if c := strings.Compare(da.name, db.name); c != 0 {
+			return c
+		}
+		return a.start - b.start
+	})
+
+	// claimed is disjoint and sorted by start
+	claimed := make([]span, 0, len(ranked))
+	var seg []span
+	for _, m := range ranked {
+		// The claimed spans m overlaps are claimed[i:j]
+		i, _ := slices.BinarySearchFunc(claimed, m.start, func(c span, start int) int {
+			if c.end <= start {
+				return -1
+			}
+			return 1
+		})
+		j := i
+		seg = seg[:0]
+		for pos := m.start; ; j++ {
+			if j == len(claimed) || claimed[j].start >= m.end {
+				if pos < m.end {
+					seg = append(seg, span{start: pos, end: m.end, det: m.det})
+				}
+				break
+			}
+			if pos < claimed[j].start {
+				seg = append(seg, span{start: pos, end: claimed[j].start, det: m.det})
+			}
+			seg = append(seg, claimed[j])
+			pos = claimed[j].end
+		}
+		claimed = slices.Replace(claimed, i, j, seg...)
+	}
+	return claimed
+}
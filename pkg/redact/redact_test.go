@@ -0,0 +1,274 @@
+package redact
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// overlapPolicy has custom patterns that overlap the built-ins and each other
+var overlapPolicy = Policy{
+	CustomPatterns: []CustomPattern{
+		{Name: "url", Pattern: `https?://\S+`},
+		{Name: "digit_run", Pattern: `\d[\d -]{6,}\d`},
+		{Name: "account", Pattern: `ACCT-\d+`, Priority: PriorityCard + 10},
+		{Name: "ticket", Pattern: `T-\d{3}-\d{2}-\d{4}`, Priority: PrioritySSN},
+	},
+	Profanity:        ProfanityFilter{Enabled: true},
+	EnabledDetectors: []string{"ip"},
+}
+
+var overlapTexts = []string{
+	"card 4111 1111 1111 1111 exp 12 25",
+	"card 4111 1111 1111 1111 99 ok",
+	"see https://example.com/?u=jane@example.com now",
+	"call 800-555-0199 or 123-45-6789",
+	"ACCT-4111111111111111 on file",
+	"T-123-45-6789 reopened",
+	"ssn 123-45-6789 from 10.0.0.1 damn",
+	"mail ops@example.com, ops@example.com!",
+	"nothing to see here",
+}
+
+func TestOverlapPriority(t *testing.T) {
+	r, err := Compile(overlapPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want []Match
+	}{
+		// credit_card outranks a custom digit run; what the run covers
+		// beyond the card is still redacted, as the run
+		{"card 4111 1111 1111 1111 99 ok", []Match{
+			{"credit_card", 5, 24, 5, 24},
+			{"digit_run", 24, 27, 24, 27},
+		}},
+		// email outranks a custom URL pattern around it
+		{"see https://example.com/?u=jane@example.com now", []Match{
+			{"url", 4, 27, 4, 27},
+			{"email", 27, 43, 27, 43},
+		}},
+		// A custom pattern with a higher priority wins over the card in it
+		{"ACCT-4111111111111111 on file", []Match{{"account", 0, 21, 0, 21}}},
+		// At equal priority the longer match wins: the ticket over the SSN
+		{"T-123-45-6789 reopened", []Match{{"ticket", 0, 13, 0, 13}}},
+	}
+	for _, tt := range tests {
+		if got := r.Detect(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Detect(%q) =\n%v, want\n%v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// Shuffling the detectors, as registering them in another order would,
+// must not change what is redacted or which detector gets the credit
+func TestRegistrationOrderIndependence(t *testing.T) {
+	base, err := Compile(overlapPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range 200 {
+		shuffled := *base
+		shuffled.detectors = slices.Clone(base.detectors)
+		rng.Shuffle(len(shuffled.detectors), func(a, b int) {
+			shuffled.detectors[a], shuffled.detectors[b] = shuffled.detectors[b], shuffled.detectors[a]
+		})
+		for _, text := range overlapTexts {
+			if got, want := shuffled.Redact(text), base.Redact(text); got != want {
+				t.Fatalf("order %d %v: Redact(%q) = %q, want %q", i, shuffled.Detectors(), text, got, want)
+			}
+			if got, want := shuffled.Detect(text), base.Detect(text); !reflect.DeepEqual(got, want) {
+				t.Fatalf("order %d %v: Detect(%q) = %v, want %v", i, shuffled.Detectors(), text, got, want)
+			}
+		}
+	}
+}
+
+// The same holds for custom patterns listed in another order in the policy
+func TestCustomPatternOrderIndependence(t *testing.T) {
+	reversed := overlapPolicy
+	reversed.CustomPatterns = slices.Clone(overlapPolicy.CustomPatterns)
+	slices.Reverse(reversed.CustomPatterns)
+	a, err := Compile(overlapPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Compile(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range overlapTexts {
+		if got, want := b.Redact(text), a.Redact(text); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestMultiByteOffsets(t *testing.T) {
+	r, err := Compile(Policy{EnabledDetectors: []string{"ip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		text string
+		want []Match
+		out  string
+	}{
+		{"cjk", "邮件jane@example.com谢谢", []Match{{"email", 6, 22, 2, 18}}, "邮件[REDACTED]谢谢"},
+		{"emoji", "📞 800-555-0199 👍", []Match{{"phone", 5, 17, 2, 14}}, "📞 [REDACTED] 👍"},
+		{"accents", "Ünïcödé 10.0.0.1 and café 123-45-6789", []Match{
+			{"ip", 12, 20, 8, 16},
+			{"ssn", 31, 42, 26, 37},
+		}, "Ünïcödé [REDACTED] and café [REDACTED]"},
+		{"combining marks", "émail a@b.com", []Match{{"email", 8, 15, 7, 14}}, "émail [REDACTED]"},
+		{"invalid bytes", "\xff\xfe 800-555-0199", []Match{{"phone", 3, 15, 3, 15}}, "\xff\xfe [REDACTED]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.Detect(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Detect = %v, want %v", got, tt.want)
+			}
+			runes := []rune(tt.text)
+			for _, m := range got {
+				if !utf8.RuneStart(tt.text[m.Start]) || m.End < len(tt.text) && !utf8.RuneStart(tt.text[m.End]) {
+					t.Errorf("%v splits a UTF-8 sequence", m)
+				}
+				if utf8.ValidString(tt.text) && string(runes[m.RuneStart:m.RuneEnd]) != tt.text[m.Start:m.End] {
+					t.Errorf("%v: rune range %q, byte range %q", m, string(runes[m.RuneStart:m.RuneEnd]), tt.text[m.Start:m.End])
+				}
+			}
+			if out := r.Redact(tt.text); out != tt.out {
+				t.Errorf("Redact = %q, want %q", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestMultiByteProfanity(t *testing.T) {
+	r, err := Compile(Policy{Profanity: ProfanityFilter{Enabled: true, Words: []string{"damn", "ßwort", "merdé"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ text, want string }{
+		{"damn it", "[PROFANITY] it"},
+		// RE2's \b would find these inside longer words
+		{"damné", "damné"},
+		{"ädamn", "ädamn"},
+		{"ßwort!", "[PROFANITY]!"},
+		{"aßwort", "aßwort"},
+		{"MERDÉ, merdé", "[PROFANITY], [PROFANITY]"},
+		{"merdés", "merdés"},
+		{"日本damn語", "日本damn語"},
+		{"🙄 damn 🙄", "🙄 [PROFANITY] 🙄"},
+	}
+	for _, tt := range tests {
+		if got := r.Redact(tt.text); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMultiByteMasks(t *testing.T) {
+	r, err := Compile(Policy{
+		PreserveFormat: true,
+		CustomPatterns: []CustomPattern{{Name: "name", Pattern: `名前:\S+`}, {Name: "raw", Pattern: `id=\S+`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ text, want string }{
+		{"call 800-555-0199", "call XXX-XXX-XXXX"},
+		// One X per letter, however many bytes it takes; invalid bytes kept
+		{"名前:山田太郎 ok", "XX:XXXX ok"},
+		{"id=ab\xffcd", "XX=XX\xffXX"},
+	}
+	for _, tt := range tests {
+		got := r.Redact(tt.text)
+		if got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if utf8.ValidString(tt.text) && !utf8.ValidString(got) {
+			t.Errorf("Redact(%q) = %q is not valid UTF-8", tt.text, got)
+		}
+	}
+}
+
+func TestPlaceholderMustBeValidUTF8(t *testing.T) {
+	if _, err := Compile(Policy{Placeholder: "[\xe2\x80]"}); err == nil {
+		t.Error("placeholder with a truncated sequence accepted")
+	}
+	if _, err := Compile(Policy{Placeholder: "«秘密»"}); err != nil {
+		t.Errorf("multi-byte placeholder rejected: %v", err)
+	}
+}
+
+// ip is opt-in: the default policy leaves dotted numbers alone
+func TestIPOptIn(t *testing.T) {
+	const text = "upgraded to 1.2.3.4 from 10.0.0.1"
+	if got := Redact(text); got != text {
+		t.Errorf("default Redact(%q) = %q", text, got)
+	}
+	r, err := Compile(Policy{EnabledDetectors: []string{"ip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Redact(text), "upgraded to [REDACTED] from [REDACTED]"; got != want {
+		t.Errorf("Redact(%q) = %q, want %q", text, got, want)
+	}
+	// Disabling wins, and disabling ip without enabling it is no error
+	r, err = Compile(Policy{EnabledDetectors: []string{"ip"}, DisabledDetectors: []string{"ip"}})
+	if err != nil || slices.Contains(r.Detectors(), "ip") {
+		t.Errorf("enabled and disabled ip: detectors %v, err %v", r.Detectors(), err)
+	}
+	if _, err := Compile(Policy{DisabledDetectors: []string{"ip"}}); err != nil {
+		t.Errorf("disabling ip: %v", err)
+	}
+	if _, err := Compile(Policy{EnabledDetectors: []string{"email"}}); err == nil {
+		t.Error("enabling a detector that always runs accepted")
+	}
+}
+
+// Searching only cardRegions finds exactly what searching the whole text does
+func TestCardRegions(t *testing.T) {
+	card := cardDetector
+	rng := rand.New(rand.NewPCG(3, 4))
+	const alphabet = "0123456789012345678901234567890123456789  --a._é"
+	for range 2000 {
+		b := make([]byte, rng.IntN(80))
+		for i := range b {
+			b[i] = alphabet[rng.IntN(len(alphabet))]
+		}
+		text := string(b)
+		whole := card.pattern.FindAllStringIndex(text, -1)
+		if got := card.find(text); !reflect.DeepEqual(got, whole) && len(got)+len(whole) > 0 {
+			t.Fatalf("find(%q) = %v, whole text matches %v", text, got, whole)
+		}
+	}
+}
+
+// BenchmarkRedact redacts 100KB documents with the default policy: one with
+// nothing to redact and one with PII on every line
+func BenchmarkRedact(b *testing.B) {
+	docs := []struct{ name, line string }{
+		{"clean", "GET /index.html 200 served from cache in 12ms for the frontend pool\n"},
+		{"pii", "user jane@example.com from 10.0.0.1 called 800-555-0199 card 4111 1111 1111 1111\n"},
+	}
+	for _, d := range docs {
+		text := strings.Repeat(d.line, 100<<10/len(d.line))
+		b.Run(d.name, func(b *testing.B) {
+			b.SetBytes(int64(len(text)))
+			b.ReportAllocs()
+			for b.Loop() {
+				Redact(text)
+			}
+		})
+	}
+}
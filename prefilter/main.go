@@ -0,0 +1,38 @@
+// Command prefilter is an API Gateway request authorizer for the ingest
+// route. It runs the header checks of internal/prefilter, so oversized or
+// anonymous requests are refused before the ingest Lambda is invoked at all.
+// API Gateway answers every refusal with 403; the ingest handler repeats the
+// checks with the body and returns the precise status.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/prefilter"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+var config = prefilter.FromEnv()
+
+func handler(ctx context.Context, request events.APIGatewayV2CustomAuthorizerV2Request) (events.APIGatewayV2CustomAuthorizerSimpleResponse, error) {
+	headers := make(map[string]string, len(request.Headers))
+	for k, v := range request.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	if r := config.CheckHeaders(headers); r != nil {
+		prefilter.Record(r, "authorizer")
+		slog.Info("Request rejected", "reason", r.Reason, "request_id", request.RequestContext.RequestID)
+		return events.APIGatewayV2CustomAuthorizerSimpleResponse{IsAuthorized: false}, nil
+	}
+	return events.APIGatewayV2CustomAuthorizerSimpleResponse{IsAuthorized: true}, nil
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
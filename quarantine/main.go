@@ -0,0 +1,246 @@
+// Quarantine consumes the worker's dead-letter queue. Every message that
+// exhausted its retries is stored in the quarantine table with why it failed
+// as far as can be told, how often it was received and its raw body, so a
+// poisoned message is kept and investigated instead of expiring unseen. Each
+// quarantined message is counted in MessagesQuarantined, which alarms, and
+// its record is marked FAILED with a tenant-facing failure code. Messages
+// whose signature fails to verify are kept apart: nothing in them is
+// trusted, so they are filed under _unknown and mark no record.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/failure"
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/pipelinekey"
+	"robust-processor/pkg/model"
+	"robust-processor/pkg/redact"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const metricNamespace = "RobustProcessor"
+
+// Failure reasons. A message that is valid JSON and meets the queue contract
+// failed in processing; the worker's log has the error under its message_id.
+const (
+	reasonInvalidJSON      = "invalid_json"
+	reasonContract         = "contract_violation"
+	reasonRetriesExhausted = "retries_exhausted"
+	reasonInvalidSignature = "invalid_signature"
+)
+
+// unknownTenant keys messages whose tenant_id could not be read
+const unknownTenant = "_unknown"
+
+var (
+	dynamoClient        *dynamodb.Client
+	tableName           string
+	quarantineTableName string
+	// quarantineRetention bounds how long raw bodies, which hold
+	// unredacted text, are kept (QUARANTINE_RETENTION, default 14 days)
+	quarantineRetention = 14 * 24 * time.Hour
+	// pipelineKey verifies message signatures; nil when signing is off.
+	// previousPipelineKey, the key before the last rotation, is accepted too.
+	pipelineKey         []byte
+	previousPipelineKey []byte
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("TABLE_NAME")
+	quarantineTableName = os.Getenv("QUARANTINE_TABLE_NAME")
+	if pipelineKey, err = pipelinekey.FromEnv(context.TODO(), cfg); err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	if previousPipelineKey, err = pipelinekey.PreviousFromEnv(context.TODO(), cfg); err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	if d, err := time.ParseDuration(os.Getenv("QUARANTINE_RETENTION")); err == nil && d > 0 {
+		quarantineRetention = d
+	}
+}
+
+func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	var failures []events.SQSBatchItemFailure
+	for _, record := range sqsEvent.Records {
+		if err := quarantine(ctx, record); err != nil {
+			slog.Error("Failed to quarantine message", "message_id", record.MessageId, "error", err)
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+	return events.SQSEventResponse{BatchItemFailures: failures}, nil
+}
+
+// quarantine stores one dead-lettered message. Writes are keyed by message
+// ID, so a redelivered DLQ message overwrites its own entry.
+func quarantine(ctx context.Context, record events.SQSMessage) error {
+	attributes := map[string]string{}
+	for name, attr := range record.MessageAttributes {
+		if attr.StringValue != nil {
+			attributes[name] = *attr.StringValue
+		}
+	}
+	reason, detail, event := diagnose(record.Body)
+	tags, signature := model.CostTagsFrom(attributes), attributes[model.SignatureAttribute]
+	forged := pipelineKey != nil && !model.VerifySignature(pipelineKey, record.Body, tags, signature) &&
+		(previousPipelineKey == nil || !model.VerifySignature(previousPipelineKey, record.Body, tags, signature))
+	if forged {
+		reason, detail = reasonInvalidSignature, "signature missing or invalid"
+	}
+	tenantID := event.TenantID
+	if tenantID == "" || forged {
+		tenantID = unknownTenant
+	}
+
+	now := time.Now().UTC()
+	item := map[string]types.AttributeValue{
+		"tenant_id":      &types.AttributeValueMemberS{Value: tenantID},
+		"message_id":     &types.AttributeValueMemberS{Value: record.MessageId},
+		"reason":         &types.AttributeValueMemberS{Value: reason},
+		"body":           &types.AttributeValueMemberS{Value: record.Body},
+		"quarantined_at": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		"expires_at":     &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(quarantineRetention).Unix(), 10)},
+		"source_queue":   &types.AttributeValueMemberS{Value: record.EventSourceARN},
+	}
+	if event.LogID != "" {
+		item["log_id"] = &types.AttributeValueMemberS{Value: event.LogID}
+	}
+	// Validation errors may quote the body; the body itself is kept whole
+	if detail != "" {
+		item["detail"] = &types.AttributeValueMemberS{Value: redact.Redact(detail)}
+	}
+	// The count carries over from the source queue and includes this delivery
+	if n, err := strconv.Atoi(record.Attributes["ApproximateReceiveCount"]); err == nil {
+		item["attempts"] = &types.AttributeValueMemberN{Value: strconv.Itoa(n)}
+	}
+	if ms, err := strconv.ParseInt(record.Attributes["SentTimestamp"], 10, 64); err == nil {
+		item["sent_at"] = &types.AttributeValueMemberS{Value: time.UnixMilli(ms).UTC().Format(time.RFC3339)}
+	}
+	if forged && event.TenantID != "" {
+		item["claimed_tenant_id"] = &types.AttributeValueMemberS{Value: event.TenantID}
+	}
+	if len(attributes) > 0 {
+		attrs := map[string]types.AttributeValue{}
+		for name, v := range attributes {
+			attrs[name] = &types.AttributeValueMemberS{Value: v}
+		}
+		item["attributes"] = &types.AttributeValueMemberM{Value: attrs}
+	}
+
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(quarantineTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("store quarantined message: %w", err)
+	}
+
+	if !forged && event.TenantID != "" && event.LogID != "" {
+		if err := markFailed(ctx, event.TenantID, event.LogID, reason); err != nil {
+			return err
+		}
+	}
+
+	emitMetric("MessagesQuarantined", 1, "Count", map[string]string{"reason": reason})
+	emitMetric("MessagesQuarantined", 1, "Count", nil)
+	slog.Warn("Message quarantined", "message_id", record.MessageId, "tenant_id", tenantID, "log_id", event.LogID, "reason", reason)
+	return nil
+}
+
+// diagnose tells why a message may have failed and reads as much of the
+// event as it can. Only contract problems can be seen from the body alone.
+func diagnose(body string) (reason, detail string, event model.LogEvent) {
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		// A body that breaks the contract may still name its tenant and log
+		var partial struct {
+			TenantID string `json:"tenant_id"`
+			LogID    string `json:"log_id"`
+		}
+		if json.Unmarshal([]byte(body), &partial) != nil {
+			return reasonInvalidJSON, err.Error(), model.LogEvent{}
+		}
+		event.TenantID, event.LogID = partial.TenantID, partial.LogID
+	}
+	if err := model.Validate([]byte(body)); err != nil {
+		return reasonContract, err.Error(), event
+	}
+	return reasonRetriesExhausted, "", event
+}
+
+// markFailed turns the record's QUEUED stub, or its absence, into a FAILED
+// record for the status API. The code is the one the worker recorded for the
+// last failed attempt, unless the body itself shows the message is invalid.
+// A record processed meanwhile is left alone.
+func markFailed(ctx context.Context, tenantID, logID, reason string) error {
+	code, update := failure.InvalidMessage, "SET #status = :failed, failed_at = :now, failure_code = :code REMOVE queued_hour"
+	if reason == reasonRetriesExhausted {
+		code, update = failure.Internal, "SET #status = :failed, failed_at = :now, failure_code = if_not_exists(last_failure, :code) REMOVE queued_hour"
+	}
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		UpdateExpression:         aws.String(update),
+		ConditionExpression:      aws.String("attribute_not_exists(log_id) OR #status = :queued"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":failed": &types.AttributeValueMemberS{Value: "FAILED"},
+			":queued": &types.AttributeValueMemberS{Value: "QUEUED"},
+			":now":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":code":   &types.AttributeValueMemberS{Value: string(code)},
+		},
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if errors.As(err, &conditional) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("mark record failed: %w", err)
+	}
+	return nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/apikey"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	// recoveryWindow is how long a deleted log can be undeleted before the
+	// table's TTL purges it (DELETE_RECOVERY_WINDOW, default 30 days)
+	recoveryWindow = 30 * 24 * time.Hour
+	// apiKeys authenticates every request as ingest does; nil unless
+	// API_KEY_SECRET_PREFIX is set
+	apiKeys *apikey.Store
+)
+
+// requireAPIKeys reports false with the response to send when API keys
+// aren't configured. Without them any caller naming a tenant is taken for
+// it, so routes that destroy logs or reveal what redaction removed refuse
+// to run at all; what names the route in the 501.
+func requireAPIKeys(what string) (events.APIGatewayV2HTTPResponse, bool) {
+	if apiKeys == nil {
+		return errorResponse(501, what+" requires API keys (API_KEY_SECRET_PREFIX)"), false
+	}
+	return events.APIGatewayV2HTTPResponse{}, true
+}
+
+type deleteResponse struct {
+	LogID     string `json:"log_id"`
+	DeletedAt string `json:"deleted_at"`
+	// PurgeAt is unset for chained logs, which are never purged
+	PurgeAt string `json:"purge_at,omitempty"`
+	// Chained reports a log sealed into a hash chain, kept as a tombstone
+	Chained bool `json:"chained,omitempty"`
+}
+
+// deleteLog soft-deletes a log: it is stamped deleted_at, hidden from every
+// read, and given an expires_at recoveryWindow away, until which the
+// undelete Lambda can restore it. An expiry the record already had is kept
+// in restore_expires_at. QUEUED logs are refused, since the worker's result
+// would replace the stub and bring the log back. A log sealed into a hash
+// chain becomes a tombstone instead: hidden like any deleted log, but given
+// no expiry, as the TTL purging a link would break the chain for
+// verifychain, just as retention_days can't be combined with hash_chain.
+// Erasure remains the way to remove one for good.
+func deleteLog(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID, logID string) events.APIGatewayV2HTTPResponse {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		ProjectionExpression:     aws.String("#status, deleted_at, expires_at, chain_hash"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+	})
+	if err != nil {
+		slog.Error("Delete lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if out.Item == nil || out.Item["deleted_at"] != nil {
+		return errorResponse(404, "Log not found")
+	}
+	status, _ := out.Item["status"].(*types.AttributeValueMemberS)
+	if status == nil || status.Value == "QUEUED" {
+		return errorResponse(409, "Log is still queued; delete it once processed")
+	}
+
+	now := time.Now().UTC()
+	purgeAt := now.Add(recoveryWindow)
+	_, chained := out.Item["chain_hash"]
+	update := "SET deleted_at = :now"
+	values := map[string]types.AttributeValue{
+		":now":    &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		":status": status,
+	}
+	if !chained {
+		update += ", expires_at = :exp"
+		values[":exp"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(purgeAt.Unix(), 10)}
+		if prior, ok := out.Item["expires_at"]; ok {
+			update += ", restore_expires_at = :prior"
+			values[":prior"] = prior
+		}
+	}
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		UpdateExpression: aws.String(update),
+		// Lost to a concurrent delete or a change of state since the read
+		ConditionExpression:       aws.String("attribute_not_exists(deleted_at) AND #status = :status"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if errors.As(err, &conditional) {
+		return errorResponse(409, "Log changed while being deleted; retry")
+	}
+	if err != nil {
+		slog.Error("Delete failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	resp := deleteResponse{LogID: logID, DeletedAt: now.Format(time.RFC3339), Chained: chained}
+	if !chained {
+		resp.PurgeAt = purgeAt.Format(time.RFC3339)
+	}
+	slog.Info("Log deleted", "tenant_id", tenantID, "log_id", logID, "purge_at", resp.PurgeAt, "chained", chained)
+	return jsonResponse(resp)
+}
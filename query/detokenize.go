@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/envelope"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxTokens caps the tokens of one POST /detokenize request
+const maxTokens = 100
+
+// tokenVaultTableName is the worker's token vault; empty, and
+// de-tokenization answering 501, unless DETOKENIZE is "true"
+var tokenVaultTableName string
+
+// vaultEntry is the part of a token vault item de-tokenization reads
+type vaultEntry struct {
+	Token      string `dynamodbav:"token"`
+	Value      string `dynamodbav:"value"`
+	Ciphertext []byte `dynamodbav:"value_ciphertext"`
+	DataKey    []byte `dynamodbav:"value_data_key"`
+	KeyARN     string `dynamodbav:"value_key_arn"`
+}
+
+// detokenize answers POST /detokenize, {"tokens": ["[EMAIL:...]", ...]},
+// with the value each token of a tokenizing tenant stands for. It takes
+// the same three permissions as original reads, with the tenant's flag
+// being detokenize: true, and likewise refuses to run without API keys.
+// Tokens the vault doesn't hold are listed under "unknown", as are tokens
+// sealed under a key the tenant revoked. Every request is logged with the
+// number of tokens, never the tokens.
+func detokenize(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID string) events.APIGatewayV2HTTPResponse {
+	if resp, ok := requireAPIKeys("De-tokenization"); !ok {
+		return resp
+	}
+	if tokenVaultTableName == "" {
+		return errorResponse(501, "De-tokenization is not enabled")
+	}
+	allowed, err := tenantAllows(ctx, tenantID, "detokenize")
+	if err != nil {
+		slog.Error("Tenant policy lookup failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if !allowed {
+		return errorResponse(403, "De-tokenization is not enabled for this tenant")
+	}
+
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		if body, err = base64.StdEncoding.DecodeString(request.Body); err != nil {
+			return errorResponse(400, "Invalid body encoding")
+		}
+	}
+	var req struct {
+		Tokens []string `json:"tokens"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Tokens) == 0 {
+		return errorResponse(400, `Body must be {"tokens": [...]}`)
+	}
+	if len(req.Tokens) > maxTokens {
+		return errorResponse(400, "At most "+strconv.Itoa(maxTokens)+" tokens per request")
+	}
+
+	entries, err := lookupTokens(ctx, tenantID, req.Tokens)
+	if err != nil {
+		slog.Error("Token vault lookup failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	values := map[string]string{}
+	unknown := []string{}
+	for _, token := range req.Tokens {
+		e, ok := entries[token]
+		if !ok {
+			unknown = append(unknown, token)
+			continue
+		}
+		if e.KeyARN != "" {
+			sealed := envelope.Sealed{Ciphertext: e.Ciphertext, DataKey: e.DataKey, KeyARN: e.KeyARN}
+			if e.Value, err = envelope.Open(ctx, kmsClient, sealed, tenantID, token); envelope.KeyUnavailable(err) {
+				unknown = append(unknown, token)
+				continue
+			}
+			if err != nil {
+				slog.Error("Token decryption failed", "tenant_id", tenantID, "error", err)
+				return errorResponse(500, "Internal server error")
+			}
+		}
+		values[token] = e.Value
+	}
+
+	slog.Info("Tokens de-tokenized", "tenant_id", tenantID, "requested", len(req.Tokens), "resolved", len(values),
+		"source_ip", request.RequestContext.HTTP.SourceIP)
+	resp := jsonResponse(map[string]interface{}{"values": values, "unknown": unknown})
+	resp.Headers["Cache-Control"] = "no-store"
+	return resp
+}
+
+// lookupTokens reads the tenant's vault entries for tokens, keyed by token
+func lookupTokens(ctx context.Context, tenantID string, tokens []string) (map[string]vaultEntry, error) {
+	seen := map[string]bool{}
+	var keys []map[string]types.AttributeValue
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			keys = append(keys, map[string]types.AttributeValue{
+				"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+				"token":     &types.AttributeValueMemberS{Value: token},
+			})
+		}
+	}
+	entries := map[string]vaultEntry{}
+	// BatchGetItem takes up to 100 keys, as many as a request holds, and
+	// may leave some unprocessed
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt == 4 {
+			return nil, fmt.Errorf("batch get: keys still unprocessed after %d attempts", attempt)
+		}
+		if attempt > 0 {
+			time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+		}
+		out, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				tokenVaultTableName: {Keys: keys, ConsistentRead: aws.Bool(true)},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var page []vaultEntry
+		if err := attributevalue.UnmarshalListOfMaps(out.Responses[tokenVaultTableName], &page); err != nil {
+			return nil, err
+		}
+		for _, e := range page {
+			entries[e.Token] = e
+		}
+		keys = out.UnprocessedKeys[tokenVaultTableName].Keys
+	}
+	return entries, nil
+}
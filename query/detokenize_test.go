@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Without API keys no caller is authenticated, so no token is reversed
+func TestDetokenizeRequiresAPIKeys(t *testing.T) {
+	apiKeys = nil
+	tokenVaultTableName = "TokenVault"
+	t.Cleanup(func() { tokenVaultTableName = "" })
+
+	resp, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{
+		RouteKey:              "POST /detokenize",
+		QueryStringParameters: map[string]string{"tenant_id": "acme"},
+		Body:                  `{"tokens": ["[EMAIL:3f9a0c12d4e5b687]"]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 501 {
+		t.Errorf("detokenize without an API key: %d %s, want 501", resp.StatusCode, resp.Body)
+	}
+}
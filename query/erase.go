@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/google/uuid"
+)
+
+var (
+	// lambdaClient, erasureTableName and eraseFunction serve erasure
+	// requests; they answer 501 unless ERASURE_TABLE_NAME and
+	// ERASE_FUNCTION_NAME are set
+	lambdaClient     *lambdasvc.Client
+	erasureTableName string
+	eraseFunction    string
+)
+
+// erasureView is an erasure's audit record as the erase Lambda keeps it
+type erasureView struct {
+	TenantID      string `dynamodbav:"tenant_id" json:"tenant_id"`
+	ErasureID     string `dynamodbav:"erasure_id" json:"erasure_id"`
+	Scope         string `dynamodbav:"scope" json:"scope"`
+	LogID         string `dynamodbav:"log_id,omitempty" json:"log_id,omitempty"`
+	RequestedAt   string `dynamodbav:"requested_at" json:"requested_at"`
+	RequestedFrom string `dynamodbav:"requested_from,omitempty" json:"requested_from,omitempty"`
+	Status        string `dynamodbav:"status" json:"status"`
+	RecordsErased int64  `dynamodbav:"records_erased" json:"records_erased"`
+	Quarantined   int64  `dynamodbav:"quarantined_erased" json:"quarantined_erased"`
+	IndexErased   int64  `dynamodbav:"index_erased" json:"index_erased"`
+	CompletedAt   string `dynamodbav:"completed_at,omitempty" json:"completed_at,omitempty"`
+	FailureReason string `dynamodbav:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	UpdatedAt     string `dynamodbav:"updated_at" json:"updated_at"`
+}
+
+// eraseLog answers DELETE /logs/{log_id}?erase=true: unlike a soft delete
+// it removes the log, its parts and every copy of them for good, and can't
+// be undone. A log already soft-deleted can still be erased.
+func eraseLog(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID, logID string) events.APIGatewayV2HTTPResponse {
+	if resp, ok := authorizeErasure(); !ok {
+		return resp
+	}
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		ProjectionExpression:     aws.String("#status"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+	})
+	if err != nil {
+		slog.Error("Erasure lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if out.Item == nil {
+		return errorResponse(404, "Log not found")
+	}
+	// As for deletes: the worker's result would bring a QUEUED log back
+	if status, _ := out.Item["status"].(*types.AttributeValueMemberS); status == nil || status.Value == "QUEUED" {
+		return errorResponse(409, "Log is still queued; erase it once processed")
+	}
+	return startErasure(ctx, request, erasureView{TenantID: tenantID, Scope: "log", LogID: logID})
+}
+
+// eraseTenant answers DELETE /tenants/{tenant_id}/logs, the erasure of all
+// of the tenant's logs. Records still in the queue when it runs are stored
+// afterwards; a second erasure once ingest has stopped removes them.
+func eraseTenant(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID string) events.APIGatewayV2HTTPResponse {
+	if resp, ok := authorizeErasure(); !ok {
+		return resp
+	}
+	return startErasure(ctx, request, erasureView{TenantID: tenantID, Scope: "tenant"})
+}
+
+// erasureStatus answers GET /erasures/{erasure_id} with the audit record
+func erasureStatus(ctx context.Context, tenantID, erasureID string) events.APIGatewayV2HTTPResponse {
+	if erasureTableName == "" {
+		return errorResponse(501, "Erasure is not configured")
+	}
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(erasureTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id":  &types.AttributeValueMemberS{Value: tenantID},
+			"erasure_id": &types.AttributeValueMemberS{Value: erasureID},
+		},
+	})
+	if err != nil {
+		slog.Error("Erasure status lookup failed", "tenant_id", tenantID, "erasure_id", erasureID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if out.Item == nil {
+		return errorResponse(404, "Erasure not found")
+	}
+	var view erasureView
+	if err := attributevalue.UnmarshalMap(out.Item, &view); err != nil {
+		slog.Error("Erasure status decode failed", "tenant_id", tenantID, "erasure_id", erasureID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	return jsonResponse(view)
+}
+
+// authorizeErasure reports false with the response to send when erasure
+// isn't configured, or callers can't be authenticated; with API keys the
+// handler has authenticated them
+func authorizeErasure() (events.APIGatewayV2HTTPResponse, bool) {
+	if resp, ok := requireAPIKeys("Erasure"); !ok {
+		return resp, false
+	}
+	if erasureTableName == "" || eraseFunction == "" {
+		return errorResponse(501, "Erasure is not configured"), false
+	}
+	return events.APIGatewayV2HTTPResponse{}, true
+}
+
+// startErasure records the request in the audit table and hands it to the
+// erase Lambda. The record is written first, so no erasure runs unaudited;
+// if the invocation fails it is marked FAILED and the caller may retry.
+func startErasure(ctx context.Context, request events.APIGatewayV2HTTPRequest, e erasureView) events.APIGatewayV2HTTPResponse {
+	now := time.Now().UTC().Format(time.RFC3339)
+	e.ErasureID = uuid.New().String()
+	e.RequestedAt = now
+	e.RequestedFrom = request.RequestContext.HTTP.SourceIP
+	e.Status = "PENDING"
+	e.UpdatedAt = now
+	item, err := attributevalue.MarshalMap(e)
+	if err == nil {
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(erasureTableName), Item: item})
+	}
+	if err != nil {
+		slog.Error("Erasure audit write failed", "tenant_id", e.TenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+
+	payload, _ := json.Marshal(map[string]string{"tenant_id": e.TenantID, "erasure_id": e.ErasureID})
+	_, err = lambdaClient.Invoke(ctx, &lambdasvc.InvokeInput{
+		FunctionName:   aws.String(eraseFunction),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		slog.Error("Erasure start failed", "tenant_id", e.TenantID, "erasure_id", e.ErasureID, "error", err)
+		e.Status, e.FailureReason = "FAILED", "could not be started"
+		if item, err := attributevalue.MarshalMap(e); err == nil {
+			_, _ = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(erasureTableName), Item: item})
+		}
+		return errorResponse(503, "Erasure could not be started; retry")
+	}
+
+	slog.Info("Erasure requested", "tenant_id", e.TenantID, "erasure_id", e.ErasureID, "scope", e.Scope, "log_id", e.LogID)
+	resp := jsonResponse(e)
+	resp.StatusCode = 202
+	return resp
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Without API keys no caller is authenticated, so no erasure may start
+func TestEraseRequiresAPIKeys(t *testing.T) {
+	apiKeys = nil
+	erasureTableName, eraseFunction = "ErasureAudit", "Erase"
+	t.Cleanup(func() { erasureTableName, eraseFunction = "", "" })
+
+	requests := []events.APIGatewayV2HTTPRequest{
+		{
+			RouteKey:       "DELETE /tenants/{tenant_id}/logs",
+			PathParameters: map[string]string{"tenant_id": "acme"},
+		},
+		{
+			RouteKey:              "DELETE /logs/{log_id}",
+			PathParameters:        map[string]string{"log_id": "l1"},
+			QueryStringParameters: map[string]string{"tenant_id": "acme", "erase": "true"},
+		},
+	}
+	for _, request := range requests {
+		resp, err := handler(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 501 {
+			t.Errorf("%s without an API key: %d %s, want 501", request.RouteKey, resp.StatusCode, resp.Body)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+var (
+	// presignClient, exportTableName, exportFunction and exportBucket serve
+	// export requests; they answer 501 unless EXPORT_TABLE_NAME,
+	// EXPORT_FUNCTION_NAME and EXPORT_BUCKET are set
+	presignClient   *s3.PresignClient
+	exportTableName string
+	exportFunction  string
+	exportBucket    string
+	// exportURLTTL is how long download URLs work (EXPORT_URL_TTL, default
+	// 1h); a client whose URLs expired asks for the export again
+	exportURLTTL = time.Hour
+	// exportRetention is how long an export is kept (EXPORT_RETENTION,
+	// default 7 days), matching the bucket's lifecycle
+	exportRetention = 7 * 24 * time.Hour
+)
+
+// exportPart is one part of an export as the export Lambda records it, with
+// a download URL
+type exportPart struct {
+	Number     int    `dynamodbav:"number" json:"part"`
+	Key        string `dynamodbav:"key" json:"key"`
+	Records    int64  `dynamodbav:"records" json:"records"`
+	Bytes      int64  `dynamodbav:"bytes" json:"bytes"`
+	SHA256     string `dynamodbav:"sha256" json:"sha256"`
+	FirstLogID string `dynamodbav:"first_log_id" json:"first_log_id"`
+	LastLogID  string `dynamodbav:"last_log_id" json:"last_log_id"`
+	URL        string `dynamodbav:"-" json:"url,omitempty"`
+}
+
+// exportView is an export's item, and its manifest once complete
+type exportView struct {
+	TenantID        string       `dynamodbav:"tenant_id" json:"tenant_id"`
+	ExportID        string       `dynamodbav:"export_id" json:"export_id"`
+	RequestedAt     string       `dynamodbav:"requested_at" json:"requested_at"`
+	RequestedFrom   string       `dynamodbav:"requested_from,omitempty" json:"requested_from,omitempty"`
+	Status          string       `dynamodbav:"status" json:"status"`
+	Parts           []exportPart `dynamodbav:"parts" json:"parts"`
+	RecordsExported int64        `dynamodbav:"records_exported" json:"records_exported"`
+	ManifestKey     string       `dynamodbav:"manifest_key,omitempty" json:"manifest_key,omitempty"`
+	ManifestURL     string       `dynamodbav:"-" json:"manifest_url,omitempty"`
+	URLsExpireAt    string       `dynamodbav:"-" json:"urls_expire_at,omitempty"`
+	CompletedAt     string       `dynamodbav:"completed_at,omitempty" json:"completed_at,omitempty"`
+	FailureReason   string       `dynamodbav:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	UpdatedAt       string       `dynamodbav:"updated_at" json:"updated_at"`
+	ExpiresAt       int64        `dynamodbav:"expires_at,omitempty" json:"-"`
+}
+
+// startExport answers POST /exports: it records the request and hands it to
+// the export Lambda, returning 202 with the export_id to poll
+func startExport(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID string) events.APIGatewayV2HTTPResponse {
+	if exportTableName == "" || exportFunction == "" || exportBucket == "" {
+		return errorResponse(501, "Exports are not configured")
+	}
+	now := time.Now().UTC()
+	e := exportView{
+		TenantID:      tenantID,
+		ExportID:      uuid.New().String(),
+		RequestedAt:   now.Format(time.RFC3339),
+		RequestedFrom: request.RequestContext.HTTP.SourceIP,
+		Status:        "PENDING",
+		Parts:         []exportPart{},
+		UpdatedAt:     now.Format(time.RFC3339),
+		ExpiresAt:     now.Add(exportRetention).Unix(),
+	}
+	item, err := attributevalue.MarshalMap(e)
+	if err == nil {
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(exportTableName), Item: item})
+	}
+	if err != nil {
+		slog.Error("Export write failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+
+	payload, _ := json.Marshal(map[string]string{"tenant_id": e.TenantID, "export_id": e.ExportID})
+	_, err = lambdaClient.Invoke(ctx, &lambdasvc.InvokeInput{
+		FunctionName:   aws.String(exportFunction),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		slog.Error("Export start failed", "tenant_id", tenantID, "export_id", e.ExportID, "error", err)
+		e.Status, e.FailureReason = "FAILED", "could not be started"
+		if item, err := attributevalue.MarshalMap(e); err == nil {
+			_, _ = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(exportTableName), Item: item})
+		}
+		return errorResponse(503, "Export could not be started; retry")
+	}
+
+	slog.Info("Export requested", "tenant_id", tenantID, "export_id", e.ExportID)
+	resp := jsonResponse(e)
+	resp.StatusCode = 202
+	return resp
+}
+
+// exportStatus answers GET /exports/{export_id} with the export's progress
+// and a download URL for every finished part, so parts can be fetched
+// while later ones are still being written; once DONE it adds the
+// manifest's. Each call signs fresh URLs, so a client resuming after they
+// expired calls again and fetches the parts it is missing.
+func exportStatus(ctx context.Context, tenantID, exportID string) events.APIGatewayV2HTTPResponse {
+	if exportTableName == "" || exportBucket == "" {
+		return errorResponse(501, "Exports are not configured")
+	}
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(exportTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"export_id": &types.AttributeValueMemberS{Value: exportID},
+		},
+	})
+	if err != nil {
+		slog.Error("Export status lookup failed", "tenant_id", tenantID, "export_id", exportID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if out.Item == nil {
+		return errorResponse(404, "Export not found")
+	}
+	var view exportView
+	if err := attributevalue.UnmarshalMap(out.Item, &view); err != nil {
+		slog.Error("Export status decode failed", "tenant_id", tenantID, "export_id", exportID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if view.ExpiresAt > 0 && time.Now().Unix() >= view.ExpiresAt {
+		return errorResponse(410, "Export has expired")
+	}
+
+	for i := range view.Parts {
+		if view.Parts[i].URL, err = presign(ctx, view.Parts[i].Key); err != nil {
+			break
+		}
+	}
+	if err == nil && view.ManifestKey != "" {
+		view.ManifestURL, err = presign(ctx, view.ManifestKey)
+	}
+	if err != nil {
+		slog.Error("Export URL signing failed", "tenant_id", tenantID, "export_id", exportID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if len(view.Parts) > 0 {
+		view.URLsExpireAt = time.Now().Add(exportURLTTL).UTC().Format(time.RFC3339)
+	}
+	resp := jsonResponse(view)
+	resp.Headers["Cache-Control"] = "no-store"
+	return resp
+}
+
+// presign returns a GET URL for an object of the export bucket
+func presign(ctx context.Context, key string) (string, error) {
+	req, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(exportBucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(exportURLTTL))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"robust-processor/internal/honeypot"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+var (
+	// honeypotQueueURL receives every request made with a honeypot key, as
+	// it does from ingest; unset, requests are only counted and logged
+	honeypotQueueURL string
+	sqsClient        *sqs.Client
+	// honeypotDelay holds each honeypot response back (HONEYPOT_DELAY,
+	// default 2s) to slow the caller down
+	honeypotDelay = honeypot.DefaultDelay
+)
+
+// honeypotResponse answers a request made with a key the tenant flagged as
+// a honeypot as ingest does: the request is captured, security alerted
+// through the HoneypotRequests metric, and the caller sent, after a delay,
+// the answer the route gives a tenant with no logs. Nothing is read,
+// deleted, erased or exported, and the 401 that would give the flag away
+// is never sent.
+func honeypotResponse(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID, key string) events.APIGatewayV2HTTPResponse {
+	capture := honeypot.NewCapture(request, tenantID, key)
+	slog.Warn("Honeypot key used", "tenant_id", tenantID, "key_digest", capture.KeyDigest,
+		"source_ip", capture.SourceIP, "path", capture.Path)
+	emitMetric("HoneypotRequests", 1, "Count", map[string]string{"tenant_id": tenantID})
+
+	if honeypotQueueURL != "" {
+		if err := capture.Send(ctx, sqsClient, honeypotQueueURL); err != nil {
+			slog.Error("Failed to capture honeypot request", "tenant_id", tenantID, "error", err)
+			emitMetric("HoneypotCaptureFailures", 1, "Count", nil)
+		}
+	}
+
+	honeypot.Tarpit(ctx, honeypotDelay)
+	return decoyResponse(request)
+}
+
+// decoyResponse is what the route answers for a tenant with no logs:
+// listings are empty and every ID is not found. Routes that would start
+// work or hand out values have nothing to fake; a failure gives away
+// nothing.
+func decoyResponse(request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	params := request.QueryStringParameters
+	switch request.RouteKey {
+	case "GET /logs", "GET /logs/recent":
+		return jsonResponse(map[string]interface{}{"logs": []logView{}})
+	case "GET /logs/search":
+		return jsonResponse(map[string]interface{}{"results": []interface{}{}})
+	case "GET /logs/labels":
+		resp := map[string]interface{}{"from": params["from"], "records": 0, "labels": map[string]int{}}
+		if params["from"] == "" {
+			resp["from"] = time.Now().UTC().Add(-labelStatsWindow).Format(time.RFC3339)
+		}
+		if params["to"] != "" {
+			resp["to"] = params["to"]
+		}
+		return jsonResponse(resp)
+	case "GET /erasures/{erasure_id}":
+		return errorResponse(404, "Erasure not found")
+	case "GET /exports/{export_id}":
+		return errorResponse(404, "Export not found")
+	case "POST /pseudonyms", "POST /detokenize", "POST /exports", "DELETE /tenants/{tenant_id}/logs":
+		return errorResponse(500, "Internal server error")
+	}
+	return errorResponse(404, "Log not found")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"robust-processor/internal/apikey"
+	"robust-processor/internal/honeypot"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// secretsStub answers every GetSecretValue with the same tenant secret
+type secretsStub string
+
+func (s secretsStub) RoundTrip(*http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(string(s)))}, nil
+}
+
+// A honeypot key must get the decoy of a tenant with no logs, never the
+// 401 that would tell its holder the key was found out
+func TestHoneypotKey(t *testing.T) {
+	cfg := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+		HTTPClient: &http.Client{Transport: secretsStub(
+			`{"SecretString": "{\"keys\": [\"good\"], \"compromised_keys\": [{\"key\": \"trap\", \"mode\": \"honeypot\"}, {\"key\": \"gone\"}]}"}`)},
+	}
+	apiKeys = apikey.New(cfg, "keys/", 0)
+	honeypotDelay = 0
+	t.Cleanup(func() { apiKeys, honeypotDelay = nil, honeypot.DefaultDelay })
+
+	tests := []struct {
+		key      string
+		routeKey string
+		status   int
+		body     string
+	}{
+		{"trap", "GET /logs/{log_id}", 404, `{"error":"Log not found"}`},
+		{"trap", "DELETE /logs/{log_id}", 404, `{"error":"Log not found"}`},
+		{"trap", "GET /logs", 200, `{"logs":[]}`},
+		{"trap", "GET /logs/search", 200, `{"results":[]}`},
+		{"trap", "POST /exports", 500, `{"error":"Internal server error"}`},
+		{"gone", "GET /logs", 401, `{"error":"Invalid API key"}`},
+		{"wrong", "GET /logs", 401, `{"error":"Invalid API key"}`},
+	}
+	for _, tt := range tests {
+		resp, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{
+			RouteKey:              tt.routeKey,
+			Headers:               map[string]string{"x-api-key": tt.key},
+			PathParameters:        map[string]string{"log_id": "l1"},
+			QueryStringParameters: map[string]string{"tenant_id": "acme"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status || resp.Body != tt.body {
+			t.Errorf("%s with key %s: %d %s, want %d %s", tt.routeKey, tt.key, resp.StatusCode, resp.Body, tt.status, tt.body)
+		}
+	}
+}
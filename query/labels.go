@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// labelStatsWindow is the range GET /logs/labels counts without ?from=
+	labelStatsWindow = 24 * time.Hour
+	// maxLabelStatsRecords bounds the records one GET /logs/labels reads,
+	// keeping it inside the API Gateway timeout
+	maxLabelStatsRecords = 100000
+)
+
+// labelStats answers GET /logs/labels, how many of the tenant's logs
+// processed in ?from= to ?to= (RFC 3339, inclusive; default the last 24
+// hours) carry each classification label, and how many logs were counted.
+// It reads recentIndex for the range projecting only labels, so nothing
+// else of a record is read. Deleted logs aren't counted. A range holding
+// more than maxLabelStatsRecords logs is counted up to there and answered
+// with a next_cursor, which counts the rest of the range as ?cursor=; the
+// caller adds up the pages.
+func labelStats(ctx context.Context, tenantID string, params map[string]string) events.APIGatewayV2HTTPResponse {
+	from, to, err := parseRange(params["from"], params["to"])
+	if err != nil {
+		return errorResponse(400, err.Error())
+	}
+	if from == "" {
+		start := time.Now().UTC().Add(-labelStatsWindow)
+		if to != "" {
+			end, _ := time.Parse(time.RFC3339, to)
+			start = end.Add(-labelStatsWindow)
+		}
+		from = start.Format(time.RFC3339)
+	}
+	values := map[string]types.AttributeValue{
+		":t":    &types.AttributeValueMemberS{Value: tenantID},
+		":from": &types.AttributeValueMemberS{Value: from},
+	}
+	condition := "tenant_id = :t AND processed_at >= :from"
+	if to != "" {
+		condition = "tenant_id = :t AND processed_at BETWEEN :from AND :to"
+		values[":to"] = &types.AttributeValueMemberS{Value: to}
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(recentIndex),
+		KeyConditionExpression:    aws.String(condition),
+		FilterExpression:          aws.String("attribute_not_exists(deleted_at)"),
+		ProjectionExpression:      aws.String("labels"),
+		ExpressionAttributeValues: values,
+	}
+	if cursor := params["cursor"]; cursor != "" {
+		var c listCursor
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err == nil {
+			err = json.Unmarshal(raw, &c)
+		}
+		if err != nil || c.LogID == "" || c.ProcessedAt == "" {
+			return errorResponse(400, "Invalid cursor")
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"tenant_id":    &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":       &types.AttributeValueMemberS{Value: c.LogID},
+			"processed_at": &types.AttributeValueMemberS{Value: c.ProcessedAt},
+		}
+	}
+
+	counts := map[string]int{}
+	records := 0
+	var start map[string]types.AttributeValue
+	for {
+		out, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			slog.Error("Label stats query failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		var page []struct {
+			Labels []string `dynamodbav:"labels"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			slog.Error("Label stats decode failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		for _, item := range page {
+			for _, label := range item.Labels {
+				counts[label]++
+			}
+		}
+		records += len(page)
+		start = out.LastEvaluatedKey
+		if start == nil || records >= maxLabelStatsRecords {
+			break
+		}
+		input.ExclusiveStartKey = start
+	}
+
+	resp := map[string]interface{}{"from": from, "records": records, "labels": counts}
+	if to != "" {
+		resp["to"] = to
+	}
+	if start != nil {
+		var c listCursor
+		err := attributevalue.Unmarshal(start["log_id"], &c.LogID)
+		if err == nil {
+			err = attributevalue.Unmarshal(start["processed_at"], &c.ProcessedAt)
+		}
+		if err != nil {
+			slog.Error("Label stats cursor failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		raw, _ := json.Marshal(c)
+		resp["next_cursor"] = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return jsonResponse(resp)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// maxList caps ?limit= on GET /logs, and is its default
+	maxList = 100
+	// maxLabel bounds ?label=; labels are short names such as
+	// contains-credentials
+	maxLabel = 64
+)
+
+// listCursor is the LastEvaluatedKey of a list page, less the tenant, which
+// the next request names anyway: a cursor can't reach another tenant's logs.
+// Pages of a time range also carry the index key, processed_at.
+type listCursor struct {
+	LogID       string `json:"log_id"`
+	ProcessedAt string `json:"processed_at,omitempty"`
+}
+
+// listLogs answers GET /logs, the tenant's logs in log_id order, a page at a
+// time: one Query of the tenant's partition, projected to the public view so
+// original_text is never read. With ?from= and/or ?to= (RFC 3339, both
+// inclusive) it lists the logs processed in that range instead, oldest
+// first, from recentIndex, which only holds processed logs and only their
+// public view. The response's next_cursor, when present, fetches the
+// following page as ?cursor=, with the same range. ?label= lists only the
+// logs classified with that label. Deleted and filtered-out logs are
+// skipped, so a page can be short of the limit while more follow.
+func listLogs(ctx context.Context, tenantID string, params map[string]string) events.APIGatewayV2HTTPResponse {
+	n := maxList
+	if limit := params["limit"]; limit != "" {
+		var err error
+		if n, err = strconv.Atoi(limit); err != nil || n < 1 || n > maxList {
+			return errorResponse(400, "limit must be between 1 and "+strconv.Itoa(maxList))
+		}
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(tableName),
+		KeyConditionExpression:   aws.String("tenant_id = :t"),
+		FilterExpression:         aws.String("attribute_not_exists(deleted_at)"),
+		ProjectionExpression:     aws.String(viewProjection),
+		ExpressionAttributeNames: viewNames,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: tenantID},
+		},
+	}
+	label, err := parseLabel(params["label"])
+	if err != nil {
+		return errorResponse(400, err.Error())
+	}
+	if label != "" {
+		input.FilterExpression = aws.String("attribute_not_exists(deleted_at) AND contains(labels, :label)")
+		input.ExpressionAttributeValues[":label"] = &types.AttributeValueMemberS{Value: label}
+	}
+	ranged := params["from"] != "" || params["to"] != ""
+	if ranged {
+		condition := "tenant_id = :t AND processed_at "
+		from, to, err := parseRange(params["from"], params["to"])
+		if err != nil {
+			return errorResponse(400, err.Error())
+		}
+		switch {
+		case from != "" && to != "":
+			condition += "BETWEEN :from AND :to"
+		case from != "":
+			condition += ">= :from"
+		default:
+			condition += "<= :to"
+		}
+		if from != "" {
+			input.ExpressionAttributeValues[":from"] = &types.AttributeValueMemberS{Value: from}
+		}
+		if to != "" {
+			input.ExpressionAttributeValues[":to"] = &types.AttributeValueMemberS{Value: to}
+		}
+		// The index projects the public view, so everything it holds is read
+		input.IndexName = aws.String(recentIndex)
+		input.KeyConditionExpression = aws.String(condition)
+		input.ProjectionExpression = nil
+		input.ExpressionAttributeNames = nil
+	}
+
+	if cursor := params["cursor"]; cursor != "" {
+		var c listCursor
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err == nil {
+			err = json.Unmarshal(raw, &c)
+		}
+		if err != nil || c.LogID == "" || ranged != (c.ProcessedAt != "") {
+			return errorResponse(400, "Invalid cursor")
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: c.LogID},
+		}
+		if ranged {
+			input.ExclusiveStartKey["processed_at"] = &types.AttributeValueMemberS{Value: c.ProcessedAt}
+		}
+	}
+
+	logs := []logView{}
+	var start map[string]types.AttributeValue
+	for {
+		// Each page asks for no more than the page still needs, so the last
+		// key evaluated is always the cursor to continue from
+		input.Limit = aws.Int32(int32(n - len(logs)))
+		out, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			slog.Error("List logs query failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		var page []logView
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			slog.Error("List logs decode failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		logs = append(logs, page...)
+		start = out.LastEvaluatedKey
+		if start == nil || len(logs) >= n {
+			break
+		}
+		input.ExclusiveStartKey = start
+	}
+
+	resp := map[string]interface{}{"logs": logs}
+	if start != nil {
+		var c listCursor
+		err := attributevalue.Unmarshal(start["log_id"], &c.LogID)
+		if err == nil && ranged {
+			err = attributevalue.Unmarshal(start["processed_at"], &c.ProcessedAt)
+		}
+		if err != nil {
+			slog.Error("List logs cursor failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		raw, _ := json.Marshal(c)
+		resp["next_cursor"] = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return jsonResponse(resp)
+}
+
+// parseRange reads ?from= and ?to= as RFC 3339 times, returning them in the
+// form processed_at is stored in, so they compare as strings
+func parseRange(from, to string) (string, string, error) {
+	var bounds [2]string
+	for i, s := range []string{from, to} {
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", "", errors.New("from and to must be RFC 3339 times such as 2024-05-01T00:00:00Z")
+		}
+		bounds[i] = t.UTC().Format(time.RFC3339)
+	}
+	if bounds[0] != "" && bounds[1] != "" && bounds[0] > bounds[1] {
+		return "", "", errors.New("from must not be after to")
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// parseLabel reads ?label=, a classification label such as
+// contains-financial; empty filters nothing
+func parseLabel(label string) (string, error) {
+	if len(label) > maxLabel {
+		return "", errors.New("label must be at most " + strconv.Itoa(maxLabel) + " bytes")
+	}
+	return label, nil
+}
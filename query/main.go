@@ -0,0 +1,379 @@
+// Query serves the read API over processed logs. Only redacted content is
+// returned, but for GET /logs/{log_id}/original where the deployment and the
+// tenant both allow it; original_text otherwise stays in DynamoDB.
+// GET /logs/{log_id}/thread returns a multi-part record with its parts. It
+// also soft-deletes logs (DELETE /logs/{log_id}); deleted logs read as
+// absent. POST /pseudonyms turns search terms into the pseudonyms indexed in
+// their place, GET /logs/search finds logs by meaning in the OpenSearch
+// index, and GET /logs/labels counts them by classification label. Erasure
+// requests (DELETE /logs/{log_id}?erase=true, DELETE /tenants/{tenant_id}/logs)
+// are audited and handed to the erase Lambda, and export requests
+// (POST /exports) to the export Lambda, whose parts GET /exports/{export_id}
+// hands out download URLs for.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"robust-processor/internal/apikey"
+	"robust-processor/internal/embed"
+	"robust-processor/internal/failure"
+	"robust-processor/internal/integrity"
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/pseudonym"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// maxWait caps ?wait= below the API Gateway integration timeout (30s)
+const maxWait = 25 * time.Second
+
+var dynamoClient *dynamodb.Client
+var tableName string
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("TABLE_NAME")
+	nearDuplicateTableName = os.Getenv("NEAR_DUPLICATE_TABLE_NAME")
+	if d, err := time.ParseDuration(os.Getenv("DELETE_RECOVERY_WINDOW")); err == nil && d > 0 {
+		recoveryWindow = d
+	}
+	if prefix := os.Getenv("API_KEY_SECRET_PREFIX"); prefix != "" {
+		apiKeys = apikey.New(cfg, prefix, 0)
+	}
+	if honeypotQueueURL = os.Getenv("HONEYPOT_QUEUE_URL"); honeypotQueueURL != "" {
+		sqsClient = sqs.NewFromConfig(cfg)
+	}
+	if d, err := time.ParseDuration(os.Getenv("HONEYPOT_DELAY")); err == nil && d >= 0 {
+		honeypotDelay = d
+	}
+	if pseudonymKey, err = pseudonym.FromEnv(context.TODO(), cfg); err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	awsCfg = cfg
+	if embedder, err = embed.FromEnv(cfg); err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	lambdaClient = lambdasvc.NewFromConfig(cfg)
+	erasureTableName = os.Getenv("ERASURE_TABLE_NAME")
+	eraseFunction = os.Getenv("ERASE_FUNCTION_NAME")
+	presignClient = s3.NewPresignClient(s3.NewFromConfig(cfg))
+	exportTableName = os.Getenv("EXPORT_TABLE_NAME")
+	exportFunction = os.Getenv("EXPORT_FUNCTION_NAME")
+	exportBucket = os.Getenv("EXPORT_BUCKET")
+	if d, err := time.ParseDuration(os.Getenv("EXPORT_URL_TTL")); err == nil && d > 0 {
+		exportURLTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("EXPORT_RETENTION")); err == nil && d > 0 {
+		exportRetention = d
+	}
+	originalReads = os.Getenv("ORIGINAL_READS") == "true"
+	if os.Getenv("DETOKENIZE") == "true" {
+		tokenVaultTableName = os.Getenv("TOKEN_VAULT_TABLE_NAME")
+	}
+	if originalReads || tokenVaultTableName != "" {
+		kmsClient = kms.NewFromConfig(cfg)
+	}
+	policyTableName = os.Getenv("POLICY_TABLE_NAME")
+	searchEndpoint = strings.TrimRight(os.Getenv("OPENSEARCH_ENDPOINT"), "/")
+	if index := os.Getenv("OPENSEARCH_INDEX"); index != "" {
+		searchIndex = index
+	}
+}
+
+// logView is the public, redacted view of a stored log
+type logView struct {
+	TenantID string `dynamodbav:"tenant_id" json:"tenant_id"`
+	LogID    string `dynamodbav:"log_id" json:"log_id"`
+	Source   string `dynamodbav:"source" json:"source"`
+	ParentID string `dynamodbav:"parent_id" json:"parent_id,omitempty"`
+	// Part is a sub-document's 1-based position among its record's parts
+	Part         int    `dynamodbav:"part" json:"part,omitempty"`
+	BatchID      string `dynamodbav:"batch_id" json:"batch_id,omitempty"`
+	Status       string `dynamodbav:"status" json:"status"`
+	QueuedAt     string `dynamodbav:"queued_at" json:"queued_at,omitempty"`
+	ProcessedAt  string `dynamodbav:"processed_at" json:"processed_at,omitempty"`
+	ModifiedData string `dynamodbav:"modified_data" json:"modified_data,omitempty"`
+	// Encryption is "client" when modified_data is the tenant's own
+	// ciphertext, stored as sent
+	Encryption string `dynamodbav:"encryption" json:"encryption,omitempty"`
+	// PolicyVersion is the policy version modified_data was redacted under;
+	// records processed before versions were stored have none
+	PolicyVersion *int   `dynamodbav:"policy_version" json:"policy_version,omitempty"`
+	FailedAt      string `dynamodbav:"failed_at" json:"failed_at,omitempty"`
+	// FailureCode and FailureMessage explain a FAILED record; internal error
+	// text is never stored on the record
+	FailureCode    string `dynamodbav:"failure_code" json:"failure_code,omitempty"`
+	FailureMessage string `dynamodbav:"-" json:"failure_message,omitempty"`
+	// Fingerprint is the SimHash of modified_data, 16 hex digits; see
+	// GET /logs/{log_id}/similar
+	Fingerprint string `dynamodbav:"simhash" json:"simhash,omitempty"`
+	// Labels are the record's content classifications, such as
+	// contains-financial
+	Labels []string `dynamodbav:"labels" json:"labels,omitempty"`
+	// DeletedAt marks a soft-deleted log, which reads treat as absent
+	DeletedAt string `dynamodbav:"deleted_at" json:"-"`
+}
+
+// viewProjection reads a logView, and never original_text
+const viewProjection = "tenant_id, log_id, #source, parent_id, #part, batch_id, #status, queued_at, processed_at, modified_data, encryption, policy_version, failed_at, failure_code, simhash, labels, deleted_at"
+
+// viewNames are the reserved words viewProjection names
+var viewNames = map[string]string{"#source": "source", "#part": "part", "#status": "status"}
+
+// final reports whether the log has left the queue; anything but the QUEUED
+// stub ingest writes before publishing is the worker's result
+func (v logView) final() bool {
+	return v.Status != "" && v.Status != "QUEUED"
+}
+
+func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	tenantID := request.QueryStringParameters["tenant_id"]
+	if tenantID == "" {
+		tenantID = request.Headers["x-tenant-id"]
+	}
+	// A tenant in the path must agree with any the caller also named
+	if pathTenant := request.PathParameters["tenant_id"]; pathTenant != "" {
+		if tenantID != "" && tenantID != pathTenant {
+			return errorResponse(403, "tenant_id does not match the path"), nil
+		}
+		tenantID = pathTenant
+	}
+	if tenantID == "" {
+		return errorResponse(400, "Missing tenant_id"), nil
+	}
+	// Every route reads or changes one tenant's logs, so with API keys
+	// configured every route takes the tenant's X-Api-Key
+	if apiKeys != nil {
+		key := request.Headers["x-api-key"]
+		verdict, err := apiKeys.Classify(ctx, tenantID, key)
+		if err != nil {
+			slog.Error("API key lookup failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error"), nil
+		}
+		switch verdict {
+		case apikey.Valid:
+		case apikey.Honeypot:
+			return honeypotResponse(ctx, request, tenantID, key), nil
+		default:
+			return errorResponse(401, "Invalid API key"), nil
+		}
+	}
+	logID := request.PathParameters["log_id"]
+
+	switch request.RouteKey {
+	case "GET /logs/{log_id}/similar":
+		return similarLogs(ctx, tenantID, logID, request.QueryStringParameters), nil
+	case "GET /logs/{log_id}/receipt":
+		return receiptResponse(ctx, tenantID, logID), nil
+	case "GET /logs/{log_id}/original":
+		return originalResponse(ctx, request, tenantID, logID), nil
+	case "GET /logs/{log_id}/thread":
+		return threadResponse(ctx, tenantID, logID), nil
+	case "DELETE /logs/{log_id}":
+		if request.QueryStringParameters["erase"] == "true" {
+			return eraseLog(ctx, request, tenantID, logID), nil
+		}
+		return deleteLog(ctx, request, tenantID, logID), nil
+	case "DELETE /tenants/{tenant_id}/logs":
+		return eraseTenant(ctx, request, tenantID), nil
+	case "GET /erasures/{erasure_id}":
+		return erasureStatus(ctx, tenantID, request.PathParameters["erasure_id"]), nil
+	case "POST /exports":
+		return startExport(ctx, request, tenantID), nil
+	case "GET /exports/{export_id}":
+		return exportStatus(ctx, tenantID, request.PathParameters["export_id"]), nil
+	case "GET /logs":
+		return listLogs(ctx, tenantID, request.QueryStringParameters), nil
+	case "GET /logs/search":
+		return searchLogs(ctx, tenantID, request.QueryStringParameters), nil
+	case "GET /logs/labels":
+		return labelStats(ctx, tenantID, request.QueryStringParameters), nil
+	case "GET /logs/recent":
+		return recentLogs(ctx, tenantID, request.QueryStringParameters["limit"]), nil
+	case "POST /pseudonyms":
+		return pseudonyms(ctx, request, tenantID), nil
+	case "POST /detokenize":
+		return detokenize(ctx, request, tenantID), nil
+	}
+
+	wait, err := parseWait(request.QueryStringParameters["wait"])
+	if err != nil {
+		return errorResponse(400, "wait must be a duration such as 10s"), nil
+	}
+	asOf := -1
+	if s := request.QueryStringParameters["as_of_policy"]; s != "" {
+		if asOf, err = strconv.Atoi(s); err != nil || asOf < 0 {
+			return errorResponse(400, "as_of_policy must be a policy version number"), nil
+		}
+	}
+
+	view, found, err := waitForLog(ctx, tenantID, logID, wait)
+	if err != nil {
+		slog.Error("Status lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error"), nil
+	}
+	if !found || view.DeletedAt != "" {
+		return errorResponse(404, "Log not found"), nil
+	}
+	if view.FailureCode != "" {
+		view.FailureMessage = failure.Message(failure.Code(view.FailureCode))
+	}
+	if asOf >= 0 {
+		return asOfPolicyResponse(view, asOf), nil
+	}
+
+	return jsonResponse(view), nil
+}
+
+// asOfPolicyResponse answers ?as_of_policy=N. A record is redacted once, by
+// the policy version current when the worker processed it, and only that
+// output is kept: a later policy never rewrites it. So the output as of N
+// is the stored one when the record was processed under N, and there is
+// none otherwise.
+func asOfPolicyResponse(view logView, version int) events.APIGatewayV2HTTPResponse {
+	switch {
+	case view.Status != "PROCESSED":
+		return errorResponse(404, "Log has no redaction output")
+	case view.PolicyVersion == nil:
+		return errorResponse(404, "Log predates policy version tracking")
+	case *view.PolicyVersion != version:
+		return errorResponse(404, fmt.Sprintf("Log was redacted under policy version %d, not %d", *view.PolicyVersion, version))
+	}
+	return jsonResponse(view)
+}
+
+// receiptView returns a stored receipt exactly as signed. receipt is kept as
+// a string because the signature covers those bytes, not a re-encoding.
+type receiptView struct {
+	Receipt          string `dynamodbav:"receipt" json:"receipt"`
+	Signature        string `dynamodbav:"receipt_signature" json:"signature"`
+	SigningAlgorithm string `dynamodbav:"-" json:"signing_algorithm"`
+}
+
+func receiptResponse(ctx context.Context, tenantID, logID string) events.APIGatewayV2HTTPResponse {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		ProjectionExpression:     aws.String("#receipt, receipt_signature, deleted_at"),
+		ExpressionAttributeNames: map[string]string{"#receipt": "receipt"},
+	})
+	if err != nil {
+		slog.Error("Receipt lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	var view receiptView
+	if err := attributevalue.UnmarshalMap(out.Item, &view); err != nil {
+		slog.Error("Receipt decode failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if view.Receipt == "" || out.Item["deleted_at"] != nil {
+		return errorResponse(404, "Receipt not found")
+	}
+	view.SigningAlgorithm = integrity.ReceiptAlgorithm
+	return jsonResponse(view)
+}
+
+func jsonResponse(v interface{}) events.APIGatewayV2HTTPResponse {
+	body, _ := json.Marshal(v)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
+
+// parseWait reads ?wait= as a Go duration or a number of seconds, capped at maxWait
+func parseWait(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, convErr := strconv.Atoi(s)
+		if convErr != nil {
+			return 0, err
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if d < 0 {
+		return 0, strconv.ErrRange
+	}
+	return min(d, maxWait), nil
+}
+
+// waitForLog polls for the log until it is final or the wait budget runs
+// out, then returns the latest state seen. Polling backs off from 200ms to
+// 1s, so a small payload's completion is seen almost immediately while a
+// long wait costs at most about one read per second.
+func waitForLog(ctx context.Context, tenantID, logID string, wait time.Duration) (logView, bool, error) {
+	deadline := time.Now().Add(wait)
+	interval := 200 * time.Millisecond
+	for {
+		view, found, err := getLog(ctx, tenantID, logID)
+		if err != nil || (found && view.final()) || time.Now().Add(interval).After(deadline) {
+			return view, found, err
+		}
+		select {
+		case <-ctx.Done():
+			return view, found, nil
+		case <-time.After(interval):
+		}
+		interval = min(2*interval, time.Second)
+	}
+}
+
+func getLog(ctx context.Context, tenantID, logID string) (logView, bool, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		ProjectionExpression:     aws.String(viewProjection),
+		ExpressionAttributeNames: viewNames,
+	})
+	if err != nil || out.Item == nil {
+		return logView{}, false, err
+	}
+	var view logView
+	if err := attributevalue.UnmarshalMap(out.Item, &view); err != nil {
+		return logView{}, false, err
+	}
+	return view, true, nil
+}
+
+// errorResponse builds the {"error": msg} body used for all failures
+func errorResponse(status int, msg string) events.APIGatewayV2HTTPResponse {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: string(body)}
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
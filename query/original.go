@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"robust-processor/internal/envelope"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+var (
+	// originalReads enables original reads (ORIGINAL_READS=true), which
+	// otherwise answer 501
+	originalReads bool
+	// kmsClient serves original reads and de-tokenization
+	kmsClient *kms.Client
+	// policyTableName holds the tenants' permission flags and pseudonym
+	// generations
+	policyTableName string
+)
+
+// storedOriginal is a record's original as the worker stored it: in the
+// clear, or sealed under the tenant's kms_key_arn
+type storedOriginal struct {
+	OriginalText string `dynamodbav:"original_text"`
+	envelope.Sealed
+	Status    string `dynamodbav:"status"`
+	DeletedAt string `dynamodbav:"deleted_at"`
+}
+
+// originalView is the answer to an original read
+type originalView struct {
+	TenantID     string `json:"tenant_id"`
+	LogID        string `json:"log_id"`
+	OriginalText string `json:"original_text"`
+	// Encrypted reports whether it was decrypted with the tenant's key
+	Encrypted bool `json:"encrypted"`
+}
+
+// originalResponse answers GET /logs/{log_id}/original, the one read that
+// returns a record's text before redaction. It takes three permissions:
+// the deployment's (ORIGINAL_READS, which also grants kms:Decrypt), the
+// tenant's (original_reads: true on its TenantPolicies item) and the
+// caller's API key, as every request checks it; without API keys nothing
+// is read. Every read is logged. An original sealed under a key the tenant
+// revoked, or whose policy doesn't grant this role kms:Decrypt, is 410: for
+// us it no longer exists.
+func originalResponse(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID, logID string) events.APIGatewayV2HTTPResponse {
+	if resp, ok := requireAPIKeys("Original reads"); !ok {
+		return resp
+	}
+	if !originalReads {
+		return errorResponse(501, "Original reads are not enabled")
+	}
+	allowed, err := tenantAllows(ctx, tenantID, "original_reads")
+	if err != nil {
+		slog.Error("Tenant policy lookup failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if !allowed {
+		return errorResponse(403, "Original reads are not enabled for this tenant")
+	}
+
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		ProjectionExpression:     aws.String("original_text, original_ciphertext, original_data_key, original_key_arn, #status, deleted_at"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+	})
+	if err != nil {
+		slog.Error("Original lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	var stored storedOriginal
+	if err := attributevalue.UnmarshalMap(out.Item, &stored); err != nil {
+		slog.Error("Original decode failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if out.Item == nil || stored.DeletedAt != "" {
+		return errorResponse(404, "Log not found")
+	}
+
+	view := originalView{TenantID: tenantID, LogID: logID, OriginalText: stored.OriginalText}
+	switch {
+	case stored.KeyARN != "":
+		view.Encrypted = true
+		view.OriginalText, err = envelope.Open(ctx, kmsClient, stored.Sealed, tenantID, logID)
+		if envelope.KeyUnavailable(err) {
+			slog.Warn("Original key unavailable", "tenant_id", tenantID, "log_id", logID, "error", err)
+			return errorResponse(410, "The tenant's key no longer opens this original")
+		}
+		if err != nil {
+			slog.Error("Original decryption failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+	case stored.Status != "PROCESSED":
+		return errorResponse(404, "Log has no stored original")
+	case out.Item["original_text"] == nil:
+		return errorResponse(404, "Original was not stored")
+	}
+
+	slog.Info("Original read", "tenant_id", tenantID, "log_id", logID, "encrypted", view.Encrypted,
+		"source_ip", request.RequestContext.HTTP.SourceIP)
+	resp := jsonResponse(view)
+	resp.Headers["Cache-Control"] = "no-store"
+	return resp
+}
+
+// tenantAllows reads one of the tenant's permission flags from its
+// TenantPolicies item; flags are read on every request, so revoking one
+// takes effect at once
+func tenantAllows(ctx context.Context, tenantID, flag string) (bool, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(policyTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		ProjectionExpression:     aws.String("#flag"),
+		ExpressionAttributeNames: map[string]string{"#flag": flag},
+	})
+	if err != nil {
+		return false, err
+	}
+	allowed, _ := out.Item[flag].(*types.AttributeValueMemberBOOL)
+	return allowed != nil && allowed.Value, nil
+}
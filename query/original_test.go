@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Without API keys no caller is authenticated, so no original is read
+func TestOriginalRequiresAPIKeys(t *testing.T) {
+	apiKeys = nil
+	originalReads = true
+	t.Cleanup(func() { originalReads = false })
+
+	resp, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{
+		RouteKey:              "GET /logs/{log_id}/original",
+		PathParameters:        map[string]string{"log_id": "l1"},
+		QueryStringParameters: map[string]string{"tenant_id": "acme"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 501 {
+		t.Errorf("original read without an API key: %d %s, want 501", resp.StatusCode, resp.Body)
+	}
+}
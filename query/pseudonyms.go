@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/pseudonym"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxPseudonyms caps the values of one POST /pseudonyms request
+const maxPseudonyms = 100
+
+// pseudonymKey derives the pseudonyms the worker indexes in OpenSearch for a
+// tenant's search_pseudonyms fields; nil unless PSEUDONYM_KEY_CIPHERTEXT is
+// set
+var pseudonymKey []byte
+
+// pseudonyms answers POST /pseudonyms, {"values": [...]}, with the tenant's
+// pseudonym of each value, so a search for a value can be written against
+// the index without the index ever holding it. The handler's API key check
+// matters here: the oracle must only answer for one's own tenant.
+func pseudonyms(ctx context.Context, request events.APIGatewayV2HTTPRequest, tenantID string) events.APIGatewayV2HTTPResponse {
+	if pseudonymKey == nil {
+		return errorResponse(501, "Pseudonyms are not configured")
+	}
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(request.Body); err != nil {
+			return errorResponse(400, "Invalid body encoding")
+		}
+	}
+	var req struct {
+		Values []string `json:"values"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Values) == 0 {
+		return errorResponse(400, `Body must be {"values": [...]}`)
+	}
+	if len(req.Values) > maxPseudonyms {
+		return errorResponse(400, "At most "+strconv.Itoa(maxPseudonyms)+" values per request")
+	}
+	gen, err := currentGeneration(ctx, tenantID)
+	if err != nil {
+		slog.Error("Tenant policy lookup failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	resp := map[string]interface{}{"pseudonyms": tokensAt(tenantID, gen.Generation, req.Values)}
+	// Records indexed before a rotation keep the last generation's
+	// pseudonyms; during the overlap searches can match both
+	if gen.Generation > 0 && time.Now().Before(gen.OverlapUntil) {
+		resp["previous_pseudonyms"] = tokensAt(tenantID, gen.Generation-1, req.Values)
+		resp["previous_until"] = gen.OverlapUntil.UTC().Format(time.RFC3339)
+	}
+	return jsonResponse(resp)
+}
+
+// tokensAt maps each value to its pseudonym of the given generation
+func tokensAt(tenantID string, generation int, values []string) map[string]string {
+	out := make(map[string]string, len(values))
+	for _, v := range values {
+		out[v] = pseudonym.TokenAt(pseudonymKey, tenantID, generation, v)
+	}
+	return out
+}
+
+// pseudonymGeneration is the part of a TenantPolicies item rotation sets
+type pseudonymGeneration struct {
+	Generation   int       `dynamodbav:"pseudonym_generation"`
+	OverlapUntil time.Time `dynamodbav:"pseudonym_overlap_until"`
+}
+
+// currentGeneration reads the tenant's pseudonym generation; tenants never
+// rotated, or without a policy, are at generation 0
+func currentGeneration(ctx context.Context, tenantID string) (pseudonymGeneration, error) {
+	var gen pseudonymGeneration
+	if policyTableName == "" {
+		return gen, nil
+	}
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(policyTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		ProjectionExpression: aws.String("pseudonym_generation, pseudonym_overlap_until"),
+	})
+	if err != nil {
+		return gen, err
+	}
+	err = attributevalue.UnmarshalMap(out.Item, &gen)
+	return gen, err
+}
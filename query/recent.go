@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// recentIndex keys processed logs by tenant and processed_at. It projects
+	// only the public view, so original_text is never copied into it.
+	recentIndex = "recent_index"
+	// maxRecent caps ?limit= on GET /logs/recent, and is its default
+	maxRecent = 100
+)
+
+// recentLogs returns the tenant's most recently processed logs, newest first,
+// from one reverse query of recentIndex. Deleted logs are skipped, which
+// costs an extra page only when a batch of the newest were deleted.
+func recentLogs(ctx context.Context, tenantID, limit string) events.APIGatewayV2HTTPResponse {
+	n := maxRecent
+	if limit != "" {
+		var err error
+		if n, err = strconv.Atoi(limit); err != nil || n < 1 || n > maxRecent {
+			return errorResponse(400, "limit must be between 1 and "+strconv.Itoa(maxRecent))
+		}
+	}
+
+	p := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String(recentIndex),
+		KeyConditionExpression: aws.String("tenant_id = :t"),
+		FilterExpression:       aws.String("attribute_not_exists(deleted_at)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(n)),
+	})
+	logs := []logView{}
+	for p.HasMorePages() && len(logs) < n {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			slog.Error("Recent logs query failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		var page []logView
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			slog.Error("Recent logs decode failed", "tenant_id", tenantID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		logs = append(logs, page...)
+	}
+	return jsonResponse(map[string]interface{}{"logs": logs[:min(len(logs), n)]})
+}
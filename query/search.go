@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"robust-processor/internal/embed"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// maxSearchResults caps ?k= on GET /logs/search; the default is 10
+	maxSearchResults = 50
+	// maxSearchQuery bounds ?q=, which is embedded as a whole
+	maxSearchQuery = 2000
+)
+
+var (
+	// embedder and searchEndpoint serve GET /logs/search; it answers 501
+	// unless both EMBEDDING_* and OPENSEARCH_ENDPOINT are set
+	embedder       *embed.Client
+	searchEndpoint string
+	searchIndex    = "logs"
+	searchHTTP     = &http.Client{Timeout: 10 * time.Second}
+	awsCfg         aws.Config
+)
+
+// searchResult is one hit: the log's public view and its similarity
+type searchResult struct {
+	Score float64 `json:"score"`
+	logView
+}
+
+// searchLogs answers GET /logs/search?q=...&k=N, the tenant's N logs whose
+// redacted text is closest in meaning to q. q is embedded with the model
+// the worker indexes with, and the nearest neighbours are found with a k-NN
+// query of the OpenSearch index restricted to the tenant and, with ?label=,
+// to logs classified with that label. Hits are then read back from
+// DynamoDB, so what is returned is the stored redacted view and deleted
+// logs drop out even while the index still holds them.
+func searchLogs(ctx context.Context, tenantID string, params map[string]string) events.APIGatewayV2HTTPResponse {
+	if embedder == nil || searchEndpoint == "" {
+		return errorResponse(501, "Semantic search is not configured")
+	}
+	q := strings.TrimSpace(params["q"])
+	if q == "" || len(q) > maxSearchQuery {
+		return errorResponse(400, "q must be between 1 and "+strconv.Itoa(maxSearchQuery)+" bytes")
+	}
+	k := 10
+	if s := params["k"]; s != "" {
+		var err error
+		if k, err = strconv.Atoi(s); err != nil || k < 1 || k > maxSearchResults {
+			return errorResponse(400, "k must be between 1 and "+strconv.Itoa(maxSearchResults))
+		}
+	}
+	label, err := parseLabel(params["label"])
+	if err != nil {
+		return errorResponse(400, err.Error())
+	}
+
+	vector, err := embedder.Embed(ctx, q)
+	if err != nil {
+		slog.Error("Query embedding failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(503, "Embedding service unavailable")
+	}
+	hits, err := nearestLogs(ctx, tenantID, label, vector, k)
+	if err != nil {
+		slog.Error("Semantic search failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.logID
+	}
+	views, err := batchGetLogs(ctx, tenantID, ids)
+	if err != nil {
+		slog.Error("Semantic search lookup failed", "tenant_id", tenantID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+
+	results := []searchResult{}
+	for _, hit := range hits {
+		view, ok := views[hit.logID]
+		if ok && view.DeletedAt == "" && (label == "" || slices.Contains(view.Labels, label)) {
+			results = append(results, searchResult{Score: hit.score, logView: view})
+		}
+	}
+	return jsonResponse(map[string]interface{}{"results": results})
+}
+
+type searchHit struct {
+	logID string
+	score float64
+}
+
+// nearestLogs runs the k-NN query, best first. The tenant and label filters
+// are applied during the search rather than after it, so k hits come back
+// whenever the tenant has k embedded logs with the label.
+func nearestLogs(ctx context.Context, tenantID, label string, vector []float32, k int) ([]searchHit, error) {
+	filters := []interface{}{map[string]interface{}{"term": map[string]string{"tenant_id": tenantID}}}
+	if label != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]string{"labels": label}})
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"size":    k,
+		"_source": []string{"log_id"},
+		"query": map[string]interface{}{
+			"knn": map[string]interface{}{
+				"embedding": map[string]interface{}{
+					"vector": vector,
+					"k":      k,
+					"filter": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+				},
+			},
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, searchEndpoint+"/"+searchIndex+"/_search", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	service := "es"
+	if strings.Contains(searchEndpoint, ".aoss.") {
+		service = "aoss"
+	}
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), service, awsCfg.Region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := searchHTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("opensearch search: status %d", resp.StatusCode)
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Score  float64 `json:"_score"`
+				Source struct {
+					LogID string `json:"log_id"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	hits := make([]searchHit, 0, len(result.Hits.Hits))
+	for _, h := range result.Hits.Hits {
+		if h.Source.LogID != "" {
+			hits = append(hits, searchHit{logID: h.Source.LogID, score: h.Score})
+		}
+	}
+	return hits, nil
+}
+
+// batchGetLogs reads the views of up to 100 logs, keyed by log_id; logs no
+// longer in the table are absent
+func batchGetLogs(ctx context.Context, tenantID string, logIDs []string) (map[string]logView, error) {
+	views := make(map[string]logView, len(logIDs))
+	if len(logIDs) == 0 {
+		return views, nil
+	}
+	keys := make([]map[string]types.AttributeValue, 0, len(logIDs))
+	seen := map[string]bool{}
+	for _, id := range logIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		keys = append(keys, map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: id},
+		})
+	}
+	request := map[string]types.KeysAndAttributes{tableName: {
+		Keys:                     keys,
+		ProjectionExpression:     aws.String(viewProjection),
+		ExpressionAttributeNames: viewNames,
+	}}
+	// Unprocessed keys are retried a few times with a short backoff; one
+	// call nearly always does
+	for attempt := 0; len(request) > 0; attempt++ {
+		if attempt == 4 {
+			return nil, fmt.Errorf("batch get: keys still unprocessed after %d attempts", attempt)
+		}
+		if attempt > 0 {
+			time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+		}
+		out, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+		if err != nil {
+			return nil, err
+		}
+		var page []logView
+		if err := attributevalue.UnmarshalListOfMaps(out.Responses[tableName], &page); err != nil {
+			return nil, err
+		}
+		for _, view := range page {
+			views[view.LogID] = view
+		}
+		request = out.UnprocessedKeys
+	}
+	return views, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	"robust-processor/internal/simhash"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// maxSimilar caps ?limit= on GET /logs/{log_id}/similar; the default is 50
+	maxSimilar = 100
+	// bandScanLimit bounds how many index entries are read per band. A log
+	// storm can put far more in one band; the count is then a lower bound.
+	bandScanLimit = 1000
+)
+
+// nearDuplicateTableName is the worker's fingerprint band index
+var nearDuplicateTableName string
+
+// similarResult is one near-duplicate: its public view and how many
+// fingerprint bits it differs in
+type similarResult struct {
+	Distance int `json:"distance"`
+	logView
+}
+
+// similarLogs answers GET /logs/{log_id}/similar, the tenant's records whose
+// redacted text is a near-duplicate of the log's: fingerprints at most
+// ?max_distance= bits apart (default and maximum simhash.MaxDistance),
+// closest first. The log's band keys are looked up in the band index, which
+// finds every such record the worker indexed, and matches are read back so
+// deleted ones drop out. near_duplicates counts all matches found, which is
+// the size of the log's cluster, while similar holds at most ?limit=.
+func similarLogs(ctx context.Context, tenantID, logID string, params map[string]string) events.APIGatewayV2HTTPResponse {
+	if nearDuplicateTableName == "" {
+		return errorResponse(501, "Near-duplicate detection is not configured")
+	}
+	maxDistance := simhash.MaxDistance
+	if s := params["max_distance"]; s != "" {
+		var err error
+		if maxDistance, err = strconv.Atoi(s); err != nil || maxDistance < 0 || maxDistance > simhash.MaxDistance {
+			return errorResponse(400, "max_distance must be between 0 and "+strconv.Itoa(simhash.MaxDistance))
+		}
+	}
+	limit := 50
+	if s := params["limit"]; s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxSimilar {
+			return errorResponse(400, "limit must be between 1 and "+strconv.Itoa(maxSimilar))
+		}
+	}
+
+	view, found, err := getLog(ctx, tenantID, logID)
+	if err != nil {
+		slog.Error("Status lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if !found || view.DeletedAt != "" {
+		return errorResponse(404, "Log not found")
+	}
+	fp, err := simhash.Parse(view.Fingerprint)
+	if err != nil {
+		return errorResponse(404, "Log has no fingerprint")
+	}
+
+	distances := map[string]int{}
+	truncated := false
+	for _, band := range simhash.BandKeys(tenantID, fp) {
+		out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(nearDuplicateTableName),
+			KeyConditionExpression: aws.String("band = :b"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":b": &types.AttributeValueMemberS{Value: band},
+			},
+			ProjectionExpression: aws.String("log_id, simhash"),
+			Limit:                aws.Int32(bandScanLimit),
+		})
+		if err != nil {
+			slog.Error("Near-duplicate lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		truncated = truncated || out.LastEvaluatedKey != nil
+		for _, item := range out.Items {
+			id, _ := item["log_id"].(*types.AttributeValueMemberS)
+			other, _ := item["simhash"].(*types.AttributeValueMemberS)
+			if id == nil || other == nil || id.Value == logID {
+				continue
+			}
+			if ofp, err := simhash.Parse(other.Value); err == nil {
+				if d := simhash.Distance(fp, ofp); d <= maxDistance {
+					distances[id.Value] = d
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(distances))
+	for id := range distances {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return cmp.Or(cmp.Compare(distances[a], distances[b]), cmp.Compare(a, b))
+	})
+	ids = ids[:min(len(ids), limit)]
+	views, err := batchGetLogs(ctx, tenantID, ids)
+	if err != nil {
+		slog.Error("Near-duplicate read failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	similar := []similarResult{}
+	for _, id := range ids {
+		if v, ok := views[id]; ok && v.DeletedAt == "" {
+			similar = append(similar, similarResult{Distance: distances[id], logView: v})
+		}
+	}
+	return jsonResponse(map[string]interface{}{
+		"log_id":          logID,
+		"simhash":         view.Fingerprint,
+		"near_duplicates": len(distances),
+		"truncated":       truncated,
+		"similar":         similar,
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+
+	"robust-processor/internal/failure"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// parentIndex keys sub-documents by the record they were submitted with
+const parentIndex = "parent_index"
+
+// threadResponse answers GET /logs/{log_id}/thread, a record submitted with
+// parts and its parts, {"log": view, "parts": [view, ...]}, all in the
+// redacted view. Parts are read with one query of parentIndex, projected to
+// the view so original_text is never read, and listed in the order they
+// were submitted in; parts still QUEUED are listed with their status.
+// parent_id is only a log_id, so parts are also matched on the tenant.
+// Deleted parts are left out, and a deleted record reads as absent.
+func threadResponse(ctx context.Context, tenantID, logID string) events.APIGatewayV2HTTPResponse {
+	view, found, err := getLog(ctx, tenantID, logID)
+	if err != nil {
+		slog.Error("Thread lookup failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+		return errorResponse(500, "Internal server error")
+	}
+	if !found || view.DeletedAt != "" {
+		return errorResponse(404, "Log not found")
+	}
+
+	p := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+		TableName:                aws.String(tableName),
+		IndexName:                aws.String(parentIndex),
+		KeyConditionExpression:   aws.String("parent_id = :p"),
+		FilterExpression:         aws.String("tenant_id = :t AND attribute_not_exists(deleted_at)"),
+		ProjectionExpression:     aws.String(viewProjection),
+		ExpressionAttributeNames: viewNames,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":p": &types.AttributeValueMemberS{Value: logID},
+			":t": &types.AttributeValueMemberS{Value: tenantID},
+		},
+	})
+	parts := []logView{}
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			slog.Error("Thread parts query failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		var page []logView
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			slog.Error("Thread parts decode failed", "tenant_id", tenantID, "log_id", logID, "error", err)
+			return errorResponse(500, "Internal server error")
+		}
+		parts = append(parts, page...)
+	}
+	// The index orders parts by log_id; parts stored before their position
+	// was recorded have none and follow the rest in log_id order
+	position := func(v logView) int {
+		if v.Part == 0 {
+			return math.MaxInt
+		}
+		return v.Part
+	}
+	slices.SortStableFunc(parts, func(a, b logView) int { return cmp.Compare(position(a), position(b)) })
+
+	if view.FailureCode != "" {
+		view.FailureMessage = failure.Message(failure.Code(view.FailureCode))
+	}
+	for i := range parts {
+		if parts[i].FailureCode != "" {
+			parts[i].FailureMessage = failure.Message(failure.Code(parts[i].FailureCode))
+		}
+	}
+	return jsonResponse(map[string]interface{}{"log": view, "parts": parts})
+}
@@ -0,0 +1,173 @@
+// Reconcile finds accepted records the worker never processed. Ingest writes
+// a QUEUED stub for every record it publishes and the worker's result
+// replaces it, so a stub still present past the SLA window means the message
+// was dropped, is stuck in retries or went to the DLQ. Stubs carry no
+// content, so they cannot be re-enqueued from here; overdue records are
+// reported in the RecordsOverdue metric, which alarms, and in the response.
+// It runs on a schedule, or on demand with {"sla": "30m", "lookback": "24h"}.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"robust-processor/internal/logscrub"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const metricNamespace = "RobustProcessor"
+
+// maxSamples bounds the overdue records listed in a report
+const maxSamples = 20
+
+// queuedIndex holds only QUEUED stubs, keyed by the UTC hour they were
+// accepted in; the worker's full-item write drops a record out of it
+const (
+	queuedIndex      = "queued_index"
+	queuedHourLayout = "2006-01-02T15"
+)
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+	sla          = 15 * time.Minute
+	lookback     = 6 * time.Hour
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("TABLE_NAME")
+	if d, err := time.ParseDuration(os.Getenv("RECONCILE_SLA")); err == nil {
+		sla = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("RECONCILE_LOOKBACK")); err == nil {
+		lookback = d
+	}
+}
+
+// stub is the part of a QUEUED stub the report needs
+type stub struct {
+	TenantID string `dynamodbav:"tenant_id" json:"tenant_id"`
+	LogID    string `dynamodbav:"log_id" json:"log_id"`
+	Source   string `dynamodbav:"source" json:"source"`
+	QueuedAt string `dynamodbav:"queued_at" json:"queued_at"`
+}
+
+type reconcileRequest struct {
+	SLA      string `json:"sla"`
+	Lookback string `json:"lookback"`
+}
+
+type report struct {
+	Since    string         `json:"since"`
+	Before   string         `json:"before"`
+	Overdue  int            `json:"overdue"`
+	ByTenant map[string]int `json:"by_tenant,omitempty"`
+	Samples  []stub         `json:"samples,omitempty"`
+}
+
+func handler(ctx context.Context, payload json.RawMessage) (report, error) {
+	var req reconcileRequest
+	_ = json.Unmarshal(payload, &req) // scheduled events carry neither
+	window, age := lookback, sla
+	if d, err := time.ParseDuration(req.Lookback); err == nil {
+		window = d
+	}
+	if d, err := time.ParseDuration(req.SLA); err == nil {
+		age = d
+	}
+
+	now := time.Now().UTC()
+	since, before := now.Add(-window), now.Add(-age)
+	rep := report{Since: since.Format(time.RFC3339), Before: before.Format(time.RFC3339), ByTenant: map[string]int{}}
+	for hour := since.Truncate(time.Hour); !hour.After(before); hour = hour.Add(time.Hour) {
+		stubs, err := queryOverdue(ctx, hour.Format(queuedHourLayout), rep.Since, rep.Before)
+		if err != nil {
+			return report{}, err
+		}
+		for _, s := range stubs {
+			rep.Overdue++
+			rep.ByTenant[s.TenantID]++
+			if len(rep.Samples) < maxSamples {
+				rep.Samples = append(rep.Samples, s)
+			}
+		}
+	}
+
+	for tenant, n := range rep.ByTenant {
+		emitMetric("RecordsOverdue", float64(n), "Count", map[string]string{"tenant_id": tenant})
+	}
+	emitMetric("RecordsOverdue", float64(rep.Overdue), "Count", nil)
+	if rep.Overdue > 0 {
+		slog.Warn("Records overdue", "since", rep.Since, "before", rep.Before, "overdue", rep.Overdue, "by_tenant", rep.ByTenant)
+	} else {
+		slog.Info("Reconciliation complete", "since", rep.Since, "before", rep.Before)
+	}
+	return rep, nil
+}
+
+// queryOverdue returns the stubs of one hour bucket queued between since and before
+func queryOverdue(ctx context.Context, hour, since, before string) ([]stub, error) {
+	var stubs []stub
+	paginator := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String(queuedIndex),
+		KeyConditionExpression: aws.String("queued_hour = :hour AND queued_at BETWEEN :since AND :before"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hour":   &types.AttributeValueMemberS{Value: hour},
+			":since":  &types.AttributeValueMemberS{Value: since},
+			":before": &types.AttributeValueMemberS{Value: before},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("query queued stubs for %s: %w", hour, err)
+		}
+		var items []stub
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("decode queued stubs: %w", err)
+		}
+		stubs = append(stubs, items...)
+	}
+	return stubs, nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
@@ -0,0 +1,313 @@
+// Redrive re-enqueues quarantined messages on the ingest queue, so operators
+// can recover from a transient outage without hand-crafting SQS messages.
+// The quarantine consumer drains the DLQ as messages arrive, so the
+// quarantine table holds every dead-lettered message. It is invoked with
+//
+//	{"tenant_id": "acme_corp", "from": "2025-01-31T00:00:00Z",
+//	 "to": "2025-02-01T00:00:00Z", "reason": "retries_exhausted",
+//	 "limit": 100, "dry_run": true}
+//
+// Every field is optional. Without a reason only retries_exhausted messages
+// are sent: invalid_json and contract_violation would fail again as they are.
+// Each redriven message's record goes back to QUEUED and its quarantine entry
+// is deleted; if it fails again it is quarantined anew. Messages are signed
+// afresh, so invalid_signature messages are only sent when asked for by
+// reason, after their content has been vetted.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"robust-processor/internal/logscrub"
+	"robust-processor/internal/pipelinekey"
+	"robust-processor/pkg/model"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const metricNamespace = "RobustProcessor"
+
+const (
+	defaultReason = "retries_exhausted"
+	defaultLimit  = 500
+	// maxListed bounds the message IDs listed in a response
+	maxListed = 50
+	// queuedTTL matches ingest's stubs
+	queuedTTL        = 15 * 24 * time.Hour
+	queuedHourLayout = "2006-01-02T15"
+)
+
+var (
+	dynamoClient        *dynamodb.Client
+	sqsClient           *sqs.Client
+	tableName           string
+	quarantineTableName string
+	queueURL            string
+	// pipelineKey signs redriven messages; nil when signing is off
+	pipelineKey []byte
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	sqsClient = sqs.NewFromConfig(cfg)
+	tableName = os.Getenv("TABLE_NAME")
+	quarantineTableName = os.Getenv("QUARANTINE_TABLE_NAME")
+	queueURL = os.Getenv("QUEUE_URL")
+	if pipelineKey, err = pipelinekey.FromEnv(context.TODO(), cfg); err != nil {
+		panic("configuration error: " + err.Error())
+	}
+}
+
+type redriveRequest struct {
+	TenantID string `json:"tenant_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Reason   string `json:"reason"`
+	Limit    int    `json:"limit"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+// quarantined is the part of a quarantine entry needed to resend it
+type quarantined struct {
+	TenantID      string            `dynamodbav:"tenant_id"`
+	MessageID     string            `dynamodbav:"message_id"`
+	LogID         string            `dynamodbav:"log_id"`
+	Body          string            `dynamodbav:"body"`
+	Attributes    map[string]string `dynamodbav:"attributes"`
+	QuarantinedAt string            `dynamodbav:"quarantined_at"`
+}
+
+type redriveResponse struct {
+	Matched    int      `json:"matched"`
+	Redriven   int      `json:"redriven"`
+	Failed     int      `json:"failed"`
+	DryRun     bool     `json:"dry_run,omitempty"`
+	MessageIDs []string `json:"message_ids,omitempty"`
+}
+
+func handler(ctx context.Context, req redriveRequest) (redriveResponse, error) {
+	if req.Reason == "" {
+		req.Reason = defaultReason
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultLimit
+	}
+	for _, t := range []string{req.From, req.To} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			return redriveResponse{}, fmt.Errorf("from and to must be RFC 3339 times: %w", err)
+		}
+	}
+
+	entries, err := findQuarantined(ctx, req)
+	if err != nil {
+		return redriveResponse{}, err
+	}
+
+	resp := redriveResponse{Matched: len(entries), DryRun: req.DryRun}
+	for _, e := range entries {
+		if len(resp.MessageIDs) < maxListed {
+			resp.MessageIDs = append(resp.MessageIDs, e.MessageID)
+		}
+		if req.DryRun {
+			continue
+		}
+		if err := redrive(ctx, e); err != nil {
+			slog.Error("Failed to redrive message", "message_id", e.MessageID, "tenant_id", e.TenantID, "error", err)
+			resp.Failed++
+			continue
+		}
+		resp.Redriven++
+	}
+	emitMetric("MessagesRedriven", float64(resp.Redriven), "Count", nil)
+	slog.Info("Redrive complete", "tenant_id", req.TenantID, "reason", req.Reason,
+		"matched", resp.Matched, "redriven", resp.Redriven, "failed", resp.Failed, "dry_run", req.DryRun)
+	return resp, nil
+}
+
+// findQuarantined lists up to req.Limit entries matching the request: a
+// query of the tenant's partition when one is named, else a scan
+func findQuarantined(ctx context.Context, req redriveRequest) ([]quarantined, error) {
+	filter := "reason = :reason"
+	values := map[string]types.AttributeValue{":reason": &types.AttributeValueMemberS{Value: req.Reason}}
+	if req.From != "" {
+		filter += " AND quarantined_at >= :from"
+		values[":from"] = &types.AttributeValueMemberS{Value: req.From}
+	}
+	if req.To != "" {
+		filter += " AND quarantined_at < :to"
+		values[":to"] = &types.AttributeValueMemberS{Value: req.To}
+	}
+
+	var more func() bool
+	var next func(context.Context) ([]map[string]types.AttributeValue, error)
+	if req.TenantID != "" {
+		values[":t"] = &types.AttributeValueMemberS{Value: req.TenantID}
+		p := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+			TableName:                 aws.String(quarantineTableName),
+			KeyConditionExpression:    aws.String("tenant_id = :t"),
+			FilterExpression:          aws.String(filter),
+			ExpressionAttributeValues: values,
+		})
+		more = p.HasMorePages
+		next = func(ctx context.Context) ([]map[string]types.AttributeValue, error) {
+			out, err := p.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return out.Items, nil
+		}
+	} else {
+		p := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{
+			TableName:                 aws.String(quarantineTableName),
+			FilterExpression:          aws.String(filter),
+			ExpressionAttributeValues: values,
+		})
+		more = p.HasMorePages
+		next = func(ctx context.Context) ([]map[string]types.AttributeValue, error) {
+			out, err := p.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return out.Items, nil
+		}
+	}
+
+	var entries []quarantined
+	for more() && len(entries) < req.Limit {
+		items, err := next(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read quarantine table: %w", err)
+		}
+		var page []quarantined
+		if err := attributevalue.UnmarshalListOfMaps(items, &page); err != nil {
+			return nil, fmt.Errorf("decode quarantine entries: %w", err)
+		}
+		entries = append(entries, page...)
+	}
+	return entries[:min(len(entries), req.Limit)], nil
+}
+
+// redrive requeues one message: its FAILED record becomes a QUEUED stub
+// again, since the worker never overwrites a finished record, then the
+// message is sent and its quarantine entry deleted. A failure before the
+// send leaves the entry for the next redrive.
+func redrive(ctx context.Context, e quarantined) error {
+	if e.LogID != "" {
+		if err := requeueRecord(ctx, e.TenantID, e.LogID); err != nil {
+			return err
+		}
+	}
+
+	if pipelineKey != nil {
+		if e.Attributes == nil {
+			e.Attributes = map[string]string{}
+		}
+		e.Attributes[model.SignatureAttribute] = model.Sign(pipelineKey, e.Body, model.CostTagsFrom(e.Attributes))
+	}
+	attrs := make(map[string]sqstypes.MessageAttributeValue, len(e.Attributes))
+	for name, v := range e.Attributes {
+		attrs[name] = sqstypes.MessageAttributeValue{DataType: aws.String(model.AttributeType(name)), StringValue: aws.String(v)}
+	}
+	// The quarantined message id deduplicates a FIFO send: the log_id's
+	// first delivery may still be inside SQS's deduplication window
+	group, dedup := model.FIFOParams(queueURL, e.TenantID, e.MessageID)
+	_, err := sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               aws.String(queueURL),
+		MessageBody:            aws.String(e.Body),
+		MessageAttributes:      attrs,
+		MessageGroupId:         group,
+		MessageDeduplicationId: dedup,
+	})
+	if err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	// Left behind, the entry would only be redriven again, which the worker
+	// suppresses as a duplicate once the record is processed
+	_, err = dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(quarantineTableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id":  &types.AttributeValueMemberS{Value: e.TenantID},
+			"message_id": &types.AttributeValueMemberS{Value: e.MessageID},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to delete redriven quarantine entry", "message_id", e.MessageID, "error", err)
+	}
+	return nil
+}
+
+// requeueRecord turns a FAILED record back into a QUEUED stub, so the status
+// API and reconciliation track it again. Records in any other state are
+// left as they are.
+func requeueRecord(ctx context.Context, tenantID, logID string) error {
+	now := time.Now().UTC()
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: logID},
+		},
+		UpdateExpression:         aws.String("SET #status = :queued, queued_at = :at, queued_hour = :hour, expires_at = :exp REMOVE failed_at, failure_code, last_failure"),
+		ConditionExpression:      aws.String("#status = :failed"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":queued": &types.AttributeValueMemberS{Value: "QUEUED"},
+			":failed": &types.AttributeValueMemberS{Value: "FAILED"},
+			":at":     &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+			":hour":   &types.AttributeValueMemberS{Value: now.Format(queuedHourLayout)},
+			":exp":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(queuedTTL).Unix(), 10)},
+		},
+	})
+	var conditional *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditional) {
+		return fmt.Errorf("requeue record: %w", err)
+	}
+	return nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
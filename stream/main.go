@@ -0,0 +1,190 @@
+// Stream serves live processing completions per tenant as server-sent events.
+// One binary has two roles: EventBridge delivers the worker's "Log Processed"
+// events, which are appended to a short-lived per-tenant feed table, and a
+// streaming Function URL tails that feed for connected clients:
+//
+//	curl -N "$STREAM_URL?tenant_id=acme_corp"
+//
+// Each connection lasts up to STREAM_DURATION; EventSource clients reconnect
+// with Last-Event-ID and resume where they left off.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"robust-processor/internal/logscrub"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// feedRetention is how long completions stay available for resuming
+	feedRetention = time.Hour
+	pollInterval  = time.Second
+	heartbeat     = 15 * time.Second
+)
+
+var (
+	dynamoClient   *dynamodb.Client
+	feedTableName  string
+	streamDuration = 5 * time.Minute
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	feedTableName = os.Getenv("FEED_TABLE_NAME")
+	if d, err := time.ParseDuration(os.Getenv("STREAM_DURATION")); err == nil {
+		streamDuration = d
+	}
+}
+
+// invocation tells the two payload shapes apart
+type invocation struct {
+	DetailType     string          `json:"detail-type"`
+	Detail         json.RawMessage `json:"detail"`
+	RequestContext json.RawMessage `json:"requestContext"`
+}
+
+// completion holds the fields of the worker's event detail used here
+type completion struct {
+	TenantID string `json:"tenant_id"`
+	LogID    string `json:"log_id"`
+}
+
+func handler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var inv invocation
+	if err := json.Unmarshal(payload, &inv); err != nil {
+		return nil, err
+	}
+	if inv.DetailType != "" {
+		return nil, record(ctx, inv.Detail)
+	}
+
+	var request events.LambdaFunctionURLRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, err
+	}
+	return serve(request), nil
+}
+
+// record appends a completion to its tenant's feed. The sort key is the
+// arrival time, so a reader resuming from an id never misses late events.
+func record(ctx context.Context, detail json.RawMessage) error {
+	var c completion
+	if err := json.Unmarshal(detail, &c); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(feedTableName),
+		Item: map[string]types.AttributeValue{
+			"tenant_id":  &types.AttributeValueMemberS{Value: c.TenantID},
+			"seq":        &types.AttributeValueMemberS{Value: now.Format(time.RFC3339Nano) + "#" + c.LogID},
+			"detail":     &types.AttributeValueMemberS{Value: string(detail)},
+			"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(feedRetention).Unix(), 10)},
+		},
+	})
+	return err
+}
+
+// serve starts an SSE response that tails the tenant's feed
+func serve(request events.LambdaFunctionURLRequest) *events.LambdaFunctionURLStreamingResponse {
+	tenantID := request.QueryStringParameters["tenant_id"]
+	if tenantID == "" {
+		return &events.LambdaFunctionURLStreamingResponse{
+			StatusCode: 400,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       strings.NewReader(`{"error":"Missing tenant_id"}`),
+		}
+	}
+	// Without Last-Event-ID the stream starts with events arriving from now on
+	cursor := request.Headers["last-event-id"]
+	if cursor == "" {
+		cursor = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), streamDuration)
+		defer cancel()
+		w.CloseWithError(tail(ctx, w, tenantID, cursor))
+	}()
+	return &events.LambdaFunctionURLStreamingResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":  "text/event-stream",
+			"Cache-Control": "no-cache",
+		},
+		Body: r,
+	}
+}
+
+// tail writes feed entries after cursor as they arrive, with a heartbeat
+// comment when idle so proxies keep the connection open
+func tail(ctx context.Context, w io.Writer, tenantID, cursor string) error {
+	fmt.Fprintf(w, "retry: %d\n\n", pollInterval.Milliseconds())
+	lastWrite := time.Now()
+	for {
+		out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(feedTableName),
+			KeyConditionExpression: aws.String("tenant_id = :t AND seq > :c"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":t": &types.AttributeValueMemberS{Value: tenantID},
+				":c": &types.AttributeValueMemberS{Value: cursor},
+			},
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			slog.Error("Feed read failed", "tenant_id", tenantID, "error", err)
+			return err
+		}
+		for _, item := range out.Items {
+			seq, _ := item["seq"].(*types.AttributeValueMemberS)
+			detail, _ := item["detail"].(*types.AttributeValueMemberS)
+			if seq == nil || detail == nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: completion\ndata: %s\n\n", seq.Value, detail.Value); err != nil {
+				return nil // client went away
+			}
+			cursor = seq.Value
+			lastWrite = time.Now()
+		}
+		if time.Since(lastWrite) >= heartbeat {
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			lastWrite = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}
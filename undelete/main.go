@@ -0,0 +1,238 @@
+// Undelete restores soft-deleted logs within their recovery window, so a
+// mistaken delete, one log or a whole script's worth, can be taken back
+// before the table's TTL purges it. It is invoked with
+//
+//	{"tenant_id": "acme_corp", "log_ids": ["..."],
+//	 "deleted_from": "2025-01-31T00:00:00Z", "deleted_to": "2025-02-01T00:00:00Z",
+//	 "limit": 1000, "dry_run": true}
+//
+// tenant_id is required. With log_ids only those logs are restored;
+// otherwise every log of the tenant deleted within the range (all of them
+// without one). A restored log is readable again and gets back the expiry
+// it had before it was deleted, or none.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"robust-processor/internal/logscrub"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const metricNamespace = "RobustProcessor"
+
+const (
+	defaultLimit = 1000
+	// maxListed bounds the log IDs listed in a response
+	maxListed = 50
+)
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error: " + err.Error())
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	tableName = os.Getenv("TABLE_NAME")
+}
+
+type undeleteRequest struct {
+	TenantID    string   `json:"tenant_id"`
+	LogIDs      []string `json:"log_ids"`
+	DeletedFrom string   `json:"deleted_from"`
+	DeletedTo   string   `json:"deleted_to"`
+	Limit       int      `json:"limit"`
+	DryRun      bool     `json:"dry_run"`
+}
+
+// deleted is the part of a soft-deleted log needed to restore it
+type deleted struct {
+	LogID            string `dynamodbav:"log_id"`
+	DeletedAt        string `dynamodbav:"deleted_at"`
+	RestoreExpiresAt *int64 `dynamodbav:"restore_expires_at"`
+}
+
+type undeleteResponse struct {
+	Matched  int      `json:"matched"`
+	Restored int      `json:"restored"`
+	Failed   int      `json:"failed"`
+	DryRun   bool     `json:"dry_run,omitempty"`
+	LogIDs   []string `json:"log_ids,omitempty"`
+}
+
+func handler(ctx context.Context, req undeleteRequest) (undeleteResponse, error) {
+	if req.TenantID == "" {
+		return undeleteResponse{}, errors.New("tenant_id is required")
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultLimit
+	}
+	for _, t := range []string{req.DeletedFrom, req.DeletedTo} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			return undeleteResponse{}, fmt.Errorf("deleted_from and deleted_to must be RFC 3339 times: %w", err)
+		}
+	}
+
+	var logs []deleted
+	var err error
+	if len(req.LogIDs) > 0 {
+		logs, err = getDeleted(ctx, req.TenantID, req.LogIDs)
+	} else {
+		logs, err = findDeleted(ctx, req)
+	}
+	if err != nil {
+		return undeleteResponse{}, err
+	}
+
+	resp := undeleteResponse{Matched: len(logs), DryRun: req.DryRun}
+	for _, l := range logs {
+		if len(resp.LogIDs) < maxListed {
+			resp.LogIDs = append(resp.LogIDs, l.LogID)
+		}
+		if req.DryRun {
+			continue
+		}
+		if err := restore(ctx, req.TenantID, l); err != nil {
+			slog.Error("Failed to undelete log", "tenant_id", req.TenantID, "log_id", l.LogID, "error", err)
+			resp.Failed++
+			continue
+		}
+		resp.Restored++
+	}
+	emitMetric("LogsUndeleted", float64(resp.Restored), "Count", nil)
+	slog.Info("Undelete complete", "tenant_id", req.TenantID,
+		"matched", resp.Matched, "restored", resp.Restored, "failed", resp.Failed, "dry_run", req.DryRun)
+	return resp, nil
+}
+
+// getDeleted reads the named logs, keeping those that are deleted
+func getDeleted(ctx context.Context, tenantID string, logIDs []string) ([]deleted, error) {
+	var logs []deleted
+	for _, id := range logIDs {
+		out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(tableName),
+			Key: map[string]types.AttributeValue{
+				"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+				"log_id":    &types.AttributeValueMemberS{Value: id},
+			},
+			ProjectionExpression: aws.String("log_id, deleted_at, restore_expires_at"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read log %s: %w", id, err)
+		}
+		if out.Item == nil || out.Item["deleted_at"] == nil {
+			continue
+		}
+		var l deleted
+		if err := attributevalue.UnmarshalMap(out.Item, &l); err != nil {
+			return nil, fmt.Errorf("decode log %s: %w", id, err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
+
+// findDeleted lists up to req.Limit of the tenant's logs deleted in range
+func findDeleted(ctx context.Context, req undeleteRequest) ([]deleted, error) {
+	filter := "attribute_exists(deleted_at)"
+	values := map[string]types.AttributeValue{":t": &types.AttributeValueMemberS{Value: req.TenantID}}
+	if req.DeletedFrom != "" {
+		filter += " AND deleted_at >= :from"
+		values[":from"] = &types.AttributeValueMemberS{Value: req.DeletedFrom}
+	}
+	if req.DeletedTo != "" {
+		filter += " AND deleted_at < :to"
+		values[":to"] = &types.AttributeValueMemberS{Value: req.DeletedTo}
+	}
+	p := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		KeyConditionExpression:    aws.String("tenant_id = :t"),
+		FilterExpression:          aws.String(filter),
+		ProjectionExpression:      aws.String("log_id, deleted_at, restore_expires_at"),
+		ExpressionAttributeValues: values,
+	})
+
+	var logs []deleted
+	for p.HasMorePages() && len(logs) < req.Limit {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read logs table: %w", err)
+		}
+		var page []deleted
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("decode deleted logs: %w", err)
+		}
+		logs = append(logs, page...)
+	}
+	return logs[:min(len(logs), req.Limit)], nil
+}
+
+// restore clears a log's deletion and puts back the expiry it had. The
+// condition on deleted_at keeps a log deleted again meanwhile deleted.
+func restore(ctx context.Context, tenantID string, l deleted) error {
+	update := "REMOVE deleted_at, expires_at, restore_expires_at"
+	values := map[string]types.AttributeValue{":at": &types.AttributeValueMemberS{Value: l.DeletedAt}}
+	if l.RestoreExpiresAt != nil {
+		update = "SET expires_at = :prior REMOVE deleted_at, restore_expires_at"
+		values[":prior"] = &types.AttributeValueMemberN{Value: fmt.Sprint(*l.RestoreExpiresAt)}
+	}
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"tenant_id": &types.AttributeValueMemberS{Value: tenantID},
+			"log_id":    &types.AttributeValueMemberS{Value: l.LogID},
+		},
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("deleted_at = :at"),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("restore log: %w", err)
+	}
+	return nil
+}
+
+// emitMetric writes a CloudWatch Embedded Metric Format record to stdout
+func emitMetric(name string, value float64, unit string, dims map[string]string) {
+	dimNames := make([]string, 0, len(dims))
+	record := map[string]interface{}{name: value}
+	for k, v := range dims {
+		dimNames = append(dimNames, k)
+		record[k] = v
+	}
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{dimNames},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": unit}},
+		}},
+	}
+	line, _ := json.Marshal(record)
+	fmt.Println(string(line))
+}
+
+func main() {
+	logscrub.Install()
+	lambda.Start(handler)
+}